@@ -1,14 +1,15 @@
 module github.com/cep21/cfmanage
 
 require (
-	github.com/aws/aws-sdk-go v1.20.14
+	github.com/aws/aws-sdk-go v1.29.16
 	github.com/google/go-github/v25 v25.1.3
 	github.com/mattn/go-runewidth v0.0.4 // indirect
 	github.com/olekukonko/tablewriter v0.0.1
-	github.com/pkg/errors v0.8.1
+	github.com/pkg/errors v0.9.1
 	github.com/spf13/cobra v0.0.5
-	github.com/stretchr/testify v1.3.0 // indirect
-	golang.org/x/net v0.0.0-20190628185345-da137c7871d7 // indirect
+	github.com/stretchr/testify v1.4.0 // indirect
+	golang.org/x/net v0.0.0-20200202094626-16171245cfb2 // indirect
 	golang.org/x/sync v0.0.0-20190423024810-112230192c58
 	golang.org/x/text v0.3.2 // indirect
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -15,8 +15,11 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/cep21/cfmanage/internal/cleanup"
 	"github.com/cep21/cfmanage/internal/logger"
@@ -27,6 +30,7 @@ import (
 type cacheKey struct {
 	region  string
 	profile string
+	role    string
 }
 
 type AWSCache struct {
@@ -37,9 +41,16 @@ type AWSCache struct {
 }
 
 func (a *AWSCache) Session(profile string, region string) (*AWSClients, error) {
+	return a.SessionAs(profile, region, "")
+}
+
+// SessionAs is Session acting as the IAM role roleARN, assumed with the credentials of profile.  An empty roleARN
+// uses the credentials of profile directly.
+func (a *AWSCache) SessionAs(profile string, region string, roleARN string) (*AWSClients, error) {
 	itemKey := cacheKey{
 		region:  region,
 		profile: profile,
+		role:    roleARN,
 	}
 	a.mu.Lock()
 	defer a.mu.Unlock()
@@ -57,11 +68,19 @@ func (a *AWSCache) Session(profile string, region string) (*AWSClients, error) {
 	if err != nil {
 		return nil, errors.Wrapf(err, "unable to make session for profile %s", profile)
 	}
+	if roleARN != "" {
+		ses = ses.Copy(&aws.Config{
+			Credentials: stscreds.NewCredentials(ses, roleARN),
+		})
+	}
 	if a.sessionCache == nil {
 		a.sessionCache = make(map[cacheKey]*AWSClients)
 	}
 	a.sessionCache[itemKey] = &AWSClients{
 		session:      ses,
+		profile:      profile,
+		region:       region,
+		role:         roleARN,
 		cleanup:      a.Cleanup,
 		pollInterval: a.PollInterval,
 	}
@@ -70,12 +89,15 @@ func (a *AWSCache) Session(profile string, region string) (*AWSClients, error) {
 
 type AWSClients struct {
 	session      *session.Session
+	profile      string
+	region       string
+	role         string
 	cleanup      *cleanup.Cleanup
 	pollInterval time.Duration
 
-	accountID oncecache.StringCache
-	myToken   string
-	mu        sync.Mutex
+	identity oncecache.Cache
+	myToken  string
+	mu       sync.Mutex
 }
 
 func (a *AWSClients) token() string {
@@ -91,15 +113,46 @@ func (a *AWSClients) Region() string {
 	return *a.session.Config.Region
 }
 
-func (a *AWSClients) AccountID() (string, error) {
-	return a.accountID.Do(func() (string, error) {
+// S3 returns an S3 client for this session
+func (a *AWSClients) S3() *s3.S3 {
+	return s3.New(a.session)
+}
+
+// DynamoDB returns a DynamoDB client for this session
+func (a *AWSClients) DynamoDB() *dynamodb.DynamoDB {
+	return dynamodb.New(a.session)
+}
+
+func (a *AWSClients) callerIdentity() (*sts.GetCallerIdentityOutput, error) {
+	ret, err := a.identity.Do(func() (interface{}, error) {
 		stsClient := sts.New(a.session)
 		out, err := stsClient.GetCallerIdentity(&sts.GetCallerIdentityInput{})
 		if err != nil {
-			return "", errors.Wrap(err, "unable to fetch identity ID")
+			return nil, errors.Wrap(err, "unable to fetch identity ID")
 		}
-		return *out.Account, nil
+		return out, nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	return ret.(*sts.GetCallerIdentityOutput), nil
+}
+
+func (a *AWSClients) AccountID() (string, error) {
+	out, err := a.callerIdentity()
+	if err != nil {
+		return "", err
+	}
+	return *out.Account, nil
+}
+
+// CallerARN is the ARN of the IAM identity this session acts as
+func (a *AWSClients) CallerARN() (string, error) {
+	out, err := a.callerIdentity()
+	if err != nil {
+		return "", err
+	}
+	return *out.Arn, nil
 }
 
 func (a *AWSClients) DescribeStack(ctx context.Context, name string) (*cloudformation.Stack, error) {
@@ -119,6 +172,19 @@ func (a *AWSClients) DescribeStack(ctx context.Context, name string) (*cloudform
 	return res.Stacks[0], nil
 }
 
+// DeployedTemplate returns the template body a stack was last deployed with
+func (a *AWSClients) DeployedTemplate(ctx context.Context, stackName string) (string, error) {
+	cf := cloudformation.New(a.session)
+	out, err := cf.GetTemplateWithContext(ctx, &cloudformation.GetTemplateInput{
+		StackName:     &stackName,
+		TemplateStage: aws.String(cloudformation.TemplateStageOriginal),
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to get template of %s", stackName)
+	}
+	return emptyOnNil(out.TemplateBody), nil
+}
+
 func guessChangesetType(ctx context.Context, cloudformationClient *cloudformation.CloudFormation, in *cloudformation.CreateChangeSetInput) *cloudformation.CreateChangeSetInput {
 	if in == nil || in.ChangeSetType == nil {
 		return in
@@ -153,8 +219,8 @@ func isAWSError(err error, code string) bool {
 	return strings.Contains(r.Error(), code)
 }
 
-func (a *AWSClients) createChangeset(ctx context.Context, cf *cloudformation.CloudFormation, in *cloudformation.CreateChangeSetInput, hasAlreadyDeletedChangeSet bool) (*cloudformation.CreateChangeSetOutput, error) {
-	res, err := cf.CreateChangeSetWithContext(ctx, in)
+func (a *AWSClients) createChangeset(ctx context.Context, cf *cloudformation.CloudFormation, in *cloudformation.CreateChangeSetInput, hasAlreadyDeletedChangeSet bool, opts ...request.Option) (*cloudformation.CreateChangeSetOutput, error) {
+	res, err := cf.CreateChangeSetWithContext(ctx, in, opts...)
 	if err == nil {
 		return res, nil
 	}
@@ -166,7 +232,7 @@ func (a *AWSClients) createChangeset(ctx context.Context, cf *cloudformation.Clo
 		if err != nil {
 			return nil, errors.Wrap(err, "deleting changeset failed")
 		}
-		return a.createChangeset(ctx, cf, in, true)
+		return a.createChangeset(ctx, cf, in, true, opts...)
 	}
 	return nil, errors.Wrap(err, "unable to create changeset")
 }
@@ -235,8 +301,18 @@ func (a *AWSClients) FixTemplateBody(ctx context.Context, in *cloudformation.Cre
 			logger.Log(1, "Bucket created with URL %s", *out.Location)
 		}
 	}
-	uploader := s3manager.NewUploader(a.session)
 	itemKey := fmt.Sprintf("cfmanage_%s_%s", *in.StackName, time.Now().UTC())
+	rec := a.record(recordDeleteS3Object, map[string]string{
+		"bucket": bucket,
+		"key":    itemKey,
+	})
+	if err := a.cleanup.AddRecord(rec, phaseChangeset, func(ctx context.Context) error {
+		logger.Log(2, "Cleaning up %s/%s", bucket, itemKey)
+		return a.deleteS3Object(ctx, bucket, itemKey)
+	}); err != nil {
+		return errors.Wrap(err, "unable to journal template body cleanup")
+	}
+	uploader := s3manager.NewUploader(a.session)
 	out, err := uploader.UploadWithContext(ctx, &s3manager.UploadInput{
 		Bucket: &bucket,
 		Key:    &itemKey,
@@ -248,53 +324,46 @@ func (a *AWSClients) FixTemplateBody(ctx context.Context, in *cloudformation.Cre
 	logger.Log(1, "template body uploaded to %s", out.Location)
 	in.TemplateBody = nil
 	in.TemplateURL = &out.Location
-	a.cleanup.Add(func(ctx context.Context) error {
-		logger.Log(2, "Cleaning up %s/%s", bucket, itemKey)
-		clients3 := s3.New(a.session)
-		_, err := clients3.DeleteObject(&s3.DeleteObjectInput{
-			Bucket: &bucket,
-			Key:    &itemKey,
-		})
-		return errors.Wrapf(err, "Unable to delete bucket=%s key=%s", bucket, itemKey)
-
-	})
 	return nil
 }
 
 func (a *AWSClients) CreateChangesetWaitForStatus(ctx context.Context, in *cloudformation.CreateChangeSetInput, existingStack *cloudformation.Stack, logger *logger.Logger) (*cloudformation.DescribeChangeSetOutput, error) {
+	return a.createChangesetWaitForStatus(ctx, in, existingStack, logger)
+}
+
+func (a *AWSClients) createChangesetWaitForStatus(ctx context.Context, in *cloudformation.CreateChangeSetInput, existingStack *cloudformation.Stack, logger *logger.Logger, opts ...request.Option) (*cloudformation.DescribeChangeSetOutput, error) {
 	if in.ChangeSetName == nil {
-		in.ChangeSetName = aws.String("A" + strconv.FormatInt(time.Now().UnixNano(), 16))
+		in.ChangeSetName = aws.String(ChangesetNamePrefix + strconv.FormatInt(time.Now().UnixNano(), 16))
 	}
 	in.ClientToken = aws.String(a.token())
 	cf := cloudformation.New(a.session)
 	in = guessChangesetType(ctx, cf, in)
 
-	res, err := a.createChangeset(ctx, cf, in, false)
-	if err != nil {
-		return nil, errors.Wrap(err, "creating changeset failed")
-	}
-	a.cleanup.Add(func(ctx context.Context) error {
-		_, err := cf.DeleteChangeSetWithContext(ctx, &cloudformation.DeleteChangeSetInput{
-			ChangeSetName: res.Id,
-		})
-		return err
+	// Journal the cleanup jobs before creating anything, so a crash between here and cleanup does not leak them
+	changesetRecord := a.record(recordDeleteChangeset, map[string]string{
+		"stack":     *in.StackName,
+		"changeset": *in.ChangeSetName,
 	})
+	if err := a.cleanup.AddRecord(changesetRecord, phaseChangeset, func(ctx context.Context) error {
+		return a.deleteChangeset(ctx, *in.StackName, *in.ChangeSetName)
+	}); err != nil {
+		return nil, errors.Wrap(err, "unable to journal changeset cleanup")
+	}
 	if existingStack == nil {
 		// Clean up the stack created by the changeset
-		a.cleanup.Add(func(ctx context.Context) error {
-			finishingStack, err := a.DescribeStack(ctx, *in.StackName)
-			if err != nil {
-				return errors.Wrapf(err, "unable to describe stack %s", *in.StackName)
-			}
-			if *finishingStack.StackStatus == "REVIEW_IN_PROGRESS" {
-				_, err := cf.DeleteStack(&cloudformation.DeleteStackInput{
-					ClientRequestToken: aws.String(a.token()),
-					StackName:          in.StackName,
-				})
-				return errors.Wrapf(err, "unable to delete stack %s", *in.StackName)
-			}
-			return nil
+		stackRecord := a.record(recordDeleteReviewStack, map[string]string{
+			"stack": *in.StackName,
 		})
+		if err := a.cleanup.AddRecord(stackRecord, phaseStack, func(ctx context.Context) error {
+			return a.deleteReviewStack(ctx, *in.StackName)
+		}); err != nil {
+			return nil, errors.Wrap(err, "unable to journal stack cleanup")
+		}
+	}
+
+	res, err := a.createChangeset(ctx, cf, in, false, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating changeset failed")
 	}
 	return a.waitForChangesetToFinishCreating(ctx, cf, *res.Id, logger, nil)
 }
@@ -367,8 +436,38 @@ func (a *AWSClients) getPollInterval() time.Duration {
 	return a.pollInterval
 }
 
+// https://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/using-cfn-describing-stacks.html
+func terminalFailureStatusStates() []string {
+	return []string{"CREATE_FAILED", "DELETE_FAILED", "ROLLBACK_FAILED", "UPDATE_ROLLBACK_FAILED", "ROLLBACK_COMPLETE", "UPDATE_ROLLBACK_COMPLETE", "IMPORT_ROLLBACK_FAILED", "IMPORT_ROLLBACK_COMPLETE"}
+}
+
+func terminalOkStatusStates() []string {
+	return []string{"CREATE_COMPLETE", "DELETE_COMPLETE", "UPDATE_COMPLETE", "IMPORT_COMPLETE"}
+}
+
 // waitForTerminalState loops forever until either the context ends, or something fails
 func (a *AWSClients) WaitForTerminalState(ctx context.Context, stackID string, log *logger.Logger) error {
+	_, err := a.WaitForTerminalStatus(ctx, stackID, log)
+	return err
+}
+
+// WaitForTerminalStatus is WaitForTerminalState, also returning the state the stack reached
+func (a *AWSClients) WaitForTerminalStatus(ctx context.Context, stackID string, log *logger.Logger) (string, error) {
+	return a.WaitForStackStatus(ctx, stackID, log, terminalOkStatusStates(), terminalFailureStatusStates())
+}
+
+func contains(states []string, s string) bool {
+	for _, state := range states {
+		if state == s {
+			return true
+		}
+	}
+	return false
+}
+
+// WaitForStackStatus polls a stack until it reaches one of okStates, returning the state it reached, or one of
+// failStates, returning an error.
+func (a *AWSClients) WaitForStackStatus(ctx context.Context, stackID string, log *logger.Logger, okStates []string, failStates []string) (string, error) {
 	lastStackStatus := ""
 	cfClient := cloudformation.New(a.session)
 	backoff := aimd.Aimd{
@@ -377,7 +476,7 @@ func (a *AWSClients) WaitForTerminalState(ctx context.Context, stackID string, l
 	for {
 		select {
 		case <-ctx.Done():
-			return errors.Wrap(ctx.Err(), "context died waiting for terminal state")
+			return "", errors.Wrap(ctx.Err(), "context died waiting for terminal state")
 		case <-time.After(backoff.Get()):
 		}
 		descOut, err := cfClient.DescribeStacksWithContext(ctx, &cloudformation.DescribeStacksInput{
@@ -388,36 +487,22 @@ func (a *AWSClients) WaitForTerminalState(ctx context.Context, stackID string, l
 				backoff.OnError()
 				continue
 			}
-			return errors.Wrapf(err, "unable to describe stack %s", stackID)
+			return "", errors.Wrapf(err, "unable to describe stack %s", stackID)
 		}
 		backoff.OnOk()
 		if len(descOut.Stacks) != 1 {
-			return errors.Errorf("unable to correctly find stack %s", stackID)
+			return "", errors.Errorf("unable to correctly find stack %s", stackID)
 		}
 		thisStack := descOut.Stacks[0]
 		if *thisStack.StackStatus != lastStackStatus {
 			log.Log(1, "Stack status set to %s: %s", *thisStack.StackStatus, emptyOnNil(thisStack.StackStatusReason))
 			lastStackStatus = *thisStack.StackStatus
 		}
-		// https://docs.aws.amazon.com/AWSCloudFormation/latest/UserGuide/using-cfn-describing-stacks.html
-		terminalFailureStatusStates := map[string]struct{}{
-			"CREATE_FAILED":            {},
-			"DELETE_FAILED":            {},
-			"ROLLBACK_FAILED":          {},
-			"UPDATE_ROLLBACK_FAILED":   {},
-			"ROLLBACK_COMPLETE":        {},
-			"UPDATE_ROLLBACK_COMPLETE": {},
-		}
-		if _, exists := terminalFailureStatusStates[emptyOnNil(thisStack.StackStatus)]; exists {
-			return errors.Errorf("Terminal stack state failure: %s %s", emptyOnNil(thisStack.StackStatus), emptyOnNil(thisStack.StackStatusReason))
-		}
-		terminalOkStatusStates := map[string]struct{}{
-			"CREATE_COMPLETE": {},
-			"DELETE_COMPLETE": {},
-			"UPDATE_COMPLETE": {},
+		if contains(failStates, lastStackStatus) {
+			return lastStackStatus, errors.Errorf("Terminal stack state failure: %s %s", lastStackStatus, emptyOnNil(thisStack.StackStatusReason))
 		}
-		if _, exists := terminalOkStatusStates[emptyOnNil(thisStack.StackStatus)]; exists {
-			return nil
+		if contains(okStates, lastStackStatus) {
+			return lastStackStatus, nil
 		}
 	}
 }
@@ -0,0 +1,170 @@
+package awscache
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/cep21/cfmanage/internal/cleanup"
+	"github.com/pkg/errors"
+)
+
+// ChangesetNamePrefix starts the name of every changeset cfmanage creates for itself.  It lets garbage collection find
+// changesets a crashed run left behind.
+const ChangesetNamePrefix = "cfmanage-"
+
+// Changesets must be deleted before the REVIEW_IN_PROGRESS stacks they created
+const (
+	phaseChangeset cleanup.Phase = iota
+	phaseStack
+)
+
+const (
+	recordDeleteChangeset   = "delete-changeset"
+	recordDeleteReviewStack = "delete-review-stack"
+	recordDeleteS3Object    = "delete-s3-object"
+)
+
+func (a *AWSClients) record(kind string, args map[string]string) cleanup.Record {
+	return cleanup.Record{
+		Kind:    kind,
+		Profile: a.profile,
+		Region:  a.region,
+		Role:    a.role,
+		Args:    args,
+	}
+}
+
+// CleanupRecord is a cleanup.Handler that replays journaled records created by AWSClients
+func (a *AWSCache) CleanupRecord(ctx context.Context, r cleanup.Record) error {
+	ses, err := a.SessionAs(r.Profile, r.Region, r.Role)
+	if err != nil {
+		return errors.Wrapf(err, "unable to make session for record %s", r.ID)
+	}
+	switch r.Kind {
+	case recordDeleteChangeset:
+		return ses.deleteChangeset(ctx, r.Args["stack"], r.Args["changeset"])
+	case recordDeleteReviewStack:
+		return ses.deleteReviewStack(ctx, r.Args["stack"])
+	case recordDeleteS3Object:
+		return ses.deleteS3Object(ctx, r.Args["bucket"], r.Args["key"])
+	}
+	return errors.Errorf("unknown cleanup record kind %s", r.Kind)
+}
+
+func (a *AWSClients) deleteChangeset(ctx context.Context, stackName string, changesetName string) error {
+	cf := cloudformation.New(a.session)
+	_, err := cf.DeleteChangeSetWithContext(ctx, &cloudformation.DeleteChangeSetInput{
+		ChangeSetName: &changesetName,
+		StackName:     &stackName,
+	})
+	if isAWSError(err, "ChangeSetNotFound") || isAWSError(err, "does not exist") {
+		return nil
+	}
+	return errors.Wrapf(err, "unable to delete changeset %s of stack %s", changesetName, stackName)
+}
+
+// deleteReviewStack removes a stack that only exists because a CREATE changeset made it
+func (a *AWSClients) deleteReviewStack(ctx context.Context, stackName string) error {
+	finishingStack, err := a.DescribeStack(ctx, stackName)
+	if err != nil {
+		return errors.Wrapf(err, "unable to describe stack %s", stackName)
+	}
+	if finishingStack == nil || emptyOnNil(finishingStack.StackStatus) != "REVIEW_IN_PROGRESS" {
+		return nil
+	}
+	cf := cloudformation.New(a.session)
+	_, err = cf.DeleteStackWithContext(ctx, &cloudformation.DeleteStackInput{
+		ClientRequestToken: aws.String(a.token()),
+		StackName:          &stackName,
+	})
+	return errors.Wrapf(err, "unable to delete stack %s", stackName)
+}
+
+func (a *AWSClients) deleteS3Object(ctx context.Context, bucket string, key string) error {
+	clients3 := s3.New(a.session)
+	_, err := clients3.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	return errors.Wrapf(err, "Unable to delete bucket=%s key=%s", bucket, key)
+}
+
+// ListChangesets returns a summary of every changeset currently attached to a stack
+func (a *AWSClients) ListChangesets(ctx context.Context, stackName string) ([]*cloudformation.ChangeSetSummary, error) {
+	cf := cloudformation.New(a.session)
+	var ret []*cloudformation.ChangeSetSummary
+	var nextToken *string
+	for {
+		out, err := cf.ListChangeSetsWithContext(ctx, &cloudformation.ListChangeSetsInput{
+			StackName: &stackName,
+			NextToken: nextToken,
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to list changesets of %s", stackName)
+		}
+		ret = append(ret, out.Summaries...)
+		if out.NextToken == nil {
+			return ret, nil
+		}
+		nextToken = out.NextToken
+	}
+}
+
+// StaleChangeset is a changeset that looks like a leftover from a cfmanage run
+type StaleChangeset struct {
+	StackName     string
+	ChangesetName string
+	ChangesetARN  string
+	Created       time.Time
+}
+
+// StaleChangesets finds cfmanage created changesets on a stack that are older than minAge
+func (a *AWSClients) StaleChangesets(ctx context.Context, stackName string, minAge time.Duration) ([]StaleChangeset, error) {
+	summaries, err := a.ListChangesets(ctx, stackName)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]StaleChangeset, 0, len(summaries))
+	for _, s := range summaries {
+		if !isManagedChangesetName(emptyOnNil(s.ChangeSetName)) {
+			continue
+		}
+		if s.CreationTime != nil && time.Since(*s.CreationTime) < minAge {
+			continue
+		}
+		st := StaleChangeset{
+			StackName:     stackName,
+			ChangesetName: emptyOnNil(s.ChangeSetName),
+			ChangesetARN:  emptyOnNil(s.ChangeSetId),
+		}
+		if s.CreationTime != nil {
+			st.Created = *s.CreationTime
+		}
+		ret = append(ret, st)
+	}
+	return ret, nil
+}
+
+// DeleteStaleChangeset removes a changeset found by StaleChangesets.  If that leaves behind an empty stack in
+// REVIEW_IN_PROGRESS, the stack is removed too.
+func (a *AWSClients) DeleteStaleChangeset(ctx context.Context, s StaleChangeset) error {
+	if err := a.deleteChangeset(ctx, s.StackName, s.ChangesetName); err != nil {
+		return err
+	}
+	remaining, err := a.ListChangesets(ctx, s.StackName)
+	if err != nil {
+		return err
+	}
+	if len(remaining) != 0 {
+		return nil
+	}
+	return a.deleteReviewStack(ctx, s.StackName)
+}
+
+func isManagedChangesetName(name string) bool {
+	return strings.HasPrefix(name, ChangesetNamePrefix)
+}
@@ -0,0 +1,126 @@
+package awscache
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/cep21/cfmanage/internal/logger"
+	"github.com/pkg/errors"
+)
+
+// The AWS SDK cfmanage is built with predates resource import.  Its requests are still sent with the query protocol,
+// so the fields import needs are added to them, and read from their responses, by hand.
+
+// ChangeSetTypeImport is the changeset type that brings existing resources under the management of a stack
+const ChangeSetTypeImport = "IMPORT"
+
+// ResourceIdentifierSummary lists the resources of a template of one type, and the properties that identify an
+// existing resource of that type
+type ResourceIdentifierSummary struct {
+	ResourceType        string
+	LogicalResourceIDs  []string
+	ResourceIdentifiers []string
+}
+
+// ResourceToImport is an existing resource that becomes the resource LogicalResourceID of a stack
+type ResourceToImport struct {
+	ResourceType      string
+	LogicalResourceID string
+	// ResourceIdentifier has a value for each of the ResourceIdentifiers of the type
+	ResourceIdentifier map[string]string
+}
+
+type templateSummaryResponse struct {
+	Summaries []struct {
+		ResourceType        string   `xml:"ResourceType"`
+		LogicalResourceIds  []string `xml:"LogicalResourceIds>member"`
+		ResourceIdentifiers []string `xml:"ResourceIdentifiers>member"`
+	} `xml:"GetTemplateSummaryResult>ResourceIdentifierSummaries>member"`
+}
+
+// ResourceIdentifiers summarizes the resources of a template that can be imported, by type
+func (a *AWSClients) ResourceIdentifiers(ctx context.Context, templateBody *string, templateURL *string) ([]ResourceIdentifierSummary, error) {
+	cf := cloudformation.New(a.session)
+	var parsed templateSummaryResponse
+	_, err := cf.GetTemplateSummaryWithContext(ctx, &cloudformation.GetTemplateSummaryInput{
+		TemplateBody: templateBody,
+		TemplateURL:  templateURL,
+	}, func(r *request.Request) {
+		r.Handlers.Unmarshal.PushFront(func(r *request.Request) {
+			b, err := ioutil.ReadAll(r.HTTPResponse.Body)
+			if err != nil {
+				r.Error = awserr.New("SerializationError", "unable to read template summary", err)
+				return
+			}
+			r.HTTPResponse.Body = ioutil.NopCloser(bytes.NewReader(b))
+			if err := xml.Unmarshal(b, &parsed); err != nil {
+				r.Error = awserr.New("SerializationError", "unable to parse resource identifiers", err)
+			}
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get template summary")
+	}
+	ret := make([]ResourceIdentifierSummary, 0, len(parsed.Summaries))
+	for _, s := range parsed.Summaries {
+		ret = append(ret, ResourceIdentifierSummary{
+			ResourceType:        s.ResourceType,
+			LogicalResourceIDs:  s.LogicalResourceIds,
+			ResourceIdentifiers: s.ResourceIdentifiers,
+		})
+	}
+	return ret, nil
+}
+
+// withResourcesToImport adds ResourcesToImport to a CreateChangeSet request
+func withResourcesToImport(resources []ResourceToImport) request.Option {
+	return func(r *request.Request) {
+		r.Handlers.Build.PushBack(func(r *request.Request) {
+			if r.Error != nil {
+				return
+			}
+			b, err := ioutil.ReadAll(r.GetBody())
+			if err != nil {
+				r.Error = awserr.New("SerializationError", "unable to read changeset request", err)
+				return
+			}
+			body, err := url.ParseQuery(string(b))
+			if err != nil {
+				r.Error = awserr.New("SerializationError", "unable to parse changeset request", err)
+				return
+			}
+			for i, res := range resources {
+				prefix := fmt.Sprintf("ResourcesToImport.member.%d.", i+1)
+				body.Set(prefix+"ResourceType", res.ResourceType)
+				body.Set(prefix+"LogicalResourceId", res.LogicalResourceID)
+				keys := make([]string, 0, len(res.ResourceIdentifier))
+				for k := range res.ResourceIdentifier {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				for j, k := range keys {
+					entry := fmt.Sprintf("%sResourceIdentifier.entry.%d.", prefix, j+1)
+					body.Set(entry+"key", k)
+					body.Set(entry+"value", res.ResourceIdentifier[k])
+				}
+			}
+			r.SetBufferBody([]byte(body.Encode()))
+		})
+	}
+}
+
+// CreateImportChangesetWaitForStatus is CreateChangesetWaitForStatus for a changeset importing resources.  The
+// template of in must describe the resources of the stack, plus those imported.
+func (a *AWSClients) CreateImportChangesetWaitForStatus(ctx context.Context, in *cloudformation.CreateChangeSetInput, existingStack *cloudformation.Stack, resources []ResourceToImport, logger *logger.Logger) (*cloudformation.DescribeChangeSetOutput, error) {
+	in.ChangeSetType = aws.String(ChangeSetTypeImport)
+	return a.createChangesetWaitForStatus(ctx, in, existingStack, logger, withResourcesToImport(resources))
+}
@@ -0,0 +1,121 @@
+package awscache
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+// fakeCloudFormation answers every request with response, and records the form of the last one
+type fakeCloudFormation struct {
+	response string
+	form     url.Values
+}
+
+func (f *fakeCloudFormation) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	b, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if f.form, err = url.ParseQuery(string(b)); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/xml")
+	_, _ = rw.Write([]byte(f.response))
+}
+
+// newFakeClients returns clients that send requests to f, and a func that stops f
+func newFakeClients(t *testing.T, f *fakeCloudFormation) (*AWSClients, func()) {
+	server := httptest.NewServer(f)
+	ses, err := session.NewSession(&aws.Config{
+		Endpoint:    aws.String(server.URL),
+		Region:      aws.String("us-west-2"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	})
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	return &AWSClients{session: ses}, server.Close
+}
+
+func TestWithResourcesToImport(t *testing.T) {
+	f := &fakeCloudFormation{response: `<CreateChangeSetResponse><CreateChangeSetResult><Id>arn:changeset</Id></CreateChangeSetResult></CreateChangeSetResponse>`}
+	clients, stop := newFakeClients(t, f)
+	defer stop()
+	cf := cloudformation.New(clients.session)
+	_, err := cf.CreateChangeSetWithContext(context.Background(), &cloudformation.CreateChangeSetInput{
+		StackName:     aws.String("infra-canary"),
+		ChangeSetName: aws.String("import"),
+		ChangeSetType: aws.String(ChangeSetTypeImport),
+	}, withResourcesToImport([]ResourceToImport{
+		{ResourceType: "AWS::S3::Bucket", LogicalResourceID: "Assets", ResourceIdentifier: map[string]string{"BucketName": "assets & more"}},
+		{ResourceType: "AWS::DynamoDB::Table", LogicalResourceID: "Table", ResourceIdentifier: map[string]string{"TableName": "jobs", "Region": "us-west-2"}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := url.Values{
+		"Action":        {"CreateChangeSet"},
+		"Version":       {"2010-05-15"},
+		"StackName":     {"infra-canary"},
+		"ChangeSetName": {"import"},
+		"ChangeSetType": {"IMPORT"},
+
+		"ResourcesToImport.member.1.ResourceType":                     {"AWS::S3::Bucket"},
+		"ResourcesToImport.member.1.LogicalResourceId":                {"Assets"},
+		"ResourcesToImport.member.1.ResourceIdentifier.entry.1.key":   {"BucketName"},
+		"ResourcesToImport.member.1.ResourceIdentifier.entry.1.value": {"assets & more"},
+		"ResourcesToImport.member.2.ResourceType":                     {"AWS::DynamoDB::Table"},
+		"ResourcesToImport.member.2.LogicalResourceId":                {"Table"},
+		// Identifiers are sorted, so the same import is always the same request
+		"ResourcesToImport.member.2.ResourceIdentifier.entry.1.key":   {"Region"},
+		"ResourcesToImport.member.2.ResourceIdentifier.entry.1.value": {"us-west-2"},
+		"ResourcesToImport.member.2.ResourceIdentifier.entry.2.key":   {"TableName"},
+		"ResourcesToImport.member.2.ResourceIdentifier.entry.2.value": {"jobs"},
+	}
+	if !reflect.DeepEqual(f.form, want) {
+		t.Fatalf("request is\n%v\nwant\n%v", f.form, want)
+	}
+}
+
+func TestResourceIdentifiers(t *testing.T) {
+	f := &fakeCloudFormation{response: `<GetTemplateSummaryResponse><GetTemplateSummaryResult>
+<ResourceIdentifierSummaries>
+<member><ResourceType>AWS::S3::Bucket</ResourceType>
+<LogicalResourceIds><member>Assets</member><member>Logs</member></LogicalResourceIds>
+<ResourceIdentifiers><member>BucketName</member></ResourceIdentifiers></member>
+<member><ResourceType>AWS::DynamoDB::Table</ResourceType>
+<LogicalResourceIds><member>Table</member></LogicalResourceIds>
+<ResourceIdentifiers><member>TableName</member></ResourceIdentifiers></member>
+</ResourceIdentifierSummaries>
+<Version>2010-09-09</Version>
+</GetTemplateSummaryResult></GetTemplateSummaryResponse>`}
+	clients, stop := newFakeClients(t, f)
+	defer stop()
+	got, err := clients.ResourceIdentifiers(context.Background(), aws.String("{}"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ResourceIdentifierSummary{
+		{ResourceType: "AWS::S3::Bucket", LogicalResourceIDs: []string{"Assets", "Logs"}, ResourceIdentifiers: []string{"BucketName"}},
+		{ResourceType: "AWS::DynamoDB::Table", LogicalResourceIDs: []string{"Table"}, ResourceIdentifiers: []string{"TableName"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("summaries %+v, want %+v", got, want)
+	}
+	if f.form.Get("Action") != "GetTemplateSummary" || f.form.Get("TemplateBody") != "{}" {
+		t.Fatalf("request is %v", f.form)
+	}
+}
@@ -0,0 +1,97 @@
+package awscache
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+)
+
+// ContinueUpdateRollback resumes the rollback of a stack in UPDATE_ROLLBACK_FAILED, skipping resources that cannot
+// roll back
+func (a *AWSClients) ContinueUpdateRollback(ctx context.Context, stackName string, resourcesToSkip []string) error {
+	cf := cloudformation.New(a.session)
+	_, err := cf.ContinueUpdateRollbackWithContext(ctx, &cloudformation.ContinueUpdateRollbackInput{
+		StackName:          &stackName,
+		ResourcesToSkip:    aws.StringSlice(resourcesToSkip),
+		ClientRequestToken: aws.String(a.token()),
+	})
+	return errors.Wrapf(err, "unable to continue update rollback of %s", stackName)
+}
+
+// DeleteStack starts deleting a stack
+func (a *AWSClients) DeleteStack(ctx context.Context, stackName string) error {
+	cf := cloudformation.New(a.session)
+	_, err := cf.DeleteStackWithContext(ctx, &cloudformation.DeleteStackInput{
+		StackName:          &stackName,
+		ClientRequestToken: aws.String(a.token()),
+	})
+	return errors.Wrapf(err, "unable to delete stack %s", stackName)
+}
+
+// ListStackResources returns every resource in a stack
+func (a *AWSClients) ListStackResources(ctx context.Context, stackName string) ([]*cloudformation.StackResourceSummary, error) {
+	cf := cloudformation.New(a.session)
+	var ret []*cloudformation.StackResourceSummary
+	err := cf.ListStackResourcesPagesWithContext(ctx, &cloudformation.ListStackResourcesInput{
+		StackName: &stackName,
+	}, func(out *cloudformation.ListStackResourcesOutput, _ bool) bool {
+		ret = append(ret, out.StackResourceSummaries...)
+		return true
+	})
+	return ret, errors.Wrapf(err, "unable to list resources of %s", stackName)
+}
+
+// LatestStackEventID returns the ID of the most recent event of a stack, or empty if it has none.  Pass it to
+// StackStreamer.AfterEventID to stream only the events of an operation that has not started yet.
+func (a *AWSClients) LatestStackEventID(ctx context.Context, stackID string) (string, error) {
+	cf := cloudformation.New(a.session)
+	out, err := cf.DescribeStackEventsWithContext(ctx, &cloudformation.DescribeStackEventsInput{
+		StackName: &stackID,
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to describe stack events of %s", stackID)
+	}
+	if len(out.StackEvents) == 0 {
+		return "", nil
+	}
+	return emptyOnNil(out.StackEvents[0].EventId), nil
+}
+
+// operationStartStates are the statuses a stack enters when an operation on it starts
+func operationStartStates() []string {
+	return []string{"CREATE_IN_PROGRESS", "UPDATE_IN_PROGRESS", "DELETE_IN_PROGRESS", "IMPORT_IN_PROGRESS"}
+}
+
+// IsStackEvent is true if event is about the stack itself rather than one of its resources
+func IsStackEvent(event *cloudformation.StackEvent) bool {
+	return emptyOnNil(event.ResourceType) == "AWS::CloudFormation::Stack" && emptyOnNil(event.PhysicalResourceId) == emptyOnNil(event.StackId)
+}
+
+// IsTerminalStatus is true for the stack statuses WaitForTerminalState stops at
+func IsTerminalStatus(status string) bool {
+	return contains(terminalOkStatusStates(), status) || contains(terminalFailureStatusStates(), status)
+}
+
+// OperationStartEventID returns the ID of the event just before the latest operation on a stack started.  Pass it to
+// StackStreamer.AfterEventID to replay that operation's events.  It is empty if the operation created the stack.
+func (a *AWSClients) OperationStartEventID(ctx context.Context, stackID string) (string, error) {
+	cf := cloudformation.New(a.session)
+	found := false
+	ret := ""
+	err := cf.DescribeStackEventsPagesWithContext(ctx, &cloudformation.DescribeStackEventsInput{
+		StackName: &stackID,
+	}, func(out *cloudformation.DescribeStackEventsOutput, _ bool) bool {
+		// Events are newest first: the operation started at the newest stack event entering an in progress state
+		for _, event := range out.StackEvents {
+			if found {
+				ret = emptyOnNil(event.EventId)
+				return false
+			}
+			found = IsStackEvent(event) && contains(operationStartStates(), emptyOnNil(event.ResourceStatus))
+		}
+		return true
+	})
+	return ret, errors.Wrapf(err, "unable to describe stack events of %s", stackID)
+}
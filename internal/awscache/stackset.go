@@ -0,0 +1,180 @@
+package awscache
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/cep21/cfmanage/internal/aimd"
+	"github.com/cep21/cfmanage/internal/logger"
+	"github.com/pkg/errors"
+)
+
+// DescribeStackSet returns a stack set, or nil if it does not exist
+func (a *AWSClients) DescribeStackSet(ctx context.Context, name string) (*cloudformation.StackSet, error) {
+	cf := cloudformation.New(a.session)
+	out, err := cf.DescribeStackSetWithContext(ctx, &cloudformation.DescribeStackSetInput{
+		StackSetName: &name,
+	})
+	if err != nil {
+		if isAWSError(err, cloudformation.ErrCodeStackSetNotFoundException) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "unable to describe stack set %s", name)
+	}
+	if out.StackSet == nil || emptyOnNil(out.StackSet.Status) == cloudformation.StackSetStatusDeleted {
+		return nil, nil
+	}
+	return out.StackSet, nil
+}
+
+// ListStackInstances returns every instance of a stack set
+func (a *AWSClients) ListStackInstances(ctx context.Context, name string) ([]*cloudformation.StackInstanceSummary, error) {
+	cf := cloudformation.New(a.session)
+	var ret []*cloudformation.StackInstanceSummary
+	in := &cloudformation.ListStackInstancesInput{
+		StackSetName: &name,
+	}
+	for {
+		out, err := cf.ListStackInstancesWithContext(ctx, in)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to list instances of stack set %s", name)
+		}
+		ret = append(ret, out.Summaries...)
+		if out.NextToken == nil {
+			return ret, nil
+		}
+		in.NextToken = out.NextToken
+	}
+}
+
+// CreateStackSet creates a stack set without instances
+func (a *AWSClients) CreateStackSet(ctx context.Context, in *cloudformation.CreateStackSetInput) error {
+	cf := cloudformation.New(a.session)
+	_, err := cf.CreateStackSetWithContext(ctx, in)
+	return errors.Wrapf(err, "unable to create stack set %s", emptyOnNil(in.StackSetName))
+}
+
+// UpdateStackSet starts updating a stack set and its instances, returning the ID of the operation
+func (a *AWSClients) UpdateStackSet(ctx context.Context, in *cloudformation.UpdateStackSetInput) (string, error) {
+	cf := cloudformation.New(a.session)
+	out, err := cf.UpdateStackSetWithContext(ctx, in)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to update stack set %s", emptyOnNil(in.StackSetName))
+	}
+	return emptyOnNil(out.OperationId), nil
+}
+
+// CreateStackInstances starts creating an instance of a stack set in each region of each account, returning the ID
+// of the operation
+func (a *AWSClients) CreateStackInstances(ctx context.Context, in *cloudformation.CreateStackInstancesInput) (string, error) {
+	cf := cloudformation.New(a.session)
+	out, err := cf.CreateStackInstancesWithContext(ctx, in)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to create instances of stack set %s", emptyOnNil(in.StackSetName))
+	}
+	return emptyOnNil(out.OperationId), nil
+}
+
+// DeleteStackInstances starts deleting the instances of a stack set in each region of each account, returning the ID
+// of the operation
+func (a *AWSClients) DeleteStackInstances(ctx context.Context, in *cloudformation.DeleteStackInstancesInput) (string, error) {
+	cf := cloudformation.New(a.session)
+	out, err := cf.DeleteStackInstancesWithContext(ctx, in)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to delete instances of stack set %s", emptyOnNil(in.StackSetName))
+	}
+	return emptyOnNil(out.OperationId), nil
+}
+
+// DetectStackSetDrift starts checking each instance of a stack set for drift, returning the ID of the operation.  Once
+// it succeeds, ListStackInstances reports the drift of each instance.
+func (a *AWSClients) DetectStackSetDrift(ctx context.Context, name string, prefs *cloudformation.StackSetOperationPreferences) (string, error) {
+	cf := cloudformation.New(a.session)
+	out, err := cf.DetectStackSetDriftWithContext(ctx, &cloudformation.DetectStackSetDriftInput{
+		StackSetName:         &name,
+		OperationPreferences: prefs,
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to detect drift of stack set %s", name)
+	}
+	return emptyOnNil(out.OperationId), nil
+}
+
+// StopStackSetOperation asks CloudFormation to stop an operation.  Instances already being updated finish first.
+func (a *AWSClients) StopStackSetOperation(ctx context.Context, name string, operationID string) error {
+	cf := cloudformation.New(a.session)
+	_, err := cf.StopStackSetOperationWithContext(ctx, &cloudformation.StopStackSetOperationInput{
+		StackSetName: &name,
+		OperationId:  &operationID,
+	})
+	return errors.Wrapf(err, "unable to stop operation %s of stack set %s", operationID, name)
+}
+
+func (a *AWSClients) stackSetOperationResults(ctx context.Context, cf *cloudformation.CloudFormation, name string, operationID string) ([]*cloudformation.StackSetOperationResultSummary, error) {
+	var ret []*cloudformation.StackSetOperationResultSummary
+	in := &cloudformation.ListStackSetOperationResultsInput{
+		StackSetName: &name,
+		OperationId:  &operationID,
+	}
+	for {
+		out, err := cf.ListStackSetOperationResultsWithContext(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, out.Summaries...)
+		if out.NextToken == nil {
+			return ret, nil
+		}
+		in.NextToken = out.NextToken
+	}
+}
+
+// WaitForStackSetOperation polls an operation of a stack set until it ends, passing onResult each result of an
+// account and region as its status changes.  It returns an error if the operation did not succeed.
+func (a *AWSClients) WaitForStackSetOperation(ctx context.Context, name string, operationID string, log *logger.Logger, onResult func(*cloudformation.StackSetOperationResultSummary)) error {
+	cf := cloudformation.New(a.session)
+	backoff := aimd.Aimd{
+		Min: a.getPollInterval(),
+	}
+	lastStatus := make(map[string]string)
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "context died waiting for stack set operation")
+		case <-time.After(backoff.Get()):
+		}
+		out, err := cf.DescribeStackSetOperationWithContext(ctx, &cloudformation.DescribeStackSetOperationInput{
+			StackSetName: &name,
+			OperationId:  &operationID,
+		})
+		if err == nil {
+			var results []*cloudformation.StackSetOperationResultSummary
+			if results, err = a.stackSetOperationResults(ctx, cf, name, operationID); err == nil {
+				for _, r := range results {
+					key := emptyOnNil(r.Account) + "/" + emptyOnNil(r.Region)
+					if status := emptyOnNil(r.Status); lastStatus[key] != status {
+						lastStatus[key] = status
+						onResult(r)
+					}
+				}
+			}
+		}
+		if err != nil {
+			if isThrottleError(err) {
+				backoff.OnError()
+				continue
+			}
+			return errors.Wrapf(err, "unable to describe operation %s of stack set %s", operationID, name)
+		}
+		backoff.OnOk()
+		status := emptyOnNil(out.StackSetOperation.Status)
+		log.Log(2, "stack set %s operation %s is %s", name, operationID, status)
+		switch status {
+		case cloudformation.StackSetOperationStatusSucceeded:
+			return nil
+		case cloudformation.StackSetOperationStatusFailed, cloudformation.StackSetOperationStatusStopped:
+			return errors.Errorf("operation %s of stack set %s %s", operationID, name, status)
+		}
+	}
+}
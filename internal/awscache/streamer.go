@@ -16,8 +16,14 @@ import (
 type StackStreamer struct {
 	PollInterval time.Duration
 	Logger       *logger.Logger
-	once         sync.Once
-	closeOnDone  chan struct{}
+	// AfterEventID, if set, streams every event newer than this one instead of only the events caused by this
+	// process's requests
+	AfterEventID string
+	// AllEvents streams every event, even if AfterEventID is empty, instead of only the events caused by this
+	// process's requests
+	AllEvents   bool
+	once        sync.Once
+	closeOnDone chan struct{}
 }
 
 func (s *StackStreamer) pollInterval() time.Duration {
@@ -35,6 +41,9 @@ func (s *StackStreamer) init() {
 func (s *StackStreamer) Start(ctx context.Context, clients *AWSClients, stackID string, streamInto chan<- *cloudformation.StackEvent) error {
 	s.once.Do(s.init)
 	cloudformationClient := cloudformation.New(clients.session)
+	if s.AfterEventID != "" || s.AllEvents {
+		return s.streamStackEvents(ctx, cloudformationClient, stackID, "", streamInto)
+	}
 	return s.streamStackEvents(ctx, cloudformationClient, stackID, clients.token(), streamInto)
 }
 
@@ -53,7 +62,7 @@ func (s *StackStreamer) log(msg string, args ...interface{}) {
 
 // streamStackEvents sends cloudformation events into a channel until told to stop.
 func (s *StackStreamer) streamStackEvents(ctx context.Context, cloudformationClient *cloudformation.CloudFormation, stackID string, clientRequestToken string, streamInto chan<- *cloudformation.StackEvent) error {
-	var stopEventID string
+	stopEventID := s.AfterEventID
 	backoff := aimd.Aimd{
 		Min: s.pollInterval(),
 	}
@@ -117,6 +126,10 @@ func (s *StackStreamer) retEvents(ctx context.Context, cloudformationClient *clo
 			}
 			ret = append(ret, event)
 		}
+		if descOut.NextToken == nil {
+			return ret, nil
+		}
+		nextToken = descOut.NextToken
 	}
 }
 
@@ -0,0 +1,40 @@
+package awscache
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi"
+	"github.com/pkg/errors"
+)
+
+// ResourceTags returns the tags of every taggable resource of a stack, by logical ID.  Only resources carrying one of
+// tagKeys are returned.  CloudFormation tags each resource it creates with the stack ID and logical ID, which is how
+// resources are matched to the stack.
+func (a *AWSClients) ResourceTags(ctx context.Context, stackID string, tagKeys []string) (map[string]map[string]string, error) {
+	client := resourcegroupstaggingapi.New(a.session)
+	ret := make(map[string]map[string]string)
+	for _, key := range tagKeys {
+		err := client.GetResourcesPagesWithContext(ctx, &resourcegroupstaggingapi.GetResourcesInput{
+			TagFilters: []*resourcegroupstaggingapi.TagFilter{
+				{Key: aws.String("aws:cloudformation:stack-id"), Values: []*string{&stackID}},
+				{Key: aws.String(key)},
+			},
+		}, func(out *resourcegroupstaggingapi.GetResourcesOutput, _ bool) bool {
+			for _, m := range out.ResourceTagMappingList {
+				tags := make(map[string]string, len(m.Tags))
+				for _, t := range m.Tags {
+					tags[emptyOnNil(t.Key)] = emptyOnNil(t.Value)
+				}
+				if logicalID := tags["aws:cloudformation:logical-id"]; logicalID != "" {
+					ret[logicalID] = tags
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to fetch resource tags of %s", stackID)
+		}
+	}
+	return ret, nil
+}
@@ -2,42 +2,166 @@ package cleanup
 
 import (
 	"context"
+	"sort"
 	"sync"
 	"time"
+
+	"github.com/cep21/cfmanage/internal/aimd"
+	"github.com/pkg/errors"
 )
 
 type Job func(ctx context.Context) error
 
+// Phase orders cleanup jobs: every job in a phase finishes before any job of a later phase starts.  Jobs inside a
+// phase run concurrently.
+type Phase int
+
+type job struct {
+	name  string
+	phase Phase
+	run   Job
+}
+
 type Cleanup struct {
 	CleanupTimeout time.Duration
-	OnErr          func(error)
-	mu             sync.Mutex
-	cleaners       []Job
+	// Attempts is how many times a failing job is tried before it is left behind.  Zero means 3.
+	Attempts int
+	// RetryInterval is the smallest backoff between attempts of a job.  Zero means half a second.
+	RetryInterval time.Duration
+	OnErr         func(error)
+	Journal       *Journal
+	mu            sync.Mutex
+	cleaners      []job
+}
+
+func (c *Cleanup) attempts() int {
+	if c.Attempts == 0 {
+		return 3
+	}
+	return c.Attempts
 }
 
-func (c *Cleanup) Add(f Job) {
+func (c *Cleanup) retryInterval() time.Duration {
+	if c.RetryInterval == 0 {
+		return time.Second / 2
+	}
+	return c.RetryInterval
+}
+
+// Add queues f to run during phase when Clean is called.  name describes f in the cleanup report.
+func (c *Cleanup) Add(name string, phase Phase, f Job) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.cleaners = append(c.cleaners, f)
+	c.cleaners = append(c.cleaners, job{
+		name:  name,
+		phase: phase,
+		run:   f,
+	})
+}
+
+// AddRecord journals r before adding f as a job.  Call it before creating the resource r describes: if this process
+// dies before cleaning up, a later run can replay r.  The record is removed from the journal once f succeeds.
+func (c *Cleanup) AddRecord(r Record, phase Phase, f Job) error {
+	if err := c.Journal.Add(&r); err != nil {
+		return err
+	}
+	c.Add(r.Kind+" "+r.String(), phase, func(ctx context.Context) error {
+		if err := f(ctx); err != nil {
+			return err
+		}
+		return c.Journal.Remove(r.ID)
+	})
+	return nil
 }
 
-func (c *Cleanup) Clean() {
+// Result is the outcome of a single cleanup job
+type Result struct {
+	Name     string
+	Phase    Phase
+	Attempts int
+	Error    string `json:",omitempty"`
+	Err      error  `json:"-"`
+}
+
+// Report describes everything a call to Clean did
+type Report struct {
+	Results []Result
+}
+
+// LeftBehind returns the jobs that never succeeded
+func (r *Report) LeftBehind() []Result {
+	ret := make([]Result, 0, len(r.Results))
+	for _, res := range r.Results {
+		if res.Err != nil {
+			ret = append(ret, res)
+		}
+	}
+	return ret
+}
+
+// Clean runs every queued job, phase by phase, and reports what happened.  Jobs are removed from the queue once they
+// run, so calling Clean twice does not repeat work.
+func (c *Cleanup) Clean() *Report {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	ctx, onDone := context.WithTimeout(context.Background(), c.CleanupTimeout)
 	defer onDone()
-	wg := sync.WaitGroup{}
-	for _, cleanJob := range c.cleaners {
-		wg.Add(1)
-		cleanJob := cleanJob
-		go func() {
-			defer wg.Done()
-			if err := cleanJob(ctx); err != nil {
-				if c.OnErr != nil {
-					c.OnErr(err)
+	jobs := c.cleaners
+	c.cleaners = nil
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].phase < jobs[j].phase
+	})
+	ret := &Report{
+		Results: make([]Result, len(jobs)),
+	}
+	for start := 0; start < len(jobs); {
+		end := start
+		for end < len(jobs) && jobs[end].phase == jobs[start].phase {
+			end++
+		}
+		wg := sync.WaitGroup{}
+		for idx := start; idx < end; idx++ {
+			wg.Add(1)
+			idx := idx
+			go func() {
+				defer wg.Done()
+				ret.Results[idx] = c.runJob(ctx, jobs[idx])
+				if ret.Results[idx].Err != nil && c.OnErr != nil {
+					c.OnErr(ret.Results[idx].Err)
 				}
-			}
-		}()
+			}()
+		}
+		wg.Wait()
+		start = end
+	}
+	return ret
+}
+
+func (c *Cleanup) runJob(ctx context.Context, j job) Result {
+	ret := Result{
+		Name:  j.name,
+		Phase: j.phase,
+	}
+	backoff := aimd.Aimd{
+		Min: c.retryInterval(),
+	}
+	for {
+		ret.Attempts++
+		ret.Err = j.run(ctx)
+		if ret.Err == nil {
+			return ret
+		}
+		if ret.Attempts >= c.attempts() {
+			ret.Error = ret.Err.Error()
+			return ret
+		}
+		backoff.OnError()
+		select {
+		case <-ctx.Done():
+			ret.Err = errors.Wrapf(ret.Err, "cleanup timed out after %d attempts", ret.Attempts)
+			ret.Error = ret.Err.Error()
+			return ret
+		case <-time.After(backoff.Get()):
+		}
 	}
-	wg.Wait()
 }
@@ -0,0 +1,225 @@
+package cleanup
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Record is a serializable description of a cleanup job.  It is written to the journal before the resource it cleans
+// up is created, so a later run can finish the job if this process dies first.
+type Record struct {
+	ID      string            `json:"id"`
+	Kind    string            `json:"kind"`
+	Profile string            `json:"profile,omitempty"`
+	Region  string            `json:"region,omitempty"`
+	Role    string            `json:"role,omitempty"`
+	Args    map[string]string `json:"args,omitempty"`
+	Created time.Time         `json:"created"`
+	Pid     int               `json:"pid"`
+	Host    string            `json:"host"`
+}
+
+// Handler executes the cleanup described by a Record
+type Handler func(ctx context.Context, r Record) error
+
+// Journal stores Records as one file per record inside Dir.  Using a file per record means concurrent cfmanage
+// processes can add and remove records without coordinating with each other.
+type Journal struct {
+	Dir string
+}
+
+// DefaultJournalDir is where cfmanage keeps its journal when no directory is given
+func DefaultJournalDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".cfmanage", "journal")
+}
+
+func newRecordID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strings.Replace(time.Now().UTC().Format("20060102150405.000000000"), ".", "", -1)
+	}
+	return hex.EncodeToString(b)
+}
+
+func (j *Journal) enabled() bool {
+	return j != nil && j.Dir != ""
+}
+
+func (j *Journal) filename(id string) string {
+	return filepath.Join(j.Dir, id+".json")
+}
+
+// Add writes r into the journal, filling in any missing bookkeeping fields
+func (j *Journal) Add(r *Record) error {
+	if r.ID == "" {
+		r.ID = newRecordID()
+	}
+	if r.Created.IsZero() {
+		r.Created = time.Now().UTC()
+	}
+	if r.Pid == 0 {
+		r.Pid = os.Getpid()
+	}
+	if r.Host == "" {
+		r.Host, _ = os.Hostname()
+	}
+	if !j.enabled() {
+		return nil
+	}
+	if err := os.MkdirAll(j.Dir, 0700); err != nil {
+		return errors.Wrapf(err, "unable to make journal directory %s", j.Dir)
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal cleanup record")
+	}
+	// Write then rename so a crash never leaves a half written record behind
+	tmp := j.filename(r.ID) + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return errors.Wrapf(err, "unable to write cleanup record %s", tmp)
+	}
+	return errors.Wrapf(os.Rename(tmp, j.filename(r.ID)), "unable to store cleanup record %s", r.ID)
+}
+
+// Sync makes the records already in the journal durable.  It does not wait for anything but the disk, so a process
+// exiting in a hurry can call it and leave the records for the next run to replay.
+func (j *Journal) Sync() error {
+	if !j.enabled() {
+		return nil
+	}
+	d, err := os.Open(j.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "unable to open journal directory %s", j.Dir)
+	}
+	defer d.Close()
+	return errors.Wrapf(d.Sync(), "unable to sync journal directory %s", j.Dir)
+}
+
+// Remove deletes a record from the journal.  Removing a record that does not exist is not an error.
+func (j *Journal) Remove(id string) error {
+	if !j.enabled() {
+		return nil
+	}
+	if err := os.Remove(j.filename(id)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "unable to remove cleanup record %s", id)
+	}
+	return nil
+}
+
+// Records returns every record in the journal, oldest first
+func (j *Journal) Records() ([]Record, error) {
+	if !j.enabled() {
+		return nil, nil
+	}
+	fi, err := ioutil.ReadDir(j.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "unable to read journal directory %s", j.Dir)
+	}
+	ret := make([]Record, 0, len(fi))
+	for _, f := range fi {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(j.Dir, f.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read cleanup record %s", f.Name())
+		}
+		var r Record
+		if err := json.Unmarshal(b, &r); err != nil {
+			return nil, errors.Wrapf(err, "invalid cleanup record %s", f.Name())
+		}
+		ret = append(ret, r)
+	}
+	sort.Slice(ret, func(i, k int) bool {
+		return ret[i].Created.Before(ret[k].Created)
+	})
+	return ret, nil
+}
+
+// String describes where the resource a record cleans up lives
+func (r Record) String() string {
+	ret := r.Profile
+	if r.Region != "" {
+		ret += "/" + r.Region
+	}
+	keys := make([]string, 0, len(r.Args))
+	for k := range r.Args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		ret += " " + k + "=" + r.Args[k]
+	}
+	return ret
+}
+
+// ForeignHostAge is how old a record written on another host, as in a journal on a shared home directory, must be
+// before it is orphaned.  Processes of other hosts cannot be checked, so they are assumed done after running longer
+// than any deploy should.
+const ForeignHostAge = 24 * time.Hour
+
+// Orphaned returns true if the process that wrote this record is no longer running
+func (r *Record) Orphaned() bool {
+	if r.Pid == os.Getpid() {
+		return false
+	}
+	if host, _ := os.Hostname(); host != r.Host {
+		return time.Since(r.Created) > ForeignHostAge
+	}
+	p, err := os.FindProcess(r.Pid)
+	if err != nil {
+		return true
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err != nil && !strings.Contains(err.Error(), "not permitted")
+}
+
+// ReplayResult is the outcome of replaying a single Record
+type ReplayResult struct {
+	Record Record
+	Err    error
+}
+
+// Replay runs handler on every orphaned record in the journal, removing the records handler cleans up without error
+func (j *Journal) Replay(ctx context.Context, handler Handler) ([]ReplayResult, error) {
+	records, err := j.Records()
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]ReplayResult, 0, len(records))
+	for _, r := range records {
+		if !r.Orphaned() {
+			continue
+		}
+		res := ReplayResult{
+			Record: r,
+			Err:    handler(ctx, r),
+		}
+		if res.Err == nil {
+			res.Err = j.Remove(r.ID)
+		}
+		ret = append(ret, res)
+	}
+	return ret, nil
+}
@@ -3,34 +3,32 @@ package cobracmds
 import (
 	"bufio"
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/cep21/cfmanage/internal/awscache"
 	"github.com/cep21/cfmanage/internal/ctxfinder"
 	"github.com/cep21/cfmanage/internal/templatereader"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
-func commonRunCommand(f *ctxfinder.ContextFinder, generateModel func(ctx context.Context, cmd *cobra.Command, args []string) (HumanPrintable, error), useJSON *bool) func(cmd *cobra.Command, args []string) error {
+func commonRunCommand(f *ctxfinder.ContextFinder, generateModel func(ctx context.Context, cmd *cobra.Command, args []string) (HumanPrintable, error), output *outputFormat) func(cmd *cobra.Command, args []string) error {
 	return func(cmd *cobra.Command, args []string) error {
 		ctx := f.Ctx()
 		data, err := generateModel(ctx, cmd, args)
 		if err != nil {
 			return errors.Wrap(err, "unable to load data for templates")
 		}
-		return display(cmd.OutOrStdout(), useJSON, data)
+		return display(cmd.OutOrStdout(), output, data)
 	}
 }
 
-func display(out io.Writer, useJSON *bool, data HumanPrintable) error {
-	if *useJSON {
-		return json.NewEncoder(out).Encode(data)
-	}
-	return data.HumanReadable(out)
+func display(out io.Writer, output *outputFormat, data HumanPrintable) error {
+	return output.get().Format(out, data)
 }
 
 type HumanPrintable interface {
@@ -67,6 +65,15 @@ func emptyOnNil(s *string) string {
 	return *s
 }
 
+// stackKey identifies a stack across accounts and regions
+func stackKey(ses *awscache.AWSClients, stackName string) (string, error) {
+	accountID, err := ses.AccountID()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%s/%s", accountID, ses.Region(), stackName), nil
+}
+
 func validateTemplateParam(tfinder *templatereader.TemplateFinder) func(*cobra.Command, []string) error {
 	return func(_ *cobra.Command, args []string) error {
 		if len(args) != 2 {
@@ -82,29 +89,159 @@ func validateTemplateParam(tfinder *templatereader.TemplateFinder) func(*cobra.C
 	}
 }
 
+// lineReader reads lines from an input in a single goroutine, so a prompt abandoned on cancel does not swallow the
+// answer to the next one.  Each RootCommand has its own: the first prompt starts it, and it stops when the command exits.
+type lineReader struct {
+	in       io.Reader
+	lines    chan string
+	done     chan struct{}
+	start    sync.Once
+	stopOnce sync.Once
+}
+
+func newLineReader(in io.Reader) *lineReader {
+	return &lineReader{
+		in:    in,
+		lines: make(chan string),
+		done:  make(chan struct{}),
+	}
+}
+
+func (l *lineReader) read() {
+	defer close(l.lines)
+	r := bufio.NewReader(l.in)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		select {
+		case l.lines <- line:
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// stop ends reading.  A read already blocked on the input ends once it returns, dropping its line.
+func (l *lineReader) stop() {
+	if l == nil {
+		return
+	}
+	l.stopOnce.Do(func() {
+		close(l.done)
+	})
+}
+
+// readLine returns the next line of input, or false if the input ended, the reader stopped or cancel closed first.
+// A nil lineReader has no input.
+func (l *lineReader) readLine(cancel <-chan struct{}) (string, bool) {
+	if l == nil {
+		return "", false
+	}
+	select {
+	case <-l.done:
+		return "", false
+	default:
+	}
+	l.start.Do(func() {
+		go l.read()
+	})
+	select {
+	case line, ok := <-l.lines:
+		return line, ok
+	case <-l.done:
+		return "", false
+	case <-cancel:
+		return "", false
+	}
+}
+
 // confirm displays a prompt `s` to the user and returns a bool indicating yes / no
-// If the lowercased, trimmed input begins with anything other than 'y', it returns false
+// Only y or yes (in any case) confirm: anything else returns false
 // It accepts an int `tries` representing the number of attempts before returning false
-func confirm(in io.Reader, out io.Writer, prompt string, tries int, _ <-chan struct{}) bool { //nolint: unparam
-	r := bufio.NewReader(in)
-
+// Closing cancel aborts the prompt, returning false
+func confirm(in *lineReader, out io.Writer, prompt string, tries int, cancel <-chan struct{}) bool {
 	for ; tries > 0; tries-- {
 		if _, err := fmt.Fprintf(out, "%s [y/n]: ", prompt); err != nil {
 			return false
 		}
 
-		res, err := r.ReadString('\n')
-		if err != nil {
+		res, ok := in.readLine(cancel)
+		if !ok {
 			return false
 		}
 
 		// Empty input (i.e. "\n")
-		if len(res) < 2 {
+		answer := strings.ToLower(strings.TrimSpace(res))
+		if answer == "" {
 			continue
 		}
 
-		return strings.ToLower(strings.TrimSpace(res))[0] == 'y'
+		return answer == "y" || answer == "yes"
 	}
 
 	return false
 }
+
+// choose asks the user to pick one of choices, matching the answer against their first letters.  It returns false if
+// no valid answer was given or cancel closed.
+func choose(in *lineReader, out io.Writer, prompt string, choices []string, tries int, cancel <-chan struct{}) (string, bool) {
+	options := make([]string, 0, len(choices))
+	for _, c := range choices {
+		options = append(options, "["+c[:1]+"]"+c[1:])
+	}
+	for ; tries > 0; tries-- {
+		if _, err := fmt.Fprintf(out, "%s %s: ", prompt, strings.Join(options, "/")); err != nil {
+			return "", false
+		}
+		res, ok := in.readLine(cancel)
+		if !ok {
+			return "", false
+		}
+		answer := strings.ToLower(strings.TrimSpace(res))
+		for _, c := range choices {
+			if answer != "" && (answer == c || answer == c[:1]) {
+				return c, true
+			}
+		}
+	}
+	return "", false
+}
+
+// typedConfirm makes the user type `expected` to proceed, for changes that are hard to undo
+func typedConfirm(in *lineReader, out io.Writer, prompt string, expected string, tries int, cancel <-chan struct{}) bool {
+	for ; tries > 0; tries-- {
+		if _, err := fmt.Fprintf(out, "%s\nType %s to proceed: ", prompt, expected); err != nil {
+			return false
+		}
+		res, ok := in.readLine(cancel)
+		if !ok {
+			return false
+		}
+		if strings.TrimSpace(res) == expected {
+			return true
+		}
+		if _, err := fmt.Fprintf(out, "%q does not match\n", strings.TrimSpace(res)); err != nil {
+			return false
+		}
+	}
+	return false
+}
+
+// ask prompts for a value until a non empty one is given.  It returns false if none was given or cancel closed.
+func ask(in *lineReader, out io.Writer, prompt string, tries int, cancel <-chan struct{}) (string, bool) {
+	for ; tries > 0; tries-- {
+		if _, err := fmt.Fprintf(out, "%s: ", prompt); err != nil {
+			return "", false
+		}
+		res, ok := in.readLine(cancel)
+		if !ok {
+			return "", false
+		}
+		if answer := strings.TrimSpace(res); answer != "" {
+			return answer, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,59 @@
+package cobracmds
+
+import (
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestLineReaderKeepsAbandonedAnswers(t *testing.T) {
+	r, w := io.Pipe()
+	defer func() {
+		_ = w.Close()
+	}()
+	in := newLineReader(r)
+	defer in.stop()
+
+	cancel := make(chan struct{})
+	close(cancel)
+	if _, ok := in.readLine(cancel); ok {
+		t.Fatal("read a line after cancel")
+	}
+	go func() {
+		_, _ = io.WriteString(w, "yes\n")
+	}()
+	// The answer typed after a prompt was cancelled goes to the next prompt
+	if !confirm(in, ioutil.Discard, "Proceed", 1, nil) {
+		t.Fatal("next prompt did not get the answer")
+	}
+}
+
+func TestLineReaderStop(t *testing.T) {
+	r, w := io.Pipe()
+	defer func() {
+		_ = w.Close()
+	}()
+	in := newLineReader(r)
+	answered := make(chan bool, 1)
+	go func() {
+		_, ok := in.readLine(nil)
+		answered <- ok
+	}()
+	in.stop()
+	select {
+	case ok := <-answered:
+		if ok {
+			t.Fatal("read a line after stop")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stop did not end a prompt")
+	}
+	// Stopping twice, or a nil reader, is fine
+	in.stop()
+	var none *lineReader
+	none.stop()
+	if _, ok := none.readLine(nil); ok {
+		t.Fatal("nil reader read a line")
+	}
+}
@@ -0,0 +1,115 @@
+package cobracmds
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/cep21/cfmanage/internal/awscache"
+	"github.com/cep21/cfmanage/internal/templatereader"
+)
+
+// compareStatus is the status of a stack found by comparing its deployed template, parameters and tags with the
+// rendered input.  Unlike a changeset it makes no writes to AWS, but cannot tell what the differences would change.
+func compareStatus(ctx context.Context, ses *awscache.AWSClients, t string, fname string, in *templatereader.ChangesetInput, stack *cloudformation.Stack) stackStatus {
+	ret := stackStatus{
+		Template:       t,
+		StackFileName:  fname,
+		StackName:      *in.StackName,
+		AccountID:      readable(ses.AccountID()),
+		Region:         ses.Region(),
+		changesetInput: in,
+		cfStack:        stack,
+	}
+	if stack == nil {
+		ret.StackStatus = "--DOES NOT EXIST--"
+		ret.ChangesetStatus = "not deployed"
+		return ret
+	}
+	ret.StackStatus = emptyOnNil(stack.StackStatus)
+	ret.Description = emptyOnNil(stack.Description)
+	ret.LastUpdated = emptyOnNilTime(stack.LastUpdatedTime)
+	var diffs []string
+	if in.TemplateBody == nil {
+		diffs = append(diffs, "template unknown (uses a template URL)")
+	} else {
+		deployed, err := ses.DeployedTemplate(ctx, *in.StackName)
+		if err != nil {
+			ret.ChangesetError = err
+			ret.ChangesetStatus = err.Error()
+			return ret
+		}
+		if !sameTemplate(deployed, *in.TemplateBody) {
+			diffs = append(diffs, "template differs")
+		}
+	}
+	if keys := differentParameters(in.Parameters, stack.Parameters); len(keys) != 0 {
+		diffs = append(diffs, "params differ: "+strings.Join(keys, ", "))
+	}
+	if !sameTags(in.Tags, stack.Tags) {
+		diffs = append(diffs, "tags differ")
+	}
+	if len(diffs) == 0 {
+		ret.ChangesetStatus = "in sync"
+	} else {
+		ret.ChangesetStatus = strings.Join(diffs, "; ")
+	}
+	return ret
+}
+
+// sameTemplate compares JSON templates by value and other templates by text, ignoring trailing whitespace
+func sameTemplate(a string, b string) bool {
+	var aj, bj interface{}
+	if json.Unmarshal([]byte(a), &aj) == nil && json.Unmarshal([]byte(b), &bj) == nil {
+		return reflect.DeepEqual(aj, bj)
+	}
+	return normalizeText(a) == normalizeText(b)
+}
+
+func normalizeText(s string) string {
+	lines := strings.Split(strings.Replace(s, "\r\n", "\n", -1), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " \t")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// differentParameters returns the keys of parameters the input sets to a value other than the deployed one.
+// Parameters that keep their previous value, and NoEcho parameters whose deployed value is masked, are not compared.
+func differentParameters(input []*cloudformation.Parameter, deployed []*cloudformation.Parameter) []string {
+	deployedValues := make(map[string]string, len(deployed))
+	for _, p := range deployed {
+		deployedValues[emptyOnNil(p.ParameterKey)] = emptyOnNil(p.ParameterValue)
+	}
+	var ret []string
+	for _, p := range input {
+		if p.UsePreviousValue != nil && *p.UsePreviousValue {
+			continue
+		}
+		key := emptyOnNil(p.ParameterKey)
+		value, exists := deployedValues[key]
+		if exists && value == "****" {
+			continue
+		}
+		if !exists || value != emptyOnNil(p.ParameterValue) {
+			ret = append(ret, key)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func tagSet(tags []*cloudformation.Tag) map[string]string {
+	ret := make(map[string]string, len(tags))
+	for _, t := range tags {
+		ret[emptyOnNil(t.Key)] = emptyOnNil(t.Value)
+	}
+	return ret
+}
+
+func sameTags(a []*cloudformation.Tag, b []*cloudformation.Tag) bool {
+	return reflect.DeepEqual(tagSet(a), tagSet(b))
+}
@@ -0,0 +1,126 @@
+package cobracmds
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/cep21/cfmanage/internal/templatereader"
+)
+
+func testParam(key string, value string) *cloudformation.Parameter {
+	return &cloudformation.Parameter{
+		ParameterKey:   aws.String(key),
+		ParameterValue: aws.String(value),
+	}
+}
+
+func TestDifferentParameters(t *testing.T) {
+	deployed := []*cloudformation.Parameter{
+		testParam("Env", "prod"),
+		testParam("Size", "large"),
+		testParam("Password", "****"),
+		testParam("Kept", "old"),
+		testParam("Removed", "x"),
+	}
+	tests := []struct {
+		name  string
+		input []*cloudformation.Parameter
+		want  []string
+	}{
+		{
+			name:  "same",
+			input: []*cloudformation.Parameter{testParam("Env", "prod"), testParam("Size", "large")},
+		},
+		{
+			name:  "changed and new values, sorted",
+			input: []*cloudformation.Parameter{testParam("Size", "small"), testParam("New", "1"), testParam("Env", "prod")},
+			want:  []string{"New", "Size"},
+		},
+		{
+			name:  "NoEcho values are masked, so never compared",
+			input: []*cloudformation.Parameter{testParam("Password", "hunter2")},
+		},
+		{
+			name:  "previous values are kept",
+			input: []*cloudformation.Parameter{{ParameterKey: aws.String("Kept"), UsePreviousValue: aws.Bool(true)}},
+		},
+		{
+			name:  "an empty value differs",
+			input: []*cloudformation.Parameter{testParam("Env", "")},
+			want:  []string{"Env"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := differentParameters(tc.input, deployed); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("different parameters %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSameTemplate(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		same bool
+	}{
+		{name: "json by value", a: `{"Resources": {"A": {}, "B": {}}}`, b: "{\n  \"Resources\": {\"B\": {}, \"A\": {}}\n}", same: true},
+		{name: "json values differ", a: `{"Resources": {"A": {"Type": "x"}}}`, b: `{"Resources": {"A": {"Type": "y"}}}`},
+		{name: "yaml trailing whitespace", a: "Resources:  \r\n  A: {}\n\n", b: "Resources:\n  A: {}", same: true},
+		{name: "yaml indentation matters", a: "Resources:\n  A: {}", b: "Resources:\n    A: {}"},
+		{name: "json against yaml", a: `{"Resources": {}}`, b: "Resources: {}"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := sameTemplate(tc.a, tc.b); got != tc.same {
+				t.Fatalf("sameTemplate is %t, want %t", got, tc.same)
+			}
+		})
+	}
+}
+
+func TestSameTags(t *testing.T) {
+	tag := func(k string, v string) *cloudformation.Tag {
+		return &cloudformation.Tag{Key: aws.String(k), Value: aws.String(v)}
+	}
+	if !sameTags([]*cloudformation.Tag{tag("a", "1"), tag("b", "2")}, []*cloudformation.Tag{tag("b", "2"), tag("a", "1")}) {
+		t.Fatal("tags in another order differ")
+	}
+	if sameTags([]*cloudformation.Tag{tag("a", "1")}, []*cloudformation.Tag{tag("a", "2")}) {
+		t.Fatal("tag values are not compared")
+	}
+	if sameTags([]*cloudformation.Tag{tag("a", "1")}, nil) {
+		t.Fatal("a removed tag is not a difference")
+	}
+	if !sameTags(nil, []*cloudformation.Tag{}) {
+		t.Fatal("no tags differ from no tags")
+	}
+}
+
+func TestComparedStatusCategory(t *testing.T) {
+	in := &templatereader.ChangesetInput{}
+	tests := []struct {
+		status  string
+		stack   *cloudformation.Stack
+		wantCat string
+	}{
+		{status: "in sync", stack: &cloudformation.Stack{}, wantCat: categoryInSync},
+		{status: "template differs; tags differ", stack: &cloudformation.Stack{}, wantCat: categoryChanged},
+		{status: "not deployed", wantCat: categoryChanged},
+		{status: "unable to describe stack", wantCat: categoryError},
+	}
+	for _, tc := range tests {
+		st := stackStatus{
+			ChangesetStatus: tc.status,
+			changesetInput:  in,
+			cfStack:         tc.stack,
+		}
+		if got := st.category(); got != tc.wantCat {
+			t.Fatalf("%q is %s, want %s", tc.status, got, tc.wantCat)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package cobracmds
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/cep21/cfmanage/internal/formatter"
+)
+
+// statefulResourceTypes hold data that is lost when CloudFormation replaces them
+var statefulResourceTypes = map[string]struct{}{
+	"AWS::Cognito::UserPool":               {},
+	"AWS::DocDB::DBCluster":                {},
+	"AWS::DocDB::DBInstance":               {},
+	"AWS::DynamoDB::Table":                 {},
+	"AWS::EC2::Volume":                     {},
+	"AWS::EFS::FileSystem":                 {},
+	"AWS::ElastiCache::CacheCluster":       {},
+	"AWS::ElastiCache::ReplicationGroup":   {},
+	"AWS::Elasticsearch::Domain":           {},
+	"AWS::Kinesis::Stream":                 {},
+	"AWS::KinesisFirehose::DeliveryStream": {},
+	"AWS::KMS::Key":                        {},
+	"AWS::Logs::LogGroup":                  {},
+	"AWS::Neptune::DBCluster":              {},
+	"AWS::Neptune::DBInstance":             {},
+	"AWS::RDS::DBCluster":                  {},
+	"AWS::RDS::DBInstance":                 {},
+	"AWS::Redshift::Cluster":               {},
+	"AWS::S3::Bucket":                      {},
+	"AWS::SecretsManager::Secret":          {},
+	"AWS::SQS::Queue":                      {},
+}
+
+// destructiveChange is a change that deletes a resource, or replaces (or may replace) one that holds data
+type destructiveChange struct {
+	LogicalID    string
+	PhysicalID   string
+	ResourceType string
+	Reason       string
+}
+
+func destructiveChanges(changes []*cloudformation.Change) []destructiveChange {
+	var ret []destructiveChange
+	for _, c := range changes {
+		rc := c.ResourceChange
+		if rc == nil {
+			continue
+		}
+		reason := ""
+		resourceType := emptyOnNil(rc.ResourceType)
+		_, stateful := statefulResourceTypes[resourceType]
+		switch {
+		case emptyOnNil(rc.Action) == cloudformation.ChangeActionRemove:
+			reason = "deleted"
+		case stateful && emptyOnNil(rc.Replacement) == cloudformation.ReplacementTrue:
+			reason = "replaced: its data is lost"
+		case stateful && emptyOnNil(rc.Replacement) == cloudformation.ReplacementConditional:
+			// CloudFormation only knows once it updates the resource: confirm as if it will
+			reason = "may replace: its data may be lost"
+		}
+		if reason == "" {
+			continue
+		}
+		ret = append(ret, destructiveChange{
+			LogicalID:    emptyOnNil(rc.LogicalResourceId),
+			PhysicalID:   emptyOnNil(rc.PhysicalResourceId),
+			ResourceType: resourceType,
+			Reason:       reason,
+		})
+	}
+	return ret
+}
+
+func printDestructive(out io.Writer, changes []destructiveChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintf(out, "!!! DESTRUCTIVE CHANGES: %d resources are deleted or replaced !!!\n", len(changes)); err != nil {
+		return err
+	}
+	renderTable(out, destructiveTable(changes))
+	return nil
+}
+
+func destructiveTable(changes []destructiveChange) formatter.Table {
+	ret := formatter.Table{
+		Title:  "Destructive changes",
+		Header: []string{"Logical ID", "Physical ID", "Resource type", "Reason"},
+	}
+	for _, c := range changes {
+		ret.Rows = append(ret.Rows, []string{c.LogicalID, c.PhysicalID, c.ResourceType, c.Reason})
+	}
+	return ret
+}
@@ -0,0 +1,41 @@
+package cobracmds
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+func testResourceChange(action string, logicalID string, resourceType string, replacement string) *cloudformation.Change {
+	return &cloudformation.Change{
+		ResourceChange: &cloudformation.ResourceChange{
+			Action:            aws.String(action),
+			LogicalResourceId: aws.String(logicalID),
+			ResourceType:      aws.String(resourceType),
+			Replacement:       aws.String(replacement),
+		},
+	}
+}
+
+func TestDestructiveChanges(t *testing.T) {
+	got := destructiveChanges([]*cloudformation.Change{
+		testResourceChange(cloudformation.ChangeActionRemove, "Topic", "AWS::SNS::Topic", ""),
+		testResourceChange(cloudformation.ChangeActionModify, "Database", "AWS::RDS::DBInstance", cloudformation.ReplacementTrue),
+		testResourceChange(cloudformation.ChangeActionModify, "Table", "AWS::DynamoDB::Table", cloudformation.ReplacementConditional),
+		testResourceChange(cloudformation.ChangeActionModify, "Bucket", "AWS::S3::Bucket", cloudformation.ReplacementFalse),
+		// Replacing what holds no data is not destructive
+		testResourceChange(cloudformation.ChangeActionModify, "Function", "AWS::Lambda::Function", cloudformation.ReplacementTrue),
+		testResourceChange(cloudformation.ChangeActionModify, "Role", "AWS::IAM::Role", cloudformation.ReplacementConditional),
+		testResourceChange(cloudformation.ChangeActionAdd, "Queue", "AWS::SQS::Queue", ""),
+	})
+	want := []destructiveChange{
+		{LogicalID: "Topic", ResourceType: "AWS::SNS::Topic", Reason: "deleted"},
+		{LogicalID: "Database", ResourceType: "AWS::RDS::DBInstance", Reason: "replaced: its data is lost"},
+		{LogicalID: "Table", ResourceType: "AWS::DynamoDB::Table", Reason: "may replace: its data may be lost"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("destructive changes\n%v\nwant\n%v", got, want)
+	}
+}
@@ -5,17 +5,18 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"os/signal"
 	"strings"
-	"syscall"
+	"time"
 
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/cep21/cfmanage/internal/awscache"
 	"github.com/cep21/cfmanage/internal/cleanup"
 	"github.com/cep21/cfmanage/internal/ctxfinder"
+	"github.com/cep21/cfmanage/internal/dashboard"
+	"github.com/cep21/cfmanage/internal/deployhistory"
+	"github.com/cep21/cfmanage/internal/formatter"
 	"github.com/cep21/cfmanage/internal/logger"
 	"github.com/cep21/cfmanage/internal/templatereader"
-	"github.com/olekukonko/tablewriter"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"golang.org/x/sync/errgroup"
@@ -26,10 +27,79 @@ type executeCommand struct {
 	T             *templatereader.TemplateFinder
 	Ctx           *templatereader.CreateChangeSetTemplate
 	Logger        *logger.Logger
-	JSON          *bool
+	Output        *outputFormat
 	ContextFinder *ctxfinder.ContextFinder
 	Cleanup       *cleanup.Cleanup
-	autoConfirm   bool
+	Locks         *stackLocks
+	History       *stackHistory
+	Policies      *stackPolicies
+	Notify        *stackNotifications
+	Hooks         *stackHooks
+	// Input answers prompts
+	Input            *lineReader
+	autoConfirm      bool
+	overridePolicy   string
+	allowDestructive bool
+	deployTimeout    time.Duration
+	idleTimeout      time.Duration
+	detach           bool
+	outputsDir       string
+	rolloutStrategy  string
+	live             bool
+	// clock times out stack updates.  Defaults to the system clock.
+	clock clock
+}
+
+// deployOptions control how a changeset is confirmed, executed and recorded
+// clock is the time.Now and time.After that deploy timeouts use, so tests can move time forward
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (s *executeCommand) getClock() clock {
+	if s.clock == nil {
+		return systemClock{}
+	}
+	return s.clock
+}
+
+type deployOptions struct {
+	AutoConfirm bool
+	// OverridePolicy is the reason to execute despite blocking policy violations
+	OverridePolicy string
+	// AllowDestructive lets AutoConfirm execute changesets that delete resources or replace stateful ones
+	AllowDestructive bool
+	// DeployTimeout, if not zero, cancels the stack update once it runs this long
+	DeployTimeout time.Duration
+	// IdleTimeout, if not zero, cancels the stack update once no stack events arrive for this long
+	IdleTimeout time.Duration
+	// Detach returns once the changeset starts executing, leaving the update running
+	Detach bool
+	// Source is recorded in the deployment history
+	Source string
+	// RollbackTo is the ID of the deployment a rollback restores, recorded in the deployment history
+	RollbackTo string
+	// OutputsDir, if set, is where the outputs of the stack are written once it is up to date
+	OutputsDir string
+	// Progress, if set, is told what the deploy is doing, for live output
+	Progress func(phase string, detail string)
+}
+
+func (o deployOptions) report(phase string, detail string) {
+	if o.Progress != nil {
+		o.Progress(phase, detail)
+	}
 }
 
 func (s *executeCommand) Cobra() *cobra.Command {
@@ -41,6 +111,14 @@ func (s *executeCommand) Cobra() *cobra.Command {
 		RunE:      s.commandRun,
 	}
 	cmd.Flags().BoolVarP(&s.autoConfirm, "auto", "a", false, "Will auto confirm the cloudformation change")
+	cmd.Flags().BoolVar(&s.allowDestructive, "allow-destructive", false, "Let --auto execute changesets that delete resources or replace stateful ones")
+	cmd.Flags().StringVar(&s.overridePolicy, "override-policy", "", "Execute despite blocking policy violations.  The value is the reason, recorded in the deployment history")
+	cmd.Flags().DurationVar(&s.deployTimeout, "deploy-timeout", 0, "If non zero, cancel the stack update if it runs longer than this, then follow the rollback")
+	cmd.Flags().DurationVar(&s.idleTimeout, "idle-timeout", 0, "If non zero, cancel the stack update if no stack events arrive for this long, then follow the rollback")
+	cmd.Flags().BoolVar(&s.detach, "detach", false, "Exit once the changeset starts executing instead of following it.  Follow it later with watch")
+	cmd.Flags().StringVar(&s.outputsDir, "outputs-dir", "", "If set, write the outputs of the stack to STACK.json and STACK.env in this directory once it is up to date")
+	cmd.Flags().StringVar(&s.rolloutStrategy, "rollout", "", "Order of deploying a params file with targets: serial, parallel or canary.  Defaults to the rollout of the params file")
+	cmd.Flags().BoolVar(&s.live, "live", true, "Show each target's progress as it happens when --auto deploys several targets to a terminal")
 	cmd.Args = validateTemplateParam(s.T)
 	return cmd
 }
@@ -55,42 +133,171 @@ func (s *executeCommand) commandRun(cmd *cobra.Command, args []string) error {
 		return errors.Wrap(err, "unable to validate params")
 	}
 	ctx := s.ContextFinder.Ctx()
-	data, err := s.modelPhase1(ctx, template, params)
+	fname := s.T.ParameterFilename(template, params)
+	in, err := templatereader.LoadCreateChangeSet(fname, s.Ctx, s.Logger)
+	if err != nil {
+		return errors.Wrap(err, "unable to load params")
+	}
+	opts := deployOptions{
+		AutoConfirm:      s.autoConfirm,
+		OverridePolicy:   s.overridePolicy,
+		AllowDestructive: s.allowDestructive,
+		DeployTimeout:    s.deployTimeout,
+		IdleTimeout:      s.idleTimeout,
+		Detach:           s.detach,
+		Source:           deployhistory.SourceExecute,
+		OutputsDir:       s.outputsDir,
+	}
+	if len(in.Targets) != 0 {
+		return s.rollout(ctx, cmd, template, fname, in, opts)
+	}
+	ctx, unlock, err := s.Locks.lock(ctx, s.T.BaseDir, in)
+	if err != nil {
+		return errors.Wrap(err, "unable to lock stack")
+	}
+	defer unlock()
+	return s.deploy(ctx, cmd, template, params, opts)
+}
+
+// deploy creates a changeset for a stack, displays it, and executes it once confirmed
+func (s *executeCommand) deploy(ctx context.Context, cmd *cobra.Command, template string, params string, opts deployOptions) error {
+	fname := s.T.ParameterFilename(template, params)
+	in, err := templatereader.LoadCreateChangeSet(fname, s.Ctx, s.Logger)
+	if err != nil {
+		return errors.Wrap(err, "unable to load params")
+	}
+	return s.deployInput(ctx, cmd, template, fname, in, opts)
+}
+
+// deployInput is deploy for an already loaded params file
+func (s *executeCommand) deployInput(ctx context.Context, cmd *cobra.Command, template string, fname string, in *templatereader.ChangesetInput, opts deployOptions) error {
+	data, err := s.modelPhase1(ctx, cmd.ErrOrStderr(), template, fname, in, opts.Progress)
 	if err != nil {
 		return errors.Wrap(err, "unable to load data for templates")
 	}
-	if data.StackStatus != "CREATE_COMPLETE" && data.StackStatus != "UPDATE_COMPLETE" && data.StackStatus != "UPDATE_ROLLBACK_COMPLETE" && data.StackStatus != "--DOES NOT EXIST--" {
+	if data.stackSet != nil {
+		return s.deployStackSet(ctx, cmd, data, opts)
+	}
+	return s.confirmAndExecute(ctx, cmd, data, opts)
+}
+
+// confirmAndExecute displays a created changeset and executes it once confirmed, recording the deployment after
+func (s *executeCommand) confirmAndExecute(ctx context.Context, cmd *cobra.Command, data *inspectCommandModel, opts deployOptions) error {
+	if !isDeployable(data.StackStatus) {
 		return fmt.Errorf("unable to create stack.  Status: %s", data.StackStatus)
 	}
-	if err := display(cmd.OutOrStdout(), s.JSON, data); err != nil {
+	if err := s.Policies.evaluate(ctx, data, opts.AutoConfirm); err != nil {
 		return err
 	}
-	if len(data.Changes) == 0 {
-		return display(cmd.OutOrStdout(), s.JSON, printableString("no changes\n"))
+	if err := display(cmd.OutOrStdout(), s.Output, data); err != nil {
+		return err
 	}
-	if !s.autoConfirm {
-		if !confirm(os.Stdin, cmd.OutOrStdout(), "Execute this cloudformation", 3, nil) {
-			return nil
+	if len(data.Changes) == 0 {
+		if err := display(cmd.OutOrStdout(), s.Output, printableString("no changes\n")); err != nil {
+			return err
 		}
+		return s.saveOutputs(ctx, data, opts)
+	}
+	if err := checkOverride(data, opts.OverridePolicy); err != nil {
+		return err
+	}
+	notifier, err := s.Notify.notifier(data.changesetInput)
+	if err != nil {
+		return err
+	}
+	lifecycle, err := s.Hooks.load(data.changesetInput)
+	if err != nil {
+		return err
+	}
+	if ok, err := s.confirmExecute(ctx, cmd.OutOrStdout(), data, opts); !ok {
+		return err
+	}
+	if err := s.Hooks.beforeExecute(ctx, cmd.ErrOrStderr(), lifecycle, data); err != nil {
+		return errors.Wrapf(err, "not executing %s", data.StackName)
+	}
+	if err := heldLock(ctx).Err(); err != nil {
+		return errors.Wrapf(err, "not executing %s", data.StackName)
+	}
+
+	s.History.recordBaseline(ctx, data.changesetInput)
+	run := s.History.start(ctx, data, s.T.BaseDir, opts)
+	s.Notify.started(notifier, data, opts.Source)
+	start := time.Now()
+	opts.report(dashboard.PhaseExecuting, emptyOnNil(data.changeset.ChangeSetName))
+	err = s.modelPhase2(ctx, cmd.OutOrStdout(), data, opts, func(e *cloudformation.StackEvent) {
+		run.addEvent(e)
+		opts.report(dashboard.PhaseExecuting, emptyOnNil(e.LogicalResourceId)+" "+emptyOnNil(e.ResourceStatus))
+	})
+	s.History.finish(run, opts.Source, err)
+	if err == errDetached {
+		// The deploy has not finished, so there is nothing to tell the webhooks yet
+		return nil
+	}
+	s.Notify.finished(notifier, data, opts.Source, start, err)
+	if err := s.Hooks.afterDeploy(cmd.ErrOrStderr(), lifecycle, data, err); err != nil {
+		return err
+	}
+	return s.saveOutputs(ctx, data, opts)
+}
+
+// isDeployable is true for the stack statuses a changeset can be executed from
+func isDeployable(status string) bool {
+	switch status {
+	case "CREATE_COMPLETE", "UPDATE_COMPLETE", "UPDATE_ROLLBACK_COMPLETE", "IMPORT_COMPLETE", "IMPORT_ROLLBACK_COMPLETE", "--DOES NOT EXIST--":
+		return true
+	}
+	return false
+}
+
+// saveOutputs writes the outputs of a stack that is up to date to opts.OutputsDir
+func (s *executeCommand) saveOutputs(ctx context.Context, data *inspectCommandModel, opts deployOptions) error {
+	if opts.OutputsDir == "" {
+		return nil
 	}
+	return errors.Wrapf(writeOutputs(ctx, s.AWSCache, data.changesetInput, opts.OutputsDir), "%s is up to date, but its outputs could not be written", data.StackName)
+}
 
-	return s.modelPhase2(ctx, cmd.OutOrStdout(), data)
+// confirmExecute asks before executing a changeset.  Destructive changesets need the stack name typed out, and are
+// refused with AutoConfirm unless AllowDestructive is set.  A prompt aborted by ctx is an error, not a refusal.
+func (s *executeCommand) confirmExecute(ctx context.Context, out io.Writer, data *inspectCommandModel, opts deployOptions) (bool, error) {
+	var ok bool
+	switch {
+	case opts.AutoConfirm && (len(data.Destructive) == 0 || opts.AllowDestructive):
+		return true, nil
+	case opts.AutoConfirm:
+		return false, errors.Errorf("refusing to auto confirm %d destructive changes to %s without --allow-destructive", len(data.Destructive), data.StackName)
+	case len(data.Destructive) == 0:
+		ok = confirm(s.Input, out, "Execute this cloudformation", 3, ctx.Done())
+	default:
+		prompt := fmt.Sprintf("This deletes or replaces %d resources of %s.", len(data.Destructive), data.StackName)
+		ok = typedConfirm(s.Input, out, prompt, data.StackName, 3, ctx.Done())
+	}
+	if !ok && ctx.Err() != nil {
+		return false, errors.Wrapf(ctx.Err(), "not executing %s", data.StackName)
+	}
+	return ok, nil
 }
 
-func (s *executeCommand) modelPhase1(ctx context.Context, template string, params string) (*inspectCommandModel, error) {
-	stats, err := populateInspectCommand(ctx, s.Ctx, s.Logger, s.AWSCache, s.T, template, params)
+// modelPhase1 creates the changeset of a stack, running its preChangeset hooks first with their output sent to hookOut
+func (s *executeCommand) modelPhase1(ctx context.Context, hookOut io.Writer, template string, fname string, in *templatereader.ChangesetInput, progress func(phase string, detail string)) (*inspectCommandModel, error) {
+	stat, err := populateStatusFromInput(ctx, s.Logger, s.AWSCache, template, fname, in, &statusOptions{
+		beforeChangeset: s.Hooks.beforeChangeset(hookOut),
+		progress:        progress,
+	})
 	if err != nil {
 		return nil, err
 	}
-	return stats, nil
+	return inspectFromStatus(stat)
 }
 
 type stackEvent struct {
-	LogicalResourceID    string `json:",omitempty"`
-	PhysicalResourceID   string `json:",omitempty"`
-	ResourceStatus       string `json:",omitempty"`
-	ResourceStatusReason string `json:",omitempty"`
-	ResourceType         string `json:",omitempty"`
+	Timestamp            *time.Time `json:",omitempty"`
+	StackName            string     `json:",omitempty"`
+	LogicalResourceID    string     `json:",omitempty"`
+	PhysicalResourceID   string     `json:",omitempty"`
+	ResourceStatus       string     `json:",omitempty"`
+	ResourceStatusReason string     `json:",omitempty"`
+	ResourceType         string     `json:",omitempty"`
 }
 
 type printableString string
@@ -100,15 +307,32 @@ func (p printableString) HumanReadable(out io.Writer) error {
 	return err
 }
 
+func (p printableString) Tables() []formatter.Table {
+	return []formatter.Table{
+		{
+			Header: []string{"Message"},
+			Rows:   [][]string{{strings.TrimSpace(string(p))}},
+		},
+	}
+}
+
 func (s *stackEvent) HumanReadable(out io.Writer) error {
-	table4 := tablewriter.NewWriter(out)
-	table4.SetHeader([]string{"LogicalResourceID", "PhysicalResourceID", "ResourceStatus", "ResourceStatusReason", "ResourceType"})
-	table4.Append([]string{s.LogicalResourceID, s.PhysicalResourceID, s.ResourceStatus, s.ResourceStatusReason, s.ResourceType})
-	table4.Render()
+	renderTable(out, s.Tables()[0])
 	return nil
 }
 
-func (s *executeCommand) printStackEvents(ctx context.Context, out io.Writer, in chan *cloudformation.StackEvent) error {
+// Tables of each event have the same header, so events streamed as csv or markdown make one table
+func (s *stackEvent) Tables() []formatter.Table {
+	return []formatter.Table{
+		{
+			Header: []string{"LogicalResourceID", "PhysicalResourceID", "ResourceStatus", "ResourceStatusReason", "ResourceType"},
+			Rows:   [][]string{{s.LogicalResourceID, s.PhysicalResourceID, s.ResourceStatus, s.ResourceStatusReason, s.ResourceType}},
+		},
+	}
+}
+
+// printStackEvents displays every event sent to in, passing it to onEvent first if onEvent is not nil
+func (s *executeCommand) printStackEvents(ctx context.Context, out io.Writer, in chan *cloudformation.StackEvent, onEvent func(*cloudformation.StackEvent)) error {
 	for {
 		select {
 		case <-ctx.Done():
@@ -117,14 +341,19 @@ func (s *executeCommand) printStackEvents(ctx context.Context, out io.Writer, in
 			if !ok {
 				return nil
 			}
+			if onEvent != nil {
+				onEvent(event)
+			}
 			p := &stackEvent{
+				Timestamp:            event.Timestamp,
+				StackName:            emptyOnNil(event.StackName),
 				LogicalResourceID:    emptyOnNil(event.LogicalResourceId),
 				PhysicalResourceID:   emptyOnNil(event.PhysicalResourceId),
 				ResourceStatus:       emptyOnNil(event.ResourceStatus),
 				ResourceStatusReason: emptyOnNil(event.ResourceStatusReason),
 				ResourceType:         emptyOnNil(event.ResourceType),
 			}
-			if err := display(out, s.JSON, p); err != nil {
+			if err := display(out, s.Output, p); err != nil {
 				return errors.Wrap(err, "unable to print out json")
 			}
 		}
@@ -133,6 +362,23 @@ func (s *executeCommand) printStackEvents(ctx context.Context, out io.Writer, in
 
 var errFinishedOk = errors.New("finished ok")
 
+// errDetached stops following a stack update that keeps running
+var errDetached = errors.New("detached before the update finished")
+
+// promptCancel asks whether to cancel the stack update or detach from it after a signal.  It returns false if ctx
+// ended first.  Without an answer the update is cancelled.
+func (s *executeCommand) promptCancel(ctx context.Context, out io.Writer, stackName string, create bool) (bool, bool) {
+	prompt := fmt.Sprintf("\nSignal caught.  Cancel the update of %s, or detach and leave it running?", stackName)
+	if create {
+		prompt = fmt.Sprintf("\nSignal caught.  Cancel creating %s by deleting it, or detach and leave it running?", stackName)
+	}
+	choice, ok := choose(s.Input, out, prompt, []string{"cancel", "detach"}, 3, ctx.Done())
+	if ctx.Err() != nil {
+		return false, false
+	}
+	return !ok || choice == "cancel", true
+}
+
 func isErrFinishedOk(err error) bool {
 	if err == nil {
 		return false
@@ -140,8 +386,8 @@ func isErrFinishedOk(err error) bool {
 	return strings.Contains(errors.Cause(err).Error(), "finished ok")
 }
 
-func (s *executeCommand) modelPhase2(ctx context.Context, out io.Writer, inspectModel *inspectCommandModel) error {
-	ses, err := s.AWSCache.Session(inspectModel.changesetInput.Profile, inspectModel.changesetInput.Region)
+func (s *executeCommand) modelPhase2(ctx context.Context, out io.Writer, inspectModel *inspectCommandModel, opts deployOptions, onEvent func(*cloudformation.StackEvent)) error {
+	ses, err := s.AWSCache.SessionAs(inspectModel.changesetInput.Profile, inspectModel.changesetInput.Region, inspectModel.changesetInput.AssumeRoleARN)
 	if err != nil {
 		return errors.Wrap(err, "unable to get session in modelPhase2")
 	}
@@ -149,6 +395,13 @@ func (s *executeCommand) modelPhase2(ctx context.Context, out io.Writer, inspect
 	if err != nil {
 		return errors.Wrapf(err, "unable to execute changeset %s", *inspectModel.changeset.ChangeSetId)
 	}
+	if opts.Detach {
+		msg := fmt.Sprintf("Started executing %s on stack %s\n", *inspectModel.changeset.ChangeSetId, *inspectModel.changeset.StackId)
+		if err := display(out, s.Output, printableString(msg)); err != nil {
+			return err
+		}
+		return errDetached
+	}
 
 	// Now stream the changes
 	streamer := awscache.StackStreamer{
@@ -157,46 +410,128 @@ func (s *executeCommand) modelPhase2(ctx context.Context, out io.Writer, inspect
 	}
 	eg, egCtx := errgroup.WithContext(ctx)
 	streamInto := make(chan *cloudformation.StackEvent)
+	activity := make(chan struct{}, 1)
+	create := emptyOnNil(inspectModel.changesetInput.ChangeSetType) == cloudformation.ChangeSetTypeCreate
+	cancelReason := ""
+	finalState := ""
 	eg.Go(func() error {
 		defer close(streamInto)
 		return streamer.Start(egCtx, ses, *inspectModel.changeset.StackId, streamInto)
 	})
 	eg.Go(func() error {
-		return s.printStackEvents(egCtx, out, streamInto)
-	})
-	eg.Go(func() error {
-		catchSignals := []os.Signal{
-			os.Interrupt, syscall.SIGTERM,
-		}
-		sigChan := make(chan os.Signal, len(catchSignals))
-		defer close(sigChan)
-		signal.Notify(sigChan, catchSignals...)
-		defer signal.Stop(sigChan)
-		select {
-		case <-sigChan:
-			p := &stackEvent{
-				ResourceType: "Program Signal caught",
-			}
-			if err := display(out, s.JSON, p); err != nil {
-				return errors.Wrap(err, "unable to display json")
+		return s.printStackEvents(egCtx, out, streamInto, func(event *cloudformation.StackEvent) {
+			select {
+			case activity <- struct{}{}:
+			default:
 			}
-			if err := ses.CancelStackUpdate(egCtx, *inspectModel.changeset.StackName); err != nil {
-				return errors.Wrap(err, "unable to cancel stack update")
+			if onEvent != nil {
+				onEvent(event)
 			}
-		case <-egCtx.Done():
-		}
-		return nil
+		})
 	})
 	eg.Go(func() error {
-		actualErr := ses.WaitForTerminalState(egCtx, *inspectModel.changeset.StackId, s.Logger)
+		var err error
+		cancelReason, err = s.cancelUpdate(egCtx, out, ses, *inspectModel.changeset.StackName, create, opts, activity)
+		return err
+	})
+	eg.Go(func() error {
+		var actualErr error
+		finalState, actualErr = ses.WaitForTerminalStatus(egCtx, *inspectModel.changeset.StackId, s.Logger)
 		if actualErr == nil {
 			return errFinishedOk
 		}
 		return actualErr
 	})
 	err = eg.Wait()
+	if errors.Cause(err) == errDetached {
+		if displayErr := display(out, s.Output, printableString(fmt.Sprintf("Detached from %s: the update keeps running\n", *inspectModel.changeset.StackName))); displayErr != nil {
+			return displayErr
+		}
+		return err
+	}
+	if cancelReason != "" {
+		if finalState == "DELETE_COMPLETE" {
+			return errors.Errorf("deleted %s, which was being created (%s)", *inspectModel.changeset.StackName, cancelReason)
+		}
+		if isErrFinishedOk(err) {
+			return display(out, s.Output, printableString(fmt.Sprintf("%s: the update finished before it could be cancelled\n", cancelReason)))
+		}
+		return errors.Wrapf(err, "cancelled the update of %s (%s)", *inspectModel.changeset.StackName, cancelReason)
+	}
 	if isErrFinishedOk(err) {
 		return nil
 	}
 	return err
 }
+
+// cancelUpdate cancels a stack update once waitForCancel finds a reason to.  It returns why it cancelled, or empty if
+// ctx ended first.  Events keep streaming through the rollback that follows.  A stack being created has no update to
+// cancel, so it is deleted instead, which stops creating it.
+func (s *executeCommand) cancelUpdate(ctx context.Context, out io.Writer, ses *awscache.AWSClients, stackName string, create bool, opts deployOptions, activity <-chan struct{}) (string, error) {
+	sigChan, stopIntercept := s.ContextFinder.Intercept()
+	defer stopIntercept()
+	reason, err := s.waitForCancel(ctx, out, stackName, create, opts, activity, sigChan)
+	if reason == "" || err != nil {
+		return reason, err
+	}
+	if !create {
+		if err := display(out, s.Output, &stackEvent{ResourceType: reason}); err != nil {
+			return reason, errors.Wrap(err, "unable to display json")
+		}
+		return reason, errors.Wrap(ses.CancelStackUpdate(ctx, stackName), "unable to cancel stack update")
+	}
+	stack, err := ses.DescribeStack(ctx, stackName)
+	if err != nil {
+		return reason, err
+	}
+	if stack == nil || emptyOnNil(stack.StackStatus) != "CREATE_IN_PROGRESS" {
+		// The create already ended: report how it ended instead of deleting it
+		return reason, nil
+	}
+	if err := display(out, s.Output, &stackEvent{ResourceType: reason + ": deleting the stack being created"}); err != nil {
+		return reason, errors.Wrap(err, "unable to display json")
+	}
+	return reason, errors.Wrap(ses.DeleteStack(ctx, stackName), "unable to delete the stack being created")
+}
+
+// waitForCancel returns why a stack update should be cancelled: a signal, opts.DeployTimeout passing, no event sent to
+// activity for opts.IdleTimeout, or losing the lock of the stack.  It returns empty if ctx ends first.  Unless
+// opts.AutoConfirm is set, a signal first asks whether to cancel, and returns errDetached if the user would rather
+// leave the update running.
+func (s *executeCommand) waitForCancel(ctx context.Context, out io.Writer, stackName string, create bool, opts deployOptions, activity <-chan struct{}, sigChan <-chan os.Signal) (string, error) {
+	clk := s.getClock()
+	var deadline <-chan time.Time
+	if opts.DeployTimeout > 0 {
+		deadline = clk.After(opts.DeployTimeout)
+	}
+	lastActivity := clk.Now()
+	for {
+		var idle <-chan time.Time
+		if opts.IdleTimeout > 0 {
+			idle = clk.After(lastActivity.Add(opts.IdleTimeout).Sub(clk.Now()))
+		}
+		select {
+		case <-ctx.Done():
+			return "", nil
+		case <-activity:
+			lastActivity = clk.Now()
+		case <-sigChan:
+			if !opts.AutoConfirm {
+				cancel, ok := s.promptCancel(ctx, out, stackName, create)
+				if !ok {
+					return "", nil
+				}
+				if !cancel {
+					return "", errDetached
+				}
+			}
+			return "Program Signal caught", nil
+		case <-deadline:
+			return fmt.Sprintf("Deploy timeout of %s exceeded", opts.DeployTimeout), nil
+		case <-idle:
+			return fmt.Sprintf("No stack events for %s", opts.IdleTimeout), nil
+		case <-heldLock(ctx).Lost():
+			return fmt.Sprintf("Stack lock lost: %s", heldLock(ctx).Err()), nil
+		}
+	}
+}
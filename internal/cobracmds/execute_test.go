@@ -0,0 +1,162 @@
+package cobracmds
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type fakeTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+// fakeClock only moves when Advance is called
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+	afters int
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.afters++
+	c := make(chan time.Time, 1)
+	if d <= 0 {
+		c <- f.now
+		return c
+	}
+	f.timers = append(f.timers, fakeTimer{at: f.now.Add(d), c: c})
+	return c
+}
+
+// Advance moves time forward, firing the timers that are due
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+	pending := f.timers[:0]
+	for _, t := range f.timers {
+		if t.at.After(f.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.c <- f.now
+	}
+	f.timers = pending
+}
+
+// waitForAfters waits until After was called n times, so the code under test is waiting on its timers
+func (f *fakeClock) waitForAfters(t *testing.T, n int) {
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(time.Millisecond) {
+		f.mu.Lock()
+		afters := f.afters
+		f.mu.Unlock()
+		if afters >= n {
+			return
+		}
+	}
+	t.Fatalf("After was not called %d times", n)
+}
+
+type cancelResult struct {
+	reason string
+	err    error
+}
+
+func startWaitForCancel(ctx context.Context, clk *fakeClock, opts deployOptions, activity chan struct{}, sigChan chan os.Signal) <-chan cancelResult {
+	s := &executeCommand{
+		clock: clk,
+	}
+	ret := make(chan cancelResult, 1)
+	go func() {
+		reason, err := s.waitForCancel(ctx, ioutil.Discard, "stack", false, opts, activity, sigChan)
+		ret <- cancelResult{reason: reason, err: err}
+	}()
+	return ret
+}
+
+func expectNoCancel(t *testing.T, results <-chan cancelResult) {
+	// Give waitForCancel a moment to act on timers that should not have fired
+	select {
+	case r := <-results:
+		t.Fatalf("cancelled too early: %q %v", r.reason, r.err)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func expectCancel(t *testing.T, results <-chan cancelResult, reason string) {
+	select {
+	case r := <-results:
+		if r.err != nil || r.reason != reason {
+			t.Fatalf("cancelled with %q %v, want %q", r.reason, r.err, reason)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("never cancelled, want %q", reason)
+	}
+}
+
+func TestDeployTimeout(t *testing.T) {
+	clk := &fakeClock{now: time.Unix(1000, 0)}
+	activity := make(chan struct{})
+	results := startWaitForCancel(context.Background(), clk, deployOptions{DeployTimeout: time.Minute}, activity, nil)
+	clk.waitForAfters(t, 1)
+	clk.Advance(59 * time.Second)
+	// Activity does not extend the deploy timeout
+	activity <- struct{}{}
+	expectNoCancel(t, results)
+	clk.Advance(time.Second)
+	expectCancel(t, results, "Deploy timeout of 1m0s exceeded")
+}
+
+func TestIdleTimeout(t *testing.T) {
+	clk := &fakeClock{now: time.Unix(1000, 0)}
+	activity := make(chan struct{})
+	results := startWaitForCancel(context.Background(), clk, deployOptions{IdleTimeout: time.Minute, DeployTimeout: time.Hour}, activity, nil)
+	// The deploy deadline, then the first idle timer
+	clk.waitForAfters(t, 2)
+	clk.Advance(50 * time.Second)
+	activity <- struct{}{}
+	// An event restarts the idle timer
+	clk.waitForAfters(t, 3)
+	clk.Advance(50 * time.Second)
+	expectNoCancel(t, results)
+	clk.Advance(10 * time.Second)
+	expectCancel(t, results, "No stack events for 1m0s")
+}
+
+func TestNoTimeoutsNeverCancel(t *testing.T) {
+	clk := &fakeClock{now: time.Unix(1000, 0)}
+	ctx, cancel := context.WithCancel(context.Background())
+	results := startWaitForCancel(ctx, clk, deployOptions{}, make(chan struct{}), nil)
+	clk.Advance(24 * time.Hour)
+	expectNoCancel(t, results)
+	clk.mu.Lock()
+	afters := clk.afters
+	clk.mu.Unlock()
+	if afters != 0 {
+		t.Fatalf("started %d timers without timeouts", afters)
+	}
+	cancel()
+	expectCancel(t, results, "")
+}
+
+func TestSignalCancelsWithAutoConfirm(t *testing.T) {
+	clk := &fakeClock{now: time.Unix(1000, 0)}
+	sigChan := make(chan os.Signal, 1)
+	results := startWaitForCancel(context.Background(), clk, deployOptions{AutoConfirm: true, DeployTimeout: time.Hour}, make(chan struct{}), sigChan)
+	sigChan <- syscall.SIGTERM
+	expectCancel(t, results, "Program Signal caught")
+}
@@ -0,0 +1,188 @@
+package cobracmds
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cep21/cfmanage/internal/policy"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// ExitError makes the process exit with Code
+type ExitError struct {
+	Code   int
+	Reason string
+}
+
+func (e *ExitError) Error() string {
+	return e.Reason
+}
+
+// ExitCode is the process exit code for an error returned by RootCommand.Execute
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if e, ok := errors.Cause(err).(*ExitError); ok {
+		return e.Code
+	}
+	return 1
+}
+
+// Categories of a stack in a status summary
+const (
+	categoryInSync  = "in sync"
+	categoryChanged = "changed"
+	categoryError   = "error"
+)
+
+// Conditions --fail-on can fail on
+const (
+	failOnFailedState    = "failed-state"
+	failOnChangesetError = "changeset-error"
+	failOnDrift          = "drift"
+)
+
+func (st *stackStatus) category() string {
+	if st.ChangesetError != nil || st.changesetInput == nil {
+		return categoryError
+	}
+	if st.stackSet != nil {
+		if len(st.stackSet.changes()) == 0 {
+			return categoryInSync
+		}
+		return categoryChanged
+	}
+	if st.changeset != nil {
+		if emptyOnNil(st.changeset.Status) == "FAILED" && !isNoChangesReason(emptyOnNil(st.changeset.StatusReason)) {
+			return categoryError
+		}
+		if len(st.changeset.Changes) == 0 {
+			return categoryInSync
+		}
+		return categoryChanged
+	}
+	// Without a changeset, only a comparison in sync is known to be in sync
+	switch {
+	case st.ChangesetStatus == "in sync":
+		return categoryInSync
+	case st.cfStack == nil && st.ChangesetStatus != "not deployed":
+		return categoryError
+	}
+	return categoryChanged
+}
+
+func isNoChangesReason(reason string) bool {
+	return strings.Contains(reason, "didn't contain changes") || strings.Contains(reason, "No updates are to be performed")
+}
+
+// inFailedState is true for stacks CloudFormation left broken
+func (st *stackStatus) inFailedState() bool {
+	if st.stackSet != nil {
+		return st.stackSet.inoperable()
+	}
+	return strings.HasSuffix(st.StackStatus, "_FAILED") || st.StackStatus == "ROLLBACK_COMPLETE"
+}
+
+type statusSummary struct {
+	Stacks      int
+	InSync      int
+	Changed     int
+	Errors      int
+	FailedState int
+}
+
+func summarize(statuses []stackStatus) statusSummary {
+	ret := statusSummary{
+		Stacks: len(statuses),
+	}
+	for i := range statuses {
+		switch statuses[i].category() {
+		case categoryInSync:
+			ret.InSync++
+		case categoryChanged:
+			ret.Changed++
+		case categoryError:
+			ret.Errors++
+		}
+		if statuses[i].inFailedState() {
+			ret.FailedState++
+		}
+	}
+	return ret
+}
+
+func (s statusSummary) String() string {
+	ret := fmt.Sprintf("%d stacks: %d in sync, %d changed, %d error", s.Stacks, s.InSync, s.Changed, s.Errors)
+	if s.Errors != 1 {
+		ret += "s"
+	}
+	if s.FailedState != 0 {
+		ret += fmt.Sprintf(", %d in a failed state", s.FailedState)
+	}
+	return ret
+}
+
+func (s statusSummary) HumanReadable(out io.Writer) error {
+	_, err := fmt.Fprintln(out, s.String())
+	return err
+}
+
+// exitCodes gate CI on the state of stacks
+type exitCodes struct {
+	detailed bool
+	failOn   []string
+}
+
+func (e *exitCodes) register(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&e.detailed, "detailed-exitcode", false, "Exit 0 if no stack has changes, 2 if some do, and 1 on errors")
+	cmd.Flags().StringSliceVar(&e.failOn, "fail-on", nil, "Exit 1 if any stack matches one of: "+strings.Join([]string{failOnFailedState, failOnChangesetError, failOnDrift}, ", "))
+}
+
+// check returns an *ExitError if the statuses should fail the command
+func (e *exitCodes) check(cmd *cobra.Command, statuses []stackStatus) error {
+	summary := summarize(statuses)
+	var failures []string
+	for _, f := range e.failOn {
+		switch f {
+		case failOnFailedState:
+			if summary.FailedState != 0 {
+				failures = append(failures, fmt.Sprintf("%d stacks in a failed state", summary.FailedState))
+			}
+		case failOnChangesetError:
+			if summary.Errors != 0 {
+				failures = append(failures, fmt.Sprintf("%d stacks with errors", summary.Errors))
+			}
+		case failOnDrift:
+			if summary.Changed != 0 {
+				failures = append(failures, fmt.Sprintf("%d stacks with changes", summary.Changed))
+			}
+		default:
+			return errors.Errorf("unknown --fail-on condition %s", f)
+		}
+	}
+	// Blocking policy violations fail the command whatever the flags
+	var blocking policy.Violations
+	for i := range statuses {
+		blocking = append(blocking, statuses[i].policy.Blocking()...)
+	}
+	if len(blocking) != 0 {
+		failures = append(failures, fmt.Sprintf("%d blocking policy violations (%s)", len(blocking), blocking.String()))
+	}
+	var ret *ExitError
+	switch {
+	case len(failures) != 0:
+		ret = &ExitError{Code: 1, Reason: strings.Join(failures, ", ")}
+	case e.detailed && summary.Errors != 0:
+		ret = &ExitError{Code: 1, Reason: fmt.Sprintf("%d stacks with errors", summary.Errors)}
+	case e.detailed && summary.Changed != 0:
+		ret = &ExitError{Code: 2, Reason: fmt.Sprintf("%d stacks with changes", summary.Changed)}
+	default:
+		return nil
+	}
+	// The state of the stacks was already displayed: usage would only be noise
+	cmd.SilenceUsage = true
+	return ret
+}
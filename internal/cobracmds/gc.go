@@ -0,0 +1,162 @@
+package cobracmds
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/cep21/cfmanage/internal/awscache"
+	"github.com/cep21/cfmanage/internal/cleanup"
+	"github.com/cep21/cfmanage/internal/ctxfinder"
+	"github.com/cep21/cfmanage/internal/logger"
+	"github.com/cep21/cfmanage/internal/templatereader"
+	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+type gcCommand struct {
+	AWSCache      *awscache.AWSCache
+	T             *templatereader.TemplateFinder
+	Ctx           *templatereader.CreateChangeSetTemplate
+	Logger        *logger.Logger
+	Output        *outputFormat
+	ContextFinder *ctxfinder.ContextFinder
+	Cleanup       *cleanup.Cleanup
+	scan          bool
+	minAge        time.Duration
+}
+
+func (s *gcCommand) Cobra() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:       "gc",
+		Short:     "Remove changesets, stacks and S3 objects left behind by interrupted cfmanage runs",
+		Example:   "cfexecute gc --scan",
+		ValidArgs: []string{},
+		Args:      cobra.NoArgs,
+	}
+	cmd.Flags().BoolVar(&s.scan, "scan", false, "Also scan every managed stack for stale changesets created by cfmanage")
+	cmd.Flags().DurationVar(&s.minAge, "min-age", time.Hour, "Only remove scanned changesets older than this")
+	cmd.RunE = commonRunCommand(s.ContextFinder, s.model, s.Output)
+	return cmd
+}
+
+type gcItem struct {
+	Kind        string
+	Description string
+	Result      string
+
+	err error
+}
+
+func newGCItem(kind string, description string, err error) gcItem {
+	return gcItem{
+		Kind:        kind,
+		Description: description,
+		Result:      resultString(err),
+		err:         err,
+	}
+}
+
+type gcCommandModel struct {
+	Cleaned []gcItem
+}
+
+func (g *gcCommandModel) HumanReadable(out io.Writer) error {
+	if len(g.Cleaned) == 0 {
+		_, err := io.WriteString(out, "nothing to clean up\n")
+		return err
+	}
+	table := tablewriter.NewWriter(out)
+	table.SetHeader([]string{"Kind", "Description", "Result"})
+	for _, c := range g.Cleaned {
+		table.Append([]string{c.Kind, c.Description, c.Result})
+	}
+	table.Render()
+	return nil
+}
+
+func resultString(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return "cleaned"
+}
+
+func (s *gcCommand) model(ctx context.Context, cmd *cobra.Command, args []string) (HumanPrintable, error) {
+	ret := &gcCommandModel{}
+	results, err := s.Cleanup.Journal.Replay(ctx, s.AWSCache.CleanupRecord)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to replay cleanup journal")
+	}
+	for _, r := range results {
+		ret.Cleaned = append(ret.Cleaned, newGCItem(r.Record.Kind, r.Record.String(), r.Err))
+	}
+	if !s.scan {
+		return ret, nil
+	}
+	scanned, err := s.scanStacks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ret.Cleaned = append(ret.Cleaned, scanned...)
+	return ret, nil
+}
+
+func (s *gcCommand) scanStacks(ctx context.Context) ([]gcItem, error) {
+	templates, err := s.T.ListTemplates()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list all templates")
+	}
+	var inputs []*templatereader.ChangesetInput
+	for _, t := range templates {
+		params, err := s.T.ListParameters(t)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to list parameters for template %s", t)
+		}
+		for _, p := range params {
+			in, err := templatereader.LoadCreateChangeSet(s.T.ParameterFilename(t, p), s.Ctx, s.Logger)
+			if err != nil {
+				s.Logger.Log(1, "skipping %s/%s: %s", t, p, err.Error())
+				continue
+			}
+			inputs = append(inputs, in)
+		}
+	}
+	items := make([][]gcItem, len(inputs))
+	eg, egCtx := errgroup.WithContext(ctx)
+	for idx, in := range inputs {
+		idx := idx
+		in := in
+		eg.Go(func() error {
+			ses, err := s.AWSCache.SessionAs(in.Profile, in.Region, in.AssumeRoleARN)
+			if err != nil {
+				return errors.Wrapf(err, "unable to fetch AWS session for profile %s", in.Profile)
+			}
+			stack, err := ses.DescribeStack(egCtx, *in.StackName)
+			if err != nil {
+				return err
+			}
+			if stack == nil {
+				return nil
+			}
+			stale, err := ses.StaleChangesets(egCtx, *in.StackName, s.minAge)
+			if err != nil {
+				return err
+			}
+			for _, st := range stale {
+				items[idx] = append(items[idx], newGCItem("stale-changeset", st.ChangesetARN, ses.DeleteStaleChangeset(egCtx, st)))
+			}
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	var ret []gcItem
+	for _, i := range items {
+		ret = append(ret, i...)
+	}
+	return ret, nil
+}
@@ -0,0 +1,413 @@
+package cobracmds
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/cep21/cfmanage/internal/awscache"
+	"github.com/cep21/cfmanage/internal/ctxfinder"
+	"github.com/cep21/cfmanage/internal/deployhistory"
+	"github.com/cep21/cfmanage/internal/gitinfo"
+	"github.com/cep21/cfmanage/internal/logger"
+	"github.com/cep21/cfmanage/internal/stacklock"
+	"github.com/cep21/cfmanage/internal/templatereader"
+	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// stackHistory finds the deployment history store a params file asks for
+type stackHistory struct {
+	AWSCache *awscache.AWSCache
+	Logger   *logger.Logger
+	Dir      string
+}
+
+// store returns the history store and key of a stack, or a nil store if the stack is configured without history
+func (s *stackHistory) store(in *templatereader.ChangesetInput) (deployhistory.Store, string, error) {
+	cfg := in.History
+	if cfg == nil {
+		cfg = &templatereader.HistoryConfig{}
+	}
+	ses, err := s.AWSCache.SessionAs(in.Profile, in.Region, in.AssumeRoleARN)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "unable to fetch AWS session for profile %s", in.Profile)
+	}
+	key, err := stackKey(ses, *in.StackName)
+	if err != nil {
+		return nil, "", err
+	}
+	switch cfg.Backend {
+	case "none":
+		return nil, key, nil
+	case "", "file":
+		return &deployhistory.FileStore{
+			Dir: s.Dir,
+		}, key, nil
+	case "s3":
+		bucket := firstNonEmpty(cfg.Bucket, in.Bucket)
+		if bucket == "" {
+			return nil, "", errors.New("the s3 history backend needs a bucket")
+		}
+		return &deployhistory.S3Store{
+			Client: ses.S3(),
+			Bucket: bucket,
+			Prefix: firstNonEmpty(cfg.Prefix, "cfmanage-history"),
+		}, key, nil
+	}
+	return nil, "", errors.Errorf("unknown history backend %s", cfg.Backend)
+}
+
+// snapshot describes the template and parameters a stack is deployed with right now
+func snapshot(ctx context.Context, ses *awscache.AWSClients, key string, stackName string, source string) (*deployhistory.Deployment, error) {
+	stack, err := ses.DescribeStack(ctx, stackName)
+	if err != nil {
+		return nil, err
+	}
+	if stack == nil {
+		return nil, errors.Errorf("stack %s does not exist", stackName)
+	}
+	body, err := ses.DeployedTemplate(ctx, stackName)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	return &deployhistory.Deployment{
+		ID:           deployhistory.NewID(now),
+		Key:          key,
+		StackName:    stackName,
+		StackID:      emptyOnNil(stack.StackId),
+		Time:         now,
+		Source:       source,
+		Status:       emptyOnNil(stack.StackStatus),
+		TemplateBody: body,
+		Parameters:   stack.Parameters,
+		Tags:         stack.Tags,
+		Capabilities: stack.Capabilities,
+	}, nil
+}
+
+// recordBaseline saves the state of a stack before cfmanage deploys it for the first time, so there is always
+// something to roll back to
+func (s *stackHistory) recordBaseline(ctx context.Context, in *templatereader.ChangesetInput) {
+	store, key, err := s.store(in)
+	if err != nil || store == nil {
+		return
+	}
+	existing, err := store.List(ctx, key)
+	if err != nil || len(existing) != 0 {
+		return
+	}
+	ses, err := s.AWSCache.SessionAs(in.Profile, in.Region, in.AssumeRoleARN)
+	if err != nil {
+		return
+	}
+	if stack, err := ses.DescribeStack(ctx, *in.StackName); err != nil || stack == nil {
+		return
+	}
+	s.save(ctx, store, ses, key, *in.StackName, deployhistory.SourceBaseline)
+}
+
+// deploymentRun collects the audit record of a single deploy while it runs
+type deploymentRun struct {
+	store deployhistory.Store
+	ses   *awscache.AWSClients
+	mu    sync.Mutex
+	d     deployhistory.Deployment
+}
+
+func (r *deploymentRun) addEvent(e *cloudformation.StackEvent) {
+	if r == nil {
+		return
+	}
+	ev := deployhistory.Event{
+		LogicalID:    emptyOnNil(e.LogicalResourceId),
+		ResourceType: emptyOnNil(e.ResourceType),
+		Status:       emptyOnNil(e.ResourceStatus),
+		Reason:       emptyOnNil(e.ResourceStatusReason),
+	}
+	if e.Timestamp != nil {
+		ev.Time = *e.Timestamp
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.d.Events = append(r.d.Events, ev)
+}
+
+// start begins the audit record of a deploy of data's changeset.  It returns nil if the stack does not record
+// history.
+func (s *stackHistory) start(ctx context.Context, data *inspectCommandModel, baseDir string, opts deployOptions) *deploymentRun {
+	in := data.changesetInput
+	store, key, err := s.store(in)
+	if err != nil {
+		s.Logger.Log(0, "unable to record deployment: %s", err.Error())
+		return nil
+	}
+	if store == nil {
+		return nil
+	}
+	ses, err := s.AWSCache.SessionAs(in.Profile, in.Region, in.AssumeRoleARN)
+	if err != nil {
+		s.Logger.Log(0, "unable to record deployment: %s", err.Error())
+		return nil
+	}
+	now := time.Now().UTC()
+	ret := &deploymentRun{
+		store: store,
+		ses:   ses,
+		d: deployhistory.Deployment{
+			ID:           deployhistory.NewID(now),
+			Key:          key,
+			StackName:    *in.StackName,
+			User:         stacklock.Owner(),
+			InputHash:    data.inputHash,
+			StartTime:    now,
+			RolledBackTo: opts.RollbackTo,
+		},
+	}
+	if blocking := data.Policy.Blocking(); len(blocking) != 0 {
+		ret.d.PolicyOverride = opts.OverridePolicy
+		for _, v := range blocking {
+			ret.d.PolicyViolations = append(ret.d.PolicyViolations, v.Rule+": "+v.Message)
+		}
+	}
+	ret.d.IdentityARN, _ = ses.CallerARN()
+	if git, err := gitinfo.Describe(ctx, baseDir); err == nil {
+		ret.d.GitSHA = git.SHA
+		ret.d.GitDirty = git.Dirty
+	}
+	if data.changeset != nil {
+		ret.d.ChangesetARN = emptyOnNil(data.changeset.ChangeSetId)
+		for _, c := range data.changeset.Changes {
+			if c.ResourceChange == nil {
+				continue
+			}
+			ret.d.Changes = append(ret.d.Changes, deployhistory.Change{
+				Action:       emptyOnNil(c.ResourceChange.Action),
+				LogicalID:    emptyOnNil(c.ResourceChange.LogicalResourceId),
+				PhysicalID:   emptyOnNil(c.ResourceChange.PhysicalResourceId),
+				ResourceType: emptyOnNil(c.ResourceChange.ResourceType),
+				Replacement:  emptyOnNil(c.ResourceChange.Replacement),
+			})
+		}
+	}
+	return ret
+}
+
+// finish completes the audit record of a deploy with its outcome and saves it.  Failing to record history never fails
+// the deploy.
+func (s *stackHistory) finish(run *deploymentRun, source string, deployErr error) {
+	if run == nil {
+		return
+	}
+	// The command's context may be dead by now (timeouts, signals): still try to record what happened
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	d := &run.d
+	d.Source = source
+	d.EndTime = time.Now().UTC()
+	d.Time = d.EndTime
+	if errors.Cause(deployErr) == errDetached {
+		// The update is still running: what the stack is left with is not known yet
+		d.Incomplete = deployErr.Error()
+	} else if deployErr != nil {
+		d.Error = deployErr.Error()
+	}
+	state, err := snapshot(ctx, run.ses, d.Key, d.StackName, source)
+	if err != nil {
+		s.Logger.Log(0, "unable to describe stack after deployment: %s", err.Error())
+		d.Incomplete = firstNonEmpty(d.Incomplete, "unable to describe stack after deployment: "+err.Error())
+	} else {
+		d.StackID = state.StackID
+		d.Status = state.Status
+		d.TemplateBody = state.TemplateBody
+		d.Parameters = state.Parameters
+		d.Tags = state.Tags
+		d.Capabilities = state.Capabilities
+	}
+	if err := run.store.Save(ctx, *d); err != nil {
+		s.Logger.Log(0, "unable to record deployment: %s", err.Error())
+		return
+	}
+	s.Logger.Log(1, "recorded %s deployment %s of %s", source, d.ID, d.Key)
+}
+
+func (s *stackHistory) save(ctx context.Context, store deployhistory.Store, ses *awscache.AWSClients, key string, stackName string, source string) {
+	d, err := snapshot(ctx, ses, key, stackName, source)
+	if err != nil {
+		s.Logger.Log(0, "unable to record deployment: %s", err.Error())
+		return
+	}
+	if err := store.Save(ctx, *d); err != nil {
+		s.Logger.Log(0, "unable to record deployment: %s", err.Error())
+		return
+	}
+	s.Logger.Log(1, "recorded %s deployment %s of %s", source, d.ID, key)
+}
+
+type historyCommand struct {
+	T             *templatereader.TemplateFinder
+	Ctx           *templatereader.CreateChangeSetTemplate
+	Logger        *logger.Logger
+	Output        *outputFormat
+	ContextFinder *ctxfinder.ContextFinder
+	History       *stackHistory
+	show          string
+	limit         int
+}
+
+func (s *historyCommand) Cobra() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:       "history [template] [params]",
+		ValidArgs: s.T.ValidTemplatesAndParams(),
+		Short:     "List past deployments of a stack",
+		Example:   "cfexecute history infra canary --show 20190102T150405Z-1a2b3c4d",
+	}
+	cmd.Flags().StringVar(&s.show, "show", "", "ID of a deployment to show in detail")
+	cmd.Flags().IntVar(&s.limit, "limit", 20, "Only list this many of the most recent deployments.  Zero lists all of them")
+	cmd.Args = validateTemplateParam(s.T)
+	cmd.RunE = commonRunCommand(s.ContextFinder, s.model, s.Output)
+	return cmd
+}
+
+type historyCommandModel struct {
+	Deployments []deployhistory.Deployment
+}
+
+func resultOf(d *deployhistory.Deployment) string {
+	if !d.Succeeded() {
+		return "FAILED: " + d.Error
+	}
+	if d.Incomplete != "" {
+		return strings.TrimSpace(d.Status + " (incomplete: " + d.Incomplete + ")")
+	}
+	return d.Status
+}
+
+func durationString(d *deployhistory.Deployment) string {
+	if dur := d.Duration(); dur != 0 {
+		return dur.Round(time.Second).String()
+	}
+	return ""
+}
+
+func (h *historyCommandModel) HumanReadable(out io.Writer) error {
+	if len(h.Deployments) == 0 {
+		_, err := io.WriteString(out, "no recorded deployments\n")
+		return err
+	}
+	table := tablewriter.NewWriter(out)
+	table.SetHeader([]string{"ID", "Time", "Source", "User", "Git", "Result", "Changes", "Duration"})
+	for i := range h.Deployments {
+		d := &h.Deployments[i]
+		table.Append([]string{d.ID, d.Time.Format("2006-01-02 15:04:05 MST"), d.Source, d.User, d.Git().String(), resultOf(d), strconv.Itoa(len(d.Changes)), durationString(d)})
+	}
+	table.Render()
+	return nil
+}
+
+type deploymentModel struct {
+	Deployment deployhistory.Deployment
+}
+
+func (m *deploymentModel) HumanReadable(out io.Writer) error {
+	d := &m.Deployment
+	table := tablewriter.NewWriter(out)
+	table.SetHeader([]string{"Field", "Value"})
+	table.AppendBulk([][]string{
+		{"ID", d.ID},
+		{"Stack", d.Key},
+		{"Source", d.Source},
+		{"User", d.User},
+		{"Identity", d.IdentityARN},
+		{"Git", d.Git().String()},
+		{"Changeset", d.ChangesetARN},
+		{"Input hash", d.InputHash},
+		{"Started", formatTime(d.StartTime)},
+		{"Finished", formatTime(d.EndTime)},
+		{"Duration", durationString(d)},
+		{"Result", resultOf(d)},
+	})
+	if d.RolledBackTo != "" {
+		table.Append([]string{"Rolled back to", d.RolledBackTo})
+	}
+	if d.PolicyOverride != "" {
+		table.Append([]string{"Policy override", d.PolicyOverride})
+		for _, v := range d.PolicyViolations {
+			table.Append([]string{"Overridden", v})
+		}
+	}
+	table.Render()
+	if len(d.Changes) != 0 {
+		if _, err := io.WriteString(out, "Changes\n"); err != nil {
+			return err
+		}
+		table = tablewriter.NewWriter(out)
+		table.SetHeader([]string{"Action", "Logical ID", "Physical ID", "Resource type", "Replacement"})
+		for _, c := range d.Changes {
+			table.Append([]string{c.Action, c.LogicalID, c.PhysicalID, c.ResourceType, c.Replacement})
+		}
+		table.Render()
+	}
+	if len(d.Events) != 0 {
+		if _, err := io.WriteString(out, "Events\n"); err != nil {
+			return err
+		}
+		table = tablewriter.NewWriter(out)
+		table.SetHeader([]string{"Time", "Logical ID", "Resource type", "Status", "Reason"})
+		for _, e := range d.Events {
+			table.Append([]string{e.Time.Format("15:04:05"), e.LogicalID, e.ResourceType, e.Status, e.Reason})
+		}
+		table.Render()
+	}
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04:05 MST")
+}
+
+func (s *historyCommand) model(ctx context.Context, cmd *cobra.Command, args []string) (HumanPrintable, error) {
+	in, err := templatereader.LoadCreateChangeSet(s.T.ParameterFilename(args[0], args[1]), s.Ctx, s.Logger)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to load params")
+	}
+	store, key, err := s.History.store(in)
+	if err != nil {
+		return nil, err
+	}
+	if store == nil {
+		return nil, errors.New("deployment history is disabled for this stack")
+	}
+	deployments, err := store.List(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if s.show != "" {
+		for _, d := range deployments {
+			if d.ID == s.show {
+				return &deploymentModel{Deployment: d}, nil
+			}
+		}
+		return nil, errors.Errorf("no recorded deployment with ID %s", s.show)
+	}
+	// Newest first
+	ret := &historyCommandModel{}
+	for i := len(deployments) - 1; i >= 0; i-- {
+		if s.limit > 0 && len(ret.Deployments) == s.limit {
+			break
+		}
+		ret.Deployments = append(ret.Deployments, deployments[i])
+	}
+	return ret, nil
+}
@@ -0,0 +1,175 @@
+package cobracmds
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/cep21/cfmanage/internal/awscache"
+	"github.com/cep21/cfmanage/internal/hooks"
+	"github.com/cep21/cfmanage/internal/logger"
+	"github.com/cep21/cfmanage/internal/schema"
+	"github.com/cep21/cfmanage/internal/templatereader"
+	"github.com/pkg/errors"
+)
+
+// stackHooks runs the lifecycle hooks of a params file
+type stackHooks struct {
+	AWSCache *awscache.AWSCache
+	T        *templatereader.TemplateFinder
+	Logger   *logger.Logger
+}
+
+// lifecycleHooks are the hooks of each phase
+type lifecycleHooks map[string][]hooks.Hook
+
+// load parses the hooks of a params file, so a bad hook is found before anything is deployed
+func (s *stackHooks) load(in *templatereader.ChangesetInput) (lifecycleHooks, error) {
+	ret := lifecycleHooks{}
+	cfg := in.Hooks
+	if cfg == nil {
+		return ret, nil
+	}
+	phases := map[string][]templatereader.HookConfig{
+		schema.HookPreChangeset: cfg.PreChangeset,
+		schema.HookPreExecute:   cfg.PreExecute,
+		schema.HookPostSuccess:  cfg.PostSuccess,
+		schema.HookPostFailure:  cfg.PostFailure,
+	}
+	for phase, configs := range phases {
+		for _, c := range configs {
+			if len(c.Command) == 0 {
+				return nil, errors.Errorf("%s hook has no command", phase)
+			}
+			h := hooks.Hook{
+				Command: c.Command,
+				Dir:     c.Dir,
+				Env:     c.Env,
+			}
+			if !filepath.IsAbs(h.Dir) {
+				h.Dir = filepath.Join(s.T.BaseDir, h.Dir)
+			}
+			if c.Timeout != "" {
+				var err error
+				if h.Timeout, err = time.ParseDuration(c.Timeout); err != nil {
+					return nil, errors.Wrapf(err, "invalid timeout %s of %s hook %s", c.Timeout, phase, h.String())
+				}
+			}
+			ret[phase] = append(ret[phase], h)
+		}
+	}
+	return ret, nil
+}
+
+func (s *stackHooks) run(ctx context.Context, out io.Writer, lifecycle lifecycleHooks, input schema.HookInput) error {
+	r := hooks.Runner{
+		Out:    out,
+		Logger: s.Logger,
+	}
+	return r.Run(ctx, lifecycle[input.Hook], input)
+}
+
+// beforeChangeset runs the preChangeset hooks of a params file once its stack is described
+func (s *stackHooks) beforeChangeset(out io.Writer) func(context.Context, *awscache.AWSClients, *templatereader.ChangesetInput, *cloudformation.Stack) error {
+	return func(ctx context.Context, ses *awscache.AWSClients, in *templatereader.ChangesetInput, stack *cloudformation.Stack) error {
+		lifecycle, err := s.load(in)
+		if err != nil {
+			return err
+		}
+		if len(lifecycle[schema.HookPreChangeset]) == 0 {
+			return nil
+		}
+		input := schema.HookInput{
+			Header:    schema.NewHeader("hookInput"),
+			Hook:      schema.HookPreChangeset,
+			StackName: emptyOnNil(in.StackName),
+			AccountID: readable(ses.AccountID()),
+			Region:    ses.Region(),
+			Outputs:   map[string]string{},
+		}
+		if stack != nil {
+			input.StackID = emptyOnNil(stack.StackId)
+			input.Outputs = outputMap(stack.Outputs)
+		}
+		return s.run(ctx, out, lifecycle, input)
+	}
+}
+
+func outputMap(outputs []*cloudformation.Output) map[string]string {
+	ret := make(map[string]string, len(outputs))
+	for _, o := range outputs {
+		ret[emptyOnNil(o.OutputKey)] = emptyOnNil(o.OutputValue)
+	}
+	return ret
+}
+
+func hookInput(phase string, data *inspectCommandModel) schema.HookInput {
+	ret := schema.HookInput{
+		Header:       schema.NewHeader("hookInput"),
+		Hook:         phase,
+		StackName:    data.StackName,
+		StackID:      emptyOnNil(data.changeset.StackId),
+		AccountID:    data.AccountID,
+		Region:       data.Region,
+		ChangesetARN: emptyOnNil(data.changeset.ChangeSetId),
+		Changes:      schema.NewChangeSummary(data.changeset.Changes),
+		Outputs:      make(map[string]string, len(data.Outputs)),
+	}
+	for _, o := range data.Outputs {
+		ret.Outputs[o.Key] = o.Value
+	}
+	return ret
+}
+
+// beforeExecute runs the preExecute hooks of a confirmed changeset
+func (s *stackHooks) beforeExecute(ctx context.Context, out io.Writer, lifecycle lifecycleHooks, data *inspectCommandModel) error {
+	return s.run(ctx, out, lifecycle, hookInput(schema.HookPreExecute, data))
+}
+
+// afterDeploy runs the postSuccess or postFailure hooks of a deploy that ended with deployErr, and returns the error
+// of the deploy.  Like notifications, they are bounded by their own timeouts rather than the deploy's context.  A
+// failed postSuccess hook fails a deploy that succeeded.
+func (s *stackHooks) afterDeploy(out io.Writer, lifecycle lifecycleHooks, data *inspectCommandModel, deployErr error) error {
+	phase := schema.HookPostSuccess
+	if deployErr != nil {
+		phase = schema.HookPostFailure
+	}
+	if len(lifecycle[phase]) == 0 {
+		return deployErr
+	}
+	input := hookInput(phase, data)
+	if deployErr != nil {
+		input.Error = schema.NewError(deployErr)
+	}
+	if outputs, err := s.currentOutputs(data); err != nil {
+		s.Logger.Log(0, "unable to describe %s for its new outputs: %s", data.StackName, err.Error())
+	} else {
+		input.Outputs = outputs
+	}
+	err := s.run(context.Background(), out, lifecycle, input)
+	if deployErr != nil {
+		if err != nil {
+			s.Logger.Log(0, "%s", err.Error())
+		}
+		return deployErr
+	}
+	return errors.Wrapf(err, "%s updated, but a hook failed", data.StackName)
+}
+
+func (s *stackHooks) currentOutputs(data *inspectCommandModel) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	st, err := describeOutputs(ctx, s.AWSCache, data.changesetInput)
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string]string{}
+	if st != nil {
+		for _, o := range st.Outputs {
+			ret[o.Key] = o.Value
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,73 @@
+package cobracmds
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cep21/cfmanage/internal/schema"
+	"github.com/cep21/cfmanage/internal/templatereader"
+)
+
+func TestLoadHooks(t *testing.T) {
+	s := &stackHooks{T: &templatereader.TemplateFinder{BaseDir: "/deploy"}}
+	lifecycle, err := s.load(&templatereader.ChangesetInput{Hooks: &templatereader.HooksConfig{
+		PreExecute: []templatereader.HookConfig{
+			{Command: []string{"./check.sh"}, Dir: "scripts", Timeout: "30s"},
+			{Command: []string{"make", "smoke"}, Dir: "/src"},
+		},
+		PostFailure: []templatereader.HookConfig{
+			{Command: []string{"./page.sh"}, Env: map[string]string{"TEAM": "infra"}},
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := lifecycleHooks{
+		schema.HookPreExecute: {
+			{Command: []string{"./check.sh"}, Dir: "/deploy/scripts", Timeout: 30 * time.Second},
+			{Command: []string{"make", "smoke"}, Dir: "/src"},
+		},
+		schema.HookPostFailure: {
+			{Command: []string{"./page.sh"}, Dir: "/deploy", Env: map[string]string{"TEAM": "infra"}},
+		},
+	}
+	if !reflect.DeepEqual(lifecycle, want) {
+		t.Fatalf("loaded %v, want %v", lifecycle, want)
+	}
+
+	lifecycle, err = s.load(&templatereader.ChangesetInput{})
+	if err != nil || len(lifecycle[schema.HookPreExecute]) != 0 {
+		t.Fatalf("a params file without hooks loaded %v (%v)", lifecycle, err)
+	}
+}
+
+func TestLoadInvalidHooks(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  templatereader.HooksConfig
+		err  string
+	}{
+		{
+			name: "no command",
+			cfg:  templatereader.HooksConfig{PreChangeset: []templatereader.HookConfig{{Dir: "scripts"}}},
+			err:  "preChangeset hook has no command",
+		},
+		{
+			name: "invalid timeout",
+			cfg:  templatereader.HooksConfig{PostSuccess: []templatereader.HookConfig{{Command: []string{"./notify.sh"}, Timeout: "soon"}}},
+			err:  "invalid timeout soon of postSuccess hook ./notify.sh",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &stackHooks{T: &templatereader.TemplateFinder{BaseDir: "/deploy"}}
+			cfg := tc.cfg
+			_, err := s.load(&templatereader.ChangesetInput{Hooks: &cfg})
+			if err == nil || !strings.HasPrefix(err.Error(), tc.err) {
+				t.Fatalf("load returned %v, want %s", err, tc.err)
+			}
+		})
+	}
+}
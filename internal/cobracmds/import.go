@@ -0,0 +1,225 @@
+package cobracmds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cep21/cfmanage/internal/awscache"
+	"github.com/cep21/cfmanage/internal/ctxfinder"
+	"github.com/cep21/cfmanage/internal/deployhistory"
+	"github.com/cep21/cfmanage/internal/logger"
+	"github.com/cep21/cfmanage/internal/statuscache"
+	"github.com/cep21/cfmanage/internal/templatereader"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+type importCommand struct {
+	AWSCache       *awscache.AWSCache
+	T              *templatereader.TemplateFinder
+	Ctx            *templatereader.CreateChangeSetTemplate
+	Logger         *logger.Logger
+	Output         *outputFormat
+	ContextFinder  *ctxfinder.ContextFinder
+	Locks          *stackLocks
+	Execute        *executeCommand
+	autoConfirm    bool
+	overridePolicy string
+	identifiers    string
+	deployTimeout  time.Duration
+	idleTimeout    time.Duration
+}
+
+func (s *importCommand) Cobra() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:       "import [template] [params]",
+		ValidArgs: s.T.ValidTemplatesAndParams(),
+		Short:     "Import existing resources into a stack",
+		Long: `Import the resources of a template that are not in its stack yet, instead of creating them.
+
+Each resource to import needs DeletionPolicy: Retain, and is identified by properties that depend on its type, like
+BucketName for an AWS::S3::Bucket.  You are prompted for them unless --identifiers names a JSON file of them, as in
+  {"Bucket": {"BucketName": "my-bucket"}}`,
+		Example: "cfexecute import infra canary --identifiers ids.json",
+		RunE:    s.commandRun,
+	}
+	cmd.Flags().BoolVarP(&s.autoConfirm, "auto", "a", false, "Will auto confirm the import")
+	cmd.Flags().StringVar(&s.overridePolicy, "override-policy", "", "Import despite blocking policy violations.  The value is the reason, recorded in the deployment history")
+	cmd.Flags().StringVar(&s.identifiers, "identifiers", "", "JSON file mapping the logical ID of each resource to import to its identifying properties")
+	cmd.Flags().DurationVar(&s.deployTimeout, "deploy-timeout", 0, "If non zero, cancel the import if it runs longer than this, then follow the rollback")
+	cmd.Flags().DurationVar(&s.idleTimeout, "idle-timeout", 0, "If non zero, cancel the import if no stack events arrive for this long, then follow the rollback")
+	cmd.Args = validateTemplateParam(s.T)
+	return cmd
+}
+
+// templateResource is the part of a resource of a template import checks
+type templateResource struct {
+	Type           string `yaml:"Type"`
+	DeletionPolicy string `yaml:"DeletionPolicy"`
+}
+
+// templateResources reads the resources of a JSON or YAML template
+func templateResources(body string) (map[string]templateResource, error) {
+	var doc struct {
+		Resources map[string]templateResource `yaml:"Resources"`
+	}
+	if err := yaml.Unmarshal([]byte(body), &doc); err != nil {
+		return nil, errors.Wrap(err, "unable to parse template")
+	}
+	return doc.Resources, nil
+}
+
+// importCandidates are the resources of a template, by type, that its stack does not have yet
+func importCandidates(summaries []awscache.ResourceIdentifierSummary, existing map[string]struct{}) []awscache.ResourceToImport {
+	var ret []awscache.ResourceToImport
+	for _, summary := range summaries {
+		for _, id := range summary.LogicalResourceIDs {
+			if _, exists := existing[id]; exists {
+				continue
+			}
+			ret = append(ret, awscache.ResourceToImport{
+				ResourceType:       summary.ResourceType,
+				LogicalResourceID:  id,
+				ResourceIdentifier: make(map[string]string, len(summary.ResourceIdentifiers)),
+			})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].LogicalResourceID < ret[j].LogicalResourceID
+	})
+	return ret
+}
+
+// unretained lists the resources that would be deleted with the stack if an import rolled back
+func unretained(resources []awscache.ResourceToImport, template map[string]templateResource) []string {
+	var ret []string
+	for _, r := range resources {
+		if template[r.LogicalResourceID].DeletionPolicy != "Retain" {
+			ret = append(ret, r.LogicalResourceID)
+		}
+	}
+	return ret
+}
+
+func (s *importCommand) commandRun(cmd *cobra.Command, args []string) error {
+	template := args[0]
+	params := args[1]
+	ctx := s.ContextFinder.Ctx()
+	fname := s.T.ParameterFilename(template, params)
+	in, err := templatereader.LoadCreateChangeSet(fname, s.Ctx, s.Logger)
+	if err != nil {
+		return errors.Wrap(err, "unable to load params")
+	}
+	if in.StackSet != nil || len(in.Targets) != 0 {
+		return errors.Errorf("%s deploys a stack set or to several targets: import only supports a single stack", fname)
+	}
+	if in.TemplateBody == nil {
+		return errors.Errorf("%s has no TemplateBody: import needs it to check the DeletionPolicy of each resource", fname)
+	}
+	declared, err := templateResources(*in.TemplateBody)
+	if err != nil {
+		return err
+	}
+	ctx, unlock, err := s.Locks.lock(ctx, s.T.BaseDir, in)
+	if err != nil {
+		return errors.Wrap(err, "unable to lock stack")
+	}
+	defer unlock()
+	ses, err := s.AWSCache.SessionAs(in.Profile, in.Region, in.AssumeRoleARN)
+	if err != nil {
+		return errors.Wrapf(err, "unable to fetch AWS session for profile %s", in.Profile)
+	}
+	stack, err := ses.DescribeStack(ctx, *in.StackName)
+	if err != nil {
+		return err
+	}
+	existing := map[string]struct{}{}
+	if stack != nil {
+		summaries, err := ses.ListStackResources(ctx, *stack.StackId)
+		if err != nil {
+			return err
+		}
+		for _, r := range summaries {
+			existing[emptyOnNil(r.LogicalResourceId)] = struct{}{}
+		}
+	}
+	if err := ses.FixTemplateBody(ctx, &in.CreateChangeSetInput, in.Bucket, s.Logger); err != nil {
+		return errors.Wrap(err, "unable to fix template body with s3")
+	}
+	summaries, err := ses.ResourceIdentifiers(ctx, in.TemplateBody, in.TemplateURL)
+	if err != nil {
+		return err
+	}
+	resources := importCandidates(summaries, existing)
+	if len(resources) == 0 {
+		return display(cmd.OutOrStdout(), s.Output, printableString(fmt.Sprintf("every resource of %s is already in stack %s: nothing to import\n", fname, *in.StackName)))
+	}
+	if missing := unretained(resources, declared); len(missing) != 0 {
+		return errors.Errorf("resources to import must set DeletionPolicy: Retain, which %s do not", strings.Join(missing, ", "))
+	}
+	if err := s.identify(ctx, cmd.ErrOrStderr(), resources, summaries); err != nil {
+		return err
+	}
+	out, err := ses.CreateImportChangesetWaitForStatus(ctx, &in.CreateChangeSetInput, stack, resources, s.Logger)
+	if err != nil {
+		return errors.Wrap(err, "unable to create import changeset")
+	}
+	stat := readyStatus(ses, template, fname, in, stack, &statuscache.Entry{
+		Computed:  time.Now(),
+		Changeset: out,
+	})
+	data, err := inspectFromStatus(stat)
+	if err != nil {
+		return err
+	}
+	return s.Execute.confirmAndExecute(ctx, cmd, data, deployOptions{
+		AutoConfirm:    s.autoConfirm,
+		OverridePolicy: s.overridePolicy,
+		DeployTimeout:  s.deployTimeout,
+		IdleTimeout:    s.idleTimeout,
+		Source:         deployhistory.SourceImport,
+	})
+}
+
+// identify fills in the identifying properties of each resource to import, from the --identifiers file or by
+// prompting for them
+func (s *importCommand) identify(ctx context.Context, out io.Writer, resources []awscache.ResourceToImport, summaries []awscache.ResourceIdentifierSummary) error {
+	properties := make(map[string][]string, len(summaries))
+	for _, summary := range summaries {
+		properties[summary.ResourceType] = summary.ResourceIdentifiers
+	}
+	known := map[string]map[string]string{}
+	if s.identifiers != "" {
+		b, err := ioutil.ReadFile(s.identifiers)
+		if err != nil {
+			return errors.Wrapf(err, "unable to read identifiers file %s", s.identifiers)
+		}
+		if err := json.Unmarshal(b, &known); err != nil {
+			return errors.Wrapf(err, "invalid identifiers file %s", s.identifiers)
+		}
+	}
+	for _, r := range resources {
+		for _, p := range properties[r.ResourceType] {
+			if v := known[r.LogicalResourceID][p]; v != "" {
+				r.ResourceIdentifier[p] = v
+				continue
+			}
+			if s.identifiers != "" || s.autoConfirm {
+				return errors.Errorf("no %s given for %s (%s)", p, r.LogicalResourceID, r.ResourceType)
+			}
+			v, ok := ask(s.Execute.Input, out, fmt.Sprintf("%s of existing %s to import as %s", p, r.ResourceType, r.LogicalResourceID), 3, ctx.Done())
+			if !ok {
+				return errors.Errorf("no %s given for %s", p, r.LogicalResourceID)
+			}
+			r.ResourceIdentifier[p] = v
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package cobracmds
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cep21/cfmanage/internal/awscache"
+)
+
+func TestImportCandidates(t *testing.T) {
+	summaries := []awscache.ResourceIdentifierSummary{
+		{ResourceType: "AWS::S3::Bucket", LogicalResourceIDs: []string{"Logs", "Assets"}, ResourceIdentifiers: []string{"BucketName"}},
+		{ResourceType: "AWS::DynamoDB::Table", LogicalResourceIDs: []string{"Table"}, ResourceIdentifiers: []string{"TableName"}},
+	}
+	got := importCandidates(summaries, map[string]struct{}{"Logs": {}})
+	want := []awscache.ResourceToImport{
+		{ResourceType: "AWS::S3::Bucket", LogicalResourceID: "Assets", ResourceIdentifier: map[string]string{}},
+		{ResourceType: "AWS::DynamoDB::Table", LogicalResourceID: "Table", ResourceIdentifier: map[string]string{}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("candidates %+v, want %+v", got, want)
+	}
+	if got := importCandidates(summaries, map[string]struct{}{"Logs": {}, "Assets": {}, "Table": {}}); len(got) != 0 {
+		t.Fatalf("a stack with every resource has candidates %+v", got)
+	}
+}
+
+func TestUnretained(t *testing.T) {
+	template, err := templateResources(`
+Resources:
+  Assets:
+    Type: AWS::S3::Bucket
+    DeletionPolicy: Retain
+  Table:
+    Type: AWS::DynamoDB::Table
+    DeletionPolicy: Delete
+  Queue:
+    Type: AWS::SQS::Queue
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources := []awscache.ResourceToImport{{LogicalResourceID: "Assets"}, {LogicalResourceID: "Queue"}, {LogicalResourceID: "Table"}}
+	if got, want := unretained(resources, template), []string{"Queue", "Table"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("unretained %v, want %v", got, want)
+	}
+
+	// JSON templates are YAML too
+	template, err = templateResources(`{"Resources": {"Assets": {"Type": "AWS::S3::Bucket", "DeletionPolicy": "Retain"}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := unretained(resources[:1], template); len(got) != 0 {
+		t.Fatalf("a retained resource is unretained: %v", got)
+	}
+}
@@ -9,9 +9,11 @@ import (
 	"github.com/cep21/cfmanage/internal/awscache"
 	"github.com/cep21/cfmanage/internal/cleanup"
 	"github.com/cep21/cfmanage/internal/ctxfinder"
+	"github.com/cep21/cfmanage/internal/formatter"
 	"github.com/cep21/cfmanage/internal/logger"
+	"github.com/cep21/cfmanage/internal/policy"
 	"github.com/cep21/cfmanage/internal/templatereader"
-	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
@@ -20,9 +22,13 @@ type inspectCommand struct {
 	T             *templatereader.TemplateFinder
 	Ctx           *templatereader.CreateChangeSetTemplate
 	Logger        *logger.Logger
-	JSON          *bool
+	Output        *outputFormat
 	ContextFinder *ctxfinder.ContextFinder
 	Cleanup       *cleanup.Cleanup
+	Locks         *stackLocks
+	Policies      *stackPolicies
+	exitCodes     exitCodes
+	detectDrift   bool
 }
 
 func (s *inspectCommand) Cobra() *cobra.Command {
@@ -33,7 +39,18 @@ func (s *inspectCommand) Cobra() *cobra.Command {
 		Example:   "cfexecute inspect infra canary",
 	}
 	cmd.Args = validateTemplateParam(s.T)
-	cmd.RunE = commonRunCommand(s.ContextFinder, s.model, s.JSON)
+	cmd.Flags().BoolVar(&s.detectDrift, "detect-drift", false, "Check each instance of a stack set for drift before showing it.  Takes as long as a stack set operation")
+	s.exitCodes.register(cmd)
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		data, err := s.model(s.ContextFinder.Ctx(), cmd, args)
+		if err != nil {
+			return errors.Wrap(err, "unable to load data for templates")
+		}
+		if err := display(cmd.OutOrStdout(), s.Output, data); err != nil {
+			return err
+		}
+		return s.exitCodes.check(cmd, []stackStatus{data.stackStatus})
+	}
 	return cmd
 }
 
@@ -69,15 +86,19 @@ func printParams(out io.Writer, title string, params []param) error {
 		_, err := fmt.Fprintf(out, "<NONE>\n")
 		return err
 	}
-	table4 := tablewriter.NewWriter(out)
-	table4.SetHeader([]string{"Key", "Value"})
+	renderTable(out, paramsTable(title, params))
+	return nil
+}
+
+func paramsTable(title string, params []param) formatter.Table {
+	ret := formatter.Table{
+		Title:  title,
+		Header: []string{"Key", "Value"},
+	}
 	for _, p := range params {
-		table4.Append([]string{
-			p.Key, p.Value,
-		})
+		ret.Rows = append(ret.Rows, []string{p.Key, p.Value})
 	}
-	table4.Render()
-	return nil
+	return ret
 }
 
 type inspectCommandModel struct {
@@ -87,6 +108,8 @@ type inspectCommandModel struct {
 	Parameters  []param
 	Outputs     []param
 	Changes     []param
+	Policy      policy.Violations   `json:",omitempty"`
+	Destructive []destructiveChange `json:",omitempty"`
 }
 
 func (i *inspectCommandModel) HumanReadable(out io.Writer) error {
@@ -106,7 +129,40 @@ func (i *inspectCommandModel) HumanReadable(out io.Writer) error {
 	if err := printParams(out, "Changes", i.Changes); err != nil {
 		return err
 	}
-	return nil
+	if i.stackSet != nil {
+		instances := stackSetInstancesTable([]stackStatus{i.stackStatus})
+		if _, err := fmt.Fprintf(out, "%s\n", instances.Title); err != nil {
+			return err
+		}
+		renderTable(out, instances)
+	}
+	if err := printPolicy(out, i.Policy); err != nil {
+		return err
+	}
+	return printDestructive(out, i.Destructive)
+}
+
+func (i *inspectCommandModel) Tables() []formatter.Table {
+	ret := []formatter.Table{
+		{
+			Title:  "Stack summary",
+			Header: statusColumns(),
+			Rows:   [][]string{i.stackStatus.row()},
+		},
+		paramsTable("Parameters", i.Parameters),
+		paramsTable("Outputs", i.Outputs),
+		paramsTable("Changes", i.Changes),
+	}
+	if i.stackSet != nil {
+		ret = append(ret, stackSetInstancesTable([]stackStatus{i.stackStatus}))
+	}
+	if len(i.Policy) != 0 {
+		ret = append(ret, policyTable(i.Policy))
+	}
+	if len(i.Destructive) != 0 {
+		ret = append(ret, destructiveTable(i.Destructive))
+	}
+	return ret
 }
 
 type param struct {
@@ -114,17 +170,40 @@ type param struct {
 	Value string
 }
 
-func (s *inspectCommand) model(ctx context.Context, cmd *cobra.Command, args []string) (HumanPrintable, error) {
+func (s *inspectCommand) model(ctx context.Context, cmd *cobra.Command, args []string) (*inspectCommandModel, error) {
 	template := args[0]
 	params := args[1]
-	return populateInspectCommand(ctx, s.Ctx, s.Logger, s.AWSCache, s.T, template, params)
+	ret, err := populateInspectCommand(ctx, s.Ctx, s.Logger, s.AWSCache, s.T, template, params)
+	if err != nil {
+		return nil, err
+	}
+	if s.detectDrift && ret.stackSet != nil {
+		in := ret.changesetInput
+		ses, err := s.AWSCache.SessionAs(in.Profile, in.Region, in.AssumeRoleARN)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to fetch AWS session for profile %s", in.Profile)
+		}
+		if err := ret.stackSet.detectDrift(ctx, ses, in, s.Logger); err != nil {
+			return nil, err
+		}
+		ret.ChangesetStatus = ret.stackSet.summary()
+	}
+	ret.LockedBy = s.Locks.describe(ctx, ret.changesetInput)
+	if err := s.Policies.evaluate(ctx, ret, false); err != nil {
+		return nil, err
+	}
+	return ret, nil
 }
 
 func populateInspectCommand(ctx context.Context, createTemplate *templatereader.CreateChangeSetTemplate, log *logger.Logger, awsCache *awscache.AWSCache, tfinder *templatereader.TemplateFinder, template string, params string) (*inspectCommandModel, error) {
-	stat, err := populateStatusCommand(ctx, createTemplate, log, awsCache, tfinder, template, params)
+	stat, err := populateStatusCommand(ctx, createTemplate, log, awsCache, tfinder, template, params, nil)
 	if err != nil {
 		return nil, err
 	}
+	return inspectFromStatus(stat)
+}
+
+func inspectFromStatus(stat stackStatus) (*inspectCommandModel, error) {
 	if stat.ChangesetError != nil {
 		return nil, stat.ChangesetError
 	}
@@ -145,6 +224,17 @@ func populateInspectCommand(ctx context.Context, createTemplate *templatereader.
 			})
 		}
 	}
+	if stat.stackSet != nil {
+		ret.Description = stat.Description
+		for _, p := range stat.changesetInput.Parameters {
+			ret.Parameters = append(ret.Parameters, param{
+				Key:   emptyOnNil(p.ParameterKey),
+				Value: emptyOnNil(p.ParameterValue),
+			})
+		}
+		ret.Changes = stat.stackSet.changes()
+		ret.Destructive = stat.stackSet.destructive()
+	}
 	if stat.changeset != nil {
 		ret.Parameters = make([]param, 0, len(stat.changeset.Parameters))
 		for _, p := range stat.changeset.Parameters {
@@ -160,6 +250,7 @@ func populateInspectCommand(ctx context.Context, createTemplate *templatereader.
 				Value: emptyOnNil(c.ResourceChange.Action),
 			})
 		}
+		ret.Destructive = destructiveChanges(stat.changeset.Changes)
 	}
 	return ret, nil
 }
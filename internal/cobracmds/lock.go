@@ -0,0 +1,182 @@
+package cobracmds
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cep21/cfmanage/internal/awscache"
+	"github.com/cep21/cfmanage/internal/ctxfinder"
+	"github.com/cep21/cfmanage/internal/gitinfo"
+	"github.com/cep21/cfmanage/internal/logger"
+	"github.com/cep21/cfmanage/internal/stacklock"
+	"github.com/cep21/cfmanage/internal/templatereader"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// stackLocks finds the lock backend a params file asks for
+type stackLocks struct {
+	AWSCache *awscache.AWSCache
+	Logger   *logger.Logger
+	Dir      string
+}
+
+// locker returns the Locker and lock key for a stack, or a nil Locker if the stack is configured without locking
+func (s *stackLocks) locker(in *templatereader.ChangesetInput) (*stacklock.Locker, string, error) {
+	cfg := in.Lock
+	if cfg == nil {
+		cfg = &templatereader.LockConfig{}
+	}
+	ses, err := s.AWSCache.SessionAs(in.Profile, in.Region, in.AssumeRoleARN)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "unable to fetch AWS session for profile %s", in.Profile)
+	}
+	key, err := stackKey(ses, *in.StackName)
+	if err != nil {
+		return nil, "", err
+	}
+	ret := &stacklock.Locker{
+		Logger: s.Logger,
+	}
+	if cfg.TTL != "" {
+		if ret.TTL, err = time.ParseDuration(cfg.TTL); err != nil {
+			return nil, "", errors.Wrapf(err, "invalid lock ttl %s", cfg.TTL)
+		}
+	}
+	switch cfg.Backend {
+	case "none":
+		return nil, key, nil
+	case "", "file":
+		ret.Backend = &stacklock.FileBackend{
+			Dir: s.Dir,
+		}
+	case "s3":
+		ret.Backend = &stacklock.S3Backend{
+			Client: ses.S3(),
+			Bucket: cfg.Bucket,
+			Prefix: cfg.Prefix,
+		}
+	case "dynamodb":
+		ret.Backend = &stacklock.DynamoDBBackend{
+			Client: ses.DynamoDB(),
+			Table:  cfg.Table,
+		}
+	default:
+		return nil, "", errors.Errorf("unknown lock backend %s", cfg.Backend)
+	}
+	return ret, key, nil
+}
+
+type heldLockKey struct{}
+
+// heldLock is the lock taken by stackLocks.lock for ctx, or nil if none was
+func heldLock(ctx context.Context) *stacklock.Lock {
+	held, _ := ctx.Value(heldLockKey{}).(*stacklock.Lock)
+	return held
+}
+
+// lock takes the lock of a stack.  The returned context carries the lock for heldLock, so a deploy can stop once the
+// lock is lost.  The returned function releases it.
+func (s *stackLocks) lock(ctx context.Context, baseDir string, in *templatereader.ChangesetInput) (context.Context, func(), error) {
+	l, key, err := s.locker(in)
+	if err != nil {
+		return nil, nil, err
+	}
+	if l == nil {
+		return ctx, func() {}, nil
+	}
+	git, err := gitinfo.Describe(ctx, baseDir)
+	if err != nil {
+		s.Logger.Log(2, "unable to describe git commit of %s: %s", baseDir, err.Error())
+	}
+	held, err := l.Lock(ctx, key, git.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	s.Logger.Log(1, "locked %s", key)
+	return context.WithValue(ctx, heldLockKey{}, held), func() {
+		// The command's context may already be dead: still try to release the lock
+		releaseCtx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+		if err := held.Unlock(releaseCtx); err != nil {
+			s.Logger.Log(0, "%s", err.Error())
+		}
+	}, nil
+}
+
+// describe returns who holds the lock of a stack, for display
+func (s *stackLocks) describe(ctx context.Context, in *templatereader.ChangesetInput) string {
+	if in == nil {
+		return ""
+	}
+	l, key, err := s.locker(in)
+	if err != nil {
+		return "unknown: " + err.Error()
+	}
+	if l == nil {
+		return ""
+	}
+	info, err := l.Backend.Get(ctx, key)
+	if err != nil {
+		return "unknown: " + err.Error()
+	}
+	if info == nil {
+		return ""
+	}
+	if info.Expired(time.Now()) {
+		return info.String() + " (expired)"
+	}
+	return info.String()
+}
+
+type unlockCommand struct {
+	T             *templatereader.TemplateFinder
+	Ctx           *templatereader.CreateChangeSetTemplate
+	Logger        *logger.Logger
+	Output        *outputFormat
+	ContextFinder *ctxfinder.ContextFinder
+	Locks         *stackLocks
+	force         bool
+}
+
+func (s *unlockCommand) Cobra() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:       "unlock [template] [params]",
+		ValidArgs: s.T.ValidTemplatesAndParams(),
+		Short:     "Remove the lock someone else holds on a stack",
+		Example:   "cfexecute unlock infra canary --force",
+	}
+	cmd.Flags().BoolVar(&s.force, "force", false, "Remove the lock even though another process holds it")
+	cmd.Args = validateTemplateParam(s.T)
+	cmd.RunE = commonRunCommand(s.ContextFinder, s.model, s.Output)
+	return cmd
+}
+
+func (s *unlockCommand) model(ctx context.Context, cmd *cobra.Command, args []string) (HumanPrintable, error) {
+	in, err := templatereader.LoadCreateChangeSet(s.T.ParameterFilename(args[0], args[1]), s.Ctx, s.Logger)
+	if err != nil {
+		return nil, err
+	}
+	l, key, err := s.Locks.locker(in)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil {
+		return printableString("locking is disabled for this stack\n"), nil
+	}
+	info, err := l.Backend.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return printableString(fmt.Sprintf("%s is not locked\n", key)), nil
+	}
+	if !s.force {
+		return nil, errors.Errorf("%s is locked by %s: pass --force to remove the lock", key, info.String())
+	}
+	if err := l.Backend.ForceRelease(ctx, key); err != nil {
+		return nil, err
+	}
+	return printableString(fmt.Sprintf("removed lock on %s held by %s\n", key, info.String())), nil
+}
@@ -0,0 +1,99 @@
+package cobracmds
+
+import (
+	"time"
+
+	"github.com/cep21/cfmanage/internal/logger"
+	"github.com/cep21/cfmanage/internal/notify"
+	"github.com/cep21/cfmanage/internal/schema"
+	"github.com/cep21/cfmanage/internal/stacklock"
+	"github.com/cep21/cfmanage/internal/templatereader"
+	"github.com/pkg/errors"
+)
+
+// stackNotifications posts deploy events to the webhooks of a params file
+type stackNotifications struct {
+	Logger *logger.Logger
+}
+
+// notifier returns the notifier of the params file, or nil if it has no webhooks
+func (s *stackNotifications) notifier(in *templatereader.ChangesetInput) (*notify.Notifier, error) {
+	cfg := in.Notify
+	if cfg == nil || len(cfg.Webhooks) == 0 {
+		return nil, nil
+	}
+	ret := &notify.Notifier{
+		Retries: 3,
+		Logger:  s.Logger,
+	}
+	if cfg.Timeout != "" {
+		var err error
+		if ret.Timeout, err = time.ParseDuration(cfg.Timeout); err != nil {
+			return nil, errors.Wrapf(err, "invalid notify timeout %s", cfg.Timeout)
+		}
+	}
+	if cfg.Retries != nil {
+		ret.Retries = *cfg.Retries
+	}
+	for _, w := range cfg.Webhooks {
+		if _, err := notify.Payload(w.Format, schema.DeployEvent{}); err != nil {
+			return nil, err
+		}
+		for _, e := range w.Events {
+			if e != schema.DeployStarted && e != schema.DeploySucceeded && e != schema.DeployFailed {
+				return nil, errors.Errorf("unknown webhook event %s: expected %s, %s or %s", e, schema.DeployStarted, schema.DeploySucceeded, schema.DeployFailed)
+			}
+		}
+		ret.Webhooks = append(ret.Webhooks, notify.Webhook{
+			URL:    w.URL,
+			Format: w.Format,
+			Events: w.Events,
+		})
+	}
+	return ret, nil
+}
+
+func deployEvent(data *inspectCommandModel, event string, source string) schema.DeployEvent {
+	ret := schema.NewHeader("deployEvent")
+	return schema.DeployEvent{
+		Header:       ret,
+		Event:        event,
+		StackName:    data.StackName,
+		StackID:      emptyOnNil(data.changeset.StackId),
+		AccountID:    data.AccountID,
+		Region:       data.Region,
+		ChangesetARN: emptyOnNil(data.changeset.ChangeSetId),
+		Source:       source,
+		User:         stacklock.Owner(),
+		Changes:      schema.NewChangeSummary(data.changeset.Changes),
+		Time:         time.Now(),
+	}
+}
+
+// started posts that a deploy of data started.  Failing to notify never fails the deploy.
+func (s *stackNotifications) started(n *notify.Notifier, data *inspectCommandModel, source string) {
+	if n == nil {
+		return
+	}
+	s.send(n, deployEvent(data, schema.DeployStarted, source))
+}
+
+// finished posts how a deploy of data that started at start ended
+func (s *stackNotifications) finished(n *notify.Notifier, data *inspectCommandModel, source string, start time.Time, deployErr error) {
+	if n == nil {
+		return
+	}
+	e := deployEvent(data, schema.DeploySucceeded, source)
+	e.DurationSeconds = e.Time.Sub(start).Seconds()
+	if deployErr != nil {
+		e.Event = schema.DeployFailed
+		e.Error = schema.NewError(deployErr)
+	}
+	s.send(n, e)
+}
+
+func (s *stackNotifications) send(n *notify.Notifier, e schema.DeployEvent) {
+	if err := n.Notify(e); err != nil {
+		s.Logger.Log(0, "unable to send %s notification of %s: %s", e.Event, e.StackName, err.Error())
+	}
+}
@@ -0,0 +1,79 @@
+package cobracmds
+
+import (
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/cep21/cfmanage/internal/formatter"
+	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
+)
+
+// renderTable writes t as a table for people.  The title is left to the caller.
+func renderTable(out io.Writer, t formatter.Table) {
+	table := tablewriter.NewWriter(out)
+	table.SetHeader(t.Header)
+	table.AppendBulk(t.Rows)
+	table.Render()
+}
+
+// outputFormat is the format commands display their models in
+type outputFormat struct {
+	mu        sync.Mutex
+	name      string
+	formatter formatter.Formatter
+}
+
+func outputFormatUsage() string {
+	return "Output format: one of " + strings.Join(formatter.Names(), ", ") + ".  template and template-file take a Go text/template or a file of one, as in template='{{ .StackName }}'"
+}
+
+// set picks the format from the --output and --json flags
+func (o *outputFormat) set(spec string, useJSON bool) error {
+	if useJSON {
+		if spec != "" && spec != "json" {
+			return errors.Errorf("--json conflicts with --output %s", spec)
+		}
+		spec = "json"
+	}
+	if spec == "" {
+		spec = "table"
+	}
+	f, err := formatter.New(spec)
+	if err != nil {
+		return err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.name = strings.SplitN(spec, "=", 2)[0]
+	o.formatter = f
+	return nil
+}
+
+// get returns the formatter to display models with.  It is a table until set.
+func (o *outputFormat) get() formatter.Formatter {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.formatter == nil {
+		o.name = "table"
+		o.formatter, _ = formatter.New(o.name)
+	}
+	return o.formatter
+}
+
+// isJSON is true if models are displayed as JSON documents or lines of them
+func (o *outputFormat) isJSON() bool {
+	o.get()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.name == "json" || o.name == "ndjson"
+}
+
+// isTable is true if models are displayed for people rather than programs
+func (o *outputFormat) isTable() bool {
+	o.get()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.name == "table"
+}
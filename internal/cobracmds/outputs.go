@@ -0,0 +1,291 @@
+package cobracmds
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cep21/cfmanage/internal/awscache"
+	"github.com/cep21/cfmanage/internal/ctxfinder"
+	"github.com/cep21/cfmanage/internal/formatter"
+	"github.com/cep21/cfmanage/internal/logger"
+	"github.com/cep21/cfmanage/internal/schema"
+	"github.com/cep21/cfmanage/internal/templatereader"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+type outputsCommand struct {
+	AWSCache      *awscache.AWSCache
+	T             *templatereader.TemplateFinder
+	Ctx           *templatereader.CreateChangeSetTemplate
+	Logger        *logger.Logger
+	Output        *outputFormat
+	ContextFinder *ctxfinder.ContextFinder
+	all           bool
+	format        string
+}
+
+func (s *outputsCommand) Cobra() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:       "outputs [template] [params]",
+		ValidArgs: s.T.ValidTemplatesAndParams(),
+		Short:     "Print the outputs of deployed stacks",
+		Long: "Print the outputs of a deployed stack, or with --all of every deployed stack.  The env format writes them as shell exports.  " +
+			"With --all, each variable is prefixed with its stack name.",
+		Example: "eval $(cfexecute outputs infra canary --format env)",
+	}
+	cmd.Flags().BoolVar(&s.all, "all", false, "Print the outputs of every stack")
+	cmd.Flags().StringVar(&s.format, "format", "", "Same as --output, for this command")
+	cmd.Args = func(cmd *cobra.Command, args []string) error {
+		if s.all {
+			if len(args) != 0 {
+				return errors.New("--all takes no arguments")
+			}
+			return nil
+		}
+		return validateTemplateParam(s.T)(cmd, args)
+	}
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		output := s.Output
+		if s.format != "" {
+			if cmd.Flags().Changed("output") || cmd.Flags().Changed("json") {
+				return errors.New("--format conflicts with --output and --json")
+			}
+			output = &outputFormat{}
+			if err := output.set(s.format, false); err != nil {
+				return err
+			}
+		}
+		data, err := s.model(s.ContextFinder.Ctx(), args)
+		if err != nil {
+			return errors.Wrap(err, "unable to load data for templates")
+		}
+		return display(cmd.OutOrStdout(), output, data)
+	}
+	return cmd
+}
+
+type stackOutput struct {
+	Key         string
+	Value       string
+	Description string
+	ExportName  string
+}
+
+type stackOutputs struct {
+	StackName string
+	StackID   string
+	AccountID string
+	Region    string
+	Outputs   []stackOutput
+}
+
+type outputsCommandModel struct {
+	Stacks []stackOutputs
+	// prefixed variables with the stack name, so the outputs of several stacks do not collide
+	prefixed bool
+}
+
+func (o *outputsCommandModel) HumanReadable(out io.Writer) error {
+	for _, t := range o.Tables() {
+		if _, err := fmt.Fprintf(out, "%s\n", t.Title); err != nil {
+			return err
+		}
+		renderTable(out, t)
+	}
+	return nil
+}
+
+func (o *outputsCommandModel) Tables() []formatter.Table {
+	ret := make([]formatter.Table, 0, len(o.Stacks))
+	for _, st := range o.Stacks {
+		t := formatter.Table{
+			Title:  st.StackName,
+			Header: []string{"Key", "Value", "Description", "ExportName"},
+		}
+		for _, out := range st.Outputs {
+			t.Rows = append(t.Rows, []string{out.Key, out.Value, out.Description, out.ExportName})
+		}
+		ret = append(ret, t)
+	}
+	return ret
+}
+
+func (o *outputsCommandModel) Items() []interface{} {
+	ret := make([]interface{}, 0, len(o.Stacks))
+	for _, st := range o.Stacks {
+		ret = append(ret, st.schema())
+	}
+	return ret
+}
+
+func (o *outputsCommandModel) Variables() [][2]string {
+	var ret [][2]string
+	for _, st := range o.Stacks {
+		for _, out := range st.Outputs {
+			name := out.Key
+			if o.prefixed {
+				name = st.StackName + "_" + out.Key
+			}
+			ret = append(ret, [2]string{name, out.Value})
+		}
+	}
+	return ret
+}
+
+func (st *stackOutputs) schema() schema.StackOutputs {
+	ret := schema.StackOutputs{
+		StackName: st.StackName,
+		StackID:   st.StackID,
+		AccountID: st.AccountID,
+		Region:    st.Region,
+		Outputs:   make([]schema.Output, 0, len(st.Outputs)),
+	}
+	for _, out := range st.Outputs {
+		ret.Outputs = append(ret.Outputs, schema.Output(out))
+	}
+	return ret
+}
+
+func (o outputsCommandModel) MarshalJSON() ([]byte, error) {
+	ret := schema.OutputList{
+		Header: schema.NewHeader("outputs"),
+		Stacks: make([]schema.StackOutputs, 0, len(o.Stacks)),
+	}
+	for _, st := range o.Stacks {
+		ret.Stacks = append(ret.Stacks, st.schema())
+	}
+	return json.Marshal(ret)
+}
+
+// describeOutputs returns the outputs of the stack of a params file, or nil if the stack does not exist
+func describeOutputs(ctx context.Context, awsCache *awscache.AWSCache, in *templatereader.ChangesetInput) (*stackOutputs, error) {
+	ses, err := awsCache.SessionAs(in.Profile, in.Region, in.AssumeRoleARN)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to fetch AWS session for profile %s", in.Profile)
+	}
+	stack, err := ses.DescribeStack(ctx, *in.StackName)
+	if err != nil {
+		return nil, err
+	}
+	if stack == nil {
+		return nil, nil
+	}
+	ret := &stackOutputs{
+		StackName: *in.StackName,
+		StackID:   emptyOnNil(stack.StackId),
+		AccountID: readable(ses.AccountID()),
+		Region:    ses.Region(),
+		Outputs:   make([]stackOutput, 0, len(stack.Outputs)),
+	}
+	for _, o := range stack.Outputs {
+		ret.Outputs = append(ret.Outputs, stackOutput{
+			Key:         emptyOnNil(o.OutputKey),
+			Value:       emptyOnNil(o.OutputValue),
+			Description: emptyOnNil(o.Description),
+			ExportName:  emptyOnNil(o.ExportName),
+		})
+	}
+	return ret, nil
+}
+
+func (s *outputsCommand) model(ctx context.Context, args []string) (*outputsCommandModel, error) {
+	if !s.all {
+		in, err := templatereader.LoadCreateChangeSet(s.T.ParameterFilename(args[0], args[1]), s.Ctx, s.Logger)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to load params")
+		}
+		st, err := describeOutputs(ctx, s.AWSCache, in)
+		if err != nil {
+			return nil, err
+		}
+		if st == nil {
+			return nil, errors.Errorf("stack %s does not exist", *in.StackName)
+		}
+		return &outputsCommandModel{
+			Stacks: []stackOutputs{*st},
+		}, nil
+	}
+	templates, err := s.T.ListTemplates()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list all templates")
+	}
+	var fnames []string
+	for _, t := range templates {
+		params, err := s.T.ListParameters(t)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to list parameters for template %s", t)
+		}
+		for _, p := range params {
+			fnames = append(fnames, s.T.ParameterFilename(t, p))
+		}
+	}
+	found := make([]*stackOutputs, len(fnames))
+	eg, egCtx := errgroup.WithContext(ctx)
+	for idx, fname := range fnames {
+		idx, fname := idx, fname
+		eg.Go(func() error {
+			in, err := templatereader.LoadCreateChangeSet(fname, s.Ctx, s.Logger)
+			if err != nil {
+				return errors.Wrapf(err, "unable to load params %s", fname)
+			}
+			found[idx], err = describeOutputs(egCtx, s.AWSCache, in)
+			if found[idx] == nil && err == nil {
+				s.Logger.Log(1, "skipping %s: stack %s does not exist", fname, *in.StackName)
+			}
+			return err
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	ret := &outputsCommandModel{
+		prefixed: true,
+	}
+	for _, st := range found {
+		if st != nil {
+			ret.Stacks = append(ret.Stacks, *st)
+		}
+	}
+	return ret, nil
+}
+
+// writeOutputs saves the outputs of the stack of a params file into dir, as StackName.json in the json output format
+// and StackName.env in the env output format
+func writeOutputs(ctx context.Context, awsCache *awscache.AWSCache, in *templatereader.ChangesetInput, dir string) error {
+	st, err := describeOutputs(ctx, awsCache, in)
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		return errors.Errorf("stack %s does not exist", *in.StackName)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "unable to make outputs directory %s", dir)
+	}
+	model := &outputsCommandModel{
+		Stacks: []stackOutputs{*st},
+	}
+	for _, format := range []string{"json", "env"} {
+		f, err := formatter.New(format)
+		if err != nil {
+			return err
+		}
+		var b bytes.Buffer
+		if err := f.Format(&b, model); err != nil {
+			return err
+		}
+		fname := filepath.Join(dir, st.StackName+"."+format)
+		if err := ioutil.WriteFile(fname, b.Bytes(), 0644); err != nil {
+			return errors.Wrapf(err, "unable to write outputs to %s", fname)
+		}
+	}
+	return nil
+}
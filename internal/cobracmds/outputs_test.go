@@ -0,0 +1,80 @@
+package cobracmds
+
+import (
+	"bytes"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/cep21/cfmanage/internal/formatter"
+)
+
+func testOutputsModel(prefixed bool) *outputsCommandModel {
+	return &outputsCommandModel{
+		Stacks: []stackOutputs{
+			{StackName: "infra-canary", Outputs: []stackOutput{
+				{Key: "Url", Value: "https://canary.example.com/?a=1&b=2"},
+				{Key: "Motd", Value: `it's "$HOME" and $(date) or ` + "`id`"},
+			}},
+			{StackName: "infra-prod", Outputs: []stackOutput{
+				{Key: "Url", Value: "https://example.com"},
+				{Key: "Multiline", Value: "first\nsecond\\n"},
+				{Key: "Empty"},
+			}},
+		},
+		prefixed: prefixed,
+	}
+}
+
+func TestOutputsVariables(t *testing.T) {
+	got := testOutputsModel(true).Variables()
+	want := [][2]string{
+		{"infra-canary_Url", "https://canary.example.com/?a=1&b=2"},
+		{"infra-canary_Motd", `it's "$HOME" and $(date) or ` + "`id`"},
+		{"infra-prod_Url", "https://example.com"},
+		{"infra-prod_Multiline", "first\nsecond\\n"},
+		{"infra-prod_Empty", ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("variables %q, want %q", got, want)
+	}
+	if got := testOutputsModel(false).Variables()[0][0]; got != "Url" {
+		t.Fatalf("an unprefixed variable is %s, want Url", got)
+	}
+}
+
+// The env format must give a shell that evals it every value exactly, whatever characters it contains
+func TestOutputsEnvQuoting(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("env output is tested with sh")
+	}
+	model := testOutputsModel(true)
+	f, err := formatter.New("env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var script bytes.Buffer
+	if err := f.Format(&script, model); err != nil {
+		t.Fatal(err)
+	}
+	vars := model.Variables()
+	for _, v := range vars {
+		// Each value between markers, so trailing newlines and empty values are kept
+		script.WriteString(`printf '<%s>' "$` + formatter.EnvName(v[0]) + `"` + "\n")
+	}
+	cmd := exec.Command("sh", "-c", script.String())
+	cmd.Env = []string{}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("sh could not eval\n%s\n%v", script.String(), err)
+	}
+	var want strings.Builder
+	for _, v := range vars {
+		want.WriteString("<" + v[1] + ">")
+	}
+	if string(out) != want.String() {
+		t.Fatalf("sh read\n%s\nwant\n%s", out, want.String())
+	}
+}
@@ -0,0 +1,107 @@
+package cobracmds
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/cep21/cfmanage/internal/awscache"
+	"github.com/cep21/cfmanage/internal/formatter"
+	"github.com/cep21/cfmanage/internal/logger"
+	"github.com/cep21/cfmanage/internal/policy"
+	"github.com/cep21/cfmanage/internal/templatereader"
+	"github.com/pkg/errors"
+)
+
+// stackPolicies evaluates the project's guardrail policies against changesets
+type stackPolicies struct {
+	AWSCache *awscache.AWSCache
+	T        *templatereader.TemplateFinder
+	Logger   *logger.Logger
+	// File holds the policies.  Empty means policies.json in the template directory.
+	File string
+}
+
+func (s *stackPolicies) filename() string {
+	if s.File != "" {
+		return s.File
+	}
+	return filepath.Join(s.T.BaseDir, "policies.json")
+}
+
+// evaluate sets the policy violations of an inspected changeset
+func (s *stackPolicies) evaluate(ctx context.Context, data *inspectCommandModel, autoConfirm bool) error {
+	if err := s.evaluateStatus(ctx, &data.stackStatus, autoConfirm); err != nil {
+		return err
+	}
+	data.Policy = data.policy
+	return nil
+}
+
+// evaluateStatus sets the policy violations of a stack's changeset
+func (s *stackPolicies) evaluateStatus(ctx context.Context, st *stackStatus, autoConfirm bool) error {
+	if st.changeset == nil {
+		return nil
+	}
+	set, err := policy.Load(s.filename())
+	if err != nil {
+		return err
+	}
+	if len(set.Rules) == 0 {
+		return nil
+	}
+	in := st.changesetInput
+	evalInput := policy.Input{
+		StackName:   *in.StackName,
+		Changes:     st.changeset.Changes,
+		Tags:        in.Tags,
+		AutoConfirm: autoConfirm,
+	}
+	if keys := set.ResourceTagKeys(*in.StackName); len(keys) != 0 && st.cfStack != nil {
+		ses, err := s.AWSCache.SessionAs(in.Profile, in.Region, in.AssumeRoleARN)
+		if err != nil {
+			return errors.Wrapf(err, "unable to fetch AWS session for profile %s", in.Profile)
+		}
+		if evalInput.ResourceTags, err = ses.ResourceTags(ctx, *st.cfStack.StackId, keys); err != nil {
+			return err
+		}
+	}
+	st.policy = set.Evaluate(evalInput)
+	s.Logger.Log(1, "%d policy violations for %s", len(st.policy), *in.StackName)
+	return nil
+}
+
+// checkOverride fails if data has blocking violations, unless they are overridden with a reason
+func checkOverride(data *inspectCommandModel, overrideReason string) error {
+	blocking := data.Policy.Blocking()
+	if len(blocking) == 0 {
+		return nil
+	}
+	if overrideReason == "" {
+		return errors.Errorf("%d blocking policy violations (%s).  Pass --override-policy with a reason to execute anyway", len(blocking), blocking.String())
+	}
+	return nil
+}
+
+func printPolicy(out io.Writer, violations policy.Violations) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintf(out, "Policy\n"); err != nil {
+		return err
+	}
+	renderTable(out, policyTable(violations))
+	return nil
+}
+
+func policyTable(violations policy.Violations) formatter.Table {
+	ret := formatter.Table{
+		Title:  "Policy",
+		Header: []string{"Rule", "Level", "Violation"},
+	}
+	for _, v := range violations {
+		ret.Rows = append(ret.Rows, []string{v.Rule, v.Level, v.Message})
+	}
+	return ret
+}
@@ -0,0 +1,210 @@
+package cobracmds
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/cep21/cfmanage/internal/awscache"
+	"github.com/cep21/cfmanage/internal/ctxfinder"
+	"github.com/cep21/cfmanage/internal/deployhistory"
+	"github.com/cep21/cfmanage/internal/logger"
+	"github.com/cep21/cfmanage/internal/templatereader"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+type recoverCommand struct {
+	AWSCache         *awscache.AWSCache
+	T                *templatereader.TemplateFinder
+	Ctx              *templatereader.CreateChangeSetTemplate
+	Logger           *logger.Logger
+	Output           *outputFormat
+	ContextFinder    *ctxfinder.ContextFinder
+	Locks            *stackLocks
+	Execute          *executeCommand
+	autoConfirm      bool
+	overridePolicy   string
+	allowDestructive bool
+	deployTimeout    time.Duration
+	idleTimeout      time.Duration
+	skip             []string
+}
+
+func (s *recoverCommand) Cobra() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:       "recover [template] [params]",
+		ValidArgs: s.T.ValidTemplatesAndParams(),
+		Short:     "Recover a stack stuck in a failed or in progress state",
+		Long: `Recover a stack stuck in a state execute refuses to touch:
+  UPDATE_ROLLBACK_FAILED:             continue the rollback, optionally skipping resources that cannot roll back
+  ROLLBACK_COMPLETE, ROLLBACK_FAILED: delete the stack left by a failed create and create it again
+  UPDATE_IN_PROGRESS:                 cancel the update`,
+		Example: "cfexecute recover infra canary",
+		RunE:    s.commandRun,
+	}
+	cmd.Flags().BoolVarP(&s.autoConfirm, "auto", "a", false, "Will auto confirm every recovery step")
+	cmd.Flags().BoolVar(&s.allowDestructive, "allow-destructive", false, "Let --auto create the stack again even if that deletes or replaces resources")
+	cmd.Flags().StringVar(&s.overridePolicy, "override-policy", "", "Create the stack again despite blocking policy violations.  The value is the reason, recorded in the deployment history")
+	cmd.Flags().DurationVar(&s.deployTimeout, "deploy-timeout", 0, "If non zero, cancel the stack update if it runs longer than this, then follow the rollback")
+	cmd.Flags().DurationVar(&s.idleTimeout, "idle-timeout", 0, "If non zero, cancel the stack update if no stack events arrive for this long, then follow the rollback")
+	cmd.Flags().StringSliceVar(&s.skip, "skip", nil, "Logical IDs of resources to skip when continuing a rollback.  If unset, you are prompted for each failed resource")
+	cmd.Args = validateTemplateParam(s.T)
+	return cmd
+}
+
+func (s *recoverCommand) commandRun(cmd *cobra.Command, args []string) error {
+	template := args[0]
+	params := args[1]
+	ctx := s.ContextFinder.Ctx()
+	in, err := templatereader.LoadCreateChangeSet(s.T.ParameterFilename(template, params), s.Ctx, s.Logger)
+	if err != nil {
+		return errors.Wrap(err, "unable to load params")
+	}
+	ctx, unlock, err := s.Locks.lock(ctx, s.T.BaseDir, in)
+	if err != nil {
+		return errors.Wrap(err, "unable to lock stack")
+	}
+	defer unlock()
+	ses, err := s.AWSCache.SessionAs(in.Profile, in.Region, in.AssumeRoleARN)
+	if err != nil {
+		return errors.Wrapf(err, "unable to fetch AWS session for profile %s", in.Profile)
+	}
+	stack, err := ses.DescribeStack(ctx, *in.StackName)
+	if err != nil {
+		return err
+	}
+	out := cmd.OutOrStdout()
+	if stack == nil {
+		return display(out, s.Output, printableString(fmt.Sprintf("stack %s does not exist: nothing to recover\n", *in.StackName)))
+	}
+	switch emptyOnNil(stack.StackStatus) {
+	case "UPDATE_ROLLBACK_FAILED":
+		return s.continueRollback(ctx, out, ses, stack)
+	case "ROLLBACK_COMPLETE", "ROLLBACK_FAILED":
+		if err := s.deleteStack(ctx, out, ses, stack); err != nil {
+			return err
+		}
+		return s.Execute.deploy(ctx, cmd, template, params, deployOptions{
+			AutoConfirm:      s.autoConfirm,
+			OverridePolicy:   s.overridePolicy,
+			AllowDestructive: s.allowDestructive,
+			DeployTimeout:    s.deployTimeout,
+			IdleTimeout:      s.idleTimeout,
+			Source:           deployhistory.SourceRecover,
+		})
+	case "UPDATE_IN_PROGRESS":
+		return s.cancelUpdate(ctx, out, ses, stack)
+	}
+	return display(out, s.Output, printableString(fmt.Sprintf("stack %s is %s: nothing to recover\n", *in.StackName, emptyOnNil(stack.StackStatus))))
+}
+
+// confirm asks before a step of the recovery.  Declining is an error, so scripts know the stack was not recovered.
+func (s *recoverCommand) confirm(ctx context.Context, out io.Writer, prompt string) error {
+	if s.autoConfirm || confirm(s.Execute.Input, out, prompt, 3, ctx.Done()) {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return errors.Wrap(ctx.Err(), "cancelled")
+	}
+	return errors.New("cancelled")
+}
+
+func (s *recoverCommand) resourcesToSkip(ctx context.Context, out io.Writer, ses *awscache.AWSClients, stack *cloudformation.Stack) ([]string, error) {
+	if len(s.skip) != 0 || s.autoConfirm {
+		return s.skip, nil
+	}
+	resources, err := ses.ListStackResources(ctx, *stack.StackId)
+	if err != nil {
+		return nil, err
+	}
+	var ret []string
+	for _, r := range resources {
+		if emptyOnNil(r.ResourceStatus) != "UPDATE_FAILED" {
+			continue
+		}
+		prompt := fmt.Sprintf("Skip %s (%s) which failed to roll back: %s", emptyOnNil(r.LogicalResourceId), emptyOnNil(r.ResourceType), emptyOnNil(r.ResourceStatusReason))
+		if confirm(s.Execute.Input, out, prompt, 3, ctx.Done()) {
+			ret = append(ret, emptyOnNil(r.LogicalResourceId))
+		}
+	}
+	return ret, nil
+}
+
+func (s *recoverCommand) continueRollback(ctx context.Context, out io.Writer, ses *awscache.AWSClients, stack *cloudformation.Stack) error {
+	skip, err := s.resourcesToSkip(ctx, out, ses, stack)
+	if err != nil {
+		return err
+	}
+	prompt := fmt.Sprintf("Continue rolling back %s", *stack.StackName)
+	if len(skip) != 0 {
+		prompt += fmt.Sprintf(" skipping %s", strings.Join(skip, ", "))
+	}
+	if err := s.confirm(ctx, out, prompt); err != nil {
+		return errors.Wrapf(err, "not continuing the rollback of %s", *stack.StackName)
+	}
+	return s.follow(ctx, out, ses, stack, []string{"UPDATE_ROLLBACK_COMPLETE"}, []string{"UPDATE_ROLLBACK_FAILED"}, func() error {
+		return ses.ContinueUpdateRollback(ctx, *stack.StackName, skip)
+	})
+}
+
+func (s *recoverCommand) deleteStack(ctx context.Context, out io.Writer, ses *awscache.AWSClients, stack *cloudformation.Stack) error {
+	prompt := fmt.Sprintf("Stack %s never finished creating (%s).  Delete it so it can be created again", *stack.StackName, emptyOnNil(stack.StackStatus))
+	if err := s.confirm(ctx, out, prompt); err != nil {
+		return errors.Wrap(err, "stack must be deleted before it can be created again")
+	}
+	return s.follow(ctx, out, ses, stack, []string{"DELETE_COMPLETE"}, []string{"DELETE_FAILED"}, func() error {
+		return ses.DeleteStack(ctx, *stack.StackId)
+	})
+}
+
+func (s *recoverCommand) cancelUpdate(ctx context.Context, out io.Writer, ses *awscache.AWSClients, stack *cloudformation.Stack) error {
+	if err := s.confirm(ctx, out, fmt.Sprintf("Cancel the update in progress on %s", *stack.StackName)); err != nil {
+		return errors.Wrapf(err, "not cancelling the update of %s", *stack.StackName)
+	}
+	return s.follow(ctx, out, ses, stack, []string{"UPDATE_ROLLBACK_COMPLETE", "UPDATE_COMPLETE"}, []string{"UPDATE_ROLLBACK_FAILED"}, func() error {
+		return ses.CancelStackUpdate(ctx, *stack.StackName)
+	})
+}
+
+// follow runs start, then streams the stack's events until it reaches one of okStates or failStates
+func (s *recoverCommand) follow(ctx context.Context, out io.Writer, ses *awscache.AWSClients, stack *cloudformation.Stack, okStates []string, failStates []string, start func() error) error {
+	afterEventID, err := ses.LatestStackEventID(ctx, *stack.StackId)
+	if err != nil {
+		return err
+	}
+	if err := start(); err != nil {
+		return err
+	}
+	streamer := awscache.StackStreamer{
+		PollInterval: s.AWSCache.PollInterval,
+		Logger:       s.Logger,
+		AfterEventID: afterEventID,
+	}
+	finalState := ""
+	eg, egCtx := errgroup.WithContext(ctx)
+	streamInto := make(chan *cloudformation.StackEvent)
+	eg.Go(func() error {
+		defer close(streamInto)
+		return streamer.Start(egCtx, ses, *stack.StackId, streamInto)
+	})
+	eg.Go(func() error {
+		return s.Execute.printStackEvents(egCtx, out, streamInto, nil)
+	})
+	eg.Go(func() error {
+		var actualErr error
+		finalState, actualErr = ses.WaitForStackStatus(egCtx, *stack.StackId, s.Logger, okStates, failStates)
+		if actualErr == nil {
+			return errFinishedOk
+		}
+		return actualErr
+	})
+	if err := eg.Wait(); !isErrFinishedOk(err) {
+		return err
+	}
+	return display(out, s.Output, printableString(fmt.Sprintf("stack %s is now %s\n", *stack.StackName, finalState)))
+}
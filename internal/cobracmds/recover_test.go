@@ -0,0 +1,36 @@
+package cobracmds
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func testRecoverCommand(answers string, autoConfirm bool) *recoverCommand {
+	return &recoverCommand{
+		Execute: &executeCommand{
+			Input: newLineReader(strings.NewReader(answers)),
+		},
+		autoConfirm: autoConfirm,
+	}
+}
+
+func TestRecoverConfirm(t *testing.T) {
+	ctx := context.Background()
+	if err := testRecoverCommand("y\n", false).confirm(ctx, ioutil.Discard, "Recover"); err != nil {
+		t.Fatalf("confirmed recovery returned %v", err)
+	}
+	if err := testRecoverCommand("", true).confirm(ctx, ioutil.Discard, "Recover"); err != nil {
+		t.Fatalf("auto confirmed recovery returned %v", err)
+	}
+	// Declining must fail the command, so scripts know the stack was not recovered
+	if err := testRecoverCommand("n\n", false).confirm(ctx, ioutil.Discard, "Recover"); err == nil || err.Error() != "cancelled" {
+		t.Fatalf("declined recovery returned %v, want cancelled", err)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := testRecoverCommand("", false).confirm(cancelled, ioutil.Discard, "Recover"); err == nil || !strings.HasPrefix(err.Error(), "cancelled: ") {
+		t.Fatalf("aborted prompt returned %v, want cancelled", err)
+	}
+}
@@ -0,0 +1,342 @@
+package cobracmds
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/cep21/cfmanage/internal/awscache"
+	"github.com/cep21/cfmanage/internal/cleanup"
+	"github.com/cep21/cfmanage/internal/ctxfinder"
+	"github.com/cep21/cfmanage/internal/formatter"
+	"github.com/cep21/cfmanage/internal/logger"
+	"github.com/cep21/cfmanage/internal/policy"
+	"github.com/cep21/cfmanage/internal/prcomment"
+	"github.com/cep21/cfmanage/internal/templatereader"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+// maxCommentLength stays under the 65536 characters GitHub allows in a comment
+const maxCommentLength = 60000
+
+type reportCommand struct {
+	AWSCache      *awscache.AWSCache
+	T             *templatereader.TemplateFinder
+	Ctx           *templatereader.CreateChangeSetTemplate
+	Logger        *logger.Logger
+	Output        *outputFormat
+	ContextFinder *ctxfinder.ContextFinder
+	Cleanup       *cleanup.Cleanup
+	Locks         *stackLocks
+	Policies      *stackPolicies
+	exitCodes     exitCodes
+	marker        string
+	repo          string
+	pr            int
+	githubURL     string
+}
+
+func (s *reportCommand) Cobra() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "report [template[/params]]...",
+		Short: "Write a markdown report of pending changes, and optionally keep it as a pull request comment",
+		Long: "Write a markdown report of the pending changes of every stack, or of the stacks matching the arguments, which may be globs.  " +
+			"With --pr, the report is posted as a comment on the pull request, or replaces the comment an earlier run posted.  The GitHub token is read from GITHUB_TOKEN.",
+		Example: "cfexecute report infra --repo cep21/cfmanage --pr 12",
+	}
+	cmd.Flags().StringVar(&s.marker, "marker", "cfmanage-report", "Hidden marker identifying the comment to update.  Use a different marker for each report kept on the same pull request")
+	cmd.Flags().StringVar(&s.repo, "repo", os.Getenv("GITHUB_REPOSITORY"), "owner/name of the GitHub repository of the pull request")
+	cmd.Flags().IntVar(&s.pr, "pr", 0, "Pull request to comment on.  Zero only writes the report")
+	cmd.Flags().StringVar(&s.githubURL, "github-url", os.Getenv("GITHUB_API_URL"), "GitHub API URL, for GitHub Enterprise.  Empty means github.com")
+	s.exitCodes.register(cmd)
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		data, err := s.model(s.ContextFinder.Ctx(), cmd, args)
+		if err != nil {
+			return errors.Wrap(err, "unable to make report")
+		}
+		if err := display(cmd.OutOrStdout(), s.Output, data); err != nil {
+			return err
+		}
+		statuses := make([]stackStatus, 0, len(data.Stacks))
+		for _, st := range data.Stacks {
+			if st.inspect != nil {
+				// Carries the stack's policy violations
+				statuses = append(statuses, st.inspect.stackStatus)
+				continue
+			}
+			statuses = append(statuses, st.stat)
+		}
+		return s.exitCodes.check(cmd, statuses)
+	}
+	return cmd
+}
+
+type reportStack struct {
+	name string
+	stat stackStatus
+	// inspect is nil if the stack's changeset could not be made
+	inspect *inspectCommandModel
+}
+
+type reportCommandModel struct {
+	Stacks         []reportStack
+	Summary        statusSummary
+	Markdown       string
+	CommentURL     string
+	CommentCreated bool
+}
+
+func (r *reportCommandModel) HumanReadable(out io.Writer) error {
+	if r.CommentURL == "" {
+		_, err := io.WriteString(out, r.Markdown)
+		return err
+	}
+	verb := "updated"
+	if r.CommentCreated {
+		verb = "created"
+	}
+	_, err := fmt.Fprintf(out, "%s comment %s\n", verb, r.CommentURL)
+	return err
+}
+
+// selected is true if template t and params p match one of the selectors, or there are none
+func selected(selectors []string, t string, p string) bool {
+	if len(selectors) == 0 {
+		return true
+	}
+	for _, sel := range selectors {
+		if strings.Contains(sel, "/") {
+			if ok, _ := path.Match(sel, t+"/"+p); ok {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(sel, t); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *reportCommand) model(ctx context.Context, cmd *cobra.Command, args []string) (*reportCommandModel, error) {
+	var commenter *prcomment.Commenter
+	if s.pr != 0 {
+		parts := strings.Split(s.repo, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.Errorf("expected --repo owner/name, got %q", s.repo)
+		}
+		client, err := prcomment.NewClient(s.githubURL, os.Getenv("GITHUB_TOKEN"))
+		if err != nil {
+			return nil, err
+		}
+		commenter = &prcomment.Commenter{
+			Client: client,
+			Owner:  parts[0],
+			Repo:   parts[1],
+			Number: s.pr,
+			Marker: s.marker,
+		}
+	}
+	templates, err := s.T.ListTemplates()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list all templates")
+	}
+	var names [][2]string
+	for _, t := range templates {
+		params, err := s.T.ListParameters(t)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to list parameters for template %s", t)
+		}
+		for _, p := range params {
+			if selected(args, t, p) {
+				names = append(names, [2]string{t, p})
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil, errors.Errorf("no stacks match %s", strings.Join(args, " "))
+	}
+	ret := &reportCommandModel{
+		Stacks: make([]reportStack, len(names)),
+	}
+	eg, egCtx := errgroup.WithContext(ctx)
+	for idx, name := range names {
+		idx := idx
+		t, p := name[0], name[1]
+		eg.Go(func() error {
+			stat, err := populateStatusCommand(egCtx, s.Ctx, s.Logger, s.AWSCache, s.T, t, p, nil)
+			if err != nil {
+				return errors.Wrapf(err, "unable to populate %s", p)
+			}
+			stat.LockedBy = s.Locks.describe(egCtx, stat.changesetInput)
+			st := reportStack{
+				name: t + "/" + p,
+				stat: stat,
+			}
+			if stat.ChangesetError == nil && (stat.changeset != nil || stat.stackSet != nil) {
+				if st.inspect, err = inspectFromStatus(stat); err != nil {
+					return err
+				}
+				if err := s.Policies.evaluate(egCtx, st.inspect, false); err != nil {
+					return err
+				}
+			}
+			ret.Stacks[idx] = st
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	statuses := make([]stackStatus, 0, len(ret.Stacks))
+	for _, st := range ret.Stacks {
+		statuses = append(statuses, st.stat)
+	}
+	ret.Summary = summarize(statuses)
+	ret.Markdown = reportMarkdown(s.marker, ret.Stacks, ret.Summary)
+	if commenter == nil {
+		return ret, nil
+	}
+	comment, created, err := commenter.Upsert(ctx, ret.Markdown)
+	if err != nil {
+		return nil, err
+	}
+	ret.CommentURL = comment.GetHTMLURL()
+	ret.CommentCreated = created
+	return ret, nil
+}
+
+func reportMarkdown(marker string, stacks []reportStack, summary statusSummary) string {
+	var b strings.Builder
+	b.WriteString(prcomment.HiddenMarker(marker) + "\n")
+	fmt.Fprintf(&b, "## cfmanage: %s\n\n", summary.String())
+	var inSync []reportStack
+	for _, st := range stacks {
+		if st.stat.category() == categoryInSync {
+			inSync = append(inSync, st)
+			continue
+		}
+		writeReportStack(&b, st)
+	}
+	if len(inSync) != 0 {
+		fmt.Fprintf(&b, "<details><summary>%d stacks in sync</summary>\n\n", len(inSync))
+		for _, st := range inSync {
+			fmt.Fprintf(&b, "- `%s` %s\n", st.name, st.stat.StackName)
+		}
+		b.WriteString("\n</details>\n")
+	}
+	return truncateMarkdown(b.String(), maxCommentLength)
+}
+
+func replacements(changes []*cloudformation.Change) int {
+	ret := 0
+	for _, c := range changes {
+		if c.ResourceChange != nil && emptyOnNil(c.ResourceChange.Replacement) == "True" {
+			ret++
+		}
+	}
+	return ret
+}
+
+func writeReportStack(b *strings.Builder, st reportStack) {
+	title := fmt.Sprintf("<b>%s</b> %s (%s/%s)", st.name, st.stat.StackName, st.stat.AccountID, st.stat.Region)
+	if st.inspect == nil || st.stat.category() == categoryError {
+		reason := ""
+		if st.stat.changeset != nil {
+			reason = emptyOnNil(st.stat.changeset.StatusReason)
+		}
+		// Errors are open, so they are not missed
+		fmt.Fprintf(b, "<details open><summary>:x: %s: error</summary>\n\n", title)
+		fmt.Fprintf(b, "```\n%s\n```\n", firstNonEmpty(reason, st.stat.ChangesetStatus, st.stat.StackStatus))
+		b.WriteString("\n</details>\n\n")
+		return
+	}
+	if st.stat.stackSet != nil {
+		fmt.Fprintf(b, "<details><summary>%s: stack set, %d changes</summary>\n\n", title, len(st.inspect.Changes))
+		b.WriteString(formatter.MarkdownTable(paramsTable("", st.inspect.Changes)))
+		b.WriteString("\n" + formatter.MarkdownTable(stackSetInstancesTable([]stackStatus{st.stat})))
+		b.WriteString("\n</details>\n\n")
+		return
+	}
+	changes := st.inspect.changeset.Changes
+	summary := fmt.Sprintf("%d changes", len(changes))
+	if n := replacements(changes); n != 0 {
+		summary += fmt.Sprintf(", :warning: %d replacements", n)
+	}
+	if blocking := st.inspect.Policy.Blocking(); len(blocking) != 0 {
+		summary += fmt.Sprintf(", :no_entry: %d policy violations", len(blocking))
+	} else if len(st.inspect.Policy) != 0 {
+		summary += fmt.Sprintf(", %d policy warnings", len(st.inspect.Policy))
+	}
+	if st.stat.LockedBy != "" {
+		summary += ", locked by " + st.stat.LockedBy
+	}
+	fmt.Fprintf(b, "<details><summary>%s: %s</summary>\n\n", title, summary)
+	b.WriteString(formatter.MarkdownTable(changeTable(changes)))
+	if len(st.inspect.Destructive) != 0 {
+		b.WriteString("\n**:warning: Destructive changes**\n\n")
+		b.WriteString(formatter.MarkdownTable(destructiveTable(st.inspect.Destructive)))
+	}
+	if len(st.inspect.Policy) != 0 {
+		b.WriteString("\n**Policy**\n\n")
+		b.WriteString(formatter.MarkdownTable(reportPolicyTable(st.inspect.Policy)))
+	}
+	b.WriteString("\n</details>\n\n")
+}
+
+// changeTable highlights replacements, which are easy to miss in a long list of changes
+func changeTable(changes []*cloudformation.Change) formatter.Table {
+	ret := formatter.Table{
+		Header: []string{"Action", "Logical ID", "Physical ID", "Resource type", "Replacement"},
+	}
+	for _, c := range changes {
+		rc := c.ResourceChange
+		if rc == nil {
+			continue
+		}
+		action := emptyOnNil(rc.Action)
+		replacement := emptyOnNil(rc.Replacement)
+		switch {
+		case replacement == "True":
+			replacement = "**:warning: True**"
+		case replacement == "Conditional":
+			replacement = "**Conditional**"
+		}
+		if action == "Remove" {
+			action = "**Remove**"
+		}
+		ret.Rows = append(ret.Rows, []string{action, emptyOnNil(rc.LogicalResourceId), emptyOnNil(rc.PhysicalResourceId), emptyOnNil(rc.ResourceType), replacement})
+	}
+	return ret
+}
+
+func reportPolicyTable(violations policy.Violations) formatter.Table {
+	ret := policyTable(violations)
+	for i, v := range violations {
+		if v.Level == policy.LevelBlock {
+			ret.Rows[i][1] = ":no_entry: " + v.Level
+		} else {
+			ret.Rows[i][1] = ":warning: " + v.Level
+		}
+	}
+	return ret
+}
+
+// truncateMarkdown cuts s at a line to at most max bytes, saying it did
+func truncateMarkdown(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	const note = "\n\n</details>\n\n**Report truncated.  Run `cfmanage report` for all of it.**\n"
+	cut := strings.LastIndex(s[:max-len(note)], "\n")
+	if cut == -1 {
+		cut = max - len(note)
+	}
+	return s[:cut] + note
+}
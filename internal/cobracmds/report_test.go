@@ -0,0 +1,156 @@
+package cobracmds
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/cep21/cfmanage/internal/policy"
+	"github.com/cep21/cfmanage/internal/templatereader"
+	"github.com/pkg/errors"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden files of the tests")
+
+func expectGolden(t *testing.T, name string, got string) {
+	fname := filepath.Join("testdata", name)
+	if *update {
+		if err := ioutil.WriteFile(fname, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Fatalf("output differs from %s (run go test -update to rewrite it)\ngot:\n%s\nwant:\n%s", fname, got, want)
+	}
+}
+
+func testReportStack(t *testing.T, name string, stat stackStatus) reportStack {
+	ret := reportStack{
+		name: name,
+		stat: stat,
+	}
+	if stat.ChangesetError == nil {
+		var err error
+		if ret.inspect, err = inspectFromStatus(stat); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ret
+}
+
+func testReportStatus(name string, changes ...*cloudformation.Change) stackStatus {
+	in := &templatereader.ChangesetInput{}
+	in.StackName = aws.String(name)
+	return stackStatus{
+		StackName:      name,
+		AccountID:      "111",
+		Region:         "us-west-2",
+		changesetInput: in,
+		cfStack:        &cloudformation.Stack{StackId: aws.String("arn:" + name)},
+		changeset: &cloudformation.DescribeChangeSetOutput{
+			Changes: changes,
+		},
+	}
+}
+
+func testReportStacks(t *testing.T) []reportStack {
+	changed := testReportStatus("infra-prod",
+		testResourceChange(cloudformation.ChangeActionAdd, "Topic", "AWS::SNS::Topic", ""),
+		testResourceChange(cloudformation.ChangeActionModify, "Database", "AWS::RDS::DBInstance", cloudformation.ReplacementTrue),
+		testResourceChange(cloudformation.ChangeActionModify, "Table", "AWS::DynamoDB::Table", cloudformation.ReplacementConditional),
+		testResourceChange(cloudformation.ChangeActionRemove, "Queue", "AWS::SQS::Queue", ""),
+	)
+	changed.LockedBy = "jack@laptop"
+	changedStack := testReportStack(t, "infra/prod", changed)
+	changedStack.inspect.Destructive = destructiveChanges(changed.changeset.Changes)
+	changedStack.inspect.Policy = policy.Violations{
+		{Rule: "no-deletes", Level: policy.LevelBlock, Message: "Remove Queue (AWS::SQS::Queue)"},
+		{Rule: "small-deploys", Level: policy.LevelWarn, Message: "4 changes is more than the 3 allowed"},
+	}
+
+	failed := testReportStatus("infra-canary")
+	failed.ChangesetError = errors.New("Template format error: unresolved resource dependencies [Missing]")
+	failed.ChangesetStatus = failed.ChangesetError.Error()
+
+	in := testStackSetInput(templatereader.StackSetConfig{Accounts: []string{"111", "222"}})
+	set := &cloudformation.StackSet{TemplateBody: aws.String("{}"), StackSetId: aws.String("baseline:1")}
+	stackSet := stackStatus{
+		StackName:      "baseline",
+		AccountID:      "111",
+		Region:         "us-west-2",
+		changesetInput: in,
+		stackSet: newStackSetState(in, in.StackSet.Accounts, []string{"us-west-2"}, set, []*cloudformation.StackInstanceSummary{
+			testInstance("111", "us-west-2", cloudformation.StackInstanceStatusCurrent),
+		}),
+	}
+
+	return []reportStack{
+		testReportStack(t, "infra/staging", testReportStatus("infra-staging")),
+		changedStack,
+		testReportStack(t, "infra/canary", failed),
+		testReportStack(t, "baseline/all", stackSet),
+		testReportStack(t, "infra/dev", testReportStatus("infra-dev")),
+	}
+}
+
+func TestReportMarkdown(t *testing.T) {
+	stacks := testReportStacks(t)
+	statuses := make([]stackStatus, 0, len(stacks))
+	for _, st := range stacks {
+		statuses = append(statuses, st.stat)
+	}
+	expectGolden(t, "report.md", reportMarkdown("cfmanage report", stacks, summarize(statuses)))
+}
+
+func TestTruncateMarkdown(t *testing.T) {
+	short := "line one\nline two\n"
+	if got := truncateMarkdown(short, 100); got != short {
+		t.Fatalf("truncated %q, which fits, to %q", short, got)
+	}
+	long := strings.Repeat("| a row of a long table |\n", 100)
+	got := truncateMarkdown(long, 1000)
+	if len(got) > 1000 {
+		t.Fatalf("truncated to %d bytes, more than 1000", len(got))
+	}
+	if !strings.HasSuffix(got, "**Report truncated.  Run `cfmanage report` for all of it.**\n") {
+		t.Fatalf("truncated report does not say so: %q", got)
+	}
+	// Cut at a line, so no table row is left half written
+	kept := strings.Split(got, "\n\n</details>")[0]
+	for _, line := range strings.Split(kept, "\n") {
+		if line != "| a row of a long table |" {
+			t.Fatalf("truncated in the middle of a line: %q", line)
+		}
+	}
+}
+
+func TestSelected(t *testing.T) {
+	tests := []struct {
+		selectors []string
+		template  string
+		params    string
+		want      bool
+	}{
+		{template: "infra", params: "prod", want: true},
+		{selectors: []string{"infra"}, template: "infra", params: "prod", want: true},
+		{selectors: []string{"infra"}, template: "baseline", params: "prod"},
+		{selectors: []string{"in*"}, template: "infra", params: "prod", want: true},
+		{selectors: []string{"infra/prod"}, template: "infra", params: "prod", want: true},
+		{selectors: []string{"infra/prod"}, template: "infra", params: "canary"},
+		{selectors: []string{"*/canary", "baseline"}, template: "infra", params: "canary", want: true},
+	}
+	for _, tc := range tests {
+		if got := selected(tc.selectors, tc.template, tc.params); got != tc.want {
+			t.Errorf("selected(%v, %s, %s) is %t, want %t", tc.selectors, tc.template, tc.params, got, tc.want)
+		}
+	}
+}
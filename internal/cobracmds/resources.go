@@ -0,0 +1,214 @@
+package cobracmds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/cep21/cfmanage/internal/awscache"
+	"github.com/cep21/cfmanage/internal/consolelink"
+	"github.com/cep21/cfmanage/internal/ctxfinder"
+	"github.com/cep21/cfmanage/internal/formatter"
+	"github.com/cep21/cfmanage/internal/logger"
+	"github.com/cep21/cfmanage/internal/schema"
+	"github.com/cep21/cfmanage/internal/templatereader"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+type resourcesCommand struct {
+	AWSCache      *awscache.AWSCache
+	T             *templatereader.TemplateFinder
+	Ctx           *templatereader.CreateChangeSetTemplate
+	Logger        *logger.Logger
+	Output        *outputFormat
+	ContextFinder *ctxfinder.ContextFinder
+	types         []string
+	statuses      []string
+	links         bool
+}
+
+func (s *resourcesCommand) Cobra() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:       "resources [template] [params]",
+		ValidArgs: s.T.ValidTemplatesAndParams(),
+		Short:     "List the resources of a stack with their physical IDs",
+		Example:   "cfexecute resources infra canary --type 'AWS::Lambda::*' --links",
+	}
+	cmd.Flags().StringSliceVar(&s.types, "type", nil, "Only list resources of these types.  Globs, as in AWS::Lambda::*, are allowed")
+	cmd.Flags().StringSliceVar(&s.statuses, "status", nil, "Only list resources in these statuses.  Globs, as in *_FAILED, are allowed")
+	cmd.Flags().BoolVar(&s.links, "links", false, "Add the ARN and AWS console link of each resource to the table.  Other formats always have them")
+	cmd.Args = validateTemplateParam(s.T)
+	cmd.RunE = commonRunCommand(s.ContextFinder, s.model, s.Output)
+	return cmd
+}
+
+type stackResource struct {
+	LogicalID    string
+	PhysicalID   string
+	Type         string
+	Status       string
+	StatusReason string
+	DriftStatus  string
+	LastUpdated  *time.Time
+	ARN          string
+	ConsoleURL   string
+}
+
+type resourcesCommandModel struct {
+	StackName string
+	StackID   string
+	AccountID string
+	Region    string
+	Resources []stackResource
+	links     bool
+}
+
+func (r *resourcesCommandModel) HumanReadable(out io.Writer) error {
+	t := r.Tables()[0]
+	if _, err := fmt.Fprintf(out, "%s\n", t.Title); err != nil {
+		return err
+	}
+	renderTable(out, t)
+	return nil
+}
+
+func (r *resourcesCommandModel) Tables() []formatter.Table {
+	ret := formatter.Table{
+		Title:  fmt.Sprintf("%s (%s/%s)", r.StackName, r.AccountID, r.Region),
+		Header: []string{"LogicalID", "PhysicalID", "Type", "Status", "Drift", "LastUpdated"},
+	}
+	if r.links {
+		ret.Header = append(ret.Header, "ARN", "Console")
+	}
+	for _, res := range r.Resources {
+		lastUpdated := ""
+		if res.LastUpdated != nil {
+			lastUpdated = res.LastUpdated.Format(time.RFC3339)
+		}
+		row := []string{res.LogicalID, res.PhysicalID, res.Type, res.Status, res.DriftStatus, lastUpdated}
+		if r.links {
+			row = append(row, res.ARN, res.ConsoleURL)
+		}
+		ret.Rows = append(ret.Rows, row)
+	}
+	return []formatter.Table{ret}
+}
+
+func (r *resourcesCommandModel) Items() []interface{} {
+	ret := make([]interface{}, 0, len(r.Resources))
+	for _, res := range r.Resources {
+		ret = append(ret, schema.Resource(res))
+	}
+	return ret
+}
+
+func (r resourcesCommandModel) MarshalJSON() ([]byte, error) {
+	ret := schema.Resources{
+		Header:    schema.NewHeader("resources"),
+		StackName: r.StackName,
+		StackID:   r.StackID,
+		AccountID: r.AccountID,
+		Region:    r.Region,
+		Resources: make([]schema.Resource, 0, len(r.Resources)),
+	}
+	for _, res := range r.Resources {
+		ret.Resources = append(ret.Resources, schema.Resource(res))
+	}
+	return json.Marshal(ret)
+}
+
+// matchesAny is true if s matches one of the globs, or there are none
+func matchesAny(globs []string, s string) bool {
+	if len(globs) == 0 {
+		return true
+	}
+	for _, g := range globs {
+		if ok, _ := path.Match(g, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validateFilters fails on a bad glob, which would otherwise silently match nothing
+func (s *resourcesCommand) validateFilters() error {
+	for _, g := range append(append([]string{}, s.types...), s.statuses...) {
+		if _, err := path.Match(g, ""); err != nil {
+			return errors.Wrapf(err, "invalid filter %s", g)
+		}
+	}
+	return nil
+}
+
+// matches is true if a resource passes the --type and --status filters
+func (s *resourcesCommand) matches(r *cloudformation.StackResourceSummary) bool {
+	return matchesAny(s.types, emptyOnNil(r.ResourceType)) && matchesAny(s.statuses, emptyOnNil(r.ResourceStatus))
+}
+
+func (s *resourcesCommand) model(ctx context.Context, cmd *cobra.Command, args []string) (HumanPrintable, error) {
+	if err := s.validateFilters(); err != nil {
+		return nil, err
+	}
+	in, err := templatereader.LoadCreateChangeSet(s.T.ParameterFilename(args[0], args[1]), s.Ctx, s.Logger)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to load params")
+	}
+	ses, err := s.AWSCache.SessionAs(in.Profile, in.Region, in.AssumeRoleARN)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to fetch AWS session for profile %s", in.Profile)
+	}
+	stack, err := ses.DescribeStack(ctx, *in.StackName)
+	if err != nil {
+		return nil, err
+	}
+	if stack == nil {
+		return nil, errors.Errorf("stack %s does not exist", *in.StackName)
+	}
+	summaries, err := ses.ListStackResources(ctx, *stack.StackId)
+	if err != nil {
+		return nil, err
+	}
+	ret := &resourcesCommandModel{
+		StackName: *in.StackName,
+		StackID:   *stack.StackId,
+		AccountID: readable(ses.AccountID()),
+		Region:    ses.Region(),
+		links:     s.links,
+	}
+	for _, r := range summaries {
+		if !s.matches(r) {
+			continue
+		}
+		ret.Resources = append(ret.Resources, ret.resource(r))
+	}
+	return ret, nil
+}
+
+func (r *resourcesCommandModel) resource(summary *cloudformation.StackResourceSummary) stackResource {
+	link := consolelink.Resource{
+		Type:       emptyOnNil(summary.ResourceType),
+		PhysicalID: emptyOnNil(summary.PhysicalResourceId),
+		Region:     r.Region,
+		AccountID:  r.AccountID,
+		StackID:    r.StackID,
+	}
+	ret := stackResource{
+		LogicalID:    emptyOnNil(summary.LogicalResourceId),
+		PhysicalID:   link.PhysicalID,
+		Type:         link.Type,
+		Status:       emptyOnNil(summary.ResourceStatus),
+		StatusReason: emptyOnNil(summary.ResourceStatusReason),
+		LastUpdated:  summary.LastUpdatedTimestamp,
+		ARN:          consolelink.ARN(link),
+		ConsoleURL:   consolelink.Console(link),
+	}
+	if summary.DriftInformation != nil {
+		ret.DriftStatus = emptyOnNil(summary.DriftInformation.StackResourceDriftStatus)
+	}
+	return ret
+}
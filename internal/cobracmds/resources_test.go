@@ -0,0 +1,108 @@
+package cobracmds
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+func testResourceSummary(logicalID string, resourceType string, status string) *cloudformation.StackResourceSummary {
+	return &cloudformation.StackResourceSummary{
+		LogicalResourceId:  aws.String(logicalID),
+		PhysicalResourceId: aws.String("infra-canary-" + logicalID),
+		ResourceType:       aws.String(resourceType),
+		ResourceStatus:     aws.String(status),
+	}
+}
+
+func TestResourceFilters(t *testing.T) {
+	summaries := []*cloudformation.StackResourceSummary{
+		testResourceSummary("Handler", "AWS::Lambda::Function", "UPDATE_COMPLETE"),
+		testResourceSummary("Alias", "AWS::Lambda::Alias", "UPDATE_FAILED"),
+		testResourceSummary("Table", "AWS::DynamoDB::Table", "CREATE_FAILED"),
+		testResourceSummary("Role", "AWS::IAM::Role", "CREATE_COMPLETE"),
+	}
+	tests := []struct {
+		name     string
+		types    []string
+		statuses []string
+		want     []string
+	}{
+		{name: "no filters", want: []string{"Handler", "Alias", "Table", "Role"}},
+		{name: "type glob", types: []string{"AWS::Lambda::*"}, want: []string{"Handler", "Alias"}},
+		{name: "any of the types", types: []string{"AWS::IAM::Role", "AWS::DynamoDB::Table"}, want: []string{"Table", "Role"}},
+		{name: "status glob", statuses: []string{"*_FAILED"}, want: []string{"Alias", "Table"}},
+		{name: "type and status", types: []string{"AWS::Lambda::*"}, statuses: []string{"*_FAILED"}, want: []string{"Alias"}},
+		{name: "globs match the whole value", types: []string{"AWS::Lambda"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &resourcesCommand{types: tc.types, statuses: tc.statuses}
+			if err := s.validateFilters(); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range summaries {
+				if s.matches(r) {
+					got = append(got, *r.LogicalResourceId)
+				}
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("matched %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestInvalidResourceFilters(t *testing.T) {
+	for _, s := range []*resourcesCommand{
+		{types: []string{"AWS::Lambda::*", "AWS::["}},
+		{statuses: []string{"[_FAILED"}},
+	} {
+		if err := s.validateFilters(); err == nil {
+			t.Fatalf("filters %v %v are valid", s.types, s.statuses)
+		}
+	}
+}
+
+func TestResourceLinks(t *testing.T) {
+	r := &resourcesCommandModel{
+		StackName: "infra-canary",
+		StackID:   "arn:aws:cloudformation:us-west-2:111:stack/infra-canary/1",
+		AccountID: "111",
+		Region:    "us-west-2",
+	}
+	summary := testResourceSummary("Table", "AWS::DynamoDB::Table", "UPDATE_COMPLETE")
+	summary.DriftInformation = &cloudformation.StackResourceDriftInformationSummary{
+		StackResourceDriftStatus: aws.String(cloudformation.StackResourceDriftStatusInSync),
+	}
+	got := r.resource(summary)
+	want := stackResource{
+		LogicalID:   "Table",
+		PhysicalID:  "infra-canary-Table",
+		Type:        "AWS::DynamoDB::Table",
+		Status:      "UPDATE_COMPLETE",
+		DriftStatus: "IN_SYNC",
+		ARN:         "arn:aws:dynamodb:us-west-2:111:table/infra-canary-Table",
+		ConsoleURL:  "https://us-west-2.console.aws.amazon.com/dynamodbv2/home?region=us-west-2#table?name=infra-canary-Table",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("resource\n%+v\nwant\n%+v", got, want)
+	}
+
+	// A resource without a page of its own links to the resources of its stack
+	got = r.resource(testResourceSummary("Alias", "AWS::Lambda::Alias", "UPDATE_COMPLETE"))
+	if got.ARN != "" || got.ConsoleURL != "https://us-west-2.console.aws.amazon.com/cloudformation/home?region=us-west-2#/stacks/resources?stackId=arn%3Aaws%3Acloudformation%3Aus-west-2%3A111%3Astack%2Finfra-canary%2F1" {
+		t.Fatalf("alias links to %s %s", got.ARN, got.ConsoleURL)
+	}
+	if header := (&resourcesCommandModel{}).Tables()[0].Header; len(header) != 6 {
+		t.Fatalf("table without --links has columns %v", header)
+	}
+	r.links = true
+	r.Resources = []stackResource{want}
+	if row := r.Tables()[0].Rows[0]; row[6] != want.ARN || row[7] != want.ConsoleURL {
+		t.Fatalf("table with --links has row %v", row)
+	}
+}
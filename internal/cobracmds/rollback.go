@@ -0,0 +1,194 @@
+package cobracmds
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/cep21/cfmanage/internal/awscache"
+	"github.com/cep21/cfmanage/internal/ctxfinder"
+	"github.com/cep21/cfmanage/internal/deployhistory"
+	"github.com/cep21/cfmanage/internal/logger"
+	"github.com/cep21/cfmanage/internal/templatereader"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+type rollbackCommand struct {
+	AWSCache         *awscache.AWSCache
+	T                *templatereader.TemplateFinder
+	Ctx              *templatereader.CreateChangeSetTemplate
+	Logger           *logger.Logger
+	Output           *outputFormat
+	ContextFinder    *ctxfinder.ContextFinder
+	Locks            *stackLocks
+	History          *stackHistory
+	Execute          *executeCommand
+	autoConfirm      bool
+	overridePolicy   string
+	allowDestructive bool
+	deployTimeout    time.Duration
+	idleTimeout      time.Duration
+	to               string
+}
+
+func (s *rollbackCommand) Cobra() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:       "rollback [template] [params]",
+		ValidArgs: s.T.ValidTemplatesAndParams(),
+		Short:     "Restore the template and parameters a stack was deployed with before its latest deploy",
+		Long:      "Restore the template and parameters a stack was deployed with before its latest deploy.  Unlike CloudFormation's automatic rollback, this undoes a deploy that succeeded but turned out to be wrong.  Rolling back again goes further back rather than undoing the rollback.",
+		Example:   "cfexecute rollback infra canary",
+		RunE:      s.commandRun,
+	}
+	cmd.Flags().BoolVarP(&s.autoConfirm, "auto", "a", false, "Will auto confirm the cloudformation change")
+	cmd.Flags().BoolVar(&s.allowDestructive, "allow-destructive", false, "Let --auto execute rollbacks that delete resources or replace stateful ones")
+	cmd.Flags().StringVar(&s.overridePolicy, "override-policy", "", "Roll back despite blocking policy violations.  The value is the reason, recorded in the deployment history")
+	cmd.Flags().DurationVar(&s.deployTimeout, "deploy-timeout", 0, "If non zero, cancel the stack update if it runs longer than this, then follow the rollback")
+	cmd.Flags().DurationVar(&s.idleTimeout, "idle-timeout", 0, "If non zero, cancel the stack update if no stack events arrive for this long, then follow the rollback")
+	cmd.Flags().StringVar(&s.to, "to", "", "ID of the recorded deployment to restore.  Defaults to the newest one that differs from what is deployed now, skipping rollbacks")
+	cmd.Args = validateTemplateParam(s.T)
+	return cmd
+}
+
+func (s *rollbackCommand) commandRun(cmd *cobra.Command, args []string) error {
+	template := args[0]
+	params := args[1]
+	ctx := s.ContextFinder.Ctx()
+	fname := s.T.ParameterFilename(template, params)
+	in, err := templatereader.LoadCreateChangeSet(fname, s.Ctx, s.Logger)
+	if err != nil {
+		return errors.Wrap(err, "unable to load params")
+	}
+	ctx, unlock, err := s.Locks.lock(ctx, s.T.BaseDir, in)
+	if err != nil {
+		return errors.Wrap(err, "unable to lock stack")
+	}
+	defer unlock()
+	store, key, err := s.History.store(in)
+	if err != nil {
+		return err
+	}
+	if store == nil {
+		return errors.New("deployment history is disabled for this stack: nothing to roll back to")
+	}
+	deployments, err := store.List(ctx, key)
+	if err != nil {
+		return err
+	}
+	ses, err := s.AWSCache.SessionAs(in.Profile, in.Region, in.AssumeRoleARN)
+	if err != nil {
+		return errors.Wrapf(err, "unable to fetch AWS session for profile %s", in.Profile)
+	}
+	current, err := snapshot(ctx, ses, key, *in.StackName, "")
+	if err != nil {
+		return err
+	}
+	target, err := rollbackTarget(deployments, current, s.to)
+	if err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("Rolling back %s to deployment %s (%s at %s)\n", *in.StackName, target.ID, target.Source, target.Time.Format("2006-01-02 15:04:05 MST"))
+	if err := display(cmd.OutOrStdout(), s.Output, printableString(msg)); err != nil {
+		return err
+	}
+	stat, err := populateStatusFromInput(ctx, s.Logger, s.AWSCache, template, fname, restoreInput(in, target), nil)
+	if err != nil {
+		return err
+	}
+	data, err := inspectFromStatus(stat)
+	if err != nil {
+		return err
+	}
+	return s.Execute.confirmAndExecute(ctx, cmd, data, deployOptions{
+		AutoConfirm:      s.autoConfirm,
+		OverridePolicy:   s.overridePolicy,
+		AllowDestructive: s.allowDestructive,
+		DeployTimeout:    s.deployTimeout,
+		IdleTimeout:      s.idleTimeout,
+		Source:           deployhistory.SourceRollback,
+		RollbackTo:       target.ID,
+	})
+}
+
+// rollbackTarget picks the deployment with ID `to`, or the newest deployment that differs from what is deployed now.
+// Without `to`, rollbacks are not a state to go back to: each one continues from the deployment it restored, so
+// repeated rollbacks walk further back instead of undoing each other.
+func rollbackTarget(deployments []deployhistory.Deployment, current *deployhistory.Deployment, to string) (*deployhistory.Deployment, error) {
+	for i := len(deployments) - 1; i >= 0; i-- {
+		d := &deployments[i]
+		if to == "" && d.Source == deployhistory.SourceRollback {
+			// Continue from the deployment a rollback restored, which is skipped next if it is what is deployed now.  A
+			// rollback that failed restored nothing.
+			if restored := deploymentIndex(deployments[:i], d.RolledBackTo); restored != -1 && d.Restorable() {
+				i = restored + 1
+			}
+			continue
+		}
+		if to != "" {
+			if d.ID != to {
+				continue
+			}
+			if d.TemplateBody == "" {
+				return nil, errors.Errorf("deployment %s recorded no template, so it cannot be rolled back to: %s", to, firstNonEmpty(d.Incomplete, "the stack could not be described after it"))
+			}
+			return d, nil
+		}
+		// Failed deploys are rolled back by CloudFormation: they are not a state worth restoring.  Incomplete records may
+		// have no template to restore.
+		if d.Restorable() && !d.SameState(current) {
+			return d, nil
+		}
+	}
+	if to != "" {
+		return nil, errors.Errorf("no recorded deployment with ID %s", to)
+	}
+	return nil, errors.Errorf("no recorded deployment of %s differs from what is deployed now", current.Key)
+}
+
+// deploymentIndex is the index of the newest deployment with ID id, or -1
+func deploymentIndex(deployments []deployhistory.Deployment, id string) int {
+	if id == "" {
+		return -1
+	}
+	for i := len(deployments) - 1; i >= 0; i-- {
+		if deployments[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// restoreInput builds a changeset that puts back the template, parameters and tags of a recorded deployment
+func restoreInput(in *templatereader.ChangesetInput, target *deployhistory.Deployment) *templatereader.ChangesetInput {
+	params := make([]*cloudformation.Parameter, 0, len(target.Parameters))
+	for _, p := range target.Parameters {
+		// NoEcho parameters are recorded masked: the best we can do is keep their current value
+		if emptyOnNil(p.ParameterValue) == "****" {
+			params = append(params, &cloudformation.Parameter{
+				ParameterKey:     p.ParameterKey,
+				UsePreviousValue: aws.Bool(true),
+			})
+			continue
+		}
+		params = append(params, &cloudformation.Parameter{
+			ParameterKey:   p.ParameterKey,
+			ParameterValue: p.ParameterValue,
+		})
+	}
+	ret := *in
+	ret.CreateChangeSetInput = cloudformation.CreateChangeSetInput{
+		StackName:             in.StackName,
+		ChangeSetType:         aws.String("UPDATE"),
+		Description:           aws.String("cfmanage rollback to " + target.ID),
+		TemplateBody:          aws.String(target.TemplateBody),
+		Parameters:            params,
+		Tags:                  target.Tags,
+		Capabilities:          target.Capabilities,
+		RoleARN:               in.RoleARN,
+		NotificationARNs:      in.NotificationARNs,
+		RollbackConfiguration: in.RollbackConfiguration,
+	}
+	return &ret
+}
@@ -0,0 +1,72 @@
+package cobracmds
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cep21/cfmanage/internal/deployhistory"
+)
+
+func testDeployment(id string, source string, template string) deployhistory.Deployment {
+	return deployhistory.Deployment{
+		ID:           id,
+		Key:          "111/us-west-2/infra",
+		Time:         time.Unix(1500000000, 0),
+		Source:       source,
+		TemplateBody: template,
+	}
+}
+
+func testRollback(id string, to deployhistory.Deployment) deployhistory.Deployment {
+	ret := testDeployment(id, deployhistory.SourceRollback, to.TemplateBody)
+	ret.RolledBackTo = to.ID
+	return ret
+}
+
+func expectRollbackTarget(t *testing.T, deployments []deployhistory.Deployment, to string, want string) {
+	current := deployments[len(deployments)-1]
+	got, err := rollbackTarget(deployments, &current, to)
+	if err != nil {
+		t.Fatalf("no rollback target, want %s: %v", want, err)
+	}
+	if got.ID != want {
+		t.Fatalf("rolls back to %s, want %s", got.ID, want)
+	}
+}
+
+func TestRepeatedRollbacksWalkBack(t *testing.T) {
+	base := testDeployment("base", deployhistory.SourceBaseline, "base")
+	a := testDeployment("a", deployhistory.SourceExecute, "A")
+	b := testDeployment("b", deployhistory.SourceExecute, "B")
+	deployments := []deployhistory.Deployment{base, a, b}
+	expectRollbackTarget(t, deployments, "", "a")
+
+	// A second rollback goes on to what came before A, instead of back to B
+	deployments = append(deployments, testRollback("rollback1", a))
+	expectRollbackTarget(t, deployments, "", "base")
+
+	deployments = append(deployments, testRollback("rollback2", base))
+	current := deployments[len(deployments)-1]
+	if got, err := rollbackTarget(deployments, &current, ""); err == nil {
+		t.Fatalf("rolled back past the oldest deployment to %s", got.ID)
+	}
+
+	// --to still picks any deployment
+	expectRollbackTarget(t, deployments, "b", "b")
+}
+
+func TestFailedRollbackIsNotFollowed(t *testing.T) {
+	a := testDeployment("a", deployhistory.SourceExecute, "A")
+	b := testDeployment("b", deployhistory.SourceExecute, "B")
+	failed := testRollback("rollback1", a)
+	failed.Error = "stack rolled back"
+	// CloudFormation put B back after the failed rollback
+	current := testDeployment("current", deployhistory.SourceExecute, "B")
+	got, err := rollbackTarget([]deployhistory.Deployment{a, b, failed}, &current, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != "a" {
+		t.Fatalf("rolls back to %s, want a", got.ID)
+	}
+}
@@ -1,7 +1,11 @@
 package cobracmds
 
 import (
+	"encoding/json"
+	"fmt"
 	"io"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/google/go-github/v25/github"
@@ -9,24 +13,104 @@ import (
 	"github.com/cep21/cfmanage/internal/awscache"
 	"github.com/cep21/cfmanage/internal/cleanup"
 	"github.com/cep21/cfmanage/internal/ctxfinder"
+	"github.com/cep21/cfmanage/internal/deployhistory"
 	"github.com/cep21/cfmanage/internal/logger"
+	"github.com/cep21/cfmanage/internal/stacklock"
 	"github.com/cep21/cfmanage/internal/templatereader"
+	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
 )
 
 type RootCommand struct {
-	AWSCache      *awscache.AWSCache
-	T             *templatereader.TemplateFinder
-	Ctx           *templatereader.CreateChangeSetTemplate
-	Logger        *logger.Logger
-	Out           io.Writer
+	AWSCache *awscache.AWSCache
+	T        *templatereader.TemplateFinder
+	Ctx      *templatereader.CreateChangeSetTemplate
+	Logger   *logger.Logger
+	Out      io.Writer
+	// In answers prompts.  Defaults to stdin.
+	In io.Reader
+	// ErrOut receives what is not the command's result, like the cleanup report.  Defaults to stderr.
+	ErrOut        io.Writer
 	JSONFormat    bool
+	OutputFormat  string
 	Cleanup       *cleanup.Cleanup
 	ContextFinder *ctxfinder.ContextFinder
+
+	output outputFormat
+	// input reads In for the prompts of the command being run
+	input *lineReader
+	// exit defaults to os.Exit
+	exit func(code int)
+	// forceExitCleanup bounds the cleanup run after a second signal.  Defaults to 5 seconds.
+	forceExitCleanup time.Duration
 }
 
 const currentVersion = "1.3.0"
 
+// Execute runs the command line.  Cleanup always runs afterwards, even if the command fails or is interrupted.
+func (s *RootCommand) Execute() error {
+	if s.ContextFinder.ForceExit == nil {
+		s.ContextFinder.ForceExit = s.forceExit
+	}
+	err := s.Cobra().Execute()
+	s.input.stop()
+	s.ContextFinder.Close()
+	s.reportCleanup(s.Cleanup.Clean())
+	return err
+}
+
+func (s *RootCommand) errOut() io.Writer {
+	if s.ErrOut == nil {
+		return os.Stderr
+	}
+	return s.ErrOut
+}
+
+// reportCleanup writes what cleanup did to ErrOut, so it never mixes with the command's output.  JSON and ndjson output
+// get a cleanupReport document on a line of its own, other formats text.
+func (s *RootCommand) reportCleanup(report *cleanup.Report) {
+	if len(report.Results) == 0 {
+		return
+	}
+	m := &cleanupReportModel{Cleanup: report}
+	var err error
+	if s.output.isJSON() {
+		err = json.NewEncoder(s.errOut()).Encode(m)
+	} else {
+		err = m.HumanReadable(s.errOut())
+	}
+	if err != nil {
+		s.Logger.Log(0, "unable to write cleanup report: %s", err.Error())
+	}
+}
+
+// forceExit runs cleanup and exits without waiting for the command, for users who signal twice.  Cleanup may be what
+// hangs, so it only gets a few seconds: jobs still running then stay in the journal for the next run to replay.
+func (s *RootCommand) forceExit(sig os.Signal) {
+	bound := s.forceExitCleanup
+	if bound == 0 {
+		bound = time.Second * 5
+	}
+	s.Logger.Log(0, "caught second signal %s: cleaning up for at most %s and exiting", sig, bound)
+	done := make(chan *cleanup.Report, 1)
+	go func() {
+		done <- s.Cleanup.Clean()
+	}()
+	select {
+	case report := <-done:
+		s.reportCleanup(report)
+	case <-time.After(bound):
+		s.Logger.Log(0, "cleanup did not finish in %s: the next run finishes journaled cleanup", bound)
+		if err := s.Cleanup.Journal.Sync(); err != nil {
+			s.Logger.Log(0, "%s", err.Error())
+		}
+	}
+	if s.exit == nil {
+		os.Exit(130)
+	}
+	s.exit(130)
+}
+
 func (s *RootCommand) Cobra() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "cfmanage",
@@ -34,16 +118,56 @@ func (s *RootCommand) Cobra() *cobra.Command {
 		Long:    "cfmanage lets you manage a wide set of cloudformation files that represent many stacks at once",
 		Example: "cfexecute",
 		Version: currentVersion,
-		PersistentPostRun: func(cmd *cobra.Command, args []string) {
-			s.Cleanup.Clean()
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := s.output.set(s.OutputFormat, s.JSONFormat); err != nil {
+				return err
+			}
+			if _, exists := cmd.Annotations[annotationReplayJournal]; exists {
+				s.replayJournal()
+			}
+			return nil
 		},
 	}
+	if s.Cleanup.Journal == nil {
+		s.Cleanup.Journal = &cleanup.Journal{}
+	}
+	in := s.In
+	if in == nil {
+		in = os.Stdin
+	}
+	s.input = newLineReader(in)
 	cmd.PersistentFlags().IntVarP(&s.Logger.Verbosity, "verbosity", "v", 0, "Output verbosity.  Higher is more verbose")
 	cmd.PersistentFlags().DurationVarP(&s.ContextFinder.Timeout, "timeout", "t", 0, "If non zero, will time out commands on this value")
-	cmd.PersistentFlags().DurationVar(&s.Cleanup.CleanupTimeout, "cleantimeout", time.Second, "How long to wait for cleanup jobs to finish (in addition to the timeout of the script itself)")
+	cmd.PersistentFlags().DurationVar(&s.Cleanup.CleanupTimeout, "cleantimeout", 30*time.Second, "How long to wait for cleanup jobs to finish (in addition to the timeout of the script itself)")
+	cmd.PersistentFlags().StringVar(&s.Cleanup.Journal.Dir, "journal", cleanup.DefaultJournalDir(), "Directory to journal cleanup jobs into, so a later run can finish them if this one dies.  Empty disables the journal")
 	cmd.PersistentFlags().DurationVar(&s.AWSCache.PollInterval, "pollinterval", time.Second, "How long to wait between polls to CloudFormation  to see if stacks are finished creating")
 	cmd.PersistentFlags().StringVarP(&s.T.BaseDir, "dir", "d", "cloudformation", "Directory containing cloudformation files")
-	cmd.PersistentFlags().BoolVarP(&s.JSONFormat, "json", "j", false, "If true, will output as JSON")
+	cmd.PersistentFlags().BoolVarP(&s.JSONFormat, "json", "j", false, "If true, will output as JSON.  Same as --output json")
+	cmd.PersistentFlags().StringVarP(&s.OutputFormat, "output", "o", "", outputFormatUsage())
+	locks := &stackLocks{
+		AWSCache: s.AWSCache,
+		Logger:   s.Logger,
+	}
+	history := &stackHistory{
+		AWSCache: s.AWSCache,
+		Logger:   s.Logger,
+	}
+	cmd.PersistentFlags().StringVar(&history.Dir, "historydir", deployhistory.DefaultDir(), "Directory holding deployment history for params files that use the file history backend")
+	policies := &stackPolicies{
+		AWSCache: s.AWSCache,
+		T:        s.T,
+		Logger:   s.Logger,
+	}
+	notifications := &stackNotifications{
+		Logger: s.Logger,
+	}
+	lifecycle := &stackHooks{
+		AWSCache: s.AWSCache,
+		T:        s.T,
+		Logger:   s.Logger,
+	}
+	cmd.PersistentFlags().StringVar(&policies.File, "policyfile", "", "JSON file of guardrail policies checked against every changeset.  Defaults to policies.json in the template directory")
+	cmd.PersistentFlags().StringVar(&locks.Dir, "lockdir", stacklock.DefaultDir(), "Directory holding stack locks for params files that use the file lock backend")
 	if s.Out != nil {
 		cmd.SetOutput(s.Out)
 	}
@@ -53,40 +177,216 @@ func (s *RootCommand) Cobra() *cobra.Command {
 		T:             s.T,
 		Ctx:           s.Ctx,
 		Logger:        s.Logger,
-		JSON:          &s.JSONFormat,
+		Output:        &s.output,
 		ContextFinder: s.ContextFinder,
 		Cleanup:       s.Cleanup,
+		Locks:         locks,
+		Policies:      policies,
 	}
-	cmd.AddCommand(statusCmd.Cobra())
+	cmd.AddCommand(replaysJournal(statusCmd.Cobra()))
 
 	inspectCmd := &inspectCommand{
 		AWSCache:      s.AWSCache,
 		T:             s.T,
 		Ctx:           s.Ctx,
 		Logger:        s.Logger,
-		JSON:          &s.JSONFormat,
+		Output:        &s.output,
 		ContextFinder: s.ContextFinder,
 		Cleanup:       s.Cleanup,
+		Locks:         locks,
+		Policies:      policies,
 	}
-	cmd.AddCommand(inspectCmd.Cobra())
+	cmd.AddCommand(replaysJournal(inspectCmd.Cobra()))
 
 	executeCommand := &executeCommand{
 		AWSCache:      s.AWSCache,
 		T:             s.T,
 		Ctx:           s.Ctx,
 		Logger:        s.Logger,
-		JSON:          &s.JSONFormat,
+		Output:        &s.output,
 		ContextFinder: s.ContextFinder,
 		Cleanup:       s.Cleanup,
+		Locks:         locks,
+		Policies:      policies,
+		History:       history,
+		Notify:        notifications,
+		Hooks:         lifecycle,
+		Input:         s.input,
+	}
+	cmd.AddCommand(replaysJournal(executeCommand.Cobra()))
+
+	recoverCommand := &recoverCommand{
+		AWSCache:      s.AWSCache,
+		T:             s.T,
+		Ctx:           s.Ctx,
+		Logger:        s.Logger,
+		Output:        &s.output,
+		ContextFinder: s.ContextFinder,
+		Locks:         locks,
+		Execute:       executeCommand,
+	}
+	cmd.AddCommand(replaysJournal(recoverCommand.Cobra()))
+
+	rollbackCommand := &rollbackCommand{
+		AWSCache:      s.AWSCache,
+		T:             s.T,
+		Ctx:           s.Ctx,
+		Logger:        s.Logger,
+		Output:        &s.output,
+		ContextFinder: s.ContextFinder,
+		Locks:         locks,
+		History:       history,
+		Execute:       executeCommand,
+	}
+	cmd.AddCommand(replaysJournal(rollbackCommand.Cobra()))
+
+	importCommand := &importCommand{
+		AWSCache:      s.AWSCache,
+		T:             s.T,
+		Ctx:           s.Ctx,
+		Logger:        s.Logger,
+		Output:        &s.output,
+		ContextFinder: s.ContextFinder,
+		Locks:         locks,
+		Execute:       executeCommand,
+	}
+	cmd.AddCommand(replaysJournal(importCommand.Cobra()))
+
+	watchCommand := &watchCommand{
+		AWSCache:      s.AWSCache,
+		T:             s.T,
+		Ctx:           s.Ctx,
+		Logger:        s.Logger,
+		Output:        &s.output,
+		ContextFinder: s.ContextFinder,
+		Execute:       executeCommand,
 	}
-	cmd.AddCommand(executeCommand.Cobra())
+	cmd.AddCommand(replaysJournal(watchCommand.Cobra()))
+
+	outputsCommand := &outputsCommand{
+		AWSCache:      s.AWSCache,
+		T:             s.T,
+		Ctx:           s.Ctx,
+		Logger:        s.Logger,
+		Output:        &s.output,
+		ContextFinder: s.ContextFinder,
+	}
+	cmd.AddCommand(replaysJournal(outputsCommand.Cobra()))
+
+	resourcesCommand := &resourcesCommand{
+		AWSCache:      s.AWSCache,
+		T:             s.T,
+		Ctx:           s.Ctx,
+		Logger:        s.Logger,
+		Output:        &s.output,
+		ContextFinder: s.ContextFinder,
+	}
+	cmd.AddCommand(replaysJournal(resourcesCommand.Cobra()))
+
+	historyCommand := &historyCommand{
+		T:             s.T,
+		Ctx:           s.Ctx,
+		Logger:        s.Logger,
+		Output:        &s.output,
+		ContextFinder: s.ContextFinder,
+		History:       history,
+	}
+	cmd.AddCommand(replaysJournal(historyCommand.Cobra()))
+
+	gcCommand := &gcCommand{
+		AWSCache:      s.AWSCache,
+		T:             s.T,
+		Ctx:           s.Ctx,
+		Logger:        s.Logger,
+		Output:        &s.output,
+		ContextFinder: s.ContextFinder,
+		Cleanup:       s.Cleanup,
+	}
+	cmd.AddCommand(gcCommand.Cobra())
+
+	unlockCommand := &unlockCommand{
+		T:             s.T,
+		Ctx:           s.Ctx,
+		Logger:        s.Logger,
+		Output:        &s.output,
+		ContextFinder: s.ContextFinder,
+		Locks:         locks,
+	}
+	cmd.AddCommand(replaysJournal(unlockCommand.Cobra()))
 
 	versionCommand := &versionCommand{
 		Logger:        s.Logger,
-		JSON:          &s.JSONFormat,
+		Output:        &s.output,
 		ContextFinder: s.ContextFinder,
 		GithubClient:  github.NewClient(nil),
 	}
 	cmd.AddCommand(versionCommand.Cobra())
+
+	reportCmd := &reportCommand{
+		AWSCache:      s.AWSCache,
+		T:             s.T,
+		Ctx:           s.Ctx,
+		Logger:        s.Logger,
+		Output:        &s.output,
+		ContextFinder: s.ContextFinder,
+		Cleanup:       s.Cleanup,
+		Locks:         locks,
+		Policies:      policies,
+	}
+	cmd.AddCommand(replaysJournal(reportCmd.Cobra()))
+
+	schemaCommand := &schemaCommand{}
+	cmd.AddCommand(schemaCommand.Cobra())
 	return cmd
 }
+
+// annotationReplayJournal marks commands that use AWS.  Journaled cleanup is replayed before they run, but not before
+// commands like version that must work without AWS credentials.  gc replays the journal itself.
+const annotationReplayJournal = "cfmanage.replayJournal"
+
+// replaysJournal marks cmd as using AWS
+func replaysJournal(cmd *cobra.Command) *cobra.Command {
+	if cmd.Annotations == nil {
+		cmd.Annotations = map[string]string{}
+	}
+	cmd.Annotations[annotationReplayJournal] = "true"
+	return cmd
+}
+
+// replayJournal finishes cleanup jobs that earlier, interrupted runs left in the journal
+func (s *RootCommand) replayJournal() {
+	results, err := s.Cleanup.Journal.Replay(s.ContextFinder.Ctx(), s.AWSCache.CleanupRecord)
+	if err != nil {
+		s.Logger.Log(0, "unable to read cleanup journal: %s", err.Error())
+		return
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			s.Logger.Log(0, "unable to replay cleanup %s (%s): %s", r.Record.Kind, r.Record.String(), r.Err.Error())
+			continue
+		}
+		s.Logger.Log(1, "replayed cleanup %s (%s)", r.Record.Kind, r.Record.String())
+	}
+}
+
+type cleanupReportModel struct {
+	Cleanup *cleanup.Report
+}
+
+func (c *cleanupReportModel) HumanReadable(out io.Writer) error {
+	leftBehind := c.Cleanup.LeftBehind()
+	if _, err := fmt.Fprintf(out, "Cleanup: %d cleaned, %d left behind\n", len(c.Cleanup.Results)-len(leftBehind), len(leftBehind)); err != nil {
+		return err
+	}
+	if len(leftBehind) == 0 {
+		return nil
+	}
+	table := tablewriter.NewWriter(out)
+	table.SetHeader([]string{"Job", "Attempts", "Error"})
+	for _, r := range leftBehind {
+		table.Append([]string{r.Name, strconv.Itoa(r.Attempts), r.Error})
+	}
+	table.Render()
+	_, err := fmt.Fprintf(out, "Run `cfmanage gc` to retry jobs left behind\n")
+	return err
+}
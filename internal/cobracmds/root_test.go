@@ -0,0 +1,230 @@
+package cobracmds
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cep21/cfmanage/internal/cleanup"
+	"github.com/cep21/cfmanage/internal/ctxfinder"
+	"github.com/cep21/cfmanage/internal/logger"
+	"github.com/cep21/cfmanage/internal/schema"
+	"github.com/pkg/errors"
+)
+
+// tempDir is a directory removed once the test ends
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "cfmanage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestForceExitDoesNotWaitForCleanup(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+	c := &cleanup.Cleanup{
+		CleanupTimeout: time.Minute,
+		Journal: &cleanup.Journal{
+			Dir: dir,
+		},
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	c.Add("hangs", 0, func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	})
+	go c.Clean()
+	<-started
+
+	codes := make(chan int, 1)
+	s := &RootCommand{
+		Cleanup: c,
+		Logger: &logger.Logger{
+			Logger: log.New(ioutil.Discard, "", 0),
+		},
+		exit: func(code int) {
+			codes <- code
+		},
+	}
+	s.forceExitCleanup = time.Millisecond * 100
+	go s.forceExit(os.Interrupt)
+	select {
+	case code := <-codes:
+		if code != 130 {
+			t.Fatalf("exit code %d, want 130", code)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("forceExit waited for the hanging cleanup")
+	}
+}
+
+// fakeSignals lets a test send signals to a ContextFinder
+type fakeSignals struct {
+	mu sync.Mutex
+	c  chan<- os.Signal
+}
+
+func (f *fakeSignals) Notify(c chan<- os.Signal) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.c = c
+}
+
+func (f *fakeSignals) Stop(c chan<- os.Signal) {}
+
+func (f *fakeSignals) send(sig os.Signal) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.c <- sig
+}
+
+func TestSecondSignalRunsCleanupThenExits(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+	journal := &cleanup.Journal{
+		Dir: dir,
+	}
+	c := &cleanup.Cleanup{
+		CleanupTimeout: time.Minute,
+		Journal:        journal,
+	}
+	ran := make(chan struct{})
+	if err := c.AddRecord(cleanup.Record{Kind: "test"}, 0, func(ctx context.Context) error {
+		close(ran)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	signals := &fakeSignals{}
+	var stderr bytes.Buffer
+	codes := make(chan int, 1)
+	s := &RootCommand{
+		Cleanup:       c,
+		ContextFinder: &ctxfinder.ContextFinder{Signals: signals},
+		ErrOut:        &stderr,
+		Logger: &logger.Logger{
+			Logger: log.New(ioutil.Discard, "", 0),
+		},
+		exit: func(code int) {
+			codes <- code
+		},
+	}
+	s.ContextFinder.ForceExit = s.forceExit
+	defer s.ContextFinder.Close()
+	ctx := s.ContextFinder.Ctx()
+
+	signals.send(os.Interrupt)
+	<-ctx.Done()
+	select {
+	case <-ran:
+		t.Fatal("first signal ran cleanup")
+	default:
+	}
+	signals.send(os.Interrupt)
+	select {
+	case code := <-codes:
+		if code != 130 {
+			t.Fatalf("exit code %d, want 130", code)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("second signal did not exit")
+	}
+	select {
+	case <-ran:
+	default:
+		t.Fatal("second signal exited without running cleanup")
+	}
+	records, err := journal.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Fatalf("%d cleanup records left in the journal", len(records))
+	}
+	if !strings.HasPrefix(stderr.String(), "Cleanup: 1 cleaned, 0 left behind") {
+		t.Fatalf("cleanup report %q", stderr.String())
+	}
+}
+
+func testCleanupReport() *cleanup.Report {
+	return &cleanup.Report{
+		Results: []cleanup.Result{
+			{Name: "delete changeset", Attempts: 1},
+			{Name: "delete bucket object", Attempts: 3, Err: errors.New("access denied")},
+		},
+	}
+}
+
+func TestCleanupReportIsJSONOnStderr(t *testing.T) {
+	for _, format := range []string{"json", "ndjson"} {
+		var stdout, stderr bytes.Buffer
+		s := &RootCommand{
+			Out:    &stdout,
+			ErrOut: &stderr,
+		}
+		if err := s.output.set(format, false); err != nil {
+			t.Fatal(err)
+		}
+		s.reportCleanup(testCleanupReport())
+		if stdout.Len() != 0 {
+			t.Fatalf("%s: cleanup report written to stdout: %s", format, stdout.String())
+		}
+		lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+		if len(lines) != 1 {
+			t.Fatalf("%s: want one line of JSON, got %q", format, stderr.String())
+		}
+		var report schema.CleanupReport
+		if err := json.Unmarshal([]byte(lines[0]), &report); err != nil {
+			t.Fatal(err)
+		}
+		if report.Kind != "cleanupReport" || report.SchemaVersion != schema.Version {
+			t.Fatalf("%s: header %+v", format, report.Header)
+		}
+		if report.Cleaned != 1 || report.LeftBehind != 1 || len(report.Results) != 2 {
+			t.Fatalf("%s: report %s", format, lines[0])
+		}
+		if report.Results[1].Error == nil || report.Results[1].Error.Message != "access denied" {
+			t.Fatalf("%s: left behind job %+v", format, report.Results[1])
+		}
+	}
+}
+
+func TestCleanupReportIsTextOnStderr(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	s := &RootCommand{
+		Out:    &stdout,
+		ErrOut: &stderr,
+	}
+	s.reportCleanup(testCleanupReport())
+	if stdout.Len() != 0 {
+		t.Fatalf("cleanup report written to stdout: %s", stdout.String())
+	}
+	if !strings.HasPrefix(stderr.String(), "Cleanup: 1 cleaned, 1 left behind\n") {
+		t.Fatalf("cleanup report %q", stderr.String())
+	}
+}
+
+func TestNoCleanupNoReport(t *testing.T) {
+	var stderr bytes.Buffer
+	s := &RootCommand{
+		ErrOut: &stderr,
+	}
+	s.reportCleanup(&cleanup.Report{})
+	if stderr.Len() != 0 {
+		t.Fatalf("reported no cleanup: %q", stderr.String())
+	}
+}
@@ -0,0 +1,308 @@
+package cobracmds
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/cep21/cfmanage/internal/deployhistory"
+	"github.com/cep21/cfmanage/internal/schema"
+	"github.com/spf13/cobra"
+)
+
+// The JSON of every model is its versioned output type in the schema package, not the model itself, so models can
+// change without breaking the tools that read them.  Methods have value receivers so both models and pointers to them
+// marshal the same way.
+
+func (st stackStatus) schema() schema.Stack {
+	ret := schema.Stack{
+		Template:        st.Template,
+		ParamsFile:      st.StackFileName,
+		StackName:       st.StackName,
+		AccountID:       st.AccountID,
+		Region:          st.Region,
+		Description:     st.Description,
+		ChangesetStatus: st.ChangesetStatus,
+		Category:        st.category(),
+		LockedBy:        st.LockedBy,
+		ComputedAt:      schema.TimePtr(st.computed),
+		Error:           schema.NewError(st.err),
+		Target:          st.target,
+	}
+	if ret.Error == nil {
+		ret.Error = schema.NewError(st.ChangesetError)
+	}
+	// Stacks that do not exist have a placeholder without an ID
+	if st.cfStack != nil && st.cfStack.StackId != nil {
+		ret.StackID = *st.cfStack.StackId
+		ret.StackStatus = emptyOnNil(st.cfStack.StackStatus)
+		ret.LastUpdated = st.cfStack.LastUpdatedTime
+		if ret.LastUpdated == nil {
+			ret.LastUpdated = st.cfStack.CreationTime
+		}
+	}
+	if st.changeset != nil {
+		count := len(st.changeset.Changes)
+		ret.ChangeCount = &count
+	}
+	if st.stackSet != nil {
+		ret.StackSet = true
+		count := len(st.stackSet.changes())
+		ret.ChangeCount = &count
+		ret.Instances = st.stackSet.schemaInstances()
+		if st.stackSet.set != nil {
+			ret.StackID = emptyOnNil(st.stackSet.set.StackSetId)
+			ret.StackStatus = st.StackStatus
+		}
+	}
+	return ret
+}
+
+func (st stackStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(schema.StackLine{
+		Header: schema.NewHeader("stack"),
+		Stack:  st.schema(),
+	})
+}
+
+func (s statusCommandModel) MarshalJSON() ([]byte, error) {
+	ret := schema.Status{
+		Header:  schema.NewHeader("status"),
+		Stacks:  make([]schema.Stack, 0, len(s.Statuses)),
+		Summary: s.Summary.schema(),
+	}
+	for _, st := range s.Statuses {
+		ret.Stacks = append(ret.Stacks, st.schema())
+	}
+	return json.Marshal(ret)
+}
+
+func (s statusSummary) schema() schema.Summary {
+	return schema.Summary{
+		Stacks:      s.Stacks,
+		InSync:      s.InSync,
+		Changed:     s.Changed,
+		Errors:      s.Errors,
+		FailedState: s.FailedState,
+	}
+}
+
+func (r reportCommandModel) MarshalJSON() ([]byte, error) {
+	ret := schema.Report{
+		Header:         schema.NewHeader("report"),
+		Stacks:         make([]schema.Stack, 0, len(r.Stacks)),
+		Summary:        r.Summary.schema(),
+		Markdown:       r.Markdown,
+		CommentURL:     r.CommentURL,
+		CommentCreated: r.CommentCreated,
+	}
+	for _, st := range r.Stacks {
+		ret.Stacks = append(ret.Stacks, st.stat.schema())
+	}
+	return json.Marshal(ret)
+}
+
+func schemaParameters(params []param) []schema.Parameter {
+	ret := make([]schema.Parameter, 0, len(params))
+	for _, p := range params {
+		ret = append(ret, schema.Parameter{
+			Key:   p.Key,
+			Value: p.Value,
+		})
+	}
+	return ret
+}
+
+func (i inspectCommandModel) MarshalJSON() ([]byte, error) {
+	ret := schema.Inspect{
+		Header:             schema.NewHeader("inspect"),
+		Stack:              i.stackStatus.schema(),
+		Parameters:         schemaParameters(i.Parameters),
+		Outputs:            schemaParameters(i.Outputs),
+		Changes:            []schema.Change{},
+		StackSetChanges:    schemaParameters(i.stackSetChanges()),
+		PolicyViolations:   make([]schema.PolicyViolation, 0, len(i.Policy)),
+		DestructiveChanges: make([]schema.DestructiveChange, 0, len(i.Destructive)),
+	}
+	if i.changeset != nil {
+		ret.Changes = schema.NewChanges(i.changeset.Changes)
+	}
+	for _, v := range i.Policy {
+		ret.PolicyViolations = append(ret.PolicyViolations, schema.PolicyViolation{
+			Rule:    v.Rule,
+			Level:   v.Level,
+			Message: v.Message,
+		})
+	}
+	for _, c := range i.Destructive {
+		ret.DestructiveChanges = append(ret.DestructiveChanges, schema.DestructiveChange{
+			LogicalID:    c.LogicalID,
+			PhysicalID:   c.PhysicalID,
+			ResourceType: c.ResourceType,
+			Reason:       c.Reason,
+		})
+	}
+	return json.Marshal(ret)
+}
+
+func (s stackEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(schema.StackEvent{
+		Header:       schema.NewHeader("stackEvent"),
+		Time:         s.Timestamp,
+		StackName:    s.StackName,
+		LogicalID:    s.LogicalResourceID,
+		PhysicalID:   s.PhysicalResourceID,
+		ResourceType: s.ResourceType,
+		Status:       s.ResourceStatus,
+		StatusReason: s.ResourceStatusReason,
+	})
+}
+
+func (p printableString) MarshalJSON() ([]byte, error) {
+	return json.Marshal(schema.Message{
+		Header:  schema.NewHeader("message"),
+		Message: strings.TrimSpace(string(p)),
+	})
+}
+
+func (v versionCommandModel) MarshalJSON() ([]byte, error) {
+	return json.Marshal(schema.VersionInfo{
+		Header:         schema.NewHeader("version"),
+		CurrentVersion: v.CurrentVersion,
+		LatestVersion:  v.LatestVersion,
+	})
+}
+
+func schemaDeployment(d *deployhistory.Deployment) schema.Deployment {
+	ret := schema.Deployment{
+		ID:               d.ID,
+		Key:              d.Key,
+		StackName:        d.StackName,
+		StackID:          d.StackID,
+		Time:             d.Time,
+		Source:           d.Source,
+		Status:           d.Status,
+		Succeeded:        d.Succeeded(),
+		User:             d.User,
+		IdentityARN:      d.IdentityARN,
+		GitSHA:           d.GitSHA,
+		GitDirty:         d.GitDirty,
+		ChangesetARN:     d.ChangesetARN,
+		InputHash:        d.InputHash,
+		StartTime:        schema.TimePtr(d.StartTime),
+		EndTime:          schema.TimePtr(d.EndTime),
+		Incomplete:       d.Incomplete,
+		RolledBackTo:     d.RolledBackTo,
+		PolicyOverride:   d.PolicyOverride,
+		PolicyViolations: d.PolicyViolations,
+		Parameters:       make([]schema.Parameter, 0, len(d.Parameters)),
+		Changes:          make([]schema.DeploymentChange, 0, len(d.Changes)),
+		Events:           make([]schema.DeploymentEvent, 0, len(d.Events)),
+	}
+	if d.Error != "" {
+		ret.Error = &schema.Error{
+			Message: d.Error,
+		}
+	}
+	for _, p := range d.Parameters {
+		ret.Parameters = append(ret.Parameters, schema.Parameter{
+			Key:   emptyOnNil(p.ParameterKey),
+			Value: emptyOnNil(p.ParameterValue),
+		})
+	}
+	for _, c := range d.Changes {
+		ret.Changes = append(ret.Changes, schema.DeploymentChange{
+			Action:       c.Action,
+			LogicalID:    c.LogicalID,
+			PhysicalID:   c.PhysicalID,
+			ResourceType: c.ResourceType,
+			Replacement:  c.Replacement,
+		})
+	}
+	for _, e := range d.Events {
+		ret.Events = append(ret.Events, schema.DeploymentEvent{
+			Time:         e.Time,
+			LogicalID:    e.LogicalID,
+			ResourceType: e.ResourceType,
+			Status:       e.Status,
+			Reason:       e.Reason,
+		})
+	}
+	return ret
+}
+
+func (h historyCommandModel) MarshalJSON() ([]byte, error) {
+	ret := schema.History{
+		Header:      schema.NewHeader("history"),
+		Deployments: make([]schema.Deployment, 0, len(h.Deployments)),
+	}
+	for i := range h.Deployments {
+		ret.Deployments = append(ret.Deployments, schemaDeployment(&h.Deployments[i]))
+	}
+	return json.Marshal(ret)
+}
+
+func (m deploymentModel) MarshalJSON() ([]byte, error) {
+	return json.Marshal(schema.DeploymentDetail{
+		Header:     schema.NewHeader("deploymentDetail"),
+		Deployment: schemaDeployment(&m.Deployment),
+	})
+}
+
+func (g gcCommandModel) MarshalJSON() ([]byte, error) {
+	ret := schema.GC{
+		Header:  schema.NewHeader("gc"),
+		Cleaned: make([]schema.CleanupItem, 0, len(g.Cleaned)),
+	}
+	for _, c := range g.Cleaned {
+		ret.Cleaned = append(ret.Cleaned, schema.CleanupItem{
+			Kind:        c.Kind,
+			Description: c.Description,
+			Error:       schema.NewError(c.err),
+		})
+	}
+	return json.Marshal(ret)
+}
+
+func (c cleanupReportModel) MarshalJSON() ([]byte, error) {
+	leftBehind := len(c.Cleanup.LeftBehind())
+	ret := schema.CleanupReport{
+		Header:     schema.NewHeader("cleanupReport"),
+		Cleaned:    len(c.Cleanup.Results) - leftBehind,
+		LeftBehind: leftBehind,
+		Results:    make([]schema.CleanupResult, 0, len(c.Cleanup.Results)),
+	}
+	for _, r := range c.Cleanup.Results {
+		ret.Results = append(ret.Results, schema.CleanupResult{
+			Name:     r.Name,
+			Attempts: r.Attempts,
+			Error:    schema.NewError(r.Err),
+		})
+	}
+	return json.Marshal(ret)
+}
+
+type schemaCommand struct{}
+
+func (s *schemaCommand) Cobra() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:       "schema [output]",
+		Short:     "Print the JSON Schema of machine readable output",
+		Long:      "Print the JSON Schema of one kind of output, or of every output if none is given.  Every JSON document cfmanage writes has a schemaVersion and a kind naming its schema.",
+		Example:   "cfexecute schema status",
+		ValidArgs: schema.Kinds(),
+		Args:      cobra.MaximumNArgs(1),
+	}
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		ret := schema.AllJSONSchema()
+		if len(args) == 1 {
+			var err error
+			if ret, err = schema.JSONSchema(args[0]); err != nil {
+				return err
+			}
+		}
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		return enc.Encode(ret)
+	}
+	return cmd
+}
@@ -0,0 +1,216 @@
+package cobracmds
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/cep21/cfmanage/internal/cleanup"
+	"github.com/cep21/cfmanage/internal/deployhistory"
+	"github.com/cep21/cfmanage/internal/policy"
+	"github.com/cep21/cfmanage/internal/schema"
+	"github.com/cep21/cfmanage/internal/templatereader"
+	"github.com/pkg/errors"
+)
+
+// checkSchema fails if doc does not match s, a JSON Schema as the schema package generates them
+func checkSchema(t *testing.T, path string, doc interface{}, s map[string]interface{}, definitions map[string]interface{}) {
+	if ref, exists := s["$ref"]; exists {
+		s = definitions[strings.TrimPrefix(ref.(string), "#/definitions/")].(map[string]interface{})
+	}
+	for _, sub := range asList(s["allOf"]) {
+		checkSchema(t, path, doc, sub.(map[string]interface{}), definitions)
+	}
+	if c, exists := s["const"]; exists && doc != c {
+		t.Errorf("%s is %v, want %v", path, doc, c)
+	}
+	if enum, exists := s["enum"]; exists && !contains(enum.([]string), doc.(string)) {
+		t.Errorf("%s is %v, not one of %v", path, doc, enum)
+	}
+	if doc == nil {
+		// Nil pointers, slices and maps without omitempty
+		return
+	}
+	switch s["type"] {
+	case "object":
+		obj, ok := doc.(map[string]interface{})
+		if !ok {
+			t.Errorf("%s is %T, want an object", path, doc)
+			return
+		}
+		if additional, exists := s["additionalProperties"]; exists {
+			for k, v := range obj {
+				checkSchema(t, path+"."+k, v, additional.(map[string]interface{}), definitions)
+			}
+			return
+		}
+		properties := s["properties"].(map[string]interface{})
+		for k, v := range obj {
+			prop, exists := properties[k]
+			if !exists {
+				t.Errorf("%s.%s is not in the schema", path, k)
+				continue
+			}
+			checkSchema(t, path+"."+k, v, prop.(map[string]interface{}), definitions)
+		}
+		if required, exists := s["required"]; exists {
+			for _, k := range required.([]string) {
+				if _, exists := obj[k]; !exists {
+					t.Errorf("%s.%s is required", path, k)
+				}
+			}
+		}
+	case "array":
+		list, ok := doc.([]interface{})
+		if !ok {
+			t.Errorf("%s is %T, want an array", path, doc)
+			return
+		}
+		for i, v := range list {
+			checkSchema(t, path+"["+strconv.Itoa(i)+"]", v, s["items"].(map[string]interface{}), definitions)
+		}
+	case "string":
+		if _, ok := doc.(string); !ok {
+			t.Errorf("%s is %T, want a string", path, doc)
+		}
+	case "integer", "number":
+		if _, ok := doc.(float64); !ok {
+			t.Errorf("%s is %T, want a number", path, doc)
+		}
+	case "boolean":
+		if _, ok := doc.(bool); !ok {
+			t.Errorf("%s is %T, want a boolean", path, doc)
+		}
+	}
+}
+
+func asList(v interface{}) []interface{} {
+	if v == nil {
+		return nil
+	}
+	return v.([]interface{})
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+func testSchemaStatus() stackStatus {
+	created := time.Unix(1500000000, 0).UTC()
+	return stackStatus{
+		Template:        "infra",
+		StackFileName:   "canary",
+		StackName:       "infra-canary",
+		AccountID:       "111",
+		Region:          "us-west-2",
+		ChangesetStatus: "CREATE_COMPLETE",
+		LockedBy:        "jack@laptop",
+		computed:        created,
+		changesetInput:  &templatereader.ChangesetInput{},
+		cfStack: &cloudformation.Stack{
+			StackId:      aws.String("arn:aws:cloudformation:us-west-2:111:stack/infra-canary/1"),
+			StackStatus:  aws.String("UPDATE_COMPLETE"),
+			CreationTime: &created,
+		},
+		changeset: &cloudformation.DescribeChangeSetOutput{
+			Changes: []*cloudformation.Change{
+				testResourceChange(cloudformation.ChangeActionRemove, "Table", "AWS::DynamoDB::Table", ""),
+			},
+		},
+	}
+}
+
+func TestOutputsMatchSchema(t *testing.T) {
+	status := testSchemaStatus()
+	failed := testSchemaStatus()
+	failed.ChangesetError = errors.New("unable to create changeset")
+	inspect := &inspectCommandModel{
+		stackStatus: status,
+		Parameters:  []param{{Key: "Env", Value: "canary"}},
+		Policy:      policy.Violations{{Rule: "no-deletes", Level: policy.LevelBlock, Message: "Remove Table"}},
+		Destructive: destructiveChanges(status.changeset.Changes),
+	}
+	now := time.Unix(1500000000, 0)
+	models := []struct {
+		kind  string
+		model interface{}
+	}{
+		{kind: "stack", model: status},
+		{kind: "status", model: statusCommandModel{Statuses: []stackStatus{status, failed}, Summary: summarize([]stackStatus{status, failed})}},
+		{kind: "inspect", model: inspect},
+		{kind: "report", model: reportCommandModel{Stacks: []reportStack{{stat: status, inspect: inspect}}, Markdown: "| a |"}},
+		{kind: "stackEvent", model: stackEvent{Timestamp: &now, StackName: "infra-canary", ResourceStatus: "UPDATE_COMPLETE"}},
+		{kind: "message", model: printableString("no changes\n")},
+		{kind: "version", model: versionCommandModel{CurrentVersion: "1.3.0", LatestVersion: "1.3.0"}},
+		{kind: "history", model: historyCommandModel{Deployments: []deployhistory.Deployment{
+			{ID: "1", Source: deployhistory.SourceRecover, Time: now, Error: "stack rolled back"},
+			{ID: "2", Source: deployhistory.SourceRollback, Time: now, RolledBackTo: "1"},
+		}}},
+		{kind: "deploymentDetail", model: deploymentModel{Deployment: deployhistory.Deployment{ID: "1", Source: deployhistory.SourceExecute}}},
+		{kind: "gc", model: gcCommandModel{Cleaned: []gcItem{newGCItem("changeset", "old", nil)}}},
+		{kind: "cleanupReport", model: cleanupReportModel{Cleanup: &cleanup.Report{Results: []cleanup.Result{{Name: "delete changeset", Attempts: 2}}}}},
+		{kind: "outputs", model: outputsCommandModel{Stacks: []stackOutputs{{StackName: "infra-canary", Outputs: []stackOutput{{Key: "Url", Value: "https://example.com"}}}}}},
+		{kind: "resources", model: resourcesCommandModel{StackName: "infra-canary", Resources: []stackResource{{LogicalID: "Table", LastUpdated: &now}}}},
+		{kind: "rollout", model: rolloutModel{Strategy: "serial", Targets: []targetResult{{Target: "prod", Result: "succeeded"}}}},
+		{kind: "deployEvent", model: deployEvent(inspect, schema.DeployFailed, deployhistory.SourceRecover)},
+		{kind: "hookInput", model: hookInput(schema.HookPreExecute, inspect)},
+	}
+	covered := make(map[string]bool)
+	for _, m := range models {
+		covered[m.kind] = true
+		t.Run(m.kind, func(t *testing.T) {
+			b, err := json.Marshal(m.model)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var doc map[string]interface{}
+			if err := json.Unmarshal(b, &doc); err != nil {
+				t.Fatal(err)
+			}
+			if doc["schemaVersion"] != schema.Version || doc["kind"] != m.kind {
+				t.Fatalf("header is %v %v, want %s %s", doc["schemaVersion"], doc["kind"], schema.Version, m.kind)
+			}
+			s, err := schema.JSONSchema(m.kind)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkSchema(t, m.kind, doc, s, s["definitions"].(map[string]interface{}))
+		})
+	}
+	for _, kind := range schema.Kinds() {
+		if !covered[kind] {
+			t.Errorf("no model of output %s is tested", kind)
+		}
+	}
+}
+
+// Value receivers make a model and a pointer to it the same document
+func TestPointersMarshalLikeValues(t *testing.T) {
+	status := testSchemaStatus()
+	for _, pair := range [][2]interface{}{
+		{status, &status},
+		{printableString("done"), func() *printableString { p := printableString("done"); return &p }()},
+		{versionCommandModel{CurrentVersion: "1"}, &versionCommandModel{CurrentVersion: "1"}},
+	} {
+		value, err := json.Marshal(pair[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		pointer, err := json.Marshal(pair[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(value) != string(pointer) {
+			t.Fatalf("pointer marshals to\n%s\nvalue to\n%s", pointer, value)
+		}
+	}
+}
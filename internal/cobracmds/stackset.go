@@ -0,0 +1,620 @@
+package cobracmds
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/cep21/cfmanage/internal/awscache"
+	"github.com/cep21/cfmanage/internal/dashboard"
+	"github.com/cep21/cfmanage/internal/formatter"
+	"github.com/cep21/cfmanage/internal/logger"
+	"github.com/cep21/cfmanage/internal/schema"
+	"github.com/cep21/cfmanage/internal/templatereader"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// instanceMissing is the status of an instance the params file wants that does not exist
+const instanceMissing = "MISSING"
+
+// stackSetState compares a stack set and its instances with a params file.  Stack sets have no changesets, so this
+// is what status, inspect and execute know about pending changes.
+type stackSetState struct {
+	name string
+	// set is nil if the stack set does not exist
+	set       *cloudformation.StackSet
+	instances []*cloudformation.StackInstanceSummary
+	// serviceManaged stack sets deploy to organizational units instead of accounts
+	serviceManaged bool
+	// targetIDs are the accounts, or the organizational units of a service managed stack set, that get an instance in
+	// each of regions
+	targetIDs []string
+	regions   []string
+	// missing are the targets and regions the params file wants an instance in that have none
+	missing [][2]string
+	// removed instances are in accounts or regions the params file no longer lists.  Execute deletes them.
+	removed []*cloudformation.StackInstanceSummary
+	// differs describes how the stack set differs from the params file
+	differs []string
+}
+
+func loadStackSetState(ctx context.Context, ses *awscache.AWSClients, in *templatereader.ChangesetInput) (*stackSetState, error) {
+	cfg := in.StackSet
+	targetIDs := cfg.Accounts
+	if cfg.ServiceManaged() {
+		targetIDs = cfg.OrganizationalUnitIDs
+	} else if len(targetIDs) == 0 {
+		account, err := ses.AccountID()
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to find the account of the profile")
+		}
+		targetIDs = []string{account}
+	}
+	regions := cfg.Regions
+	if len(regions) == 0 {
+		regions = []string{ses.Region()}
+	}
+	set, err := ses.DescribeStackSet(ctx, *in.StackName)
+	if err != nil {
+		return nil, err
+	}
+	var instances []*cloudformation.StackInstanceSummary
+	if set != nil {
+		if instances, err = ses.ListStackInstances(ctx, *in.StackName); err != nil {
+			return nil, err
+		}
+	}
+	return newStackSetState(in, targetIDs, regions, set, instances), nil
+}
+
+// newStackSetState compares a stack set, or nil if it does not exist, with a params file deploying it to targetIDs
+// in regions
+func newStackSetState(in *templatereader.ChangesetInput, targetIDs []string, regions []string, set *cloudformation.StackSet, instances []*cloudformation.StackInstanceSummary) *stackSetState {
+	ret := &stackSetState{
+		name:           *in.StackName,
+		set:            set,
+		instances:      instances,
+		serviceManaged: in.StackSet.ServiceManaged(),
+		targetIDs:      targetIDs,
+		regions:        regions,
+	}
+	if set != nil {
+		ret.differs = stackSetDifferences(in, set)
+	}
+	existing := make(map[[2]string]bool, len(ret.instances))
+	for _, inst := range ret.instances {
+		key := ret.key(inst)
+		existing[key] = true
+		if !ret.targets(key) {
+			ret.removed = append(ret.removed, inst)
+		}
+	}
+	for _, target := range ret.targetIDs {
+		for _, region := range ret.regions {
+			if key := [2]string{target, region}; !existing[key] {
+				ret.missing = append(ret.missing, key)
+			}
+		}
+	}
+	return ret
+}
+
+// stackSetDifferences describes how a deployed stack set differs from its params file
+func stackSetDifferences(in *templatereader.ChangesetInput, set *cloudformation.StackSet) []string {
+	var ret []string
+	switch {
+	case in.TemplateBody == nil:
+		ret = append(ret, "template unknown (uses a template URL)")
+	case !sameTemplate(emptyOnNil(set.TemplateBody), *in.TemplateBody):
+		ret = append(ret, "template differs")
+	}
+	if keys := differentParameters(in.Parameters, set.Parameters); len(keys) != 0 {
+		ret = append(ret, "params differ: "+strings.Join(keys, ", "))
+	}
+	if !sameTags(in.Tags, set.Tags) {
+		ret = append(ret, "tags differ")
+	}
+	cfg := in.StackSet
+	if cfg.AdministrationRoleARN != "" && cfg.AdministrationRoleARN != emptyOnNil(set.AdministrationRoleARN) {
+		ret = append(ret, "administration role differs")
+	}
+	if cfg.ExecutionRoleName != "" && cfg.ExecutionRoleName != emptyOnNil(set.ExecutionRoleName) {
+		ret = append(ret, "execution role differs")
+	}
+	if firstNonEmpty(cfg.PermissionModel, cloudformation.PermissionModelsSelfManaged) != firstNonEmpty(emptyOnNil(set.PermissionModel), cloudformation.PermissionModelsSelfManaged) {
+		ret = append(ret, "permission model differs")
+	}
+	if cfg.AutoDeployment != nil && !sameAutoDeployment(cfg.AutoDeployment, set.AutoDeployment) {
+		ret = append(ret, "auto deployment differs")
+	}
+	return ret
+}
+
+func sameAutoDeployment(want *cloudformation.AutoDeployment, got *cloudformation.AutoDeployment) bool {
+	if got == nil {
+		got = &cloudformation.AutoDeployment{}
+	}
+	return aws.BoolValue(want.Enabled) == aws.BoolValue(got.Enabled) && aws.BoolValue(want.RetainStacksOnAccountRemoval) == aws.BoolValue(got.RetainStacksOnAccountRemoval)
+}
+
+// key is the target and region of an instance: its account, or its organizational unit if the stack set is service
+// managed
+func (s *stackSetState) key(inst *cloudformation.StackInstanceSummary) [2]string {
+	if s.serviceManaged {
+		return [2]string{emptyOnNil(inst.OrganizationalUnitId), emptyOnNil(inst.Region)}
+	}
+	return [2]string{emptyOnNil(inst.Account), emptyOnNil(inst.Region)}
+}
+
+func (s *stackSetState) targets(key [2]string) bool {
+	return containsString(s.targetIDs, key[0]) && containsString(s.regions, key[1])
+}
+
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// outdated are the instances the params file wants that are not up to date with the stack set
+func (s *stackSetState) outdated() []*cloudformation.StackInstanceSummary {
+	var ret []*cloudformation.StackInstanceSummary
+	for _, inst := range s.instances {
+		if emptyOnNil(inst.Status) != cloudformation.StackInstanceStatusCurrent && s.targets(s.key(inst)) {
+			ret = append(ret, inst)
+		}
+	}
+	return ret
+}
+
+// needsUpdate is true if the stack set or some of the instances the params file wants are not what it wants
+func (s *stackSetState) needsUpdate() bool {
+	return len(s.differs) != 0 || len(s.outdated()) != 0
+}
+
+// changes are what execute would do, as inspect shows them
+func (s *stackSetState) changes() []param {
+	var ret []param
+	switch {
+	case s.set == nil:
+		ret = append(ret, param{Key: s.name, Value: "Create stack set"})
+	case len(s.differs) != 0:
+		ret = append(ret, param{Key: s.name, Value: "Update stack set: " + strings.Join(s.differs, "; ")})
+	}
+	for _, inst := range s.outdated() {
+		ret = append(ret, param{
+			Key:   emptyOnNil(inst.Account) + "/" + emptyOnNil(inst.Region),
+			Value: strings.TrimSpace("Update instance, which is " + emptyOnNil(inst.Status) + " " + emptyOnNil(inst.StatusReason)),
+		})
+	}
+	for _, m := range s.missing {
+		ret = append(ret, param{Key: m[0] + "/" + m[1], Value: "Create instance"})
+	}
+	for _, inst := range s.removed {
+		ret = append(ret, param{
+			Key:   emptyOnNil(inst.Account) + "/" + emptyOnNil(inst.Region),
+			Value: "Delete instance: no longer in the params file",
+		})
+	}
+	return ret
+}
+
+// destructive are the instances execute deletes, so deploying asks for the same confirmation as a changeset deleting
+// resources
+func (s *stackSetState) destructive() []destructiveChange {
+	var ret []destructiveChange
+	for _, inst := range s.removed {
+		ret = append(ret, destructiveChange{
+			LogicalID:    emptyOnNil(inst.Account) + "/" + emptyOnNil(inst.Region),
+			PhysicalID:   emptyOnNil(inst.StackId),
+			ResourceType: "AWS::CloudFormation::StackInstance",
+			Reason:       "deleted: no longer in the params file",
+		})
+	}
+	return ret
+}
+
+// detectDrift checks each instance of the stack set for drift, then reloads them to show what it found
+func (s *stackSetState) detectDrift(ctx context.Context, ses *awscache.AWSClients, in *templatereader.ChangesetInput, log *logger.Logger) error {
+	if s.set == nil || len(s.instances) == 0 {
+		return nil
+	}
+	opID, err := ses.DetectStackSetDrift(ctx, s.name, in.StackSet.OperationPreferences)
+	if err != nil {
+		return err
+	}
+	if err := ses.WaitForStackSetOperation(ctx, s.name, opID, log, func(r *cloudformation.StackSetOperationResultSummary) {
+		log.Log(1, "drift detection of %s in %s/%s is %s", s.name, emptyOnNil(r.Account), emptyOnNil(r.Region), emptyOnNil(r.Status))
+	}); err != nil {
+		return err
+	}
+	instances, err := ses.ListStackInstances(ctx, s.name)
+	if err != nil {
+		return err
+	}
+	*s = *newStackSetState(in, s.targetIDs, s.regions, s.set, instances)
+	return nil
+}
+
+// drifted counts the instances whose resources drifted from the stack set
+func (s *stackSetState) drifted() int {
+	ret := 0
+	for _, inst := range s.instances {
+		if emptyOnNil(inst.DriftStatus) == cloudformation.StackDriftStatusDrifted {
+			ret++
+		}
+	}
+	return ret
+}
+
+// summary counts instances by status, for the changeset status column
+func (s *stackSetState) summary() string {
+	counts := make(map[string]int)
+	for _, inst := range s.instances {
+		counts[emptyOnNil(inst.Status)]++
+	}
+	var parts []string
+	for _, status := range []string{cloudformation.StackInstanceStatusCurrent, cloudformation.StackInstanceStatusOutdated, cloudformation.StackInstanceStatusInoperable} {
+		if counts[status] != 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[status], status))
+		}
+	}
+	if len(s.missing) != 0 {
+		parts = append(parts, fmt.Sprintf("%d missing", len(s.missing)))
+	}
+	if len(s.removed) != 0 {
+		parts = append(parts, fmt.Sprintf("%d not in params file", len(s.removed)))
+	}
+	if n := s.drifted(); n != 0 {
+		parts = append(parts, fmt.Sprintf("%d %s", n, cloudformation.StackDriftStatusDrifted))
+	}
+	ret := "stack set instances: " + strings.Join(parts, ", ")
+	if len(parts) == 0 {
+		ret = "stack set without instances"
+	}
+	if len(s.differs) != 0 {
+		ret += "; " + strings.Join(s.differs, "; ")
+	}
+	return ret
+}
+
+// schemaInstances are the instances of the stack set, followed by the ones the params file wants that are missing
+func (s *stackSetState) schemaInstances() []schema.StackInstance {
+	ret := make([]schema.StackInstance, 0, len(s.instances)+len(s.missing))
+	for _, inst := range s.instances {
+		ret = append(ret, schema.StackInstance{
+			Account:              emptyOnNil(inst.Account),
+			OrganizationalUnitID: emptyOnNil(inst.OrganizationalUnitId),
+			Region:               emptyOnNil(inst.Region),
+			StackID:              emptyOnNil(inst.StackId),
+			Status:               emptyOnNil(inst.Status),
+			StatusReason:         emptyOnNil(inst.StatusReason),
+			Removed:              !s.targets(s.key(inst)),
+			DriftStatus:          emptyOnNil(inst.DriftStatus),
+		})
+	}
+	for _, m := range s.missing {
+		inst := schema.StackInstance{
+			Account: m[0],
+			Region:  m[1],
+			Status:  instanceMissing,
+		}
+		if s.serviceManaged {
+			inst.Account = ""
+			inst.OrganizationalUnitID = m[0]
+		}
+		ret = append(ret, inst)
+	}
+	return ret
+}
+
+func (s *stackSetState) inoperable() bool {
+	for _, inst := range s.instances {
+		if emptyOnNil(inst.Status) == cloudformation.StackInstanceStatusInoperable {
+			return true
+		}
+	}
+	return false
+}
+
+// stackSetInstancesTable lists the instances of every stack set in statuses
+func stackSetInstancesTable(statuses []stackStatus) formatter.Table {
+	ret := formatter.Table{
+		Title:  "Stack set instances",
+		Header: []string{"Stack set", "Account", "Organizational unit", "Region", "Status", "Status reason", "Drift", "Stack ID"},
+	}
+	for _, st := range statuses {
+		if st.stackSet == nil {
+			continue
+		}
+		for _, inst := range st.stackSet.schemaInstances() {
+			status := inst.Status
+			if inst.Removed {
+				status += " (not in params file)"
+			}
+			ret.Rows = append(ret.Rows, []string{st.StackName, inst.Account, inst.OrganizationalUnitID, inst.Region, status, inst.StatusReason, inst.DriftStatus, inst.StackID})
+		}
+	}
+	return ret
+}
+
+// stackSetStatus is the status of a params file that describes a stack set
+func stackSetStatus(ctx context.Context, ses *awscache.AWSClients, t string, fname string, in *templatereader.ChangesetInput) stackStatus {
+	ret := stackStatus{
+		Template:       t,
+		StackFileName:  fname,
+		StackName:      *in.StackName,
+		AccountID:      readable(ses.AccountID()),
+		Region:         ses.Region(),
+		changesetInput: in,
+	}
+	state, err := loadStackSetState(ctx, ses, in)
+	if err != nil {
+		ret.StackStatus = err.Error()
+		ret.ChangesetError = err
+		ret.ChangesetStatus = err.Error()
+		return ret
+	}
+	ret.stackSet = state
+	ret.StackStatus = "--DOES NOT EXIST--"
+	if state.set != nil {
+		ret.StackStatus = "STACK_SET_" + emptyOnNil(state.set.Status)
+		ret.Description = emptyOnNil(state.set.Description)
+	}
+	ret.ChangeCount = strconv.Itoa(len(state.changes()))
+	ret.ChangesetStatus = state.summary()
+	return ret
+}
+
+func stackSetCreateInput(in *templatereader.ChangesetInput) *cloudformation.CreateStackSetInput {
+	ret := &cloudformation.CreateStackSetInput{
+		StackSetName: in.StackName,
+		TemplateBody: in.TemplateBody,
+		TemplateURL:  in.TemplateURL,
+		Parameters:   in.Parameters,
+		Tags:         in.Tags,
+		Capabilities: in.Capabilities,
+	}
+	if in.StackSet.AdministrationRoleARN != "" {
+		ret.AdministrationRoleARN = aws.String(in.StackSet.AdministrationRoleARN)
+	}
+	if in.StackSet.ExecutionRoleName != "" {
+		ret.ExecutionRoleName = aws.String(in.StackSet.ExecutionRoleName)
+	}
+	if in.StackSet.PermissionModel != "" {
+		ret.PermissionModel = aws.String(in.StackSet.PermissionModel)
+	}
+	ret.AutoDeployment = in.StackSet.AutoDeployment
+	return ret
+}
+
+func stackSetUpdateInput(in *templatereader.ChangesetInput, s *stackSetState) *cloudformation.UpdateStackSetInput {
+	c := stackSetCreateInput(in)
+	ret := &cloudformation.UpdateStackSetInput{
+		StackSetName:          c.StackSetName,
+		TemplateBody:          c.TemplateBody,
+		TemplateURL:           c.TemplateURL,
+		Parameters:            c.Parameters,
+		Tags:                  c.Tags,
+		Capabilities:          c.Capabilities,
+		AdministrationRoleARN: c.AdministrationRoleARN,
+		ExecutionRoleName:     c.ExecutionRoleName,
+		PermissionModel:       c.PermissionModel,
+		AutoDeployment:        c.AutoDeployment,
+		OperationPreferences:  in.StackSet.OperationPreferences,
+	}
+	if s.serviceManaged {
+		// Service managed stack sets update the instances of the organizational units and regions they are given
+		ret.DeploymentTargets = &cloudformation.DeploymentTargets{
+			OrganizationalUnitIds: aws.StringSlice(s.targetIDs),
+		}
+		ret.Regions = aws.StringSlice(s.regions)
+	}
+	return ret
+}
+
+// instanceGroup is every region of every account, or organizational unit, that one stack set operation acts on
+type instanceGroup struct {
+	targetIDs []string
+	regions   []string
+}
+
+// groupInstances groups targets and regions into as few operations as it takes, in the order targets first appear
+func groupInstances(keys [][2]string) []instanceGroup {
+	regionsOf := make(map[string][]string)
+	var targetIDs []string
+	for _, k := range keys {
+		if _, ok := regionsOf[k[0]]; !ok {
+			targetIDs = append(targetIDs, k[0])
+		}
+		if !containsString(regionsOf[k[0]], k[1]) {
+			regionsOf[k[0]] = append(regionsOf[k[0]], k[1])
+		}
+	}
+	byRegions := make(map[string]int)
+	var ret []instanceGroup
+	for _, target := range targetIDs {
+		regions := regionsOf[target]
+		sort.Strings(regions)
+		key := strings.Join(regions, ",")
+		idx, ok := byRegions[key]
+		if !ok {
+			idx = len(ret)
+			byRegions[key] = idx
+			ret = append(ret, instanceGroup{regions: regions})
+		}
+		ret[idx].targetIDs = append(ret[idx].targetIDs, target)
+	}
+	return ret
+}
+
+// missingGroups groups the missing instances of a stack set into as few CreateStackInstances calls as it takes: each
+// call creates an instance in every region of every account, or organizational unit, it lists
+func (s *stackSetState) missingGroups() []*cloudformation.CreateStackInstancesInput {
+	var ret []*cloudformation.CreateStackInstancesInput
+	for _, g := range groupInstances(s.missing) {
+		in := &cloudformation.CreateStackInstancesInput{
+			StackSetName: aws.String(s.name),
+			Regions:      aws.StringSlice(g.regions),
+		}
+		if s.serviceManaged {
+			in.DeploymentTargets = &cloudformation.DeploymentTargets{
+				OrganizationalUnitIds: aws.StringSlice(g.targetIDs),
+			}
+		} else {
+			in.Accounts = aws.StringSlice(g.targetIDs)
+		}
+		ret = append(ret, in)
+	}
+	return ret
+}
+
+// removedGroups groups the removed instances of a stack set into as few DeleteStackInstances calls as it takes.  The
+// stacks of the instances are deleted too.
+func (s *stackSetState) removedGroups() []*cloudformation.DeleteStackInstancesInput {
+	keys := make([][2]string, 0, len(s.removed))
+	for _, inst := range s.removed {
+		keys = append(keys, s.key(inst))
+	}
+	var ret []*cloudformation.DeleteStackInstancesInput
+	for _, g := range groupInstances(keys) {
+		in := &cloudformation.DeleteStackInstancesInput{
+			StackSetName: aws.String(s.name),
+			Regions:      aws.StringSlice(g.regions),
+			RetainStacks: aws.Bool(false),
+		}
+		if s.serviceManaged {
+			in.DeploymentTargets = &cloudformation.DeploymentTargets{
+				OrganizationalUnitIds: aws.StringSlice(g.targetIDs),
+			}
+		} else {
+			in.Accounts = aws.StringSlice(g.targetIDs)
+		}
+		ret = append(ret, in)
+	}
+	return ret
+}
+
+// deployStackSet creates or updates a stack set and its instances once confirmed, streaming the result of each
+// instance as its operations run.  Instances in accounts or regions the params file no longer lists are deleted last.
+func (s *executeCommand) deployStackSet(ctx context.Context, cmd *cobra.Command, data *inspectCommandModel, opts deployOptions) error {
+	out := cmd.OutOrStdout()
+	if err := display(out, s.Output, data); err != nil {
+		return err
+	}
+	if len(data.Changes) == 0 {
+		return display(out, s.Output, printableString("no changes\n"))
+	}
+	if ok, err := s.confirmExecute(ctx, out, data, opts); !ok {
+		return err
+	}
+	if err := heldLock(ctx).Err(); err != nil {
+		return errors.Wrapf(err, "not executing %s", data.StackName)
+	}
+	in := data.changesetInput
+	state := data.stackSet
+	opts.report(dashboard.PhaseExecuting, state.name)
+	ses, err := s.AWSCache.SessionAs(in.Profile, in.Region, in.AssumeRoleARN)
+	if err != nil {
+		return errors.Wrapf(err, "unable to fetch AWS session for profile %s", in.Profile)
+	}
+	if err := ses.FixTemplateBody(ctx, &in.CreateChangeSetInput, in.Bucket, s.Logger); err != nil {
+		return err
+	}
+	if state.set == nil {
+		if err := ses.CreateStackSet(ctx, stackSetCreateInput(in)); err != nil {
+			return err
+		}
+	} else if state.needsUpdate() {
+		opID, err := ses.UpdateStackSet(ctx, stackSetUpdateInput(in, state))
+		if err != nil {
+			return err
+		}
+		if err := s.followStackSetOperation(ctx, out, ses, state.name, opID); err != nil {
+			return err
+		}
+	}
+	for _, group := range state.missingGroups() {
+		group.OperationPreferences = in.StackSet.OperationPreferences
+		opID, err := ses.CreateStackInstances(ctx, group)
+		if err != nil {
+			return err
+		}
+		if err := s.followStackSetOperation(ctx, out, ses, state.name, opID); err != nil {
+			return err
+		}
+	}
+	for _, group := range state.removedGroups() {
+		group.OperationPreferences = in.StackSet.OperationPreferences
+		opID, err := ses.DeleteStackInstances(ctx, group)
+		if err != nil {
+			return err
+		}
+		if err := s.followStackSetOperation(ctx, out, ses, state.name, opID); err != nil {
+			return err
+		}
+	}
+	return display(out, s.Output, printableString(fmt.Sprintf("Stack set %s is up to date\n", state.name)))
+}
+
+// followStackSetOperation displays the result of each instance of a stack set operation as it changes.  If ctx ends
+// or the stack lock is lost first, the operation is stopped.
+func (s *executeCommand) followStackSetOperation(ctx context.Context, out io.Writer, ses *awscache.AWSClients, name string, operationID string) error {
+	held := heldLock(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-held.Lost():
+			s.Logger.Log(0, "stopping stack set operation %s: %s", operationID, held.Err())
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	var displayErr error
+	err := ses.WaitForStackSetOperation(ctx, name, operationID, s.Logger, func(r *cloudformation.StackSetOperationResultSummary) {
+		now := time.Now()
+		e := &stackEvent{
+			Timestamp:            &now,
+			StackName:            name,
+			LogicalResourceID:    emptyOnNil(r.Account) + "/" + emptyOnNil(r.Region),
+			ResourceStatus:       emptyOnNil(r.Status),
+			ResourceStatusReason: emptyOnNil(r.StatusReason),
+			ResourceType:         "AWS::CloudFormation::StackInstance",
+		}
+		if err := display(out, s.Output, e); err != nil && displayErr == nil {
+			displayErr = err
+		}
+	})
+	if err != nil && ctx.Err() != nil {
+		// Stopping must outlive the context that was cancelled
+		stopCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if stopErr := ses.StopStackSetOperation(stopCtx, name, operationID); stopErr != nil {
+			s.Logger.Log(0, "%s", stopErr.Error())
+		}
+		return errors.Wrapf(err, "stopped operation %s of stack set %s", operationID, name)
+	}
+	if err != nil {
+		return err
+	}
+	return displayErr
+}
+
+// stackSetChanges are the pending changes of a stack set, or nil for a stack
+func (i *inspectCommandModel) stackSetChanges() []param {
+	if i.stackSet == nil {
+		return nil
+	}
+	return i.Changes
+}
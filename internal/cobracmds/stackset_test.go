@@ -0,0 +1,239 @@
+package cobracmds
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/cep21/cfmanage/internal/templatereader"
+)
+
+func testStackSetInput(cfg templatereader.StackSetConfig) *templatereader.ChangesetInput {
+	in := &templatereader.ChangesetInput{
+		StackSet: &cfg,
+	}
+	in.StackName = aws.String("baseline")
+	in.TemplateBody = aws.String("{}")
+	return in
+}
+
+func testInstance(target string, region string, status string) *cloudformation.StackInstanceSummary {
+	return &cloudformation.StackInstanceSummary{
+		Account: aws.String(target),
+		Region:  aws.String(region),
+		Status:  aws.String(status),
+	}
+}
+
+func testOUInstance(ou string, account string, region string, status string) *cloudformation.StackInstanceSummary {
+	ret := testInstance(account, region, status)
+	ret.OrganizationalUnitId = aws.String(ou)
+	return ret
+}
+
+func TestServiceManagedStackSetState(t *testing.T) {
+	in := testStackSetInput(templatereader.StackSetConfig{
+		PermissionModel:       cloudformation.PermissionModelsServiceManaged,
+		OrganizationalUnitIDs: []string{"ou-a", "ou-b"},
+	})
+	set := &cloudformation.StackSet{
+		TemplateBody:    aws.String("{}"),
+		PermissionModel: aws.String(cloudformation.PermissionModelsServiceManaged),
+	}
+	state := newStackSetState(in, in.StackSet.OrganizationalUnitIDs, []string{"us-west-2", "us-east-1"}, set, []*cloudformation.StackInstanceSummary{
+		// Two accounts of ou-a in us-west-2 are one target
+		testOUInstance("ou-a", "111", "us-west-2", cloudformation.StackInstanceStatusCurrent),
+		testOUInstance("ou-a", "222", "us-west-2", cloudformation.StackInstanceStatusOutdated),
+		testOUInstance("ou-b", "333", "us-east-1", cloudformation.StackInstanceStatusCurrent),
+	})
+	if want := [][2]string{{"ou-a", "us-east-1"}, {"ou-b", "us-west-2"}}; !reflect.DeepEqual(state.missing, want) {
+		t.Fatalf("missing %v, want %v", state.missing, want)
+	}
+	if len(state.differs) != 0 {
+		t.Fatalf("stack set differs: %v", state.differs)
+	}
+	if outdated := state.outdated(); len(outdated) != 1 || *outdated[0].Account != "222" {
+		t.Fatalf("outdated %v, want the instance in 222", outdated)
+	}
+
+	groups := state.missingGroups()
+	if len(groups) != 2 {
+		t.Fatalf("%d groups, want one per distinct set of regions", len(groups))
+	}
+	for _, g := range groups {
+		if len(g.Accounts) != 0 || g.DeploymentTargets == nil || len(g.DeploymentTargets.OrganizationalUnitIds) != 1 {
+			t.Fatalf("group %v does not target one organizational unit", g)
+		}
+	}
+
+	update := stackSetUpdateInput(in, state)
+	if !reflect.DeepEqual(aws.StringValueSlice(update.DeploymentTargets.OrganizationalUnitIds), []string{"ou-a", "ou-b"}) {
+		t.Fatalf("update targets %v", update.DeploymentTargets)
+	}
+	if aws.StringValue(update.PermissionModel) != cloudformation.PermissionModelsServiceManaged {
+		t.Fatalf("update permission model %v", update.PermissionModel)
+	}
+}
+
+func TestStackSetDifferencesPermissions(t *testing.T) {
+	in := testStackSetInput(templatereader.StackSetConfig{
+		PermissionModel:       cloudformation.PermissionModelsServiceManaged,
+		OrganizationalUnitIDs: []string{"ou-a"},
+		AutoDeployment: &cloudformation.AutoDeployment{
+			Enabled: aws.Bool(true),
+		},
+	})
+	set := &cloudformation.StackSet{
+		TemplateBody: aws.String("{}"),
+	}
+	got := stackSetDifferences(in, set)
+	want := []string{"permission model differs", "auto deployment differs"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("differences %v, want %v", got, want)
+	}
+	set.PermissionModel = aws.String(cloudformation.PermissionModelsServiceManaged)
+	set.AutoDeployment = &cloudformation.AutoDeployment{
+		Enabled:                      aws.Bool(true),
+		RetainStacksOnAccountRemoval: aws.Bool(false),
+	}
+	if got := stackSetDifferences(in, set); len(got) != 0 {
+		t.Fatalf("differences %v, want none", got)
+	}
+}
+
+func TestStackSetSummaryCountsDrift(t *testing.T) {
+	in := testStackSetInput(templatereader.StackSetConfig{
+		Accounts: []string{"111", "222"},
+	})
+	drifted := testInstance("111", "us-west-2", cloudformation.StackInstanceStatusCurrent)
+	drifted.DriftStatus = aws.String(cloudformation.StackDriftStatusDrifted)
+	inSync := testInstance("222", "us-west-2", cloudformation.StackInstanceStatusCurrent)
+	inSync.DriftStatus = aws.String(cloudformation.StackDriftStatusInSync)
+	state := newStackSetState(in, in.StackSet.Accounts, []string{"us-west-2"}, &cloudformation.StackSet{TemplateBody: aws.String("{}")}, []*cloudformation.StackInstanceSummary{drifted, inSync})
+	if got, want := state.summary(), "stack set instances: 2 CURRENT, 1 DRIFTED"; got != want {
+		t.Fatalf("summary %q, want %q", got, want)
+	}
+	if got := state.schemaInstances()[0].DriftStatus; got != cloudformation.StackDriftStatusDrifted {
+		t.Fatalf("instance drift status %s, want DRIFTED", got)
+	}
+}
+
+func TestStackSetState(t *testing.T) {
+	in := testStackSetInput(templatereader.StackSetConfig{
+		Accounts: []string{"111", "222"},
+	})
+	set := &cloudformation.StackSet{TemplateBody: aws.String("{}")}
+	state := newStackSetState(in, in.StackSet.Accounts, []string{"us-west-2", "us-east-1"}, set, []*cloudformation.StackInstanceSummary{
+		testInstance("111", "us-west-2", cloudformation.StackInstanceStatusCurrent),
+		testInstance("111", "us-east-1", cloudformation.StackInstanceStatusOutdated),
+		testInstance("222", "us-west-2", cloudformation.StackInstanceStatusCurrent),
+		// Removed from the params file: a region and a whole account
+		testInstance("111", "eu-west-1", cloudformation.StackInstanceStatusCurrent),
+		testInstance("333", "us-west-2", cloudformation.StackInstanceStatusOutdated),
+		testInstance("333", "eu-west-1", cloudformation.StackInstanceStatusCurrent),
+	})
+	if !state.needsUpdate() {
+		t.Fatal("an outdated instance does not need an update")
+	}
+	wantChanges := []param{
+		{Key: "111/us-east-1", Value: "Update instance, which is OUTDATED"},
+		{Key: "222/us-east-1", Value: "Create instance"},
+		{Key: "111/eu-west-1", Value: "Delete instance: no longer in the params file"},
+		{Key: "333/us-west-2", Value: "Delete instance: no longer in the params file"},
+		{Key: "333/eu-west-1", Value: "Delete instance: no longer in the params file"},
+	}
+	if got := state.changes(); !reflect.DeepEqual(got, wantChanges) {
+		t.Fatalf("changes\n%v\nwant\n%v", got, wantChanges)
+	}
+	if got := len(state.destructive()); got != 3 {
+		t.Fatalf("%d destructive changes, want one per removed instance", got)
+	}
+	if got, want := state.summary(), "stack set instances: 4 CURRENT, 2 OUTDATED, 1 missing, 3 not in params file"; got != want {
+		t.Fatalf("summary %q, want %q", got, want)
+	}
+
+	creates := state.missingGroups()
+	if len(creates) != 1 || !reflect.DeepEqual(aws.StringValueSlice(creates[0].Accounts), []string{"222"}) || !reflect.DeepEqual(aws.StringValueSlice(creates[0].Regions), []string{"us-east-1"}) {
+		t.Fatalf("creates %v", creates)
+	}
+	deletes := state.removedGroups()
+	if len(deletes) != 2 {
+		t.Fatalf("%d deletes, want one for 111 and one for 333: %v", len(deletes), deletes)
+	}
+	if !reflect.DeepEqual(aws.StringValueSlice(deletes[0].Accounts), []string{"111"}) || !reflect.DeepEqual(aws.StringValueSlice(deletes[0].Regions), []string{"eu-west-1"}) {
+		t.Fatalf("first delete %v", deletes[0])
+	}
+	if !reflect.DeepEqual(aws.StringValueSlice(deletes[1].Accounts), []string{"333"}) || !reflect.DeepEqual(aws.StringValueSlice(deletes[1].Regions), []string{"eu-west-1", "us-west-2"}) {
+		t.Fatalf("second delete %v", deletes[1])
+	}
+	for _, d := range deletes {
+		if aws.BoolValue(d.RetainStacks) {
+			t.Fatalf("delete %v retains the stacks of its instances", d)
+		}
+	}
+
+	removed := 0
+	for _, inst := range state.schemaInstances() {
+		if inst.Removed {
+			removed++
+		}
+	}
+	if removed != 3 {
+		t.Fatalf("%d instances marked removed, want 3", removed)
+	}
+}
+
+func TestStackSetStateWithoutStackSet(t *testing.T) {
+	in := testStackSetInput(templatereader.StackSetConfig{})
+	state := newStackSetState(in, []string{"111"}, []string{"us-west-2"}, nil, nil)
+	want := []param{
+		{Key: "baseline", Value: "Create stack set"},
+		{Key: "111/us-west-2", Value: "Create instance"},
+	}
+	if got := state.changes(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("changes %v, want %v", got, want)
+	}
+	if state.needsUpdate() {
+		t.Fatal("a stack set that does not exist needs an update instead of a create")
+	}
+}
+
+func TestGroupInstances(t *testing.T) {
+	got := groupInstances([][2]string{
+		{"111", "us-west-2"},
+		{"222", "us-east-1"},
+		{"111", "us-east-1"},
+		{"222", "us-west-2"},
+		{"333", "us-west-2"},
+		{"333", "us-west-2"},
+	})
+	want := []instanceGroup{
+		{targetIDs: []string{"111", "222"}, regions: []string{"us-east-1", "us-west-2"}},
+		{targetIDs: []string{"333"}, regions: []string{"us-west-2"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("groups %v, want %v", got, want)
+	}
+}
+
+func TestStackSetDifferences(t *testing.T) {
+	in := testStackSetInput(templatereader.StackSetConfig{
+		AdministrationRoleARN: "arn:aws:iam::111:role/admin",
+	})
+	in.TemplateBody = aws.String(`{"Resources": {}}`)
+	in.Parameters = []*cloudformation.Parameter{
+		{ParameterKey: aws.String("Env"), ParameterValue: aws.String("prod")},
+	}
+	set := &cloudformation.StackSet{
+		TemplateBody: aws.String(`{"Resources": {"Topic": {"Type": "AWS::SNS::Topic"}}}`),
+		Parameters: []*cloudformation.Parameter{
+			{ParameterKey: aws.String("Env"), ParameterValue: aws.String("dev")},
+		},
+		AdministrationRoleARN: aws.String("arn:aws:iam::111:role/other"),
+	}
+	want := []string{"template differs", "params differ: Env", "administration role differs"}
+	if got := stackSetDifferences(in, set); !reflect.DeepEqual(got, want) {
+		t.Fatalf("differences %v, want %v", got, want)
+	}
+}
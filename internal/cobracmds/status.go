@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 
@@ -12,7 +14,11 @@ import (
 	"github.com/cep21/cfmanage/internal/awscache"
 	"github.com/cep21/cfmanage/internal/cleanup"
 	"github.com/cep21/cfmanage/internal/ctxfinder"
+	"github.com/cep21/cfmanage/internal/dashboard"
+	"github.com/cep21/cfmanage/internal/formatter"
 	"github.com/cep21/cfmanage/internal/logger"
+	"github.com/cep21/cfmanage/internal/policy"
+	"github.com/cep21/cfmanage/internal/statuscache"
 	"github.com/cep21/cfmanage/internal/templatereader"
 	"github.com/olekukonko/tablewriter"
 	"github.com/pkg/errors"
@@ -25,9 +31,16 @@ type statusCommand struct {
 	T             *templatereader.TemplateFinder
 	Ctx           *templatereader.CreateChangeSetTemplate
 	Logger        *logger.Logger
-	JSON          *bool
+	Output        *outputFormat
 	ContextFinder *ctxfinder.ContextFinder
 	Cleanup       *cleanup.Cleanup
+	Locks         *stackLocks
+	Policies      *stackPolicies
+	live          bool
+	refresh       bool
+	noChangesets  bool
+	exitCodes     exitCodes
+	cache         statuscache.Cache
 }
 
 func (s *statusCommand) Cobra() *cobra.Command {
@@ -38,7 +51,25 @@ func (s *statusCommand) Cobra() *cobra.Command {
 		ValidArgs: []string{},
 		Args:      cobra.NoArgs,
 	}
-	cmd.RunE = commonRunCommand(s.ContextFinder, s.model, s.JSON)
+	cmd.Flags().BoolVar(&s.noChangesets, "no-changesets", false, "Compare deployed templates, parameters and tags with the params files instead of creating changesets.  Makes no writes to AWS")
+	cmd.Flags().BoolVar(&s.refresh, "refresh", false, "Recreate every changeset instead of reusing ones computed for unchanged inputs and stacks")
+	cmd.Flags().StringVar(&s.cache.Dir, "cachedir", statuscache.DefaultDir(), "Directory caching computed changesets.  Empty disables the cache")
+	cmd.Flags().DurationVar(&s.cache.MaxAge, "cache-max-age", 24*time.Hour, "How long a cached changeset is reused")
+	cmd.Flags().BoolVar(&s.live, "live", true, "Show each stack's progress as it happens when output is a terminal")
+	s.exitCodes.register(cmd)
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		data, err := s.model(s.ContextFinder.Ctx(), cmd, args)
+		if err != nil {
+			return errors.Wrap(err, "unable to load data for templates")
+		}
+		// Streamed formats already wrote each stack as it was ready
+		if _, streamed := s.Output.get().(formatter.ItemWriter); !streamed {
+			if err := display(cmd.OutOrStdout(), s.Output, data); err != nil {
+				return err
+			}
+		}
+		return s.exitCodes.check(cmd, data.Statuses)
+	}
 	return cmd
 }
 
@@ -53,6 +84,7 @@ func printStatus(out io.Writer, statuses []stackStatus) {
 
 type statusCommandModel struct {
 	Statuses []stackStatus
+	Summary  statusSummary
 }
 
 func (s *statusCommandModel) HumanReadable(out io.Writer) error {
@@ -62,7 +94,34 @@ func (s *statusCommandModel) HumanReadable(out io.Writer) error {
 		st.appendToTable(table)
 	}
 	table.Render()
-	return nil
+	if instances := stackSetInstancesTable(s.Statuses); len(instances.Rows) != 0 {
+		if _, err := fmt.Fprintf(out, "%s\n", instances.Title); err != nil {
+			return err
+		}
+		renderTable(out, instances)
+	}
+	return s.Summary.HumanReadable(out)
+}
+
+func (s *statusCommandModel) Tables() []formatter.Table {
+	ret := formatter.Table{
+		Header: statusColumns(),
+	}
+	for _, st := range s.Statuses {
+		ret.Rows = append(ret.Rows, st.row())
+	}
+	if instances := stackSetInstancesTable(s.Statuses); len(instances.Rows) != 0 {
+		return []formatter.Table{ret, instances}
+	}
+	return []formatter.Table{ret}
+}
+
+func (s *statusCommandModel) Items() []interface{} {
+	ret := make([]interface{}, 0, len(s.Statuses))
+	for _, st := range s.Statuses {
+		ret = append(ret, st)
+	}
+	return ret
 }
 
 type stackStatus struct {
@@ -77,38 +136,124 @@ type stackStatus struct {
 	LastUpdated     string
 	ChangesetStatus string
 	ChangesetError  error
+	LockedBy        string
+	Computed        string
 
+	// err is why the params file or stack could not be read
+	err            error
+	computed       time.Time
 	cfStack        *cloudformation.Stack
 	changeset      *cloudformation.DescribeChangeSetOutput
 	changesetInput *templatereader.ChangesetInput
+	inputHash      string
+	// stackSet is set instead of cfStack and changeset for params files that describe a stack set
+	stackSet *stackSetState
+	// target names the target of a params file with targets
+	target string
+	// policy holds the guardrail policy violations of the stack's changeset
+	policy policy.Violations
+}
+
+func statusColumns() []string {
+	return []string{"Template", "File name", "Stack Name", "Status", "Account ID", "Region", "Pending Changes", "Description", "Changeset status", "Last Updated", "Locked by", "Computed"}
+}
+
+func (st *stackStatus) row() []string {
+	return []string{
+		st.Template, st.StackFileName, st.StackName, st.StackStatus, st.AccountID, st.Region, st.ChangeCount, st.Description, st.ChangesetStatus, st.LastUpdated, st.LockedBy, st.Computed,
+	}
 }
 
 func setStatusColumns(t *tablewriter.Table) {
-	t.SetHeader([]string{"Template", "File name", "Stack Name", "Status", "Account ID", "Region", "Pending Changes", "Description", "Changeset status", "Last Updated"})
+	t.SetHeader(statusColumns())
 }
 
 func (st *stackStatus) appendToTable(t *tablewriter.Table) {
-	t.Append([]string{
-		st.Template, st.StackFileName, st.StackName, st.StackStatus, st.AccountID, st.Region, st.ChangeCount, st.Description, st.ChangesetStatus, st.LastUpdated,
-	})
+	t.Append(st.row())
+}
+
+// statusOptions let the status command follow and short-circuit populating a stack.  A nil *statusOptions does
+// neither.
+type statusOptions struct {
+	// progress is told what populating the stack is doing, for live output
+	progress func(phase string, detail string)
+	// cache, if set, reuses the changesets of inputs and stacks that have not changed
+	cache *statuscache.Cache
+	// refresh recreates changesets even if they are cached
+	refresh bool
+	// noChangesets compares the deployed stack with the input instead of creating a changeset
+	noChangesets bool
+	// beforeChangeset runs once the stack is described, before its changeset is created.  An error stops populating
+	// the stack.
+	beforeChangeset func(ctx context.Context, ses *awscache.AWSClients, in *templatereader.ChangesetInput, stack *cloudformation.Stack) error
+}
+
+func (o *statusOptions) report(phase string, detail string) {
+	if o != nil && o.progress != nil {
+		o.progress(phase, detail)
+	}
+}
+
+func (o *statusOptions) cached(log *logger.Logger, key string) *statuscache.Entry {
+	if o == nil || o.cache == nil || o.refresh {
+		return nil
+	}
+	ret, err := o.cache.Get(key, time.Now())
+	if err != nil {
+		log.Log(1, "ignoring status cache: %s", err.Error())
+		return nil
+	}
+	return ret
+}
+
+func (o *statusOptions) store(log *logger.Logger, key string, e statuscache.Entry) {
+	if o == nil || o.cache == nil {
+		return
+	}
+	if err := o.cache.Put(key, e); err != nil {
+		log.Log(1, "unable to cache status: %s", err.Error())
+	}
 }
 
 // This function should try very hard to not return error: it's used by status which is executed on all stacks.
-func populateStatusCommand(ctx context.Context, createTemplate *templatereader.CreateChangeSetTemplate, log *logger.Logger, awsCache *awscache.AWSCache, tfinder *templatereader.TemplateFinder, t string, p string) (stackStatus, error) {
+func populateStatusCommand(ctx context.Context, createTemplate *templatereader.CreateChangeSetTemplate, log *logger.Logger, awsCache *awscache.AWSCache, tfinder *templatereader.TemplateFinder, t string, p string, opts *statusOptions) (stackStatus, error) {
 	log.Log(2, "Listing params %s", p)
 	fname := tfinder.ParameterFilename(t, p)
 	in, err := templatereader.LoadCreateChangeSet(fname, createTemplate, log)
 	if err != nil {
-		return stackStatus{
-			Template:      t,
-			StackFileName: fname,
-			StackStatus:   err.Error(),
-		}, nil
+		return loadErrorStatus(t, fname, err), nil
+	}
+	return populateStatusFromInput(ctx, log, awsCache, t, fname, in, opts)
+}
+
+// loadErrorStatus is the status of a params file that could not be loaded
+func loadErrorStatus(t string, fname string, err error) stackStatus {
+	return stackStatus{
+		Template:      t,
+		StackFileName: fname,
+		StackStatus:   err.Error(),
+		err:           err,
 	}
-	ses, err := awsCache.Session(in.Profile, in.Region)
+}
+
+// populateStatusFromInput is populateStatusCommand for an already loaded params file
+func populateStatusFromInput(ctx context.Context, log *logger.Logger, awsCache *awscache.AWSCache, t string, fname string, in *templatereader.ChangesetInput, opts *statusOptions) (stackStatus, error) {
+	// Hash before creating the changeset: creating it changes the input
+	hash := in.Hash()
+	ret, err := createStatusChangeset(ctx, log, awsCache, t, fname, in, hash, opts)
+	ret.inputHash = hash
+	return ret, err
+}
+
+func createStatusChangeset(ctx context.Context, log *logger.Logger, awsCache *awscache.AWSCache, t string, fname string, in *templatereader.ChangesetInput, hash string, opts *statusOptions) (stackStatus, error) {
+	ses, err := awsCache.SessionAs(in.Profile, in.Region, in.AssumeRoleARN)
 	if err != nil {
 		return stackStatus{}, errors.Wrapf(err, "unable to fetch AWS session for profile %s", in.Profile)
 	}
+	opts.report(dashboard.PhaseDescribing, *in.StackName)
+	if in.StackSet != nil {
+		return stackSetStatus(ctx, ses, t, fname, in), nil
+	}
 	statStatus, err := ses.DescribeStack(ctx, *in.StackName)
 	if err != nil {
 		return stackStatus{
@@ -120,8 +265,23 @@ func populateStatusCommand(ctx context.Context, createTemplate *templatereader.C
 			Region:         ses.Region(),
 			cfStack:        statStatus,
 			changesetInput: in,
+			err:            err,
 		}, nil
 	}
+	if opts != nil && opts.noChangesets {
+		return compareStatus(ctx, ses, t, fname, in, statStatus), nil
+	}
+	if opts != nil && opts.beforeChangeset != nil {
+		if err := opts.beforeChangeset(ctx, ses, in, statStatus); err != nil {
+			return stackStatus{}, err
+		}
+	}
+	cacheKey := statuscache.Key(hash, statStatus)
+	if entry := opts.cached(log, cacheKey); entry != nil {
+		log.Log(2, "reusing changeset of %s computed at %s", *in.StackName, entry.Computed)
+		return readyStatus(ses, t, fname, in, statStatus, entry), nil
+	}
+	opts.report(dashboard.PhaseUploading, in.Bucket)
 	if err := ses.FixTemplateBody(ctx, &in.CreateChangeSetInput, in.Bucket, log); err != nil {
 		if statStatus == nil {
 			statStatus = &cloudformation.Stack{
@@ -143,6 +303,7 @@ func populateStatusCommand(ctx context.Context, createTemplate *templatereader.C
 			changesetInput:  in,
 		}, nil
 	}
+	opts.report(dashboard.PhaseChangeset, emptyOnNil(in.ChangeSetName))
 	out, err := ses.CreateChangesetWaitForStatus(ctx, &in.CreateChangeSetInput, statStatus, log)
 	if statStatus == nil {
 		statStatus = &cloudformation.Stack{
@@ -166,6 +327,22 @@ func populateStatusCommand(ctx context.Context, createTemplate *templatereader.C
 		}, nil
 	}
 
+	entry := statuscache.Entry{
+		Computed:  time.Now(),
+		Changeset: out,
+	}
+	opts.store(log, cacheKey, entry)
+	return readyStatus(ses, t, fname, in, statStatus, &entry), nil
+}
+
+// readyStatus is the status of a stack whose changeset was created, now or by an earlier run
+func readyStatus(ses *awscache.AWSClients, t string, fname string, in *templatereader.ChangesetInput, statStatus *cloudformation.Stack, entry *statuscache.Entry) stackStatus {
+	if statStatus == nil {
+		statStatus = &cloudformation.Stack{
+			StackStatus: aws.String("--DOES NOT EXIST--"),
+		}
+	}
+	out := entry.Changeset
 	return stackStatus{
 		Description:     emptyOnNil(out.Description),
 		LastUpdated:     emptyOnNilTime(statStatus.LastUpdatedTime),
@@ -177,39 +354,90 @@ func populateStatusCommand(ctx context.Context, createTemplate *templatereader.C
 		Region:          ses.Region(),
 		ChangesetStatus: "Ready to apply",
 		ChangeCount:     strconv.Itoa(len(out.Changes)),
+		Computed:        entry.Computed.Format(time.RFC3339),
+		computed:        entry.Computed,
 		cfStack:         statStatus,
 		changeset:       out,
 		changesetInput:  in,
-	}, nil
+	}
 }
 
-func (s *statusCommand) model(ctx context.Context, cmd *cobra.Command, args []string) (HumanPrintable, error) {
+func (s *statusCommand) model(ctx context.Context, cmd *cobra.Command, args []string) (*statusCommandModel, error) {
 	s.Logger.Log(2, "Running status command")
 	templates, err := s.T.ListTemplates()
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to list all templates")
 	}
-	statuses := make([][]stackStatus, len(templates))
+	statuses := make([][][]stackStatus, len(templates))
+	allParams := make([][]string, len(templates))
 	ret := statusCommandModel{}
-	eg, egCtx := errgroup.WithContext(ctx)
 	for tidx, t := range templates {
 		s.Logger.Log(2, "Listing template %s", t)
 		params, err := s.T.ListParameters(t)
 		if err != nil {
 			return nil, errors.Wrapf(err, "uanble to list parameters for template %s", t)
 		}
-		statuses[tidx] = make([]stackStatus, len(params))
-		for idx, p := range params {
+		allParams[tidx] = params
+		statuses[tidx] = make([][]stackStatus, len(params))
+	}
+	var dash *dashboard.Dashboard
+	if s.live && s.Output.isTable() && dashboard.IsTerminal(cmd.OutOrStdout()) {
+		dash = &dashboard.Dashboard{
+			Out: cmd.OutOrStdout(),
+		}
+		for tidx, t := range templates {
+			for _, p := range allParams[tidx] {
+				dash.Add(t + "/" + p)
+			}
+		}
+		dash.Start()
+		defer dash.Stop()
+	}
+	stream, _ := s.Output.get().(formatter.ItemWriter)
+	var streamMu sync.Mutex
+	eg, egCtx := errgroup.WithContext(ctx)
+	for tidx, t := range templates {
+		for idx, p := range allParams[tidx] {
 			p := p
 			t := t
 			idx := idx
 			tidx := tidx
 			eg.Go(func() error {
-				stat, err := populateStatusCommand(egCtx, s.Ctx, s.Logger, s.AWSCache, s.T, t, p)
+				name := t + "/" + p
+				opts := &statusOptions{
+					progress: func(phase string, detail string) {
+						dash.Update(name, phase, detail)
+					},
+					refresh:      s.refresh,
+					noChangesets: s.noChangesets,
+				}
+				if s.cache.Dir != "" {
+					opts.cache = &s.cache
+				}
+				stats, err := populateStatuses(egCtx, s.Ctx, s.Logger, s.AWSCache, s.T, t, p, opts)
 				if err != nil {
+					dash.Update(name, dashboard.PhaseFailed, err.Error())
 					return errors.Wrapf(err, "unable to populate %s", p)
 				}
-				statuses[tidx][idx] = stat
+				for i := range stats {
+					stats[i].LockedBy = s.Locks.describe(egCtx, stats[i].changesetInput)
+					if err := s.Policies.evaluateStatus(egCtx, &stats[i], false); err != nil {
+						dash.Update(name, dashboard.PhaseFailed, err.Error())
+						return err
+					}
+				}
+				phase, detail := s.dashboardResult(stats)
+				dash.Update(name, phase, detail)
+				statuses[tidx][idx] = stats
+				if stream != nil {
+					streamMu.Lock()
+					defer streamMu.Unlock()
+					for _, stat := range stats {
+						if err := stream.WriteItem(cmd.OutOrStdout(), stat); err != nil {
+							return errors.Wrap(err, "unable to write status")
+						}
+					}
+				}
 				return nil
 			})
 		}
@@ -218,7 +446,45 @@ func (s *statusCommand) model(ctx context.Context, cmd *cobra.Command, args []st
 		return nil, err
 	}
 	for _, st := range statuses {
-		ret.Statuses = append(ret.Statuses, st...)
+		for _, targets := range st {
+			ret.Statuses = append(ret.Statuses, targets...)
+		}
 	}
+	ret.Summary = summarize(ret.Statuses)
 	return &ret, nil
 }
+
+// dashboardResult is how the live status shows the statuses of a params file once they are ready.  A params file with
+// targets has one status for each.
+func (s *statusCommand) dashboardResult(stats []stackStatus) (string, string) {
+	failed := 0
+	changes := 0
+	detail := ""
+	for _, stat := range stats {
+		if stat.ChangesetError != nil || (stat.changeset == nil && !s.noChangesets) {
+			failed++
+			detail = firstNonEmpty(stat.ChangesetStatus, stat.StackStatus)
+			if stat.target != "" {
+				detail = stat.target + ": " + detail
+			}
+			continue
+		}
+		if n, err := strconv.Atoi(stat.ChangeCount); err == nil {
+			changes += n
+		}
+	}
+	if len(stats) == 1 {
+		stat := stats[0]
+		switch {
+		case failed != 0:
+			return dashboard.PhaseFailed, detail
+		case stat.ChangeCount != "":
+			return dashboard.PhaseReady, stat.ChangeCount + " changes"
+		}
+		return dashboard.PhaseReady, stat.ChangesetStatus
+	}
+	if failed != 0 {
+		return dashboard.PhaseFailed, fmt.Sprintf("%d of %d targets failed, %s", failed, len(stats), detail)
+	}
+	return dashboard.PhaseReady, fmt.Sprintf("%d changes across %d targets", changes, len(stats))
+}
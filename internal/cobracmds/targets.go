@@ -0,0 +1,369 @@
+package cobracmds
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/cep21/cfmanage/internal/awscache"
+	"github.com/cep21/cfmanage/internal/dashboard"
+	"github.com/cep21/cfmanage/internal/formatter"
+	"github.com/cep21/cfmanage/internal/logger"
+	"github.com/cep21/cfmanage/internal/schema"
+	"github.com/cep21/cfmanage/internal/templatereader"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	rolloutSerial   = "serial"
+	rolloutParallel = "parallel"
+	rolloutCanary   = "canary"
+)
+
+// paramsTarget is a params file rendered for one of its targets
+type paramsTarget struct {
+	name      string
+	accountID string
+	region    string
+	in        *templatereader.ChangesetInput
+	// err is why the params file could not be rendered for the target
+	err error
+}
+
+func targetName(in *templatereader.ChangesetInput) string {
+	return fmt.Sprintf("%s/%s", firstNonEmpty(in.AssumeRoleARN, in.Profile, "default"), in.Region)
+}
+
+// loadTargets renders the params file fname for each target of in, the params file rendered without one.  Each
+// rendering acts on the profile, role and region of its target, and nothing else.
+func loadTargets(awsCache *awscache.AWSCache, createTemplate *templatereader.CreateChangeSetTemplate, log *logger.Logger, fname string, in *templatereader.ChangesetInput) []paramsTarget {
+	ret := make([]paramsTarget, 0, len(in.Targets))
+	for _, target := range in.Targets {
+		place := templatereader.ChangesetInput{
+			Profile:       firstNonEmpty(target.Profile, in.Profile),
+			AssumeRoleARN: firstNonEmpty(target.AssumeRoleARN, in.AssumeRoleARN),
+			Region:        firstNonEmpty(target.Region, in.Region),
+		}
+		pt := paramsTarget{
+			name:   targetName(&place),
+			region: place.Region,
+		}
+		ses, err := awsCache.SessionAs(place.Profile, place.Region, place.AssumeRoleARN)
+		if err != nil {
+			pt.err = errors.Wrapf(err, "unable to fetch AWS session for target %s", pt.name)
+			ret = append(ret, pt)
+			continue
+		}
+		pt.region = ses.Region()
+		if pt.accountID, err = ses.AccountID(); err != nil {
+			pt.err = errors.Wrapf(err, "unable to find the account of target %s", pt.name)
+			ret = append(ret, pt)
+			continue
+		}
+		if pt.in, err = templatereader.LoadCreateChangeSet(fname, createTemplate.ForTarget(pt.region, pt.accountID), log); err != nil {
+			pt.err = errors.Wrapf(err, "unable to render params for target %s", pt.name)
+			ret = append(ret, pt)
+			continue
+		}
+		pt.in.Profile = place.Profile
+		pt.in.AssumeRoleARN = place.AssumeRoleARN
+		pt.in.Region = place.Region
+		pt.in.Targets = nil
+		ret = append(ret, pt)
+	}
+	return ret
+}
+
+// populateStatuses is populateStatusCommand for each target of a params file, or for the params file itself if it
+// has no targets
+func populateStatuses(ctx context.Context, createTemplate *templatereader.CreateChangeSetTemplate, log *logger.Logger, awsCache *awscache.AWSCache, tfinder *templatereader.TemplateFinder, t string, p string, opts *statusOptions) ([]stackStatus, error) {
+	fname := tfinder.ParameterFilename(t, p)
+	in, err := templatereader.LoadCreateChangeSet(fname, createTemplate, log)
+	if err != nil {
+		return []stackStatus{loadErrorStatus(t, fname, err)}, nil
+	}
+	if len(in.Targets) == 0 {
+		stat, err := populateStatusFromInput(ctx, log, awsCache, t, fname, in, opts)
+		return []stackStatus{stat}, err
+	}
+	targets := loadTargets(awsCache, createTemplate, log, fname, in)
+	ret := make([]stackStatus, len(targets))
+	eg, egCtx := errgroup.WithContext(ctx)
+	for idx, target := range targets {
+		idx := idx
+		target := target
+		if target.err != nil {
+			ret[idx] = stackStatus{
+				Template:      t,
+				StackFileName: fname,
+				StackName:     emptyOnNil(in.StackName),
+				StackStatus:   target.err.Error(),
+				AccountID:     target.accountID,
+				Region:        target.region,
+				err:           target.err,
+				target:        target.name,
+			}
+			continue
+		}
+		eg.Go(func() error {
+			stat, err := populateStatusFromInput(egCtx, log, awsCache, t, fname, target.in, opts)
+			stat.target = target.name
+			ret[idx] = stat
+			return errors.Wrapf(err, "unable to populate target %s", target.name)
+		})
+	}
+	return ret, eg.Wait()
+}
+
+// rolloutWaves splits n targets into waves deployed one after another.  The targets of a wave deploy in parallel.
+func rolloutWaves(strategy string, n int) ([][]int, error) {
+	all := make([]int, n)
+	for i := range all {
+		all[i] = i
+	}
+	switch strategy {
+	case "", rolloutSerial:
+		ret := make([][]int, 0, n)
+		for _, i := range all {
+			ret = append(ret, []int{i})
+		}
+		return ret, nil
+	case rolloutParallel:
+		return [][]int{all}, nil
+	case rolloutCanary:
+		if n <= 1 {
+			return [][]int{all}, nil
+		}
+		return [][]int{all[:1], all[1:]}, nil
+	}
+	return nil, errors.Errorf("unknown rollout strategy %s: pick serial, parallel or canary", strategy)
+}
+
+type targetResult struct {
+	Target    string
+	AccountID string
+	Region    string
+	StackName string
+	Result    string
+	err       error
+}
+
+type rolloutModel struct {
+	Strategy string
+	Targets  []targetResult
+}
+
+func (r *rolloutModel) failures() int {
+	ret := 0
+	for _, t := range r.Targets {
+		if t.err != nil {
+			ret++
+		}
+	}
+	return ret
+}
+
+func (r *rolloutModel) HumanReadable(out io.Writer) error {
+	t := r.Tables()[0]
+	if _, err := fmt.Fprintf(out, "%s\n", t.Title); err != nil {
+		return err
+	}
+	renderTable(out, t)
+	return nil
+}
+
+func (r *rolloutModel) Tables() []formatter.Table {
+	ret := formatter.Table{
+		Title:  fmt.Sprintf("%s rollout", firstNonEmpty(r.Strategy, rolloutSerial)),
+		Header: []string{"Target", "Account ID", "Region", "Stack Name", "Result", "Error"},
+	}
+	for _, t := range r.Targets {
+		errStr := ""
+		if t.err != nil {
+			errStr = t.err.Error()
+		}
+		ret.Rows = append(ret.Rows, []string{t.Target, t.AccountID, t.Region, t.StackName, t.Result, errStr})
+	}
+	return []formatter.Table{ret}
+}
+
+func (r rolloutModel) MarshalJSON() ([]byte, error) {
+	ret := schema.Rollout{
+		Header:   schema.NewHeader("rollout"),
+		Strategy: firstNonEmpty(r.Strategy, rolloutSerial),
+		Targets:  make([]schema.RolloutTarget, 0, len(r.Targets)),
+	}
+	for _, t := range r.Targets {
+		ret.Targets = append(ret.Targets, schema.RolloutTarget{
+			Target:    t.Target,
+			AccountID: t.AccountID,
+			Region:    t.Region,
+			StackName: t.StackName,
+			Result:    t.Result,
+			Error:     schema.NewError(t.err),
+		})
+	}
+	return json.Marshal(ret)
+}
+
+// targetOutput collects what deploying a target writes while a dashboard owns the terminal
+type targetOutput struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (t *targetOutput) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.buf.Write(p)
+}
+
+// rollout deploys a params file with targets to each of them in the order of its rollout.  Unless the rollout
+// continues on failure, targets not started once one fails are skipped.
+func (s *executeCommand) rollout(ctx context.Context, cmd *cobra.Command, template string, fname string, in *templatereader.ChangesetInput, opts deployOptions) error {
+	cfg := templatereader.RolloutConfig{}
+	if in.Rollout != nil {
+		cfg = *in.Rollout
+	}
+	if s.rolloutStrategy != "" {
+		cfg.Strategy = s.rolloutStrategy
+	}
+	waves, err := rolloutWaves(cfg.Strategy, len(in.Targets))
+	if err != nil {
+		return err
+	}
+	if !opts.AutoConfirm && cfg.MaxParallel != 1 {
+		for _, wave := range waves {
+			if len(wave) > 1 {
+				return errors.Errorf("a %s rollout deploys several targets at once, so it needs --auto", cfg.Strategy)
+			}
+		}
+	}
+	targets := loadTargets(s.AWSCache, s.Ctx, s.Logger, fname, in)
+	for _, target := range targets {
+		if target.err != nil {
+			return target.err
+		}
+	}
+	ret := &rolloutModel{
+		Strategy: cfg.Strategy,
+		Targets:  make([]targetResult, len(targets)),
+	}
+	for idx, target := range targets {
+		ret.Targets[idx] = targetResult{
+			Target:    target.name,
+			AccountID: target.accountID,
+			Region:    target.region,
+			StackName: emptyOnNil(target.in.StackName),
+			Result:    "skipped",
+		}
+	}
+	var dash *dashboard.Dashboard
+	var outputs []targetOutput
+	if s.live && opts.AutoConfirm && len(targets) > 1 && s.Output.isTable() && dashboard.IsTerminal(cmd.OutOrStdout()) {
+		dash = &dashboard.Dashboard{
+			Out: cmd.OutOrStdout(),
+		}
+		outputs = make([]targetOutput, len(targets))
+		for _, target := range targets {
+			dash.Add(target.name)
+		}
+		dash.Start()
+	}
+	runWaves(waves, cfg, func(idx int) error {
+		target := targets[idx]
+		s.Logger.Log(1, "deploying %s to target %s", fname, target.name)
+		targetCmd := cmd
+		targetOpts := opts
+		if dash != nil {
+			targetCmd = &cobra.Command{}
+			targetCmd.SetOut(&outputs[idx])
+			targetCmd.SetErr(&outputs[idx])
+			targetOpts.Progress = func(phase string, detail string) {
+				dash.Update(target.name, phase, detail)
+			}
+		}
+		err := s.deployTarget(ctx, targetCmd, template, fname, target.in, targetOpts)
+		if err != nil {
+			dash.Update(target.name, dashboard.PhaseFailed, err.Error())
+			ret.Targets[idx].Result = "failed"
+			ret.Targets[idx].err = err
+			return err
+		}
+		dash.Update(target.name, dashboard.PhaseDone, "succeeded")
+		ret.Targets[idx].Result = "succeeded"
+		return nil
+	}, func(idx int) {
+		dash.Update(targets[idx].name, dashboard.PhaseDone, "skipped")
+	})
+	if dash != nil {
+		dash.Stop()
+		// What each target would have printed, now that nothing redraws over it
+		for idx := range outputs {
+			if _, err := cmd.OutOrStdout().Write(outputs[idx].buf.Bytes()); err != nil {
+				return err
+			}
+		}
+	}
+	if err := display(cmd.OutOrStdout(), s.Output, ret); err != nil {
+		return err
+	}
+	if n := ret.failures(); n != 0 {
+		return errors.Errorf("%d of %d targets of %s failed", n, len(targets), fname)
+	}
+	return nil
+}
+
+// runWaves calls deploy for the targets of each wave in parallel, at most cfg.MaxParallel at once if set, and waits for
+// a wave before starting the next.  Unless the rollout continues on failure, targets not started once a deploy fails
+// are passed to skip instead.
+func runWaves(waves [][]int, cfg templatereader.RolloutConfig, deploy func(idx int) error, skip func(idx int)) {
+	var mu sync.Mutex
+	failed := false
+	for _, wave := range waves {
+		limit := len(wave)
+		if cfg.MaxParallel > 0 && cfg.MaxParallel < limit {
+			limit = cfg.MaxParallel
+		}
+		running := make(chan struct{}, limit)
+		var wg sync.WaitGroup
+		for _, idx := range wave {
+			running <- struct{}{}
+			mu.Lock()
+			stop := failed && !cfg.ContinueOnFailure
+			mu.Unlock()
+			if stop {
+				skip(idx)
+				<-running
+				continue
+			}
+			idx := idx
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-running }()
+				if err := deploy(idx); err != nil {
+					mu.Lock()
+					failed = true
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+// deployTarget deploys a params file rendered for one of its targets, holding the lock of the target's stack
+func (s *executeCommand) deployTarget(ctx context.Context, cmd *cobra.Command, template string, fname string, in *templatereader.ChangesetInput, opts deployOptions) error {
+	ctx, unlock, err := s.Locks.lock(ctx, s.T.BaseDir, in)
+	if err != nil {
+		return errors.Wrap(err, "unable to lock stack")
+	}
+	defer unlock()
+	return s.deployInput(ctx, cmd, template, fname, in, opts)
+}
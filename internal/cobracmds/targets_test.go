@@ -0,0 +1,131 @@
+package cobracmds
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cep21/cfmanage/internal/templatereader"
+	"github.com/pkg/errors"
+)
+
+func TestRolloutWaves(t *testing.T) {
+	tests := []struct {
+		strategy string
+		n        int
+		want     [][]int
+	}{
+		{strategy: "", n: 3, want: [][]int{{0}, {1}, {2}}},
+		{strategy: rolloutSerial, n: 2, want: [][]int{{0}, {1}}},
+		{strategy: rolloutParallel, n: 3, want: [][]int{{0, 1, 2}}},
+		{strategy: rolloutCanary, n: 4, want: [][]int{{0}, {1, 2, 3}}},
+		{strategy: rolloutCanary, n: 1, want: [][]int{{0}}},
+	}
+	for _, tc := range tests {
+		got, err := rolloutWaves(tc.strategy, tc.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q rollout of %d targets is %v, want %v", tc.strategy, tc.n, got, tc.want)
+		}
+	}
+	if _, err := rolloutWaves("sequential", 2); err == nil {
+		t.Fatal("an unknown strategy has waves")
+	}
+}
+
+// rolloutRecorder records what runWaves does with each target, failing the targets in fail
+type rolloutRecorder struct {
+	fail map[int]bool
+
+	mu          sync.Mutex
+	deployed    []int
+	skipped     []int
+	running     int
+	maxRunning  int
+	waitRunning time.Duration
+}
+
+func (r *rolloutRecorder) deploy(idx int) error {
+	r.mu.Lock()
+	r.deployed = append(r.deployed, idx)
+	r.running++
+	if r.running > r.maxRunning {
+		r.maxRunning = r.running
+	}
+	r.mu.Unlock()
+	// Gives targets of the same wave the chance to overlap
+	time.Sleep(r.waitRunning)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.running--
+	if r.fail[idx] {
+		return errors.Errorf("target %d failed", idx)
+	}
+	return nil
+}
+
+func (r *rolloutRecorder) skip(idx int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.skipped = append(r.skipped, idx)
+}
+
+func TestRunWaves(t *testing.T) {
+	tests := []struct {
+		name         string
+		strategy     string
+		cfg          templatereader.RolloutConfig
+		fail         map[int]bool
+		wantDeployed []int
+		wantSkipped  []int
+	}{
+		{name: "serial", wantDeployed: []int{0, 1, 2, 3}},
+		{name: "serial stops on failure", fail: map[int]bool{1: true}, wantDeployed: []int{0, 1}, wantSkipped: []int{2, 3}},
+		{
+			name:         "serial continues on failure",
+			cfg:          templatereader.RolloutConfig{ContinueOnFailure: true},
+			fail:         map[int]bool{1: true},
+			wantDeployed: []int{0, 1, 2, 3},
+		},
+		{name: "failed canary skips the rest", strategy: rolloutCanary, fail: map[int]bool{0: true}, wantDeployed: []int{0}, wantSkipped: []int{1, 2, 3}},
+		{name: "canary", strategy: rolloutCanary, fail: map[int]bool{2: true}, wantDeployed: []int{0, 1, 2, 3}},
+		{name: "a parallel wave finishes after a failure", strategy: rolloutParallel, fail: map[int]bool{0: true}, wantDeployed: []int{0, 1, 2, 3}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			waves, err := rolloutWaves(tc.strategy, 4)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := &rolloutRecorder{fail: tc.fail}
+			runWaves(waves, tc.cfg, r.deploy, r.skip)
+			sort.Ints(r.deployed)
+			if !reflect.DeepEqual(r.deployed, tc.wantDeployed) || !reflect.DeepEqual(r.skipped, tc.wantSkipped) {
+				t.Fatalf("deployed %v and skipped %v, want %v and %v", r.deployed, r.skipped, tc.wantDeployed, tc.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestRunWavesMaxParallel(t *testing.T) {
+	waves, err := rolloutWaves(rolloutParallel, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &rolloutRecorder{waitRunning: 20 * time.Millisecond}
+	runWaves(waves, templatereader.RolloutConfig{MaxParallel: 2}, r.deploy, r.skip)
+	if len(r.deployed) != 6 || r.maxRunning != 2 {
+		t.Fatalf("deployed %v with %d at once, want 6 with 2 at once", r.deployed, r.maxRunning)
+	}
+
+	// With a limit, a failure stops targets of the same wave that have not started
+	r = &rolloutRecorder{fail: map[int]bool{0: true, 1: true}, waitRunning: 20 * time.Millisecond}
+	runWaves(waves, templatereader.RolloutConfig{MaxParallel: 2}, r.deploy, r.skip)
+	if !reflect.DeepEqual(r.skipped, []int{2, 3, 4, 5}) {
+		t.Fatalf("skipped %v once the first two targets failed", r.skipped)
+	}
+}
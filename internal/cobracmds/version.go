@@ -7,6 +7,7 @@ import (
 	"io"
 
 	"github.com/cep21/cfmanage/internal/ctxfinder"
+	"github.com/cep21/cfmanage/internal/formatter"
 	"github.com/cep21/cfmanage/internal/logger"
 	"github.com/google/go-github/v25/github"
 	"github.com/spf13/cobra"
@@ -14,7 +15,7 @@ import (
 
 type versionCommand struct {
 	Logger        *logger.Logger
-	JSON          *bool
+	Output        *outputFormat
 	ContextFinder *ctxfinder.ContextFinder
 	GithubClient  *github.Client
 }
@@ -27,7 +28,7 @@ func (s *versionCommand) Cobra() *cobra.Command {
 		ValidArgs: []string{},
 		Args:      cobra.NoArgs,
 	}
-	cmd.RunE = commonRunCommand(s.ContextFinder, s.model, s.JSON)
+	cmd.RunE = commonRunCommand(s.ContextFinder, s.model, s.Output)
 	return cmd
 }
 
@@ -54,6 +55,15 @@ func (v *versionCommandModel) HumanReadable(out io.Writer) error {
 	return tmpl().Execute(out, v)
 }
 
+func (v *versionCommandModel) Tables() []formatter.Table {
+	return []formatter.Table{
+		{
+			Header: []string{"Current Version", "Latest Version"},
+			Rows:   [][]string{{v.CurrentVersion, v.LatestVersion}},
+		},
+	}
+}
+
 const githubOwner = "cep21"
 const githubRepo = "cfmanage"
 
@@ -0,0 +1,101 @@
+package cobracmds
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/cep21/cfmanage/internal/awscache"
+	"github.com/cep21/cfmanage/internal/ctxfinder"
+	"github.com/cep21/cfmanage/internal/logger"
+	"github.com/cep21/cfmanage/internal/templatereader"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+type watchCommand struct {
+	AWSCache      *awscache.AWSCache
+	T             *templatereader.TemplateFinder
+	Ctx           *templatereader.CreateChangeSetTemplate
+	Logger        *logger.Logger
+	Output        *outputFormat
+	ContextFinder *ctxfinder.ContextFinder
+	Execute       *executeCommand
+}
+
+func (s *watchCommand) Cobra() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:       "watch [template] [params]",
+		ValidArgs: s.T.ValidTemplatesAndParams(),
+		Short:     "Follow the latest operation on a stack until it finishes",
+		Long:      "Follow the latest operation on a stack, such as an update started with execute --detach.  Events since the operation started are replayed first.  Fails if the operation fails.",
+		Example:   "cfexecute watch infra canary",
+		RunE:      s.commandRun,
+	}
+	cmd.Args = validateTemplateParam(s.T)
+	return cmd
+}
+
+func (s *watchCommand) commandRun(cmd *cobra.Command, args []string) error {
+	ctx := s.ContextFinder.Ctx()
+	in, err := templatereader.LoadCreateChangeSet(s.T.ParameterFilename(args[0], args[1]), s.Ctx, s.Logger)
+	if err != nil {
+		return errors.Wrap(err, "unable to load params")
+	}
+	ses, err := s.AWSCache.SessionAs(in.Profile, in.Region, in.AssumeRoleARN)
+	if err != nil {
+		return errors.Wrapf(err, "unable to fetch AWS session for profile %s", in.Profile)
+	}
+	stack, err := ses.DescribeStack(ctx, *in.StackName)
+	if err != nil {
+		return err
+	}
+	if stack == nil {
+		return errors.Errorf("stack %s does not exist", *in.StackName)
+	}
+	afterEventID, err := ses.OperationStartEventID(ctx, *stack.StackId)
+	if err != nil {
+		return err
+	}
+	streamer := awscache.StackStreamer{
+		PollInterval: s.AWSCache.PollInterval,
+		Logger:       s.Logger,
+		AfterEventID: afterEventID,
+		AllEvents:    true,
+	}
+	out := cmd.OutOrStdout()
+	// Stop once the stack itself reaches a terminal state, so every event of the operation is printed first
+	finished := make(chan struct{})
+	var once sync.Once
+	eg, egCtx := errgroup.WithContext(ctx)
+	streamInto := make(chan *cloudformation.StackEvent)
+	eg.Go(func() error {
+		defer close(streamInto)
+		return streamer.Start(egCtx, ses, *stack.StackId, streamInto)
+	})
+	eg.Go(func() error {
+		return s.Execute.printStackEvents(egCtx, out, streamInto, func(event *cloudformation.StackEvent) {
+			if awscache.IsStackEvent(event) && awscache.IsTerminalStatus(emptyOnNil(event.ResourceStatus)) {
+				once.Do(func() {
+					close(finished)
+				})
+			}
+		})
+	})
+	eg.Go(func() error {
+		select {
+		case <-finished:
+			return errFinishedOk
+		case <-egCtx.Done():
+			return nil
+		}
+	})
+	if err := eg.Wait(); !isErrFinishedOk(err) {
+		return err
+	}
+	if err := ses.WaitForTerminalState(ctx, *stack.StackId, s.Logger); err != nil {
+		return err
+	}
+	return display(out, s.Output, printableString(fmt.Sprintf("stack %s finished\n", *in.StackName)))
+}
@@ -0,0 +1,118 @@
+package consolelink
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Partition is the AWS partition of region
+func Partition(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	}
+	return "aws"
+}
+
+func consoleHost(region string) string {
+	switch Partition(region) {
+	case "aws-cn":
+		return "console.amazonaws.cn"
+	case "aws-us-gov":
+		return "console.amazonaws-us-gov.com"
+	}
+	return "console.aws.amazon.com"
+}
+
+// Resource is a resource of a stack, as CloudFormation names it
+type Resource struct {
+	Type       string
+	PhysicalID string
+	Region     string
+	AccountID  string
+	// StackID is the stack holding the resource.  Resources without a console page of their own link to it.
+	StackID string
+}
+
+// ARN is the ARN of r, or empty if it cannot be built from the physical ID
+func ARN(r Resource) string {
+	id := r.PhysicalID
+	if strings.HasPrefix(id, "arn:") {
+		return id
+	}
+	if id == "" {
+		return ""
+	}
+	p := Partition(r.Region)
+	switch r.Type {
+	case "AWS::S3::Bucket":
+		return fmt.Sprintf("arn:%s:s3:::%s", p, id)
+	case "AWS::Lambda::Function":
+		return fmt.Sprintf("arn:%s:lambda:%s:%s:function:%s", p, r.Region, r.AccountID, id)
+	case "AWS::DynamoDB::Table":
+		return fmt.Sprintf("arn:%s:dynamodb:%s:%s:table/%s", p, r.Region, r.AccountID, id)
+	case "AWS::IAM::Role":
+		return fmt.Sprintf("arn:%s:iam::%s:role/%s", p, r.AccountID, id)
+	case "AWS::IAM::User":
+		return fmt.Sprintf("arn:%s:iam::%s:user/%s", p, r.AccountID, id)
+	case "AWS::SQS::Queue":
+		// The physical ID of a queue is its URL
+		return fmt.Sprintf("arn:%s:sqs:%s:%s:%s", p, r.Region, r.AccountID, id[strings.LastIndex(id, "/")+1:])
+	case "AWS::Logs::LogGroup":
+		return fmt.Sprintf("arn:%s:logs:%s:%s:log-group:%s", p, r.Region, r.AccountID, id)
+	case "AWS::EC2::Instance":
+		return fmt.Sprintf("arn:%s:ec2:%s:%s:instance/%s", p, r.Region, r.AccountID, id)
+	case "AWS::EC2::SecurityGroup":
+		return fmt.Sprintf("arn:%s:ec2:%s:%s:security-group/%s", p, r.Region, r.AccountID, id)
+	case "AWS::EC2::VPC":
+		return fmt.Sprintf("arn:%s:ec2:%s:%s:vpc/%s", p, r.Region, r.AccountID, id)
+	case "AWS::EC2::Subnet":
+		return fmt.Sprintf("arn:%s:ec2:%s:%s:subnet/%s", p, r.Region, r.AccountID, id)
+	case "AWS::ECS::Cluster":
+		return fmt.Sprintf("arn:%s:ecs:%s:%s:cluster/%s", p, r.Region, r.AccountID, id)
+	case "AWS::Kinesis::Stream":
+		return fmt.Sprintf("arn:%s:kinesis:%s:%s:stream/%s", p, r.Region, r.AccountID, id)
+	}
+	return ""
+}
+
+// Console is a link to r in the AWS console.  Resources without a page of their own link to the resources of their
+// stack.
+func Console(r Resource) string {
+	base := fmt.Sprintf("https://%s.%s", r.Region, consoleHost(r.Region))
+	region := "?region=" + url.QueryEscape(r.Region)
+	id := r.PhysicalID
+	if id != "" {
+		switch r.Type {
+		case "AWS::S3::Bucket":
+			return fmt.Sprintf("https://s3.%s/s3/buckets/%s", consoleHost(r.Region), url.PathEscape(id))
+		case "AWS::Lambda::Function":
+			return fmt.Sprintf("%s/lambda/home%s#/functions/%s", base, region, url.PathEscape(id))
+		case "AWS::DynamoDB::Table":
+			return fmt.Sprintf("%s/dynamodbv2/home%s#table?name=%s", base, region, url.QueryEscape(id))
+		case "AWS::IAM::Role":
+			return fmt.Sprintf("https://%s/iam/home#/roles/%s", consoleHost(r.Region), url.PathEscape(id))
+		case "AWS::SQS::Queue":
+			return fmt.Sprintf("%s/sqs/v2/home%s#/queues/%s", base, region, url.QueryEscape(id))
+		case "AWS::SNS::Topic":
+			return fmt.Sprintf("%s/sns/v3/home%s#/topic/%s", base, region, id)
+		case "AWS::Logs::LogGroup":
+			return fmt.Sprintf("%s/cloudwatch/home%s#logsV2:log-groups/log-group/%s", base, region, url.QueryEscape(url.QueryEscape(id)))
+		case "AWS::EC2::Instance":
+			return fmt.Sprintf("%s/ec2/home%s#InstanceDetails:instanceId=%s", base, region, id)
+		case "AWS::EC2::SecurityGroup":
+			return fmt.Sprintf("%s/ec2/home%s#SecurityGroup:groupId=%s", base, region, id)
+		case "AWS::ECS::Cluster":
+			return fmt.Sprintf("%s/ecs/home%s#/clusters/%s", base, region, url.PathEscape(id))
+		case "AWS::CloudFormation::Stack":
+			return fmt.Sprintf("%s/cloudformation/home%s#/stacks/stackinfo?stackId=%s", base, region, url.QueryEscape(id))
+		}
+	}
+	if r.StackID == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/cloudformation/home%s#/stacks/resources?stackId=%s", base, region, url.QueryEscape(r.StackID))
+}
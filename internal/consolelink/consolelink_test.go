@@ -0,0 +1,59 @@
+package consolelink
+
+import "testing"
+
+func TestARN(t *testing.T) {
+	tests := []struct {
+		r    Resource
+		want string
+	}{
+		{r: Resource{Type: "AWS::S3::Bucket", PhysicalID: "assets", Region: "us-west-2"}, want: "arn:aws:s3:::assets"},
+		{r: Resource{Type: "AWS::S3::Bucket", PhysicalID: "assets", Region: "cn-north-1"}, want: "arn:aws-cn:s3:::assets"},
+		{r: Resource{Type: "AWS::IAM::Role", PhysicalID: "deployer", Region: "us-gov-west-1", AccountID: "111"}, want: "arn:aws-us-gov:iam::111:role/deployer"},
+		{
+			r:    Resource{Type: "AWS::SQS::Queue", PhysicalID: "https://sqs.us-west-2.amazonaws.com/111/jobs", Region: "us-west-2", AccountID: "111"},
+			want: "arn:aws:sqs:us-west-2:111:jobs",
+		},
+		{
+			r:    Resource{Type: "AWS::SNS::Topic", PhysicalID: "arn:aws:sns:us-west-2:111:alerts", Region: "us-west-2"},
+			want: "arn:aws:sns:us-west-2:111:alerts",
+		},
+		{r: Resource{Type: "AWS::Lambda::Alias", PhysicalID: "live", Region: "us-west-2"}},
+		{r: Resource{Type: "AWS::S3::Bucket", Region: "us-west-2"}},
+	}
+	for _, tc := range tests {
+		if got := ARN(tc.r); got != tc.want {
+			t.Errorf("ARN of %+v is %q, want %q", tc.r, got, tc.want)
+		}
+	}
+}
+
+func TestConsole(t *testing.T) {
+	tests := []struct {
+		r    Resource
+		want string
+	}{
+		{
+			r:    Resource{Type: "AWS::Lambda::Function", PhysicalID: "handler", Region: "us-west-2"},
+			want: "https://us-west-2.console.aws.amazon.com/lambda/home?region=us-west-2#/functions/handler",
+		},
+		{
+			r:    Resource{Type: "AWS::S3::Bucket", PhysicalID: "assets", Region: "cn-north-1"},
+			want: "https://s3.console.amazonaws.cn/s3/buckets/assets",
+		},
+		{
+			r:    Resource{Type: "AWS::Logs::LogGroup", PhysicalID: "/aws/lambda/handler", Region: "us-west-2"},
+			want: "https://us-west-2.console.aws.amazon.com/cloudwatch/home?region=us-west-2#logsV2:log-groups/log-group/%252Faws%252Flambda%252Fhandler",
+		},
+		{
+			r:    Resource{Type: "AWS::Lambda::Alias", PhysicalID: "live", Region: "us-west-2", StackID: "stack/1"},
+			want: "https://us-west-2.console.aws.amazon.com/cloudformation/home?region=us-west-2#/stacks/resources?stackId=stack%2F1",
+		},
+		{r: Resource{Type: "AWS::Lambda::Alias", PhysicalID: "live", Region: "us-west-2"}},
+	}
+	for _, tc := range tests {
+		if got := Console(tc.r); got != tc.want {
+			t.Errorf("console link of %+v is %q, want %q", tc.r, got, tc.want)
+		}
+	}
+}
@@ -2,14 +2,62 @@ package ctxfinder
 
 import (
 	"context"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 )
 
+// SignalSource delivers the signals a ContextFinder reacts to.  Tests can inject a fake one.
+type SignalSource interface {
+	// Notify starts sending signals to c
+	Notify(c chan<- os.Signal)
+	// Stop stops sending signals to c.  No signal may be sent to c once it returns.
+	Stop(c chan<- os.Signal)
+}
+
+// OSSignals delivers SIGINT and SIGTERM from the operating system
+type OSSignals struct{}
+
+func (OSSignals) Notify(c chan<- os.Signal) {
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+}
+
+func (OSSignals) Stop(c chan<- os.Signal) {
+	signal.Stop(c)
+}
+
+// ContextFinder owns the root context of a command.  The context is cancelled on timeout, or on the first signal, so
+// commands can return and let cleanup run.  A second signal calls ForceExit.
 type ContextFinder struct {
 	Timeout time.Duration
-	mu      sync.Mutex
-	ctx     context.Context
+	// Signals defaults to OSSignals
+	Signals SignalSource
+	// ForceExit is called on the second signal.  It defaults to exiting the process.
+	ForceExit func(sig os.Signal)
+
+	mu          sync.Mutex
+	ctx         context.Context
+	cancel      context.CancelFunc
+	sigChan     chan os.Signal
+	interceptor chan os.Signal
+	signalCount int
+}
+
+func (c *ContextFinder) signals() SignalSource {
+	if c.Signals == nil {
+		return OSSignals{}
+	}
+	return c.Signals
+}
+
+func (c *ContextFinder) forceExit(sig os.Signal) {
+	if c.ForceExit != nil {
+		c.ForceExit(sig)
+		return
+	}
+	os.Exit(130)
 }
 
 func (c *ContextFinder) Ctx() context.Context {
@@ -18,9 +66,66 @@ func (c *ContextFinder) Ctx() context.Context {
 	if c.ctx != nil {
 		return c.ctx
 	}
-	c.ctx = context.Background()
 	if c.Timeout != 0 {
-		c.ctx, _ = context.WithDeadline(c.ctx, time.Now().Add(c.Timeout)) //nolint
+		c.ctx, c.cancel = context.WithDeadline(context.Background(), time.Now().Add(c.Timeout))
+	} else {
+		c.ctx, c.cancel = context.WithCancel(context.Background())
 	}
+	c.sigChan = make(chan os.Signal, 1)
+	c.signals().Notify(c.sigChan)
+	go c.watchSignals(c.sigChan, c.cancel)
 	return c.ctx
 }
+
+func (c *ContextFinder) watchSignals(sigChan <-chan os.Signal, cancel context.CancelFunc) {
+	for sig := range sigChan {
+		c.mu.Lock()
+		c.signalCount++
+		count := c.signalCount
+		interceptor := c.interceptor
+		c.mu.Unlock()
+		if count > 1 {
+			c.forceExit(sig)
+			continue
+		}
+		if interceptor == nil {
+			cancel()
+			continue
+		}
+		select {
+		case interceptor <- sig:
+		default:
+		}
+	}
+}
+
+// Intercept stops signals from cancelling the context returned by Ctx.  Until the returned function is called, the
+// first signal is sent to the returned channel instead, letting a command decide how to wind down.  A second signal
+// still calls ForceExit.
+func (c *ContextFinder) Intercept() (<-chan os.Signal, func()) {
+	ret := make(chan os.Signal, 1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interceptor = ret
+	return ret, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.interceptor == ret {
+			c.interceptor = nil
+		}
+	}
+}
+
+// Close releases the resources of the context returned by Ctx
+func (c *ContextFinder) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancel != nil {
+		c.cancel()
+	}
+	if c.sigChan != nil {
+		c.signals().Stop(c.sigChan)
+		close(c.sigChan)
+		c.sigChan = nil
+	}
+}
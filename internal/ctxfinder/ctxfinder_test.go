@@ -0,0 +1,103 @@
+package ctxfinder
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeSignals lets a test send signals to a ContextFinder
+type fakeSignals struct {
+	mu sync.Mutex
+	c  chan<- os.Signal
+}
+
+func (f *fakeSignals) Notify(c chan<- os.Signal) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.c = c
+}
+
+func (f *fakeSignals) Stop(c chan<- os.Signal) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.c = nil
+}
+
+func (f *fakeSignals) send(t *testing.T, sig os.Signal) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.c == nil {
+		t.Fatal("no channel is notified of signals")
+	}
+	f.c <- sig
+}
+
+func TestFirstSignalCancelsSecondExits(t *testing.T) {
+	signals := &fakeSignals{}
+	exited := make(chan os.Signal, 1)
+	c := &ContextFinder{
+		Signals: signals,
+		ForceExit: func(sig os.Signal) {
+			exited <- sig
+		},
+	}
+	defer c.Close()
+	ctx := c.Ctx()
+
+	signals.send(t, os.Interrupt)
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("first signal did not cancel the context")
+	}
+	select {
+	case sig := <-exited:
+		t.Fatalf("first signal %s forced an exit", sig)
+	default:
+	}
+
+	signals.send(t, syscall.SIGTERM)
+	select {
+	case sig := <-exited:
+		if sig != syscall.SIGTERM {
+			t.Fatalf("forced exit with %s, want %s", sig, syscall.SIGTERM)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("second signal did not force an exit")
+	}
+}
+
+func TestInterceptedSignalDoesNotCancel(t *testing.T) {
+	signals := &fakeSignals{}
+	exited := make(chan os.Signal, 1)
+	c := &ContextFinder{
+		Signals: signals,
+		ForceExit: func(sig os.Signal) {
+			exited <- sig
+		},
+	}
+	defer c.Close()
+	ctx := c.Ctx()
+	intercepted, stop := c.Intercept()
+	defer stop()
+
+	signals.send(t, os.Interrupt)
+	select {
+	case <-intercepted:
+	case <-time.After(time.Second):
+		t.Fatal("signal was not intercepted")
+	}
+	if ctx.Err() != nil {
+		t.Fatal("intercepted signal cancelled the context")
+	}
+
+	signals.send(t, os.Interrupt)
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Fatal("second signal did not force an exit while intercepted")
+	}
+}
@@ -0,0 +1,210 @@
+package dashboard
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Phases of a row.  Ready, Failed and Done are finished: the rest are in progress.
+const (
+	PhaseWaiting    = "waiting"
+	PhaseDescribing = "describing"
+	PhaseUploading  = "uploading"
+	PhaseChangeset  = "creating changeset"
+	PhaseReady      = "ready"
+	PhaseFailed     = "failed"
+	PhaseExecuting  = "executing"
+	PhaseDone       = "done"
+)
+
+func finished(phase string) bool {
+	return phase == PhaseReady || phase == PhaseFailed || phase == PhaseDone
+}
+
+// maxLineWidth keeps lines from wrapping, which would break redrawing them in place
+const maxLineWidth = 120
+
+var spinner = []string{"|", "/", "-", "\\"}
+
+// IsTerminal is true if out is a terminal a Dashboard can redraw
+func IsTerminal(out io.Writer) bool {
+	f, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+type row struct {
+	name   string
+	phase  string
+	detail string
+}
+
+// Dashboard redraws a row per stack and a summary bar in place on a terminal, until it is stopped
+type Dashboard struct {
+	Out io.Writer
+	// RefreshInterval defaults to 200ms
+	RefreshInterval time.Duration
+
+	mu         sync.Mutex
+	rows       []*row
+	index      map[string]*row
+	linesDrawn int
+	frame      int
+	started    time.Time
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// Add shows a row for name, in the order rows are added
+func (d *Dashboard) Add(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.index == nil {
+		d.index = make(map[string]*row)
+	}
+	if _, exists := d.index[name]; exists {
+		return
+	}
+	r := &row{
+		name:  name,
+		phase: PhaseWaiting,
+	}
+	d.rows = append(d.rows, r)
+	d.index[name] = r
+}
+
+// Update sets what the row for name is doing.  It is safe to call on a nil Dashboard.
+func (d *Dashboard) Update(name string, phase string, detail string) {
+	if d == nil {
+		return
+	}
+	d.Add(name)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	r := d.index[name]
+	r.phase = phase
+	r.detail = detail
+}
+
+func (d *Dashboard) refreshInterval() time.Duration {
+	if d.RefreshInterval == 0 {
+		return time.Millisecond * 200
+	}
+	return d.RefreshInterval
+}
+
+// Start redraws the dashboard in the background until Stop is called
+func (d *Dashboard) Start() {
+	d.mu.Lock()
+	d.started = time.Now()
+	d.done = make(chan struct{})
+	d.mu.Unlock()
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		for {
+			d.draw()
+			select {
+			case <-d.done:
+				return
+			case <-time.After(d.refreshInterval()):
+			}
+		}
+	}()
+}
+
+// Stop stops redrawing and erases the dashboard, so the final output replaces it
+func (d *Dashboard) Stop() {
+	close(d.done)
+	d.wg.Wait()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.erase()
+}
+
+func (d *Dashboard) erase() {
+	if d.linesDrawn == 0 {
+		return
+	}
+	// Move to the first line drawn, then clear everything below it
+	_, _ = fmt.Fprintf(d.Out, "\x1b[%dA\r\x1b[J", d.linesDrawn)
+	d.linesDrawn = 0
+}
+
+func (d *Dashboard) draw() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	lines := d.lines()
+	var b strings.Builder
+	if d.linesDrawn != 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", d.linesDrawn)
+	}
+	for _, l := range lines {
+		b.WriteString("\r\x1b[2K")
+		b.WriteString(l)
+		b.WriteString("\n")
+	}
+	// Clear lines left over from a taller previous frame
+	b.WriteString("\x1b[J")
+	_, _ = io.WriteString(d.Out, b.String())
+	d.linesDrawn = len(lines)
+	d.frame++
+}
+
+func truncate(s string, width int) string {
+	r := []rune(s)
+	if len(r) <= width {
+		return s
+	}
+	return string(r[:width-3]) + "..."
+}
+
+func (d *Dashboard) lines() []string {
+	nameWidth := 0
+	for _, r := range d.rows {
+		if len(r.name) > nameWidth {
+			nameWidth = len(r.name)
+		}
+	}
+	ret := make([]string, 0, len(d.rows)+2)
+	done, failed := 0, 0
+	for _, r := range d.rows {
+		marker := spinner[d.frame%len(spinner)]
+		switch {
+		case r.phase == PhaseFailed:
+			marker = "x"
+			failed++
+			done++
+		case finished(r.phase):
+			marker = "+"
+			done++
+		case r.phase == PhaseWaiting:
+			marker = " "
+		}
+		line := fmt.Sprintf("%s %-*s  %-18s  %s", marker, nameWidth, r.name, r.phase, r.detail)
+		ret = append(ret, truncate(strings.TrimRight(line, " "), maxLineWidth))
+	}
+	ret = append(ret, "", d.summary(done, failed))
+	return ret
+}
+
+func (d *Dashboard) summary(done int, failed int) string {
+	const barWidth = 30
+	total := len(d.rows)
+	filled := 0
+	if total != 0 {
+		filled = barWidth * done / total
+	}
+	bar := strings.Repeat("#", filled) + strings.Repeat("-", barWidth-filled)
+	return fmt.Sprintf("[%s] %d/%d finished, %d failed, %d in progress (%s)", bar, done, total, failed, total-done, time.Since(d.started).Round(time.Second))
+}
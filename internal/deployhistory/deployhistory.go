@@ -0,0 +1,166 @@
+package deployhistory
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/cep21/cfmanage/internal/gitinfo"
+)
+
+// Deployment records a deploy of a stack: who ran it, what changed, what happened, and the template and parameters the
+// stack was left with
+type Deployment struct {
+	ID           string
+	Key          string
+	StackName    string
+	StackID      string
+	Time         time.Time
+	Source       string
+	Status       string
+	TemplateBody string
+	Parameters   []*cloudformation.Parameter
+	Tags         []*cloudformation.Tag
+	Capabilities []*string
+
+	User         string    `json:",omitempty"`
+	IdentityARN  string    `json:",omitempty"`
+	GitSHA       string    `json:",omitempty"`
+	GitDirty     bool      `json:",omitempty"`
+	ChangesetARN string    `json:",omitempty"`
+	InputHash    string    `json:",omitempty"`
+	StartTime    time.Time `json:",omitempty"`
+	EndTime      time.Time `json:",omitempty"`
+	Error        string    `json:",omitempty"`
+	// Incomplete is why the record may not describe what the stack was left with: the deploy was left running, or the
+	// stack could not be described after it
+	Incomplete string `json:",omitempty"`
+	// RolledBackTo is the ID of the deployment a rollback restored
+	RolledBackTo string `json:",omitempty"`
+	// PolicyOverride is the reason given for executing despite PolicyViolations
+	PolicyOverride   string   `json:",omitempty"`
+	PolicyViolations []string `json:",omitempty"`
+	Changes          []Change `json:",omitempty"`
+	Events           []Event  `json:",omitempty"`
+}
+
+// Change is a single resource change of a deployment's changeset
+type Change struct {
+	Action       string
+	LogicalID    string
+	PhysicalID   string `json:",omitempty"`
+	ResourceType string
+	Replacement  string `json:",omitempty"`
+}
+
+// Event is a stack event seen while a deployment ran
+type Event struct {
+	Time         time.Time
+	LogicalID    string
+	ResourceType string
+	Status       string
+	Reason       string `json:",omitempty"`
+}
+
+// Succeeded is true if the deploy finished without error
+func (d *Deployment) Succeeded() bool {
+	return d.Error == ""
+}
+
+// Git is the commit the deploy ran from, or nil if it was not recorded
+func (d *Deployment) Git() *gitinfo.Info {
+	if d.GitSHA == "" {
+		return nil
+	}
+	return &gitinfo.Info{
+		SHA:   d.GitSHA,
+		Dirty: d.GitDirty,
+	}
+}
+
+// Restorable is true if the deployment succeeded and recorded what the stack was left with, so it can be restored
+func (d *Deployment) Restorable() bool {
+	return d.Succeeded() && d.Incomplete == "" && d.TemplateBody != ""
+}
+
+// Duration is how long the deploy ran, or zero if it was not timed
+func (d *Deployment) Duration() time.Duration {
+	if d.StartTime.IsZero() || d.EndTime.IsZero() {
+		return 0
+	}
+	return d.EndTime.Sub(d.StartTime)
+}
+
+// Sources of a Deployment
+const (
+	// SourceExecute is recorded after execute finishes
+	SourceExecute = "execute"
+	// SourceRollback is recorded after rollback finishes
+	SourceRollback = "rollback"
+	// SourceImport is recorded after import finishes
+	SourceImport = "import"
+	// SourceRecover is recorded after recover creates a stack again
+	SourceRecover = "recover"
+	// SourceBaseline is the state of a stack before cfmanage first deployed it
+	SourceBaseline = "baseline"
+)
+
+// Store saves deployments of stacks.  key identifies a stack across accounts and regions.
+type Store interface {
+	Save(ctx context.Context, d Deployment) error
+	// List returns every deployment of key, oldest first
+	List(ctx context.Context, key string) ([]Deployment, error)
+}
+
+// NewID returns a unique, time ordered, deployment ID
+func NewID(t time.Time) string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return t.UTC().Format("20060102T150405.000000000Z")
+	}
+	return fmt.Sprintf("%s-%s", t.UTC().Format("20060102T150405Z"), hex.EncodeToString(b))
+}
+
+func sortDeployments(d []Deployment) {
+	sort.SliceStable(d, func(i, j int) bool {
+		return d[i].Time.Before(d[j].Time)
+	})
+}
+
+// ParameterValues maps each parameter key of a deployment to its value
+func (d *Deployment) ParameterValues() map[string]string {
+	ret := make(map[string]string, len(d.Parameters))
+	for _, p := range d.Parameters {
+		if p.ParameterKey == nil {
+			continue
+		}
+		v := ""
+		if p.ParameterValue != nil {
+			v = *p.ParameterValue
+		}
+		ret[*p.ParameterKey] = v
+	}
+	return ret
+}
+
+// SameState is true if both deployments left a stack with the same template and parameters
+func (d *Deployment) SameState(o *Deployment) bool {
+	if d.TemplateBody != o.TemplateBody {
+		return false
+	}
+	dp := d.ParameterValues()
+	op := o.ParameterValues()
+	if len(dp) != len(op) {
+		return false
+	}
+	for k, v := range dp {
+		if ov, exists := op[k]; !exists || ov != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+package deployhistory
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// FileStore keeps the deployments of each stack as lines of JSON in a local file
+type FileStore struct {
+	Dir string
+}
+
+var _ Store = &FileStore{}
+
+// DefaultDir is where FileStore keeps history when no directory is given
+func DefaultDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".cfmanage", "history")
+}
+
+func (f *FileStore) filename(key string) string {
+	return filepath.Join(f.Dir, strings.NewReplacer("/", "_", ":", "_").Replace(key)+".jsonl")
+}
+
+func (f *FileStore) Save(_ context.Context, d Deployment) error {
+	if err := os.MkdirAll(f.Dir, 0700); err != nil {
+		return errors.Wrapf(err, "unable to make history directory %s", f.Dir)
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal deployment")
+	}
+	file, err := os.OpenFile(f.filename(d.Key), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "unable to open history file %s", f.filename(d.Key))
+	}
+	_, err = file.Write(append(b, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return errors.Wrapf(err, "unable to write history file %s", f.filename(d.Key))
+}
+
+func (f *FileStore) List(_ context.Context, key string) ([]Deployment, error) {
+	file, err := os.Open(f.filename(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "unable to open history file %s", f.filename(key))
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	var ret []Deployment
+	scanner := bufio.NewScanner(file)
+	// Lines hold whole templates, which can be much larger than the default token size
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var d Deployment
+		if err := json.Unmarshal(scanner.Bytes(), &d); err != nil {
+			return nil, errors.Wrapf(err, "invalid line in history file %s", f.filename(key))
+		}
+		ret = append(ret, d)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "unable to read history file %s", f.filename(key))
+	}
+	sortDeployments(ret)
+	return ret, nil
+}
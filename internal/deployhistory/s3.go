@@ -0,0 +1,91 @@
+package deployhistory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/pkg/errors"
+)
+
+// S3Store keeps each deployment as an object under Prefix/key/ in a bucket
+type S3Store struct {
+	Client s3iface.S3API
+	Bucket string
+	Prefix string
+}
+
+var _ Store = &S3Store{}
+
+func (s *S3Store) dir(key string) string {
+	return path.Join(s.Prefix, key) + "/"
+}
+
+func (s *S3Store) Save(ctx context.Context, d Deployment) error {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal deployment")
+	}
+	objectKey := s.dir(d.Key) + d.ID + ".json"
+	_, err = s.Client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: &s.Bucket,
+		Key:    &objectKey,
+		Body:   bytes.NewReader(b),
+	})
+	return errors.Wrapf(err, "unable to write deployment s3://%s/%s", s.Bucket, objectKey)
+}
+
+func (s *S3Store) List(ctx context.Context, key string) ([]Deployment, error) {
+	prefix := s.dir(key)
+	var objectKeys []string
+	err := s.Client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: &s.Bucket,
+		Prefix: &prefix,
+	}, func(out *s3.ListObjectsV2Output, _ bool) bool {
+		for _, o := range out.Contents {
+			if o.Key != nil && path.Ext(*o.Key) == ".json" {
+				objectKeys = append(objectKeys, *o.Key)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to list deployments in s3://%s/%s", s.Bucket, prefix)
+	}
+	ret := make([]Deployment, 0, len(objectKeys))
+	for _, k := range objectKeys {
+		d, err := s.get(ctx, k)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, d)
+	}
+	sortDeployments(ret)
+	return ret, nil
+}
+
+func (s *S3Store) get(ctx context.Context, objectKey string) (Deployment, error) {
+	out, err := s.Client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: &s.Bucket,
+		Key:    &objectKey,
+	})
+	if err != nil {
+		return Deployment{}, errors.Wrapf(err, "unable to read deployment s3://%s/%s", s.Bucket, objectKey)
+	}
+	defer func() {
+		_ = out.Body.Close()
+	}()
+	b, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		return Deployment{}, errors.Wrapf(err, "unable to read deployment s3://%s/%s", s.Bucket, objectKey)
+	}
+	var ret Deployment
+	if err := json.Unmarshal(b, &ret); err != nil {
+		return Deployment{}, errors.Wrapf(err, "invalid deployment s3://%s/%s", s.Bucket, objectKey)
+	}
+	return ret, nil
+}
@@ -0,0 +1,332 @@
+package formatter
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+func init() {
+	Register("table", noArg(func() Formatter { return tableFormat{} }))
+	Register("json", noArg(func() Formatter { return jsonFormat{} }))
+	Register("ndjson", noArg(func() Formatter { return ndjsonFormat{} }))
+	Register("yaml", noArg(func() Formatter { return &yamlFormat{} }))
+	Register("csv", noArg(func() Formatter { return &csvFormat{} }))
+	Register("markdown", noArg(func() Formatter { return &markdownFormat{} }))
+	Register("env", noArg(func() Formatter { return envFormat{} }))
+	Register("template", newTemplateFormat)
+	Register("template-file", func(arg string) (Formatter, error) {
+		if arg == "" {
+			return nil, errors.New("expected template-file=PATH")
+		}
+		b, err := ioutil.ReadFile(arg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read template file %s", arg)
+		}
+		return newTemplateFormat(string(b))
+	})
+}
+
+func noArg(f func() Formatter) Factory {
+	return func(arg string) (Formatter, error) {
+		if arg != "" {
+			return nil, errors.New("format takes no argument")
+		}
+		return f(), nil
+	}
+}
+
+type tableFormat struct{}
+
+func (tableFormat) Format(out io.Writer, data Human) error {
+	return data.HumanReadable(out)
+}
+
+type jsonFormat struct{}
+
+func (jsonFormat) Format(out io.Writer, data Human) error {
+	return json.NewEncoder(out).Encode(data)
+}
+
+// ndjsonFormat writes each item of a model as a line of JSON.  Models that are not a list are a single line.
+type ndjsonFormat struct{}
+
+func (f ndjsonFormat) Format(out io.Writer, data Human) error {
+	items, ok := data.(Itemized)
+	if !ok {
+		return f.WriteItem(out, data)
+	}
+	for _, item := range items.Items() {
+		if err := f.WriteItem(out, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ndjsonFormat) WriteItem(out io.Writer, item interface{}) error {
+	return json.NewEncoder(out).Encode(item)
+}
+
+// yamlFormat writes models as YAML documents, with the same field names as JSON
+type yamlFormat struct {
+	mu      sync.Mutex
+	written bool
+}
+
+func (f *yamlFormat) Format(out io.Writer, data Human) error {
+	// Going through JSON keeps the field names, omitempty and custom marshalling of the json format
+	b, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal json")
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	doc, err := orderedJSON(dec)
+	if err != nil {
+		return errors.Wrap(err, "unable to convert json to yaml")
+	}
+	y, err := yaml.Marshal(doc)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal yaml")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.written {
+		// Models displayed one after another, like stack events, are a stream of documents
+		y = append([]byte("---\n"), y...)
+	}
+	f.written = true
+	_, err = out.Write(y)
+	return err
+}
+
+// orderedJSON decodes the next JSON value of dec, keeping the order of object keys.  Objects are yaml.MapSlice at any
+// depth, so models that are not objects, like lists, convert too.
+func orderedJSON(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '{' {
+			ret := yaml.MapSlice{}
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := orderedJSON(dec)
+				if err != nil {
+					return nil, err
+				}
+				ret = append(ret, yaml.MapItem{Key: key, Value: value})
+			}
+			_, err := dec.Token()
+			return ret, err
+		}
+		ret := []interface{}{}
+		for dec.More() {
+			value, err := orderedJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, value)
+		}
+		_, err := dec.Token()
+		return ret, err
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i, nil
+		}
+		return t.Float64()
+	}
+	return tok, nil
+}
+
+// lastHeader remembers the header of the last table written, so rows streamed one model at a time, like stack events,
+// continue the same table
+type lastHeader struct {
+	mu      sync.Mutex
+	written bool
+	header  string
+}
+
+// next returns if a header, and a separator before it, should be written for t
+func (l *lastHeader) next(t Table) (writeHeader bool, separate bool) {
+	header := strings.Join(t.Header, "\x00")
+	separate = l.written
+	writeHeader = !l.written || t.Title != "" || header != l.header
+	l.written = true
+	l.header = header
+	return writeHeader, separate && writeHeader
+}
+
+type csvFormat struct {
+	last lastHeader
+}
+
+func (f *csvFormat) Format(out io.Writer, data Human) error {
+	tab, ok := data.(Tabular)
+	if !ok {
+		return errors.Errorf("csv output is not supported for %T", data)
+	}
+	f.last.mu.Lock()
+	defer f.last.mu.Unlock()
+	for _, t := range tab.Tables() {
+		writeHeader, separate := f.last.next(t)
+		if separate {
+			if _, err := io.WriteString(out, "\n"); err != nil {
+				return err
+			}
+		}
+		w := csv.NewWriter(out)
+		if writeHeader {
+			if err := w.Write(t.Header); err != nil {
+				return err
+			}
+		}
+		if err := w.WriteAll(t.Rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markdownFormat writes tables as GitHub flavored markdown, for pull request comments.  Models that are not tabular are
+// a code block of their human readable output.
+type markdownFormat struct {
+	last lastHeader
+}
+
+var markdownEscaper = strings.NewReplacer("|", "\\|", "\r\n", "<br>", "\n", "<br>")
+
+func markdownRow(cells []string) string {
+	escaped := make([]string, 0, len(cells))
+	for _, c := range cells {
+		escaped = append(escaped, markdownEscaper.Replace(c))
+	}
+	return "| " + strings.Join(escaped, " | ") + " |\n"
+}
+
+func markdownHeader(header []string) string {
+	divider := make([]string, len(header))
+	for i := range divider {
+		divider[i] = "---"
+	}
+	return markdownRow(header) + markdownRow(divider)
+}
+
+// MarkdownTable is the rows of t as a markdown table, without its title
+func MarkdownTable(t Table) string {
+	var b strings.Builder
+	b.WriteString(markdownHeader(t.Header))
+	for _, row := range t.Rows {
+		b.WriteString(markdownRow(row))
+	}
+	return b.String()
+}
+
+func (f *markdownFormat) Format(out io.Writer, data Human) error {
+	f.last.mu.Lock()
+	defer f.last.mu.Unlock()
+	tab, ok := data.(Tabular)
+	if !ok {
+		var buf bytes.Buffer
+		if err := data.HumanReadable(&buf); err != nil {
+			return err
+		}
+		// Text after a code block must not continue a table
+		f.last.written = false
+		_, err := fmt.Fprintf(out, "```\n%s\n```\n", strings.TrimRight(buf.String(), "\n"))
+		return err
+	}
+	var b strings.Builder
+	for _, t := range tab.Tables() {
+		writeHeader, separate := f.last.next(t)
+		if separate {
+			b.WriteString("\n")
+		}
+		if t.Title != "" {
+			fmt.Fprintf(&b, "### %s\n\n", t.Title)
+		}
+		if writeHeader {
+			b.WriteString(markdownHeader(t.Header))
+		}
+		for _, row := range t.Rows {
+			b.WriteString(markdownRow(row))
+		}
+	}
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+// envFormat writes variables as shell exports, so scripts can eval them
+type envFormat struct{}
+
+func (envFormat) Format(out io.Writer, data Human) error {
+	vars, ok := data.(Variables)
+	if !ok {
+		return errors.Errorf("env output is not supported for %T", data)
+	}
+	var b strings.Builder
+	for _, v := range vars.Variables() {
+		fmt.Fprintf(&b, "export %s=%s\n", EnvName(v[0]), shellQuote(v[1]))
+	}
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+// EnvName makes name a valid environment variable name
+func EnvName(name string) string {
+	ret := []byte(name)
+	for i, c := range ret {
+		if !(c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
+			ret[i] = '_'
+		}
+	}
+	if len(ret) == 0 || (ret[0] >= '0' && ret[0] <= '9') {
+		return "_" + string(ret)
+	}
+	return string(ret)
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// templateFormat executes a text/template against each model
+type templateFormat struct {
+	tmpl *template.Template
+}
+
+func newTemplateFormat(arg string) (Formatter, error) {
+	if arg == "" {
+		return nil, errors.New("expected template=TEXT")
+	}
+	tmpl, err := template.New("output").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+		"join": strings.Join,
+	}).Parse(arg)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse template")
+	}
+	return &templateFormat{tmpl: tmpl}, nil
+}
+
+func (f *templateFormat) Format(out io.Writer, data Human) error {
+	return f.tmpl.Execute(out, data)
+}
@@ -0,0 +1,93 @@
+package formatter
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Human is a model that can print itself for people.  Every model supports it, and the table format uses it.
+type Human interface {
+	HumanReadable(out io.Writer) error
+}
+
+// Table is a titled table of a model, for formats that write rows
+type Table struct {
+	Title  string
+	Header []string
+	Rows   [][]string
+}
+
+// Tabular models can be written as rows, for the csv and markdown formats
+type Tabular interface {
+	Tables() []Table
+}
+
+// Itemized models are a list of objects, such as one per stack, that ndjson writes a line each
+type Itemized interface {
+	Items() []interface{}
+}
+
+// Variables models are a list of names and values, for the env format
+type Variables interface {
+	Variables() [][2]string
+}
+
+// Formatter writes models in one format
+type Formatter interface {
+	Format(out io.Writer, data Human) error
+}
+
+// ItemWriter formatters can write the items of a model one at a time, as each becomes ready
+type ItemWriter interface {
+	WriteItem(out io.Writer, item interface{}) error
+}
+
+// Factory makes a Formatter.  arg is the text after the = of --output name=arg.
+type Factory func(arg string) (Formatter, error)
+
+var registry = struct {
+	mu        sync.Mutex
+	factories map[string]Factory
+}{
+	factories: make(map[string]Factory),
+}
+
+// Register makes a format available to New
+func Register(name string, f Factory) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.factories[name] = f
+}
+
+// Names lists the registered formats
+func Names() []string {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	ret := make([]string, 0, len(registry.factories))
+	for name := range registry.factories {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// New makes the formatter for an --output value: a format name, optionally followed by = and an argument, like
+// template={{ .StackName }}
+func New(spec string) (Formatter, error) {
+	name, arg := spec, ""
+	if idx := strings.Index(spec, "="); idx != -1 {
+		name, arg = spec[:idx], spec[idx+1:]
+	}
+	registry.mu.Lock()
+	f, exists := registry.factories[name]
+	registry.mu.Unlock()
+	if !exists {
+		return nil, errors.Errorf("unknown output format %s: expected one of %s", name, strings.Join(Names(), ", "))
+	}
+	ret, err := f(arg)
+	return ret, errors.Wrapf(err, "invalid output format %s", spec)
+}
@@ -0,0 +1,200 @@
+package formatter
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden files of the formatter tests")
+
+// testStack's fields are not in alphabetical order, to show yaml keeps the order of the json format
+type testStack struct {
+	Name    string            `json:"name"`
+	Status  string            `json:"status"`
+	Changes int               `json:"changes"`
+	Cost    float64           `json:"cost"`
+	Tags    map[string]string `json:"tags,omitempty"`
+	Outputs []testOutput      `json:"outputs"`
+}
+
+type testOutput struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// testModel supports every format
+type testModel struct {
+	Stacks []testStack `json:"stacks"`
+	Total  int         `json:"total"`
+}
+
+func (m testModel) HumanReadable(out io.Writer) error {
+	for _, s := range m.Stacks {
+		if _, err := fmt.Fprintf(out, "%s: %s (%d changes)\n", s.Name, s.Status, s.Changes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m testModel) Tables() []Table {
+	stacks := Table{
+		Title:  "Stacks",
+		Header: []string{"Name", "Status", "Changes"},
+	}
+	outputs := Table{
+		Title:  "Outputs",
+		Header: []string{"Stack", "Key", "Value"},
+	}
+	for _, s := range m.Stacks {
+		stacks.Rows = append(stacks.Rows, []string{s.Name, s.Status, fmt.Sprint(s.Changes)})
+		for _, o := range s.Outputs {
+			outputs.Rows = append(outputs.Rows, []string{s.Name, o.Key, o.Value})
+		}
+	}
+	return []Table{stacks, outputs}
+}
+
+func (m testModel) Items() []interface{} {
+	ret := make([]interface{}, 0, len(m.Stacks))
+	for _, s := range m.Stacks {
+		ret = append(ret, s)
+	}
+	return ret
+}
+
+func (m testModel) Variables() [][2]string {
+	var ret [][2]string
+	for _, s := range m.Stacks {
+		for _, o := range s.Outputs {
+			ret = append(ret, [2]string{s.Name + "-" + o.Key, o.Value})
+		}
+	}
+	return ret
+}
+
+func testData() testModel {
+	return testModel{
+		Stacks: []testStack{
+			{
+				Name:    "infra-canary",
+				Status:  "UPDATE_COMPLETE",
+				Changes: 2,
+				Cost:    1.5,
+				Tags:    map[string]string{"team": "infra", "env": "canary"},
+				Outputs: []testOutput{
+					{Key: "Url", Value: "https://canary.example.com"},
+					{Key: "Motd", Value: "it's | multi\nline"},
+				},
+			},
+			{
+				Name:    "infra-prod",
+				Status:  "CREATE_COMPLETE",
+				Outputs: []testOutput{},
+			},
+		},
+		Total: 2,
+	}
+}
+
+// testList is a model that is not a JSON object
+type testList []string
+
+func (l testList) HumanReadable(out io.Writer) error {
+	for _, s := range l {
+		if _, err := fmt.Fprintln(out, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// testText is a model that is a JSON string
+type testText string
+
+func (t testText) HumanReadable(out io.Writer) error {
+	_, err := io.WriteString(out, string(t)+"\n")
+	return err
+}
+
+func expectGolden(t *testing.T, name string, got []byte) {
+	fname := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := ioutil.WriteFile(fname, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("output differs from %s (run go test -update to rewrite it)\ngot:\n%s\nwant:\n%s", fname, got, want)
+	}
+}
+
+func TestFormats(t *testing.T) {
+	tests := []struct {
+		name   string
+		spec   string
+		models []Human
+	}{
+		{name: "table", spec: "table", models: []Human{testData()}},
+		{name: "json", spec: "json", models: []Human{testData()}},
+		{name: "ndjson", spec: "ndjson", models: []Human{testData(), testList{"a", "b"}}},
+		{name: "yaml", spec: "yaml", models: []Human{testData(), testData()}},
+		{name: "yaml_list", spec: "yaml", models: []Human{testList{"a", "b"}, testList{}}},
+		{name: "yaml_scalar", spec: "yaml", models: []Human{testText("done")}},
+		{name: "csv", spec: "csv", models: []Human{testData(), testData()}},
+		{name: "markdown", spec: "markdown", models: []Human{testData(), testText("done"), testData()}},
+		{name: "env", spec: "env", models: []Human{testData()}},
+		{name: "template", spec: `template={{ range .Stacks }}{{ .Name }}={{ .Status }} {{ json .Tags }}{{ "\n" }}{{ end }}`, models: []Human{testData()}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := New(tc.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			for _, m := range tc.models {
+				if err := f.Format(&buf, m); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expectGolden(t, tc.name, buf.Bytes())
+		})
+	}
+}
+
+func TestUnsupportedFormats(t *testing.T) {
+	for _, spec := range []string{"csv", "env"} {
+		f, err := New(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Format(ioutil.Discard, testText("done")); err == nil {
+			t.Fatalf("%s formatted a model it does not support", spec)
+		}
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	for name, want := range map[string]string{
+		"Url":                 "Url",
+		"infra-canary_Url":    "infra_canary_Url",
+		"my.stack/Output Key": "my_stack_Output_Key",
+		"3rdParty":            "_3rdParty",
+		"":                    "_",
+	} {
+		if got := EnvName(name); got != want {
+			t.Errorf("EnvName(%q) is %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package gitinfo
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Info describes the git commit a directory is checked out at
+type Info struct {
+	SHA   string
+	Dirty bool
+}
+
+// String is the short SHA, with a -dirty suffix if there are uncommitted changes
+func (i *Info) String() string {
+	if i == nil {
+		return ""
+	}
+	ret := i.SHA
+	if len(ret) > 12 {
+		ret = ret[:12]
+	}
+	if i.Dirty {
+		ret += "-dirty"
+	}
+	return ret
+}
+
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return "", errors.Wrapf(err, "unable to run git %s", strings.Join(args, " "))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// Describe returns the commit dir is checked out at.  It returns an error if dir is not inside a git repository.
+func Describe(ctx context.Context, dir string) (*Info, error) {
+	sha, err := git(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	status, err := git(ctx, dir, "status", "--porcelain", "--", ".")
+	if err != nil {
+		return nil, err
+	}
+	return &Info{
+		SHA:   sha,
+		Dirty: status != "",
+	}, nil
+}
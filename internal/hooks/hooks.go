@@ -0,0 +1,131 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cep21/cfmanage/internal/logger"
+	"github.com/cep21/cfmanage/internal/schema"
+	"github.com/pkg/errors"
+)
+
+// DefaultTimeout bounds hooks that do not set a timeout
+const DefaultTimeout = 5 * time.Minute
+
+// Hook is a local command run around a deploy
+type Hook struct {
+	// Command is the program and its arguments
+	Command []string
+	Dir     string
+	// Timeout bounds the command.  Zero means DefaultTimeout.
+	Timeout time.Duration
+	// Env is added to the environment of the command, after the variables describing the stack
+	Env map[string]string
+}
+
+func (h *Hook) String() string {
+	return strings.Join(h.Command, " ")
+}
+
+func (h *Hook) timeout() time.Duration {
+	if h.Timeout == 0 {
+		return DefaultTimeout
+	}
+	return h.Timeout
+}
+
+// Runner runs hooks, one at a time
+type Runner struct {
+	// Out gets the stdout and stderr of hooks
+	Out    io.Writer
+	Logger *logger.Logger
+}
+
+// Run runs hooks in order with input, stopping at the first that fails
+func (r *Runner) Run(ctx context.Context, hooks []Hook, input schema.HookInput) error {
+	if len(hooks) == 0 {
+		return nil
+	}
+	stdin, err := json.Marshal(input)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal hook input")
+	}
+	env := append(os.Environ(), Environment(input)...)
+	for i := range hooks {
+		if err := r.runOne(ctx, &hooks[i], env, stdin, input.Hook); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Runner) runOne(ctx context.Context, h *Hook, env []string, stdin []byte, phase string) error {
+	if len(h.Command) == 0 {
+		return errors.Errorf("%s hook has no command", phase)
+	}
+	ctx, cancel := context.WithTimeout(ctx, h.timeout())
+	defer cancel()
+	r.Logger.Log(1, "running %s hook %s", phase, h)
+	cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+	cmd.Dir = h.Dir
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = r.Out
+	cmd.Stderr = r.Out
+	cmd.Env = env
+	keys := make([]string, 0, len(h.Env))
+	for k := range h.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		cmd.Env = append(cmd.Env, k+"="+h.Env[k])
+	}
+	start := time.Now()
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return errors.Errorf("%s hook %s timed out after %s", phase, h, h.timeout())
+	}
+	if err != nil {
+		return errors.Wrapf(err, "%s hook %s failed", phase, h)
+	}
+	r.Logger.Log(2, "%s hook %s finished in %s", phase, h, time.Since(start))
+	return nil
+}
+
+// Environment describes input as CFMANAGE_ environment variables.  Each output of the stack is CFMANAGE_OUTPUT_ and
+// its key.
+func Environment(input schema.HookInput) []string {
+	ret := []string{
+		"CFMANAGE_HOOK=" + input.Hook,
+		"CFMANAGE_STACK_NAME=" + input.StackName,
+		"CFMANAGE_STACK_ID=" + input.StackID,
+		"CFMANAGE_ACCOUNT_ID=" + input.AccountID,
+		"CFMANAGE_REGION=" + input.Region,
+		"CFMANAGE_CHANGESET_ARN=" + input.ChangesetARN,
+		"CFMANAGE_CHANGES=" + strconv.Itoa(input.Changes.Total),
+		"CFMANAGE_CHANGES_ADD=" + strconv.Itoa(input.Changes.Add),
+		"CFMANAGE_CHANGES_MODIFY=" + strconv.Itoa(input.Changes.Modify),
+		"CFMANAGE_CHANGES_REMOVE=" + strconv.Itoa(input.Changes.Remove),
+		"CFMANAGE_CHANGES_REPLACEMENTS=" + strconv.Itoa(input.Changes.Replacements),
+	}
+	if input.Error != nil {
+		ret = append(ret, "CFMANAGE_ERROR="+input.Error.Message)
+	}
+	keys := make([]string, 0, len(input.Outputs))
+	for k := range input.Outputs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		ret = append(ret, "CFMANAGE_OUTPUT_"+k+"="+input.Outputs[k])
+	}
+	return ret
+}
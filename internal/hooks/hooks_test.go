@@ -0,0 +1,143 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cep21/cfmanage/internal/schema"
+)
+
+func testInput() schema.HookInput {
+	return schema.HookInput{
+		Header:    schema.NewHeader("hookInput"),
+		Hook:      schema.HookPreExecute,
+		StackName: "infra-canary",
+		AccountID: "111",
+		Region:    "us-west-2",
+		Changes: schema.ChangeSummary{
+			Total:  2,
+			Add:    1,
+			Remove: 1,
+		},
+		Outputs: map[string]string{"Url": "https://example.com", "Bucket": "b"},
+	}
+}
+
+func skipWithoutShell(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks are tested with sh")
+	}
+}
+
+func TestRunStopsAtFirstFailure(t *testing.T) {
+	skipWithoutShell(t)
+	var out bytes.Buffer
+	r := Runner{Out: &out}
+	err := r.Run(context.Background(), []Hook{
+		{Command: []string{"sh", "-c", "echo first"}},
+		{Command: []string{"sh", "-c", "echo second; exit 3"}},
+		{Command: []string{"sh", "-c", "echo third"}},
+	}, testInput())
+	if err == nil || !strings.Contains(err.Error(), "preExecute hook sh -c echo second; exit 3 failed") {
+		t.Fatalf("a failing hook returned %v", err)
+	}
+	// A failing preExecute hook aborts the deploy: nothing after it runs
+	if got := out.String(); got != "first\nsecond\n" {
+		t.Fatalf("hooks wrote %q", got)
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	skipWithoutShell(t)
+	r := Runner{Out: ioutil.Discard}
+	start := time.Now()
+	err := r.Run(context.Background(), []Hook{
+		{Command: []string{"sleep", "10"}, Timeout: 50 * time.Millisecond},
+	}, testInput())
+	if err == nil || err.Error() != "preExecute hook sleep 10 timed out after 50ms" {
+		t.Fatalf("a slow hook returned %v", err)
+	}
+	if took := time.Since(start); took > 5*time.Second {
+		t.Fatalf("timed out hook ran for %s", took)
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	skipWithoutShell(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := Runner{Out: ioutil.Discard}
+	if err := r.Run(ctx, []Hook{{Command: []string{"sh", "-c", "exit 0"}}}, testInput()); err == nil {
+		t.Fatal("hook ran after its context was cancelled")
+	}
+}
+
+func TestRunInput(t *testing.T) {
+	skipWithoutShell(t)
+	dir, err := ioutil.TempDir("", "hooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+	var out bytes.Buffer
+	r := Runner{Out: &out}
+	err = r.Run(context.Background(), []Hook{{
+		Command: []string{"sh", "-c", `echo "$CFMANAGE_STACK_NAME $CFMANAGE_OUTPUT_Url $EXTRA $(basename "$(pwd)")"; cat`},
+		Dir:     dir,
+		Env:     map[string]string{"EXTRA": "extra"},
+	}}, testInput())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitN(out.String(), "\n", 2)
+	if want := "infra-canary https://example.com extra " + filepath.Base(dir); lines[0] != want {
+		t.Fatalf("hook saw %q, want %q", lines[0], want)
+	}
+	// The input is the hook's stdin
+	if !strings.HasPrefix(lines[1], `{"schemaVersion":"1","kind":"hookInput","hook":"preExecute"`) {
+		t.Fatalf("hook read %q", lines[1])
+	}
+}
+
+func TestRunWithoutCommand(t *testing.T) {
+	r := Runner{Out: ioutil.Discard}
+	if err := r.Run(context.Background(), []Hook{{}}, testInput()); err == nil || err.Error() != "preExecute hook has no command" {
+		t.Fatalf("a hook without a command returned %v", err)
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	input := testInput()
+	input.Error = &schema.Error{Message: "stack rolled back"}
+	want := []string{
+		"CFMANAGE_HOOK=preExecute",
+		"CFMANAGE_STACK_NAME=infra-canary",
+		"CFMANAGE_STACK_ID=",
+		"CFMANAGE_ACCOUNT_ID=111",
+		"CFMANAGE_REGION=us-west-2",
+		"CFMANAGE_CHANGESET_ARN=",
+		"CFMANAGE_CHANGES=2",
+		"CFMANAGE_CHANGES_ADD=1",
+		"CFMANAGE_CHANGES_MODIFY=0",
+		"CFMANAGE_CHANGES_REMOVE=1",
+		"CFMANAGE_CHANGES_REPLACEMENTS=0",
+		"CFMANAGE_ERROR=stack rolled back",
+		"CFMANAGE_OUTPUT_Bucket=b",
+		"CFMANAGE_OUTPUT_Url=https://example.com",
+	}
+	if got := Environment(input); !reflect.DeepEqual(got, want) {
+		t.Fatalf("environment\n%v\nwant\n%v", got, want)
+	}
+}
@@ -0,0 +1,291 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cep21/cfmanage/internal/logger"
+	"github.com/cep21/cfmanage/internal/schema"
+	"github.com/pkg/errors"
+)
+
+// Formats of a Webhook
+const (
+	FormatGeneric = "generic"
+	FormatSlack   = "slack"
+	FormatTeams   = "teams"
+)
+
+// Webhook is an endpoint deploy events are posted to
+type Webhook struct {
+	URL string
+	// Format is generic (the default), slack or teams
+	Format string
+	// Events limits the events posted.  Empty means all of them.
+	Events []string
+}
+
+func (w *Webhook) wants(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Notifier posts deploy events to webhooks
+type Notifier struct {
+	Webhooks []Webhook
+	// Timeout bounds posting an event to a webhook, retries included.  Zero means 30 seconds.
+	Timeout time.Duration
+	// Retries is how many times a failed post is retried
+	Retries int
+	// Client defaults to http.DefaultClient
+	Client *http.Client
+	Logger *logger.Logger
+}
+
+func (n *Notifier) timeout() time.Duration {
+	if n.Timeout == 0 {
+		return time.Second * 30
+	}
+	return n.Timeout
+}
+
+func (n *Notifier) client() *http.Client {
+	if n.Client == nil {
+		return http.DefaultClient
+	}
+	return n.Client
+}
+
+// Notify posts e to every webhook that wants it, at the same time.  It returns the errors of the webhooks that failed
+// once every webhook is done.  Posting is bounded by the notifier's timeout rather than ctx, so an event about a deploy
+// that was cancelled is still sent.
+func (n *Notifier) Notify(e schema.DeployEvent) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(n.Webhooks))
+	for i := range n.Webhooks {
+		hook := &n.Webhooks[i]
+		if !hook.wants(e.Event) {
+			continue
+		}
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), n.timeout())
+			defer cancel()
+			errs[i] = n.post(ctx, hook, e)
+		}()
+	}
+	wg.Wait()
+	var msgs []string
+	for _, err := range errs {
+		if err != nil {
+			msgs = append(msgs, err.Error())
+		}
+	}
+	if len(msgs) != 0 {
+		return errors.New(strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+func (n *Notifier) post(ctx context.Context, hook *Webhook, e schema.DeployEvent) error {
+	body, err := Payload(hook.Format, e)
+	if err != nil {
+		return err
+	}
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		retry, err := n.postOnce(ctx, hook.URL, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= n.Retries {
+			return errors.Wrapf(err, "unable to notify %s", redact(hook.URL))
+		}
+		n.Logger.Log(1, "retrying webhook %s in %s: %s", redact(hook.URL), backoff, err.Error())
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(err, "unable to notify %s before timing out", redact(hook.URL))
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// postOnce posts body to url, returning if a failure is worth retrying
+func (n *Notifier) postOnce(ctx context.Context, url string, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, errors.Wrap(err, "invalid webhook")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client().Do(req)
+	if err != nil {
+		// The error of a request names its URL, which redact hides
+		if urlErr, ok := err.(*neturl.Error); ok {
+			return true, urlErr.Err
+		}
+		return true, err
+	}
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, errors.Errorf("webhook returned %s", resp.Status)
+}
+
+// redact hides the path of webhook URLs, which for Slack and Teams is the secret
+func redact(url string) string {
+	if idx := strings.Index(url, "://"); idx != -1 {
+		if slash := strings.Index(url[idx+3:], "/"); slash != -1 {
+			return url[:idx+3+slash] + "/..."
+		}
+	}
+	return url
+}
+
+// Payload is the body posted to a webhook of format
+func Payload(format string, e schema.DeployEvent) ([]byte, error) {
+	switch format {
+	case "", FormatGeneric:
+		return json.Marshal(e)
+	case FormatSlack:
+		return json.Marshal(slackPayload(e))
+	case FormatTeams:
+		return json.Marshal(teamsPayload(e))
+	}
+	return nil, errors.Errorf("unknown webhook format %s: expected %s, %s or %s", format, FormatGeneric, FormatSlack, FormatTeams)
+}
+
+func title(e schema.DeployEvent) string {
+	return fmt.Sprintf("%s of %s %s", e.Source, e.StackName, e.Event)
+}
+
+func changeText(c schema.ChangeSummary) string {
+	ret := fmt.Sprintf("%d (%d add, %d modify, %d remove)", c.Total, c.Add, c.Modify, c.Remove)
+	if c.Replacements != 0 {
+		ret += fmt.Sprintf(", %d replacements", c.Replacements)
+	}
+	return ret
+}
+
+type fact struct {
+	name  string
+	value string
+}
+
+func facts(e schema.DeployEvent) []fact {
+	ret := []fact{
+		{"Stack", e.StackName},
+		{"Account", e.AccountID},
+		{"Region", e.Region},
+		{"Changes", changeText(e.Changes)},
+		{"Run by", e.User},
+	}
+	if e.DurationSeconds != 0 {
+		ret = append(ret, fact{"Duration", time.Duration(e.DurationSeconds * float64(time.Second)).Round(time.Second).String()})
+	}
+	if e.Error != nil {
+		ret = append(ret, fact{"Error", e.Error.Message})
+	}
+	return ret
+}
+
+func color(e schema.DeployEvent) string {
+	switch e.Event {
+	case schema.DeploySucceeded:
+		return "2EB67D"
+	case schema.DeployFailed:
+		return "E01E5A"
+	}
+	return "439FE0"
+}
+
+func slackPayload(e schema.DeployEvent) interface{} {
+	type field struct {
+		Title string `json:"title"`
+		Value string `json:"value"`
+		Short bool   `json:"short"`
+	}
+	type attachment struct {
+		Color    string  `json:"color"`
+		Fallback string  `json:"fallback"`
+		Fields   []field `json:"fields"`
+		Ts       int64   `json:"ts"`
+	}
+	fields := make([]field, 0, 7)
+	for _, f := range facts(e) {
+		fields = append(fields, field{
+			Title: f.name,
+			Value: f.value,
+			Short: f.name != "Error",
+		})
+	}
+	return struct {
+		Text        string       `json:"text"`
+		Attachments []attachment `json:"attachments"`
+	}{
+		Text: title(e),
+		Attachments: []attachment{
+			{
+				Color:    "#" + color(e),
+				Fallback: title(e),
+				Fields:   fields,
+				Ts:       e.Time.Unix(),
+			},
+		},
+	}
+}
+
+func teamsPayload(e schema.DeployEvent) interface{} {
+	type teamsFact struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	type section struct {
+		Facts []teamsFact `json:"facts"`
+	}
+	teamsFacts := make([]teamsFact, 0, 7)
+	for _, f := range facts(e) {
+		teamsFacts = append(teamsFacts, teamsFact{
+			Name:  f.name,
+			Value: f.value,
+		})
+	}
+	return struct {
+		Type       string    `json:"@type"`
+		Context    string    `json:"@context"`
+		ThemeColor string    `json:"themeColor"`
+		Summary    string    `json:"summary"`
+		Title      string    `json:"title"`
+		Sections   []section `json:"sections"`
+	}{
+		Type:       "MessageCard",
+		Context:    "https://schema.org/extensions",
+		ThemeColor: color(e),
+		Summary:    title(e),
+		Title:      title(e),
+		Sections:   []section{{Facts: teamsFacts}},
+	}
+}
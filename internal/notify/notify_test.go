@@ -0,0 +1,278 @@
+package notify
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cep21/cfmanage/internal/logger"
+	"github.com/cep21/cfmanage/internal/schema"
+	"github.com/pkg/errors"
+)
+
+func testEvent() schema.DeployEvent {
+	return schema.DeployEvent{
+		Header:    schema.NewHeader("deployEvent"),
+		Event:     schema.DeployFailed,
+		StackName: "infra-canary",
+		AccountID: "123456789012",
+		Region:    "us-west-2",
+		Source:    "execute",
+		User:      "jack@laptop",
+		Changes: schema.ChangeSummary{
+			Total:  2,
+			Add:    1,
+			Modify: 1,
+		},
+		Time:            time.Unix(1500000000, 0),
+		DurationSeconds: 61,
+		Error:           schema.NewError(errors.New("stack rolled back")),
+	}
+}
+
+// recorder is a webhook answering each post with the next of its statuses, then 200
+type recorder struct {
+	mu       sync.Mutex
+	statuses []int
+	bodies   [][]byte
+}
+
+func (r *recorder) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, _ := ioutil.ReadAll(req.Body)
+	r.bodies = append(r.bodies, b)
+	if len(r.statuses) == 0 {
+		return
+	}
+	rw.WriteHeader(r.statuses[0])
+	r.statuses = r.statuses[1:]
+}
+
+func (r *recorder) posts() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.bodies)
+}
+
+func testNotifier(webhooks ...Webhook) *Notifier {
+	return &Notifier{
+		Webhooks: webhooks,
+		Logger: &logger.Logger{
+			Logger: log.New(ioutil.Discard, "", 0),
+		},
+	}
+}
+
+func TestPayloads(t *testing.T) {
+	generic := &recorder{}
+	slack := &recorder{}
+	teams := &recorder{}
+	genericSrv := httptest.NewServer(generic)
+	defer genericSrv.Close()
+	slackSrv := httptest.NewServer(slack)
+	defer slackSrv.Close()
+	teamsSrv := httptest.NewServer(teams)
+	defer teamsSrv.Close()
+	n := testNotifier(
+		Webhook{URL: genericSrv.URL},
+		Webhook{URL: slackSrv.URL, Format: FormatSlack},
+		Webhook{URL: teamsSrv.URL, Format: FormatTeams},
+	)
+	if err := n.Notify(testEvent()); err != nil {
+		t.Fatal(err)
+	}
+
+	var gotGeneric schema.DeployEvent
+	if err := json.Unmarshal(generic.bodies[0], &gotGeneric); err != nil {
+		t.Fatal(err)
+	}
+	if gotGeneric.StackName != "infra-canary" || gotGeneric.Event != schema.DeployFailed || gotGeneric.Changes.Total != 2 {
+		t.Fatalf("generic payload %s", generic.bodies[0])
+	}
+
+	var gotSlack struct {
+		Text        string `json:"text"`
+		Attachments []struct {
+			Color  string `json:"color"`
+			Fields []struct {
+				Title string `json:"title"`
+				Value string `json:"value"`
+			} `json:"fields"`
+			Ts int64 `json:"ts"`
+		} `json:"attachments"`
+	}
+	if err := json.Unmarshal(slack.bodies[0], &gotSlack); err != nil {
+		t.Fatal(err)
+	}
+	if gotSlack.Text != "execute of infra-canary failed" || len(gotSlack.Attachments) != 1 {
+		t.Fatalf("slack payload %s", slack.bodies[0])
+	}
+	if a := gotSlack.Attachments[0]; a.Color != "#E01E5A" || a.Ts != 1500000000 {
+		t.Fatalf("slack attachment %s", slack.bodies[0])
+	}
+	slackFields := map[string]string{}
+	for _, f := range gotSlack.Attachments[0].Fields {
+		slackFields[f.Title] = f.Value
+	}
+	if slackFields["Changes"] != "2 (1 add, 1 modify, 0 remove)" || slackFields["Duration"] != "1m1s" || slackFields["Error"] != "stack rolled back" {
+		t.Fatalf("slack fields %v", slackFields)
+	}
+
+	var gotTeams struct {
+		Type       string `json:"@type"`
+		ThemeColor string `json:"themeColor"`
+		Title      string `json:"title"`
+		Sections   []struct {
+			Facts []struct {
+				Name  string `json:"name"`
+				Value string `json:"value"`
+			} `json:"facts"`
+		} `json:"sections"`
+	}
+	if err := json.Unmarshal(teams.bodies[0], &gotTeams); err != nil {
+		t.Fatal(err)
+	}
+	if gotTeams.Type != "MessageCard" || gotTeams.ThemeColor != "E01E5A" || gotTeams.Title != "execute of infra-canary failed" || len(gotTeams.Sections) != 1 {
+		t.Fatalf("teams payload %s", teams.bodies[0])
+	}
+	teamsFacts := map[string]string{}
+	for _, f := range gotTeams.Sections[0].Facts {
+		teamsFacts[f.Name] = f.Value
+	}
+	if teamsFacts["Stack"] != "infra-canary" || teamsFacts["Run by"] != "jack@laptop" || teamsFacts["Error"] != "stack rolled back" {
+		t.Fatalf("teams facts %v", teamsFacts)
+	}
+}
+
+func TestUnwantedEventsAreNotPosted(t *testing.T) {
+	r := &recorder{}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	n := testNotifier(Webhook{URL: srv.URL, Events: []string{schema.DeploySucceeded}})
+	if err := n.Notify(testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	if r.posts() != 0 {
+		t.Fatalf("posted %d unwanted events", r.posts())
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		posts    int
+		fails    bool
+	}{
+		{name: "too many requests", statuses: []int{http.StatusTooManyRequests}, posts: 2},
+		{name: "server error", statuses: []int{http.StatusBadGateway}, posts: 2},
+		{name: "client error", statuses: []int{http.StatusNotFound}, posts: 1, fails: true},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			r := &recorder{statuses: tc.statuses}
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+			n := testNotifier(Webhook{URL: srv.URL})
+			n.Retries = 1
+			err := n.Notify(testEvent())
+			if (err != nil) != tc.fails {
+				t.Fatalf("error %v, want failure %t", err, tc.fails)
+			}
+			if r.posts() != tc.posts {
+				t.Fatalf("posted %d times, want %d", r.posts(), tc.posts)
+			}
+		})
+	}
+}
+
+func TestTimeoutBoundsRetries(t *testing.T) {
+	r := &recorder{statuses: []int{500, 500, 500, 500}}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	n := testNotifier(Webhook{URL: srv.URL})
+	n.Retries = 3
+	n.Timeout = time.Millisecond * 100
+	start := time.Now()
+	err := n.Notify(testEvent())
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if took := time.Since(start); took > time.Millisecond*900 {
+		t.Fatalf("notify took %s despite a timeout of %s", took, n.Timeout)
+	}
+	if r.posts() != 1 {
+		t.Fatalf("posted %d times, want 1 before the timeout", r.posts())
+	}
+}
+
+func TestTimeoutBoundsSlowWebhooks(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+	n := testNotifier(Webhook{URL: srv.URL})
+	n.Timeout = time.Millisecond * 100
+	start := time.Now()
+	if err := n.Notify(testEvent()); err == nil {
+		t.Fatal("expected an error")
+	}
+	if took := time.Since(start); took > time.Millisecond*900 {
+		t.Fatalf("notify took %s despite a timeout of %s", took, n.Timeout)
+	}
+}
+
+func TestErrorsRedactSecretPath(t *testing.T) {
+	r := &recorder{statuses: []int{http.StatusForbidden}}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	n := testNotifier(Webhook{URL: srv.URL + "/services/T000/B000/secret-token", Format: FormatSlack})
+	err := n.Notify(testEvent())
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if strings.Contains(err.Error(), "secret-token") || strings.Contains(err.Error(), "/services") {
+		t.Fatalf("error %q leaks the webhook path", err)
+	}
+	if !strings.Contains(err.Error(), srv.URL+"/...") {
+		t.Fatalf("error %q does not name the webhook host", err)
+	}
+}
+
+func TestTransportErrorsRedactSecretPath(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL + "/services/T000/B000/secret-token"
+	srv.Close()
+	n := testNotifier(Webhook{URL: url, Format: FormatSlack})
+	err := n.Notify(testEvent())
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if strings.Contains(err.Error(), "secret-token") {
+		t.Fatalf("error %q leaks the webhook path", err)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := map[string]string{
+		"https://hooks.slack.com/services/T/B/secret": "https://hooks.slack.com/...",
+		"https://example.com":                         "https://example.com",
+		"not a url":                                   "not a url",
+	}
+	for in, want := range tests {
+		if got := redact(in); got != want {
+			t.Errorf("redact(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
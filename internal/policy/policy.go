@@ -0,0 +1,261 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+)
+
+// Levels of a Rule
+const (
+	// LevelBlock fails the command unless the violation is overridden
+	LevelBlock = "block"
+	// LevelWarn only shows the violation
+	LevelWarn = "warn"
+)
+
+// Set is every rule of a project
+type Set struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Rule is one guardrail.  Each check that is set must pass.
+type Rule struct {
+	Name string `json:"name"`
+	// Stacks limits the rule to stacks whose name matches one of these globs.  Empty applies it to every stack.
+	Stacks []string `json:"stacks"`
+	// Level is block (the default) or warn
+	Level string `json:"level"`
+	// Deny fails changes that match it
+	Deny *Match `json:"deny"`
+	// RequireTags are tag keys every stack must carry
+	RequireTags []string `json:"requireTags"`
+	// MaxChanges, if not zero, is the most resource changes a single deploy may make
+	MaxChanges int `json:"maxChanges"`
+	// DenyAutoConfirm fails deploys that skip the confirmation prompt
+	DenyAutoConfirm bool `json:"denyAutoConfirm"`
+}
+
+// Match selects resource changes.  Every field that is set must match.
+type Match struct {
+	// Action is Add, Modify or Remove
+	Action string `json:"action"`
+	// Replacement is True, False or Conditional
+	Replacement string `json:"replacement"`
+	// ResourceTypes are globs such as AWS::RDS::*
+	ResourceTypes []string `json:"resourceTypes"`
+	// Tags are tag keys: the resource must carry one of them.  Only resources that already exist have tags.
+	Tags []string `json:"tags"`
+}
+
+// Input is what a Set is evaluated against
+type Input struct {
+	StackName string
+	Changes   []*cloudformation.Change
+	// Tags are the tags of the stack
+	Tags []*cloudformation.Tag
+	// ResourceTags are the tags of existing resources, by logical ID
+	ResourceTags map[string]map[string]string
+	AutoConfirm  bool
+}
+
+// Violation is a rule that did not pass
+type Violation struct {
+	Rule    string
+	Level   string
+	Message string
+}
+
+// Violations is every rule that did not pass
+type Violations []Violation
+
+// Blocking are the violations that fail the command
+func (v Violations) Blocking() Violations {
+	var ret Violations
+	for _, vi := range v {
+		if vi.Level == LevelBlock {
+			ret = append(ret, vi)
+		}
+	}
+	return ret
+}
+
+func (v Violations) String() string {
+	ret := make([]string, 0, len(v))
+	for _, vi := range v {
+		ret = append(ret, vi.Rule+": "+vi.Message)
+	}
+	return strings.Join(ret, "; ")
+}
+
+// Load reads a Set from a JSON file.  A file that does not exist is an empty Set.
+func Load(filename string) (*Set, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Set{}, nil
+		}
+		return nil, errors.Wrapf(err, "unable to open policy file %s", filename)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	var ret Set
+	if err := json.NewDecoder(f).Decode(&ret); err != nil {
+		return nil, errors.Wrapf(err, "invalid policy file %s", filename)
+	}
+	for i := range ret.Rules {
+		if err := ret.Rules[i].validate(); err != nil {
+			return nil, errors.Wrapf(err, "invalid policy file %s", filename)
+		}
+	}
+	return &ret, nil
+}
+
+func (r *Rule) validate() error {
+	if r.Name == "" {
+		return errors.New("every rule needs a name")
+	}
+	switch r.Level {
+	case "":
+		r.Level = LevelBlock
+	case LevelBlock, LevelWarn:
+	default:
+		return errors.Errorf("rule %s has unknown level %s", r.Name, r.Level)
+	}
+	for _, g := range r.Stacks {
+		if _, err := path.Match(g, ""); err != nil {
+			return errors.Wrapf(err, "rule %s has invalid stack glob %s", r.Name, g)
+		}
+	}
+	if r.Deny != nil {
+		for _, g := range r.Deny.ResourceTypes {
+			if _, err := path.Match(g, ""); err != nil {
+				return errors.Wrapf(err, "rule %s has invalid resource type glob %s", r.Name, g)
+			}
+		}
+	}
+	return nil
+}
+
+// ResourceTagKeys are the tag keys of existing resources that evaluating the Set for stackName looks at
+func (s *Set) ResourceTagKeys(stackName string) []string {
+	var ret []string
+	for _, r := range s.Rules {
+		if r.appliesTo(stackName) && r.Deny != nil {
+			ret = append(ret, r.Deny.Tags...)
+		}
+	}
+	return ret
+}
+
+// Evaluate checks every rule that applies to the input's stack
+func (s *Set) Evaluate(in Input) Violations {
+	var ret Violations
+	for _, r := range s.Rules {
+		if !r.appliesTo(in.StackName) {
+			continue
+		}
+		for _, msg := range r.check(in) {
+			ret = append(ret, Violation{
+				Rule:    r.Name,
+				Level:   r.Level,
+				Message: msg,
+			})
+		}
+	}
+	return ret
+}
+
+func globMatches(globs []string, s string) bool {
+	for _, g := range globs {
+		if ok, _ := path.Match(g, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) appliesTo(stackName string) bool {
+	return len(r.Stacks) == 0 || globMatches(r.Stacks, stackName)
+}
+
+func (r *Rule) check(in Input) []string {
+	var ret []string
+	if r.Deny != nil {
+		for _, c := range in.Changes {
+			if c.ResourceChange != nil && r.Deny.matches(c.ResourceChange, in.ResourceTags) {
+				ret = append(ret, describeChange(c.ResourceChange))
+			}
+		}
+	}
+	if len(r.RequireTags) != 0 {
+		var missing []string
+		for _, key := range r.RequireTags {
+			if !hasTag(in.Tags, key) {
+				missing = append(missing, key)
+			}
+		}
+		if len(missing) != 0 {
+			ret = append(ret, "missing stack tags "+strings.Join(missing, ", "))
+		}
+	}
+	if r.MaxChanges != 0 && len(in.Changes) > r.MaxChanges {
+		ret = append(ret, fmt.Sprintf("%d changes is more than the %d allowed", len(in.Changes), r.MaxChanges))
+	}
+	if r.DenyAutoConfirm && in.AutoConfirm {
+		ret = append(ret, "changes to this stack must be confirmed by hand")
+	}
+	return ret
+}
+
+func (m *Match) matches(c *cloudformation.ResourceChange, resourceTags map[string]map[string]string) bool {
+	if m.Action != "" && !strings.EqualFold(m.Action, emptyOnNil(c.Action)) {
+		return false
+	}
+	if m.Replacement != "" && !strings.EqualFold(m.Replacement, emptyOnNil(c.Replacement)) {
+		return false
+	}
+	if len(m.ResourceTypes) != 0 && !globMatches(m.ResourceTypes, emptyOnNil(c.ResourceType)) {
+		return false
+	}
+	if len(m.Tags) != 0 {
+		tags := resourceTags[emptyOnNil(c.LogicalResourceId)]
+		for _, key := range m.Tags {
+			if _, exists := tags[key]; exists {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func describeChange(c *cloudformation.ResourceChange) string {
+	ret := fmt.Sprintf("%s %s (%s)", emptyOnNil(c.Action), emptyOnNil(c.LogicalResourceId), emptyOnNil(c.ResourceType))
+	if emptyOnNil(c.Replacement) == "True" {
+		ret += " requires replacement"
+	}
+	return ret
+}
+
+func hasTag(tags []*cloudformation.Tag, key string) bool {
+	for _, t := range tags {
+		if t.Key != nil && *t.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func emptyOnNil(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
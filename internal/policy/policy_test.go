@@ -0,0 +1,234 @@
+package policy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+func testChange(action string, logicalID string, resourceType string, replacement string) *cloudformation.Change {
+	return &cloudformation.Change{
+		ResourceChange: &cloudformation.ResourceChange{
+			Action:            aws.String(action),
+			LogicalResourceId: aws.String(logicalID),
+			ResourceType:      aws.String(resourceType),
+			Replacement:       aws.String(replacement),
+		},
+	}
+}
+
+func testInput() Input {
+	return Input{
+		StackName: "infra-prod",
+		Changes: []*cloudformation.Change{
+			testChange("Add", "Topic", "AWS::SNS::Topic", ""),
+			testChange("Modify", "Database", "AWS::RDS::DBInstance", "True"),
+			testChange("Remove", "Bucket", "AWS::S3::Bucket", ""),
+		},
+		Tags: []*cloudformation.Tag{
+			{Key: aws.String("team"), Value: aws.String("infra")},
+		},
+		ResourceTags: map[string]map[string]string{
+			"Bucket": {"protected": "true"},
+		},
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  Rule
+		input func(in *Input)
+		want  []string
+	}{
+		{
+			name: "deny action",
+			rule: Rule{Deny: &Match{Action: "remove"}},
+			want: []string{"Remove Bucket (AWS::S3::Bucket)"},
+		},
+		{
+			name: "deny replacement",
+			rule: Rule{Deny: &Match{Replacement: "True"}},
+			want: []string{"Modify Database (AWS::RDS::DBInstance) requires replacement"},
+		},
+		{
+			name: "deny resource types",
+			rule: Rule{Deny: &Match{ResourceTypes: []string{"AWS::RDS::*", "AWS::SNS::Topic"}}},
+			want: []string{"Add Topic (AWS::SNS::Topic)", "Modify Database (AWS::RDS::DBInstance) requires replacement"},
+		},
+		{
+			name: "deny every field must match",
+			rule: Rule{Deny: &Match{Action: "Remove", ResourceTypes: []string{"AWS::RDS::*"}}},
+		},
+		{
+			name: "deny resource tags",
+			rule: Rule{Deny: &Match{Tags: []string{"protected", "critical"}}},
+			want: []string{"Remove Bucket (AWS::S3::Bucket)"},
+		},
+		{
+			name: "require tags",
+			rule: Rule{RequireTags: []string{"team", "owner", "costcenter"}},
+			want: []string{"missing stack tags owner, costcenter"},
+		},
+		{
+			name: "require tags present",
+			rule: Rule{RequireTags: []string{"team"}},
+		},
+		{
+			name: "max changes",
+			rule: Rule{MaxChanges: 2},
+			want: []string{"3 changes is more than the 2 allowed"},
+		},
+		{
+			name: "max changes at the limit",
+			rule: Rule{MaxChanges: 3},
+		},
+		{
+			name:  "deny auto confirm",
+			rule:  Rule{DenyAutoConfirm: true},
+			input: func(in *Input) { in.AutoConfirm = true },
+			want:  []string{"changes to this stack must be confirmed by hand"},
+		},
+		{
+			name: "deny auto confirm when confirming by hand",
+			rule: Rule{DenyAutoConfirm: true},
+		},
+		{
+			name: "stacks glob matches",
+			rule: Rule{Stacks: []string{"*-staging", "*-prod"}, MaxChanges: 1},
+			want: []string{"3 changes is more than the 1 allowed"},
+		},
+		{
+			name: "stacks glob does not match",
+			rule: Rule{Stacks: []string{"*-staging"}, MaxChanges: 1},
+		},
+		{
+			name: "every check that is set",
+			rule: Rule{Deny: &Match{Action: "Remove"}, RequireTags: []string{"owner"}, MaxChanges: 1},
+			want: []string{"Remove Bucket (AWS::S3::Bucket)", "missing stack tags owner", "3 changes is more than the 1 allowed"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.rule.Name = "rule"
+			if err := tc.rule.validate(); err != nil {
+				t.Fatal(err)
+			}
+			in := testInput()
+			if tc.input != nil {
+				tc.input(&in)
+			}
+			set := &Set{Rules: []Rule{tc.rule}}
+			var got []string
+			for _, v := range set.Evaluate(in) {
+				if v.Rule != "rule" || v.Level != LevelBlock {
+					t.Fatalf("violation %v has the wrong rule or level", v)
+				}
+				got = append(got, v.Message)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("violations %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	set := &Set{Rules: []Rule{
+		{Name: "default", MaxChanges: 1},
+		{Name: "blocks", Level: LevelBlock, RequireTags: []string{"owner"}},
+		{Name: "warns", Level: LevelWarn, Deny: &Match{Action: "Remove"}},
+	}}
+	for i := range set.Rules {
+		if err := set.Rules[i].validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if set.Rules[0].Level != LevelBlock {
+		t.Fatalf("a rule without a level is %s, want %s", set.Rules[0].Level, LevelBlock)
+	}
+	violations := set.Evaluate(testInput())
+	if len(violations) != 3 {
+		t.Fatalf("%d violations, want 3: %v", len(violations), violations)
+	}
+	blocking := violations.Blocking()
+	want := "default: 3 changes is more than the 1 allowed; blocks: missing stack tags owner"
+	if got := blocking.String(); got != want {
+		t.Fatalf("blocking violations %q, want %q", got, want)
+	}
+
+	warnOnly := &Set{Rules: set.Rules[2:]}
+	if blocking := warnOnly.Evaluate(testInput()).Blocking(); len(blocking) != 0 {
+		t.Fatalf("warnings are blocking: %v", blocking)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		err  string
+	}{
+		{name: "no name", rule: Rule{MaxChanges: 1}, err: "every rule needs a name"},
+		{name: "unknown level", rule: Rule{Name: "r", Level: "error"}, err: "unknown level error"},
+		{name: "bad stack glob", rule: Rule{Name: "r", Stacks: []string{"infra-["}}, err: "invalid stack glob"},
+		{name: "bad resource type glob", rule: Rule{Name: "r", Deny: &Match{ResourceTypes: []string{"AWS::["}}}, err: "invalid resource type glob"},
+		{name: "valid", rule: Rule{Name: "r", Level: LevelWarn, Stacks: []string{"infra-*"}}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.rule.validate()
+			if tc.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("validate returned %v, want %s", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	set, err := Load(filepath.Join(dir, "missing.json"))
+	if err != nil || len(set.Rules) != 0 {
+		t.Fatalf("a missing file loaded %v (%v), want an empty set", set, err)
+	}
+
+	fname := filepath.Join(dir, "policies.json")
+	if err := ioutil.WriteFile(fname, []byte(`{"rules": [{"name": "no-deletes", "deny": {"action": "Remove"}}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	set, err = Load(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Rules) != 1 || set.Rules[0].Level != LevelBlock {
+		t.Fatalf("loaded %v, want one blocking rule", set.Rules)
+	}
+
+	if err := ioutil.WriteFile(fname, []byte(`{"rules": [{"deny": {"action": "Remove"}}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(fname); err == nil {
+		t.Fatal("loaded a rule without a name")
+	}
+}
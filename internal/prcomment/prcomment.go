@@ -0,0 +1,107 @@
+package prcomment
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v25/github"
+	"github.com/pkg/errors"
+)
+
+// NewClient is a GitHub client authenticated with token.  baseURL is the API of a GitHub Enterprise server, or any
+// server speaking the GitHub API.  Empty means github.com.
+func NewClient(baseURL string, token string) (*github.Client, error) {
+	httpClient := &http.Client{
+		Transport: &tokenTransport{
+			token: token,
+		},
+	}
+	if baseURL == "" {
+		return github.NewClient(httpClient), nil
+	}
+	ret, err := github.NewEnterpriseClient(baseURL, baseURL, httpClient)
+	return ret, errors.Wrapf(err, "invalid GitHub API URL %s", baseURL)
+}
+
+type tokenTransport struct {
+	token string
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.token != "" {
+		// RoundTrip must not modify the request it is given
+		req = req.WithContext(req.Context())
+		req.Header = cloneHeader(req.Header)
+		req.Header.Set("Authorization", "token "+t.token)
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func cloneHeader(h http.Header) http.Header {
+	ret := make(http.Header, len(h))
+	for k, v := range h {
+		ret[k] = append([]string(nil), v...)
+	}
+	return ret
+}
+
+// Commenter keeps a single comment on a pull request up to date, instead of adding a comment every run.  The comment
+// is found by a marker hidden in its body.
+type Commenter struct {
+	Client *github.Client
+	Owner  string
+	Repo   string
+	Number int
+	Marker string
+}
+
+// HiddenMarker is the HTML comment that identifies a comment as the one to update
+func HiddenMarker(marker string) string {
+	return "<!-- " + marker + " -->"
+}
+
+// Find returns the comment with the marker, or nil if there is none
+func (c *Commenter) Find(ctx context.Context) (*github.IssueComment, error) {
+	opts := &github.IssueListCommentsOptions{
+		ListOptions: github.ListOptions{
+			PerPage: 100,
+		},
+	}
+	for {
+		comments, resp, err := c.Client.Issues.ListComments(ctx, c.Owner, c.Repo, c.Number, opts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to list comments of %s/%s#%d", c.Owner, c.Repo, c.Number)
+		}
+		for _, comment := range comments {
+			if strings.Contains(comment.GetBody(), HiddenMarker(c.Marker)) {
+				return comment, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// Upsert updates the comment with the marker to body, or creates it.  It returns the comment and if it was created.
+func (c *Commenter) Upsert(ctx context.Context, body string) (*github.IssueComment, bool, error) {
+	if !strings.Contains(body, HiddenMarker(c.Marker)) {
+		body = HiddenMarker(c.Marker) + "\n" + body
+	}
+	existing, err := c.Find(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing != nil {
+		ret, _, err := c.Client.Issues.EditComment(ctx, c.Owner, c.Repo, existing.GetID(), &github.IssueComment{
+			Body: &body,
+		})
+		return ret, false, errors.Wrapf(err, "unable to update comment %d of %s/%s#%d", existing.GetID(), c.Owner, c.Repo, c.Number)
+	}
+	ret, _, err := c.Client.Issues.CreateComment(ctx, c.Owner, c.Repo, c.Number, &github.IssueComment{
+		Body: &body,
+	})
+	return ret, true, errors.Wrapf(err, "unable to comment on %s/%s#%d", c.Owner, c.Repo, c.Number)
+}
@@ -0,0 +1,174 @@
+package prcomment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeIssues serves the comments of pull request o/r#1, pageSize at a time
+type fakeIssues struct {
+	t        *testing.T
+	mu       sync.Mutex
+	pageSize int
+	comments []map[string]interface{}
+	lists    int
+	creates  int
+	edits    int
+}
+
+func (f *fakeIssues) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if got := req.Header.Get("Authorization"); got != "token secret" {
+		f.t.Errorf("Authorization header %q", got)
+	}
+	switch {
+	case req.Method == http.MethodGet && req.URL.Path == "/repos/o/r/issues/1/comments":
+		f.lists++
+		page := 1
+		if p := req.URL.Query().Get("page"); p != "" {
+			page, _ = strconv.Atoi(p)
+		}
+		start := (page - 1) * f.pageSize
+		end := start + f.pageSize
+		if end < len(f.comments) {
+			next := *req.URL
+			q := next.Query()
+			q.Set("page", strconv.Itoa(page+1))
+			next.RawQuery = q.Encode()
+			rw.Header().Set("Link", fmt.Sprintf(`<http://%s%s>; rel="next"`, req.Host, next.RequestURI()))
+		} else {
+			end = len(f.comments)
+		}
+		if start > end {
+			start = end
+		}
+		f.write(rw, f.comments[start:end])
+	case req.Method == http.MethodPost && req.URL.Path == "/repos/o/r/issues/1/comments":
+		f.creates++
+		comment := f.read(req)
+		comment["id"] = len(f.comments) + 1
+		f.comments = append(f.comments, comment)
+		rw.WriteHeader(http.StatusCreated)
+		f.write(rw, comment)
+	case req.Method == http.MethodPatch && strings.HasPrefix(req.URL.Path, "/repos/o/r/issues/comments/"):
+		f.edits++
+		id, err := strconv.Atoi(strings.TrimPrefix(req.URL.Path, "/repos/o/r/issues/comments/"))
+		if err != nil || id < 1 || id > len(f.comments) {
+			http.NotFound(rw, req)
+			return
+		}
+		f.comments[id-1]["body"] = f.read(req)["body"]
+		f.write(rw, f.comments[id-1])
+	default:
+		f.t.Errorf("unexpected request %s %s", req.Method, req.URL)
+		http.NotFound(rw, req)
+	}
+}
+
+func (f *fakeIssues) read(req *http.Request) map[string]interface{} {
+	ret := map[string]interface{}{}
+	if err := json.NewDecoder(req.Body).Decode(&ret); err != nil {
+		f.t.Errorf("invalid request body: %s", err)
+	}
+	return ret
+}
+
+func (f *fakeIssues) write(rw http.ResponseWriter, v interface{}) {
+	if err := json.NewEncoder(rw).Encode(v); err != nil {
+		f.t.Errorf("unable to write response: %s", err)
+	}
+}
+
+// newCommenter comments through f.  Call the returned func to stop f's server.
+func newCommenter(t *testing.T, f *fakeIssues) (*Commenter, func()) {
+	srv := httptest.NewServer(f)
+	client, err := NewClient(srv.URL+"/", "secret")
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	return &Commenter{
+		Client: client,
+		Owner:  "o",
+		Repo:   "r",
+		Number: 1,
+		Marker: "cfmanage report",
+	}, srv.Close
+}
+
+func TestUpsertCreatesThenEdits(t *testing.T) {
+	f := &fakeIssues{t: t, pageSize: 100}
+	c, closeServer := newCommenter(t, f)
+	defer closeServer()
+	ctx := context.Background()
+
+	comment, created, err := c.Upsert(ctx, "first run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created {
+		t.Fatal("first run did not create a comment")
+	}
+	if !strings.Contains(comment.GetBody(), HiddenMarker(c.Marker)) {
+		t.Fatalf("created comment %q has no hidden marker", comment.GetBody())
+	}
+
+	comment, created, err = c.Upsert(ctx, "second run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created {
+		t.Fatal("second run created a comment instead of editing the first")
+	}
+	if comment.GetID() != 1 || !strings.Contains(comment.GetBody(), "second run") {
+		t.Fatalf("second run returned comment %d %q", comment.GetID(), comment.GetBody())
+	}
+	if f.creates != 1 || f.edits != 1 || len(f.comments) != 1 {
+		t.Fatalf("%d creates, %d edits, %d comments: want 1 of each", f.creates, f.edits, len(f.comments))
+	}
+	if body := f.comments[0]["body"]; body != HiddenMarker(c.Marker)+"\nsecond run" {
+		t.Fatalf("comment body is %q", body)
+	}
+}
+
+func TestFindPaginates(t *testing.T) {
+	f := &fakeIssues{t: t, pageSize: 2}
+	for i := 1; i <= 4; i++ {
+		f.comments = append(f.comments, map[string]interface{}{"id": i, "body": fmt.Sprintf("comment %d", i)})
+	}
+	f.comments = append(f.comments, map[string]interface{}{"id": 5, "body": HiddenMarker("cfmanage report") + "\nold report"})
+	c, closeServer := newCommenter(t, f)
+	defer closeServer()
+
+	comment, err := c.Find(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comment.GetID() != 5 {
+		t.Fatalf("found comment %d, want 5", comment.GetID())
+	}
+	if f.lists != 3 {
+		t.Fatalf("listed %d pages, want 3", f.lists)
+	}
+
+	c.Marker = "some other report"
+	f.lists = 0
+	comment, err = c.Find(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comment != nil {
+		t.Fatalf("found comment %d without the marker", comment.GetID())
+	}
+	if f.lists != 3 {
+		t.Fatalf("listed %d pages, want 3", f.lists)
+	}
+}
@@ -0,0 +1,160 @@
+package schema
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const draft = "http://json-schema.org/draft-07/schema#"
+
+// JSONSchema describes the output of kind as a JSON Schema
+func JSONSchema(kind string) (map[string]interface{}, error) {
+	v, exists := Outputs()[kind]
+	if !exists {
+		return nil, errors.Errorf("unknown output %s: expected one of %s", kind, strings.Join(Kinds(), ", "))
+	}
+	g := generator{
+		definitions: make(map[string]interface{}),
+	}
+	ret := g.output(kind, reflect.TypeOf(v))
+	ret["$schema"] = draft
+	ret["title"] = "cfmanage " + kind + " output, schema version " + Version
+	ret["definitions"] = g.definitions
+	return ret, nil
+}
+
+// AllJSONSchema describes every output as one JSON Schema, telling them apart by kind
+func AllJSONSchema() map[string]interface{} {
+	g := generator{
+		definitions: make(map[string]interface{}),
+	}
+	outputs := Outputs()
+	oneOf := make([]interface{}, 0, len(outputs))
+	for _, kind := range Kinds() {
+		oneOf = append(oneOf, g.output(kind, reflect.TypeOf(outputs[kind])))
+	}
+	return map[string]interface{}{
+		"$schema":     draft,
+		"title":       "cfmanage output, schema version " + Version,
+		"oneOf":       oneOf,
+		"definitions": g.definitions,
+	}
+}
+
+// Kinds lists the kinds of output, sorted
+func Kinds() []string {
+	outputs := Outputs()
+	ret := make([]string, 0, len(outputs))
+	for kind := range outputs {
+		ret = append(ret, kind)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+type generator struct {
+	definitions map[string]interface{}
+}
+
+func (g *generator) output(kind string, t reflect.Type) map[string]interface{} {
+	return map[string]interface{}{
+		"allOf": []interface{}{
+			g.schema(t),
+			map[string]interface{}{
+				"properties": map[string]interface{}{
+					"schemaVersion": map[string]interface{}{"const": Version},
+					"kind":          map[string]interface{}{"const": kind},
+				},
+			},
+		},
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *generator) schema(t reflect.Type) map[string]interface{} {
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if _, exists := g.definitions[t.Name()]; !exists {
+			// Reserve the name first, so recursive types terminate
+			g.definitions[t.Name()] = nil
+			def := map[string]interface{}{
+				"type": "object",
+			}
+			properties := make(map[string]interface{})
+			var required []string
+			g.fields(t, properties, &required)
+			def["properties"] = properties
+			if len(required) != 0 {
+				sort.Strings(required)
+				def["required"] = required
+			}
+			g.definitions[t.Name()] = def
+		}
+		return map[string]interface{}{"$ref": "#/definitions/" + t.Name()}
+	}
+	return map[string]interface{}{}
+}
+
+// fields adds the JSON properties of a struct, flattening embedded structs like encoding/json does
+func (g *generator) fields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		name := parts[0]
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			g.fields(f.Type, properties, required)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		prop := g.schema(f.Type)
+		if _, isRef := prop["$ref"]; isRef && f.Tag.Get("description") != "" {
+			// Siblings of $ref are ignored, so wrap it
+			prop = map[string]interface{}{"allOf": []interface{}{prop}}
+		}
+		if desc := f.Tag.Get("description"); desc != "" {
+			prop["description"] = desc
+		}
+		if enum := f.Tag.Get("enum"); enum != "" {
+			prop["enum"] = strings.Split(enum, ",")
+		}
+		properties[name] = prop
+		omitEmpty := false
+		for _, opt := range parts[1:] {
+			omitEmpty = omitEmpty || opt == "omitempty"
+		}
+		if !omitEmpty {
+			*required = append(*required, name)
+		}
+	}
+}
@@ -0,0 +1,493 @@
+// Package schema defines the machine readable output of every command.  The JSON of these types is a contract: fields
+// are only added within a schema version, and removing or changing one bumps Version.
+package schema
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+)
+
+// Version is the schemaVersion of every output
+const Version = "1"
+
+// Header starts every output document
+type Header struct {
+	SchemaVersion string `json:"schemaVersion" description:"Version of this output's schema"`
+	Kind          string `json:"kind" description:"Which output this document is"`
+}
+
+// NewHeader is the header of an output of kind
+func NewHeader(kind string) Header {
+	return Header{
+		SchemaVersion: Version,
+		Kind:          kind,
+	}
+}
+
+// Error is a failure reported inside an output
+type Error struct {
+	Message string `json:"message" description:"Human readable description of the error"`
+	Code    string `json:"code,omitempty" description:"AWS error code, if AWS returned the error"`
+}
+
+// NewError describes err, or returns nil if err is nil
+func NewError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	ret := &Error{
+		Message: err.Error(),
+	}
+	if aerr, ok := errors.Cause(err).(awserr.Error); ok {
+		ret.Code = aerr.Code()
+	}
+	return ret
+}
+
+// Stack is the state of one stack and its params file
+type Stack struct {
+	Template        string          `json:"template" description:"Template directory of the stack"`
+	ParamsFile      string          `json:"paramsFile" description:"Params file the stack is deployed from"`
+	StackName       string          `json:"stackName,omitempty"`
+	StackID         string          `json:"stackId,omitempty" description:"Empty if the stack does not exist"`
+	StackStatus     string          `json:"stackStatus,omitempty" description:"CloudFormation status of the stack.  Empty if it does not exist"`
+	AccountID       string          `json:"accountId,omitempty"`
+	Region          string          `json:"region,omitempty"`
+	Description     string          `json:"description,omitempty"`
+	LastUpdated     *time.Time      `json:"lastUpdated,omitempty" description:"When the stack was last updated, or created if it never was"`
+	ChangesetStatus string          `json:"changesetStatus,omitempty" description:"What status found out about pending changes"`
+	ChangeCount     *int            `json:"changeCount,omitempty" description:"Number of pending changes.  Absent if no changeset was made"`
+	Category        string          `json:"category" description:"in sync, changed or error" enum:"in sync,changed,error"`
+	LockedBy        string          `json:"lockedBy,omitempty" description:"Owner of the stack's deploy lock, if it is locked"`
+	ComputedAt      *time.Time      `json:"computedAt,omitempty" description:"When the changeset was created, which may be earlier than this run if it was cached"`
+	Error           *Error          `json:"error,omitempty" description:"Why the state of the stack could not be found"`
+	StackSet        bool            `json:"stackSet,omitempty" description:"True if the params file describes a stack set rather than a stack"`
+	Instances       []StackInstance `json:"instances,omitempty" description:"Instances of a stack set, and the ones its params file wants that are missing"`
+	Target          string          `json:"target,omitempty" description:"Which target of the params file this is, for params files with targets"`
+}
+
+// StackInstance is an instance of a stack set in an account and region
+type StackInstance struct {
+	Account              string `json:"account" description:"Empty for a missing instance of a service managed stack set"`
+	OrganizationalUnitID string `json:"organizationalUnitId,omitempty" description:"Organizational unit of an instance of a service managed stack set"`
+	Region               string `json:"region"`
+	StackID              string `json:"stackId,omitempty"`
+	Status               string `json:"status" enum:"CURRENT,OUTDATED,INOPERABLE,MISSING"`
+	StatusReason         string `json:"statusReason,omitempty"`
+	Removed              bool   `json:"removed,omitempty" description:"The params file no longer lists the account or region of this instance, so execute deletes it"`
+	DriftStatus          string `json:"driftStatus,omitempty" enum:"DRIFTED,IN_SYNC,UNKNOWN,NOT_CHECKED" description:"Set once drift detection ran, as inspect --detect-drift does"`
+}
+
+// StackLine is a Stack written on its own, as a line of ndjson status output
+type StackLine struct {
+	Header
+	Stack
+}
+
+// Summary counts the stacks of a status
+type Summary struct {
+	Stacks      int `json:"stacks"`
+	InSync      int `json:"inSync"`
+	Changed     int `json:"changed"`
+	Errors      int `json:"errors"`
+	FailedState int `json:"failedState" description:"Stacks CloudFormation left in a failed state"`
+}
+
+// Status is the output of the status command
+type Status struct {
+	Header
+	Stacks  []Stack `json:"stacks"`
+	Summary Summary `json:"summary"`
+}
+
+// Parameter is a key and value of a stack
+type Parameter struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// ChangeDetail is why a resource changes
+type ChangeDetail struct {
+	Attribute          string `json:"attribute,omitempty" description:"Which part of the resource changes, like Properties or Tags"`
+	Name               string `json:"name,omitempty" description:"Name of the changed property"`
+	RequiresRecreation string `json:"requiresRecreation,omitempty" enum:"Never,Conditionally,Always"`
+	ChangeSource       string `json:"changeSource,omitempty"`
+	CausingEntity      string `json:"causingEntity,omitempty"`
+	Evaluation         string `json:"evaluation,omitempty" enum:"Static,Dynamic"`
+}
+
+// Change is a resource change of a changeset
+type Change struct {
+	Action       string         `json:"action" enum:"Add,Modify,Remove,Import"`
+	LogicalID    string         `json:"logicalId"`
+	PhysicalID   string         `json:"physicalId,omitempty"`
+	ResourceType string         `json:"resourceType"`
+	Replacement  string         `json:"replacement,omitempty" enum:"True,False,Conditional"`
+	Scope        []string       `json:"scope,omitempty"`
+	Details      []ChangeDetail `json:"details,omitempty"`
+}
+
+// NewChanges describes the changes of a changeset
+func NewChanges(changes []*cloudformation.Change) []Change {
+	ret := make([]Change, 0, len(changes))
+	for _, c := range changes {
+		rc := c.ResourceChange
+		if rc == nil {
+			continue
+		}
+		change := Change{
+			Action:       str(rc.Action),
+			LogicalID:    str(rc.LogicalResourceId),
+			PhysicalID:   str(rc.PhysicalResourceId),
+			ResourceType: str(rc.ResourceType),
+			Replacement:  str(rc.Replacement),
+		}
+		for _, s := range rc.Scope {
+			change.Scope = append(change.Scope, str(s))
+		}
+		for _, d := range rc.Details {
+			detail := ChangeDetail{
+				ChangeSource:  str(d.ChangeSource),
+				CausingEntity: str(d.CausingEntity),
+				Evaluation:    str(d.Evaluation),
+			}
+			if d.Target != nil {
+				detail.Attribute = str(d.Target.Attribute)
+				detail.Name = str(d.Target.Name)
+				detail.RequiresRecreation = str(d.Target.RequiresRecreation)
+			}
+			change.Details = append(change.Details, detail)
+		}
+		ret = append(ret, change)
+	}
+	return ret
+}
+
+// PolicyViolation is a guardrail policy a changeset breaks
+type PolicyViolation struct {
+	Rule    string `json:"rule"`
+	Level   string `json:"level" enum:"block,warn"`
+	Message string `json:"message"`
+}
+
+// DestructiveChange is a change that deletes or replaces a resource holding data
+type DestructiveChange struct {
+	LogicalID    string `json:"logicalId"`
+	PhysicalID   string `json:"physicalId,omitempty"`
+	ResourceType string `json:"resourceType"`
+	Reason       string `json:"reason"`
+}
+
+// Inspect is the output of the inspect command
+type Inspect struct {
+	Header
+	Stack              Stack               `json:"stack"`
+	Parameters         []Parameter         `json:"parameters"`
+	Outputs            []Parameter         `json:"outputs"`
+	Changes            []Change            `json:"changes"`
+	PolicyViolations   []PolicyViolation   `json:"policyViolations"`
+	DestructiveChanges []DestructiveChange `json:"destructiveChanges"`
+	StackSetChanges    []Parameter         `json:"stackSetChanges,omitempty" description:"Pending changes of a stack set, which has no changeset, keyed by stack set or account/region"`
+}
+
+// Report is the output of the report command
+type Report struct {
+	Header
+	Stacks         []Stack `json:"stacks"`
+	Summary        Summary `json:"summary"`
+	Markdown       string  `json:"markdown"`
+	CommentURL     string  `json:"commentUrl,omitempty" description:"Pull request comment the report was posted as"`
+	CommentCreated bool    `json:"commentCreated,omitempty" description:"True if the comment was new, rather than updated"`
+}
+
+// StackEvent is a CloudFormation event, streamed by execute, rollback, recover and watch
+type StackEvent struct {
+	Header
+	Time         *time.Time `json:"time,omitempty"`
+	StackName    string     `json:"stackName,omitempty"`
+	LogicalID    string     `json:"logicalId,omitempty"`
+	PhysicalID   string     `json:"physicalId,omitempty"`
+	ResourceType string     `json:"resourceType,omitempty"`
+	Status       string     `json:"status,omitempty"`
+	StatusReason string     `json:"statusReason,omitempty"`
+}
+
+// ChangeSummary counts the changes of a deploy
+type ChangeSummary struct {
+	Total        int `json:"total"`
+	Add          int `json:"add"`
+	Modify       int `json:"modify"`
+	Remove       int `json:"remove"`
+	Replacements int `json:"replacements"`
+}
+
+// NewChangeSummary counts changes
+func NewChangeSummary(changes []*cloudformation.Change) ChangeSummary {
+	ret := ChangeSummary{}
+	for _, c := range changes {
+		if c.ResourceChange == nil {
+			continue
+		}
+		ret.Total++
+		switch str(c.ResourceChange.Action) {
+		case cloudformation.ChangeActionAdd:
+			ret.Add++
+		case cloudformation.ChangeActionModify:
+			ret.Modify++
+		case cloudformation.ChangeActionRemove:
+			ret.Remove++
+		}
+		if str(c.ResourceChange.Replacement) == cloudformation.ReplacementTrue {
+			ret.Replacements++
+		}
+	}
+	return ret
+}
+
+// Events of a deploy
+const (
+	DeployStarted   = "started"
+	DeploySucceeded = "succeeded"
+	DeployFailed    = "failed"
+)
+
+// DeployEvent is posted to generic webhooks as a deploy starts and finishes
+type DeployEvent struct {
+	Header
+	Event           string        `json:"event" enum:"started,succeeded,failed"`
+	StackName       string        `json:"stackName"`
+	StackID         string        `json:"stackId,omitempty"`
+	AccountID       string        `json:"accountId,omitempty"`
+	Region          string        `json:"region,omitempty"`
+	ChangesetARN    string        `json:"changesetArn,omitempty"`
+	Source          string        `json:"source" description:"Command deploying the stack" enum:"execute,rollback,import,recover"`
+	User            string        `json:"user" description:"Who ran the deploy, as user@host"`
+	Changes         ChangeSummary `json:"changes"`
+	Time            time.Time     `json:"time"`
+	DurationSeconds float64       `json:"durationSeconds,omitempty" description:"How long the deploy ran.  Absent when it starts"`
+	Error           *Error        `json:"error,omitempty" description:"Why the deploy failed"`
+}
+
+// Phases of a deploy that run hooks
+const (
+	HookPreChangeset = "preChangeset"
+	HookPreExecute   = "preExecute"
+	HookPostSuccess  = "postSuccess"
+	HookPostFailure  = "postFailure"
+)
+
+// HookInput is written to the stdin of lifecycle hooks
+type HookInput struct {
+	Header
+	Hook         string            `json:"hook" enum:"preChangeset,preExecute,postSuccess,postFailure"`
+	StackName    string            `json:"stackName"`
+	StackID      string            `json:"stackId,omitempty" description:"Absent if the stack does not exist yet"`
+	AccountID    string            `json:"accountId,omitempty"`
+	Region       string            `json:"region,omitempty"`
+	ChangesetARN string            `json:"changesetArn,omitempty" description:"Absent before the changeset is created"`
+	Changes      ChangeSummary     `json:"changes"`
+	Outputs      map[string]string `json:"outputs" description:"Outputs of the stack.  After a deploy, its new outputs"`
+	Error        *Error            `json:"error,omitempty" description:"Why the deploy failed"`
+}
+
+// Output is a value a stack exports
+type Output struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Description string `json:"description,omitempty"`
+	ExportName  string `json:"exportName,omitempty"`
+}
+
+// StackOutputs are the outputs of a deployed stack
+type StackOutputs struct {
+	StackName string   `json:"stackName"`
+	StackID   string   `json:"stackId"`
+	AccountID string   `json:"accountId,omitempty"`
+	Region    string   `json:"region,omitempty"`
+	Outputs   []Output `json:"outputs"`
+}
+
+// OutputList is the outputs command, and the files execute writes to --outputs-dir
+type OutputList struct {
+	Header
+	Stacks []StackOutputs `json:"stacks"`
+}
+
+// Resource is a resource of a stack
+type Resource struct {
+	LogicalID    string     `json:"logicalId"`
+	PhysicalID   string     `json:"physicalId,omitempty"`
+	Type         string     `json:"type"`
+	Status       string     `json:"status"`
+	StatusReason string     `json:"statusReason,omitempty"`
+	DriftStatus  string     `json:"driftStatus,omitempty" enum:"DELETED,MODIFIED,IN_SYNC,NOT_CHECKED"`
+	LastUpdated  *time.Time `json:"lastUpdated,omitempty"`
+	ARN          string     `json:"arn,omitempty" description:"Absent if it could not be worked out from the physical ID"`
+	ConsoleURL   string     `json:"consoleUrl,omitempty" description:"The resource in the AWS console, or the resources of its stack"`
+}
+
+// Resources is the resources command
+type Resources struct {
+	Header
+	StackName string     `json:"stackName"`
+	StackID   string     `json:"stackId"`
+	AccountID string     `json:"accountId,omitempty"`
+	Region    string     `json:"region,omitempty"`
+	Resources []Resource `json:"resources"`
+}
+
+// Message is progress or a result described in words
+type Message struct {
+	Header
+	Message string `json:"message"`
+}
+
+// RolloutTarget is how deploying to one target of a params file went
+type RolloutTarget struct {
+	Target    string `json:"target"`
+	AccountID string `json:"accountId,omitempty"`
+	Region    string `json:"region,omitempty"`
+	StackName string `json:"stackName,omitempty"`
+	Result    string `json:"result" enum:"succeeded,failed,skipped"`
+	Error     *Error `json:"error,omitempty"`
+}
+
+// Rollout follows executing a params file with targets
+type Rollout struct {
+	Header
+	Strategy string          `json:"strategy" enum:"serial,parallel,canary"`
+	Targets  []RolloutTarget `json:"targets"`
+}
+
+// VersionInfo is the output of the version command
+type VersionInfo struct {
+	Header
+	CurrentVersion string `json:"currentVersion"`
+	LatestVersion  string `json:"latestVersion" description:"Latest released version, or unknown"`
+}
+
+// DeploymentChange is a resource change of a recorded deployment
+type DeploymentChange struct {
+	Action       string `json:"action"`
+	LogicalID    string `json:"logicalId"`
+	PhysicalID   string `json:"physicalId,omitempty"`
+	ResourceType string `json:"resourceType"`
+	Replacement  string `json:"replacement,omitempty"`
+}
+
+// DeploymentEvent is a stack event seen while a deployment ran
+type DeploymentEvent struct {
+	Time         time.Time `json:"time"`
+	LogicalID    string    `json:"logicalId"`
+	ResourceType string    `json:"resourceType"`
+	Status       string    `json:"status"`
+	Reason       string    `json:"reason,omitempty"`
+}
+
+// Deployment is a recorded deploy of a stack
+type Deployment struct {
+	ID               string             `json:"id"`
+	Key              string             `json:"key" description:"account/region/stack the deployment was to"`
+	StackName        string             `json:"stackName"`
+	StackID          string             `json:"stackId,omitempty"`
+	Time             time.Time          `json:"time"`
+	Source           string             `json:"source" enum:"execute,rollback,import,recover,baseline"`
+	Status           string             `json:"status" description:"CloudFormation status the stack was left in"`
+	Succeeded        bool               `json:"succeeded"`
+	User             string             `json:"user,omitempty"`
+	IdentityARN      string             `json:"identityArn,omitempty"`
+	GitSHA           string             `json:"gitSha,omitempty"`
+	GitDirty         bool               `json:"gitDirty,omitempty"`
+	ChangesetARN     string             `json:"changesetArn,omitempty"`
+	InputHash        string             `json:"inputHash,omitempty"`
+	StartTime        *time.Time         `json:"startTime,omitempty"`
+	EndTime          *time.Time         `json:"endTime,omitempty"`
+	Error            *Error             `json:"error,omitempty"`
+	Incomplete       string             `json:"incomplete,omitempty" description:"Why the record may not describe what the stack was left with.  Incomplete deployments are not rolled back to"`
+	RolledBackTo     string             `json:"rolledBackTo,omitempty" description:"ID of the deployment a rollback restored"`
+	PolicyOverride   string             `json:"policyOverride,omitempty"`
+	PolicyViolations []string           `json:"policyViolations,omitempty"`
+	Parameters       []Parameter        `json:"parameters"`
+	Changes          []DeploymentChange `json:"changes"`
+	Events           []DeploymentEvent  `json:"events"`
+}
+
+// History is the output of the history command
+type History struct {
+	Header
+	Deployments []Deployment `json:"deployments" description:"Oldest first"`
+}
+
+// DeploymentDetail is the output of history --show
+type DeploymentDetail struct {
+	Header
+	Deployment Deployment `json:"deployment"`
+}
+
+// CleanupItem is a leftover cleaned by gc
+type CleanupItem struct {
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+	Error       *Error `json:"error,omitempty" description:"Why the item could not be cleaned.  Absent if it was"`
+}
+
+// GC is the output of the gc command
+type GC struct {
+	Header
+	Cleaned []CleanupItem `json:"cleaned"`
+}
+
+// CleanupResult is a cleanup job run after a command
+type CleanupResult struct {
+	Name     string `json:"name"`
+	Attempts int    `json:"attempts"`
+	Error    *Error `json:"error,omitempty" description:"Why the job was left behind.  Absent if it succeeded"`
+}
+
+// CleanupReport is written to stderr after a command that ran cleanup jobs, so it never mixes with the command's output
+type CleanupReport struct {
+	Header
+	Cleaned    int             `json:"cleaned" description:"How many jobs succeeded"`
+	LeftBehind int             `json:"leftBehind" description:"How many jobs never succeeded.  gc retries them"`
+	Results    []CleanupResult `json:"results"`
+}
+
+// Outputs maps the kind of each output document to its type
+func Outputs() map[string]interface{} {
+	return map[string]interface{}{
+		"status":           Status{},
+		"stack":            StackLine{},
+		"inspect":          Inspect{},
+		"report":           Report{},
+		"stackEvent":       StackEvent{},
+		"message":          Message{},
+		"deployEvent":      DeployEvent{},
+		"hookInput":        HookInput{},
+		"outputs":          OutputList{},
+		"resources":        Resources{},
+		"rollout":          Rollout{},
+		"version":          VersionInfo{},
+		"history":          History{},
+		"deploymentDetail": DeploymentDetail{},
+		"gc":               GC{},
+		"cleanupReport":    CleanupReport{},
+	}
+}
+
+// TimePtr is nil for the zero time, so it is omitted
+func TimePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func str(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
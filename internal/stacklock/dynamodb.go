@@ -0,0 +1,159 @@
+package stacklock
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/pkg/errors"
+)
+
+// DynamoDBBackend keeps locks as items in a table whose string hash key is named LockKey.  Writes are conditional
+// expressions, so two hosts can never both hold the same lock.
+type DynamoDBBackend struct {
+	Client dynamodbiface.DynamoDBAPI
+	Table  string
+}
+
+var _ Backend = &DynamoDBBackend{}
+
+func isConditionFailed(err error) bool {
+	if ae, ok := errors.Cause(err).(awserr.Error); ok {
+		return ae.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+	}
+	return false
+}
+
+func unixString(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+func toItem(info Info) map[string]*dynamodb.AttributeValue {
+	ret := map[string]*dynamodb.AttributeValue{
+		"LockKey":   {S: aws.String(info.Key)},
+		"LockID":    {S: aws.String(info.ID)},
+		"Owner":     {S: aws.String(info.Owner)},
+		"Acquired":  {N: aws.String(unixString(info.Acquired))},
+		"ExpiresAt": {N: aws.String(unixString(info.ExpiresAt))},
+	}
+	// DynamoDB does not allow empty strings
+	if info.GitSHA != "" {
+		ret["GitSHA"] = &dynamodb.AttributeValue{S: aws.String(info.GitSHA)}
+	}
+	return ret
+}
+
+func attrString(item map[string]*dynamodb.AttributeValue, key string) string {
+	if v, exists := item[key]; exists && v.S != nil {
+		return *v.S
+	}
+	return ""
+}
+
+func attrTime(item map[string]*dynamodb.AttributeValue, key string) time.Time {
+	if v, exists := item[key]; exists && v.N != nil {
+		if sec, err := strconv.ParseInt(*v.N, 10, 64); err == nil {
+			return time.Unix(sec, 0).UTC()
+		}
+	}
+	return time.Time{}
+}
+
+func fromItem(item map[string]*dynamodb.AttributeValue) *Info {
+	return &Info{
+		Key:       attrString(item, "LockKey"),
+		ID:        attrString(item, "LockID"),
+		Owner:     attrString(item, "Owner"),
+		GitSHA:    attrString(item, "GitSHA"),
+		Acquired:  attrTime(item, "Acquired"),
+		ExpiresAt: attrTime(item, "ExpiresAt"),
+	}
+}
+
+func (d *DynamoDBBackend) Acquire(ctx context.Context, info Info) error {
+	_, err := d.Client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName:           &d.Table,
+		Item:                toItem(info),
+		ConditionExpression: aws.String("attribute_not_exists(LockKey) OR ExpiresAt < :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": {N: aws.String(unixString(time.Now()))},
+		},
+	})
+	if err == nil {
+		return nil
+	}
+	if !isConditionFailed(err) {
+		return errors.Wrapf(err, "unable to create lock for %s", info.Key)
+	}
+	current, err := d.Get(ctx, info.Key)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return d.Acquire(ctx, info)
+	}
+	return &LockedError{Holder: *current}
+}
+
+func (d *DynamoDBBackend) Refresh(ctx context.Context, info Info) error {
+	_, err := d.Client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName:           &d.Table,
+		Item:                toItem(info),
+		ConditionExpression: aws.String("LockID = :id"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":id": {S: aws.String(info.ID)},
+		},
+	})
+	if isConditionFailed(err) {
+		return &LostError{Key: info.Key}
+	}
+	return errors.Wrapf(err, "unable to refresh lock on %s", info.Key)
+}
+
+func (d *DynamoDBBackend) Release(ctx context.Context, info Info) error {
+	_, err := d.Client.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName: &d.Table,
+		Key: map[string]*dynamodb.AttributeValue{
+			"LockKey": {S: aws.String(info.Key)},
+		},
+		ConditionExpression: aws.String("LockID = :id"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":id": {S: aws.String(info.ID)},
+		},
+	})
+	if isConditionFailed(err) {
+		return nil
+	}
+	return errors.Wrapf(err, "unable to release lock on %s", info.Key)
+}
+
+func (d *DynamoDBBackend) Get(ctx context.Context, key string) (*Info, error) {
+	out, err := d.Client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:      &d.Table,
+		ConsistentRead: aws.Bool(true),
+		Key: map[string]*dynamodb.AttributeValue{
+			"LockKey": {S: aws.String(key)},
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read lock on %s", key)
+	}
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+	return fromItem(out.Item), nil
+}
+
+func (d *DynamoDBBackend) ForceRelease(ctx context.Context, key string) error {
+	_, err := d.Client.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName: &d.Table,
+		Key: map[string]*dynamodb.AttributeValue{
+			"LockKey": {S: aws.String(key)},
+		},
+	})
+	return errors.Wrapf(err, "unable to delete lock on %s", key)
+}
@@ -0,0 +1,78 @@
+package stacklock
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// fakeDynamoDB stores items in memory and evaluates the condition expressions the DynamoDB backend sends
+type fakeDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+	t     *testing.T
+	mu    sync.Mutex
+	items map[string]map[string]*dynamodb.AttributeValue
+}
+
+func (f *fakeDynamoDB) check(key string, condition *string, values map[string]*dynamodb.AttributeValue) error {
+	current, exists := f.items[key]
+	holds := true
+	switch aws.StringValue(condition) {
+	case "":
+	case "attribute_not_exists(LockKey) OR ExpiresAt < :now":
+		now, _ := strconv.ParseInt(aws.StringValue(values[":now"].N), 10, 64)
+		holds = !exists || attrTime(current, "ExpiresAt").Unix() < now
+	case "LockID = :id":
+		holds = exists && attrString(current, "LockID") == aws.StringValue(values[":id"].S)
+	default:
+		f.t.Fatalf("unexpected condition %s", aws.StringValue(condition))
+	}
+	if !holds {
+		return awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+	}
+	return nil
+}
+
+func (f *fakeDynamoDB) PutItemWithContext(_ aws.Context, in *dynamodb.PutItemInput, _ ...request.Option) (*dynamodb.PutItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := attrString(in.Item, "LockKey")
+	if err := f.check(key, in.ConditionExpression, in.ExpressionAttributeValues); err != nil {
+		return nil, err
+	}
+	f.items[key] = in.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDynamoDB) GetItemWithContext(_ aws.Context, in *dynamodb.GetItemInput, _ ...request.Option) (*dynamodb.GetItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &dynamodb.GetItemOutput{Item: f.items[attrString(in.Key, "LockKey")]}, nil
+}
+
+func (f *fakeDynamoDB) DeleteItemWithContext(_ aws.Context, in *dynamodb.DeleteItemInput, _ ...request.Option) (*dynamodb.DeleteItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := attrString(in.Key, "LockKey")
+	if err := f.check(key, in.ConditionExpression, in.ExpressionAttributeValues); err != nil {
+		return nil, err
+	}
+	delete(f.items, key)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func TestDynamoDBBackend(t *testing.T) {
+	testBackend(t, &DynamoDBBackend{
+		Client: &fakeDynamoDB{
+			t:     t,
+			items: make(map[string]map[string]*dynamodb.AttributeValue),
+		},
+		Table: "locks",
+	})
+}
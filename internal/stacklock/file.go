@@ -0,0 +1,144 @@
+package stacklock
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FileBackend keeps locks as files in a local directory.  It only protects stacks from processes on the same host.
+type FileBackend struct {
+	Dir string
+}
+
+var _ Backend = &FileBackend{}
+
+func (f *FileBackend) filename(key string) string {
+	return filepath.Join(f.Dir, strings.NewReplacer("/", "_", ":", "_").Replace(key)+".lock")
+}
+
+// guard takes an exclusive lock on the sidecar of the lock file of key, so a single process at a time reads the lock
+// file then changes it.  The returned function lets the next process in.
+func (f *FileBackend) guard(key string) (func(), error) {
+	if err := os.MkdirAll(f.Dir, 0700); err != nil {
+		return nil, errors.Wrapf(err, "unable to make lock directory %s", f.Dir)
+	}
+	name := f.filename(key) + ".flock"
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open %s", name)
+	}
+	if err := lockFile(file); err != nil {
+		_ = file.Close()
+		return nil, errors.Wrapf(err, "unable to lock %s", name)
+	}
+	return func() {
+		_ = unlockFile(file)
+		_ = file.Close()
+	}, nil
+}
+
+// write replaces the lock file of info with it.  Writing a temporary file then renaming it means readers never see a
+// partial lock.
+func (f *FileBackend) write(info Info) error {
+	b, err := json.Marshal(info)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal lock")
+	}
+	name := f.filename(info.Key)
+	tmp := name + "." + info.ID + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return errors.Wrapf(err, "unable to write lock file %s", tmp)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		_ = os.Remove(tmp)
+		return errors.Wrapf(err, "unable to write lock file %s", name)
+	}
+	return nil
+}
+
+func (f *FileBackend) Acquire(ctx context.Context, info Info) error {
+	unguard, err := f.guard(info.Key)
+	if err != nil {
+		return err
+	}
+	defer unguard()
+	current, err := f.Get(ctx, info.Key)
+	if err != nil {
+		return err
+	}
+	if current != nil && !current.Expired(time.Now()) {
+		return &LockedError{Holder: *current}
+	}
+	// Nobody holds the lock, or the holder stopped refreshing it: take it
+	return f.write(info)
+}
+
+func (f *FileBackend) Refresh(ctx context.Context, info Info) error {
+	unguard, err := f.guard(info.Key)
+	if err != nil {
+		return err
+	}
+	defer unguard()
+	current, err := f.Get(ctx, info.Key)
+	if err != nil {
+		return err
+	}
+	if current == nil || current.ID != info.ID {
+		return &LostError{Key: info.Key}
+	}
+	return errors.Wrapf(f.write(info), "unable to refresh lock on %s", info.Key)
+}
+
+func (f *FileBackend) Release(ctx context.Context, info Info) error {
+	unguard, err := f.guard(info.Key)
+	if err != nil {
+		return err
+	}
+	defer unguard()
+	current, err := f.Get(ctx, info.Key)
+	if err != nil {
+		return err
+	}
+	if current == nil || current.ID != info.ID {
+		return nil
+	}
+	return f.remove(info.Key)
+}
+
+func (f *FileBackend) Get(_ context.Context, key string) (*Info, error) {
+	b, err := ioutil.ReadFile(f.filename(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "unable to read lock file %s", f.filename(key))
+	}
+	var ret Info
+	if err := json.Unmarshal(b, &ret); err != nil {
+		return nil, errors.Wrapf(err, "invalid lock file %s", f.filename(key))
+	}
+	return &ret, nil
+}
+
+func (f *FileBackend) ForceRelease(_ context.Context, key string) error {
+	unguard, err := f.guard(key)
+	if err != nil {
+		return err
+	}
+	defer unguard()
+	return f.remove(key)
+}
+
+func (f *FileBackend) remove(key string) error {
+	if err := os.Remove(f.filename(key)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "unable to remove lock file %s", f.filename(key))
+	}
+	return nil
+}
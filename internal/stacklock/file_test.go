@@ -0,0 +1,72 @@
+package stacklock
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newFileBackend(t *testing.T) (*FileBackend, func()) {
+	dir, err := ioutil.TempDir("", "stacklock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &FileBackend{Dir: dir}, func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestFileBackend(t *testing.T) {
+	b, remove := newFileBackend(t)
+	defer remove()
+	testBackend(t, b)
+}
+
+func TestFileBackendConcurrentTakeover(t *testing.T) {
+	b, remove := newFileBackend(t)
+	defer remove()
+	ctx := context.Background()
+	for round := 0; round < 50; round++ {
+		if err := b.ForceRelease(ctx, "k"); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Acquire(ctx, testInfo("expired", -time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var winners []string
+		for i := 0; i < 8; i++ {
+			info := testInfo(fmt.Sprintf("taker-%d", i), time.Hour)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := b.Acquire(ctx, info)
+				if err == nil {
+					mu.Lock()
+					winners = append(winners, info.ID)
+					mu.Unlock()
+					return
+				}
+				if _, ok := err.(*LockedError); !ok {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+		if len(winners) != 1 {
+			t.Fatalf("round %d: %v took over the expired lock, want exactly one", round, winners)
+		}
+		current, err := b.Get(ctx, "k")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if current == nil || current.ID != winners[0] {
+			t.Fatalf("round %d: lock is held by %v, want %s", round, current, winners[0])
+		}
+	}
+}
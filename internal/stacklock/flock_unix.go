@@ -0,0 +1,23 @@
+//go:build !windows
+// +build !windows
+
+package stacklock
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile blocks until this process holds an exclusive lock on f
+func lockFile(f *os.File) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,170 @@
+package stacklock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/pkg/errors"
+)
+
+// S3Backend keeps locks as objects in a bucket.  Writes are conditional (If-None-Match / If-Match), so two hosts
+// can never both create or take over the same lock.
+type S3Backend struct {
+	Client s3iface.S3API
+	Bucket string
+	Prefix string
+}
+
+var _ Backend = &S3Backend{}
+
+func (s *S3Backend) key(key string) string {
+	return path.Join(s.Prefix, key+".lock")
+}
+
+func withHeader(key string, value string) request.Option {
+	return func(r *request.Request) {
+		r.HTTPRequest.Header.Set(key, value)
+	}
+}
+
+func isPreconditionFailed(err error) bool {
+	if ae, ok := errors.Cause(err).(awserr.Error); ok {
+		return ae.Code() == "PreconditionFailed" || ae.Code() == "ConditionalRequestConflict"
+	}
+	return false
+}
+
+func isNotFound(err error) bool {
+	if ae, ok := errors.Cause(err).(awserr.Error); ok {
+		return ae.Code() == s3.ErrCodeNoSuchKey || ae.Code() == "NotFound"
+	}
+	return false
+}
+
+func (s *S3Backend) put(ctx context.Context, info Info, opts ...request.Option) error {
+	b, err := json.Marshal(info)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal lock")
+	}
+	key := s.key(info.Key)
+	_, err = s.Client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: &s.Bucket,
+		Key:    &key,
+		Body:   bytes.NewReader(b),
+	}, opts...)
+	return err
+}
+
+// get returns the lock stored for key and the ETag of the object holding it
+func (s *S3Backend) get(ctx context.Context, key string) (*Info, string, error) {
+	objectKey := s.key(key)
+	out, err := s.Client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: &s.Bucket,
+		Key:    &objectKey,
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, "", nil
+		}
+		return nil, "", errors.Wrapf(err, "unable to read lock s3://%s/%s", s.Bucket, objectKey)
+	}
+	defer func() {
+		_ = out.Body.Close()
+	}()
+	b, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "unable to read lock s3://%s/%s", s.Bucket, objectKey)
+	}
+	var ret Info
+	if err := json.Unmarshal(b, &ret); err != nil {
+		return nil, "", errors.Wrapf(err, "invalid lock s3://%s/%s", s.Bucket, objectKey)
+	}
+	etag := ""
+	if out.ETag != nil {
+		etag = *out.ETag
+	}
+	return &ret, etag, nil
+}
+
+func (s *S3Backend) Acquire(ctx context.Context, info Info) error {
+	err := s.put(ctx, info, withHeader("If-None-Match", "*"))
+	if err == nil {
+		return nil
+	}
+	if !isPreconditionFailed(err) {
+		return errors.Wrapf(err, "unable to create lock for %s", info.Key)
+	}
+	current, etag, err := s.get(ctx, info.Key)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		// Released between our put and get: try again
+		return s.Acquire(ctx, info)
+	}
+	if !current.Expired(time.Now()) {
+		return &LockedError{Holder: *current}
+	}
+	// Take over the expired lock, but only if nobody else took it over first
+	if err := s.put(ctx, info, withHeader("If-Match", etag)); err != nil {
+		if isPreconditionFailed(err) {
+			return s.Acquire(ctx, info)
+		}
+		return errors.Wrapf(err, "unable to take over expired lock for %s", info.Key)
+	}
+	return nil
+}
+
+func (s *S3Backend) Refresh(ctx context.Context, info Info) error {
+	current, etag, err := s.get(ctx, info.Key)
+	if err != nil {
+		return err
+	}
+	if current == nil || current.ID != info.ID {
+		return &LostError{Key: info.Key}
+	}
+	return errors.Wrapf(s.put(ctx, info, withHeader("If-Match", etag)), "unable to refresh lock on %s", info.Key)
+}
+
+func (s *S3Backend) Release(ctx context.Context, info Info) error {
+	for {
+		current, etag, err := s.get(ctx, info.Key)
+		if err != nil {
+			return err
+		}
+		if current == nil || current.ID != info.ID {
+			return nil
+		}
+		// Only delete the lock as it was read: someone may take it over in between
+		err = s.delete(ctx, info.Key, withHeader("If-Match", etag))
+		if !isPreconditionFailed(err) {
+			return err
+		}
+	}
+}
+
+func (s *S3Backend) Get(ctx context.Context, key string) (*Info, error) {
+	ret, _, err := s.get(ctx, key)
+	return ret, err
+}
+
+func (s *S3Backend) ForceRelease(ctx context.Context, key string) error {
+	return s.delete(ctx, key)
+}
+
+func (s *S3Backend) delete(ctx context.Context, key string, opts ...request.Option) error {
+	objectKey := s.key(key)
+	_, err := s.Client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: &s.Bucket,
+		Key:    &objectKey,
+	}, opts...)
+	return errors.Wrapf(err, "unable to delete lock s3://%s/%s", s.Bucket, objectKey)
+}
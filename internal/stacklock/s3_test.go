@@ -0,0 +1,141 @@
+package stacklock
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+type fakeObject struct {
+	body []byte
+	etag string
+}
+
+// fakeS3 stores objects in memory and honors the If-Match and If-None-Match headers the S3 backend sends
+type fakeS3 struct {
+	s3iface.S3API
+	mu      sync.Mutex
+	objects map[string]fakeObject
+	version int
+	// beforeDelete runs before each delete, to simulate another process acting in between
+	beforeDelete func()
+}
+
+func headers(opts []request.Option) http.Header {
+	r := &request.Request{
+		HTTPRequest: &http.Request{Header: http.Header{}},
+	}
+	r.ApplyOptions(opts...)
+	return r.HTTPRequest.Header
+}
+
+func preconditionFailed() error {
+	return awserr.New("PreconditionFailed", "At least one of the pre-conditions you specified did not hold", nil)
+}
+
+// check returns an error if the headers of a request do not hold for the object at key
+func (f *fakeS3) check(key string, h http.Header) error {
+	current, exists := f.objects[key]
+	if h.Get("If-None-Match") == "*" && exists {
+		return preconditionFailed()
+	}
+	if match := h.Get("If-Match"); match != "" && (!exists || current.etag != match) {
+		return preconditionFailed()
+	}
+	return nil
+}
+
+func (f *fakeS3) PutObjectWithContext(_ aws.Context, in *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	b, err := ioutil.ReadAll(in.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check(*in.Key, headers(opts)); err != nil {
+		return nil, err
+	}
+	f.version++
+	etag := fmt.Sprintf(`"%d"`, f.version)
+	f.objects[*in.Key] = fakeObject{body: b, etag: etag}
+	return &s3.PutObjectOutput{ETag: &etag}, nil
+}
+
+func (f *fakeS3) GetObjectWithContext(_ aws.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	obj, exists := f.objects[*in.Key]
+	if !exists {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil)
+	}
+	return &s3.GetObjectOutput{
+		Body: ioutil.NopCloser(bytes.NewReader(obj.body)),
+		ETag: aws.String(obj.etag),
+	}, nil
+}
+
+func (f *fakeS3) DeleteObjectWithContext(_ aws.Context, in *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error) {
+	if f.beforeDelete != nil {
+		f.beforeDelete()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check(*in.Key, headers(opts)); err != nil {
+		return nil, err
+	}
+	delete(f.objects, *in.Key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func newS3Backend() (*S3Backend, *fakeS3) {
+	client := &fakeS3{
+		objects: map[string]fakeObject{},
+	}
+	return &S3Backend{
+		Client: client,
+		Bucket: "bucket",
+		Prefix: "locks",
+	}, client
+}
+
+func TestS3Backend(t *testing.T) {
+	b, _ := newS3Backend()
+	testBackend(t, b)
+}
+
+func TestS3ReleaseAfterTakeover(t *testing.T) {
+	b, client := newS3Backend()
+	ctx := context.Background()
+	first := testInfo("first", -time.Minute)
+	if err := b.Acquire(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	// The lock expired: another process takes it over after first reads it to release it
+	client.beforeDelete = func() {
+		client.beforeDelete = nil
+		if err := b.Acquire(ctx, testInfo("second", time.Hour)); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := b.Release(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	current, err := b.Get(ctx, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current == nil || current.ID != "second" {
+		t.Fatalf("releasing the expired lock deleted the lock that took it over: lock is %v", current)
+	}
+}
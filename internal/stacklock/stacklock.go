@@ -0,0 +1,213 @@
+package stacklock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cep21/cfmanage/internal/logger"
+	"github.com/pkg/errors"
+)
+
+// Info describes who holds a lock
+type Info struct {
+	Key       string
+	ID        string
+	Owner     string
+	GitSHA    string `json:",omitempty"`
+	Acquired  time.Time
+	ExpiresAt time.Time
+}
+
+// Expired is true if the holder of the lock stopped refreshing it
+func (i *Info) Expired(now time.Time) bool {
+	return now.After(i.ExpiresAt)
+}
+
+func (i *Info) String() string {
+	ret := fmt.Sprintf("%s since %s", i.Owner, i.Acquired.Format(time.RFC3339))
+	if i.GitSHA != "" {
+		ret += " at " + i.GitSHA
+	}
+	return ret
+}
+
+// Backend stores locks.  Implementations must make Acquire atomic: two callers racing for the same key must never both
+// succeed.
+type Backend interface {
+	// Acquire takes the lock described by info, or returns a *LockedError if someone else holds an unexpired lock
+	Acquire(ctx context.Context, info Info) error
+	// Refresh extends a lock this process holds
+	Refresh(ctx context.Context, info Info) error
+	// Release gives up a lock this process holds
+	Release(ctx context.Context, info Info) error
+	// Get returns who holds key, or nil if nobody does
+	Get(ctx context.Context, key string) (*Info, error)
+	// ForceRelease removes the lock on key no matter who holds it
+	ForceRelease(ctx context.Context, key string) error
+}
+
+// LockedError is returned when someone else holds a lock
+type LockedError struct {
+	Holder Info
+}
+
+func (l *LockedError) Error() string {
+	return fmt.Sprintf("stack %s is locked by %s", l.Holder.Key, l.Holder.String())
+}
+
+// LostError is returned when refreshing a lock someone else took over or removed
+type LostError struct {
+	Key string
+}
+
+func (l *LostError) Error() string {
+	return fmt.Sprintf("lock on %s was taken away", l.Key)
+}
+
+// DefaultDir is where the file backend keeps locks when no directory is given
+func DefaultDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".cfmanage", "locks")
+}
+
+// Owner describes the user running this process
+func Owner() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, _ := os.Hostname()
+	return name + "@" + host
+}
+
+func newLockID() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// Locker takes advisory locks from a Backend and keeps them alive until they are unlocked
+type Locker struct {
+	Backend Backend
+	// TTL is how long a lock lives without being refreshed.  Zero means 10 minutes.
+	TTL    time.Duration
+	Logger *logger.Logger
+}
+
+func (l *Locker) ttl() time.Duration {
+	if l.TTL == 0 {
+		return time.Minute * 10
+	}
+	return l.TTL
+}
+
+// Lock acquires key, refreshing the lock in the background until Unlock is called
+func (l *Locker) Lock(ctx context.Context, key string, gitSHA string) (*Lock, error) {
+	now := time.Now().UTC()
+	info := Info{
+		Key:       key,
+		ID:        newLockID(),
+		Owner:     Owner(),
+		GitSHA:    gitSHA,
+		Acquired:  now,
+		ExpiresAt: now.Add(l.ttl()),
+	}
+	if err := l.Backend.Acquire(ctx, info); err != nil {
+		return nil, err
+	}
+	ret := &Lock{
+		locker: l,
+		info:   info,
+		done:   make(chan struct{}),
+		lost:   make(chan struct{}),
+	}
+	go ret.heartbeat()
+	return ret, nil
+}
+
+// Lock is a held lock
+type Lock struct {
+	locker *Locker
+	mu     sync.Mutex
+	info   Info
+	done   chan struct{}
+	once   sync.Once
+	lost   chan struct{}
+	err    error
+}
+
+// Lost is closed if the lock is lost: someone took it over, or it expired before it could be refreshed.  Err then says
+// why.  A nil Lock is never lost.
+func (l *Lock) Lost() <-chan struct{} {
+	if l == nil {
+		return nil
+	}
+	return l.lost
+}
+
+// Err is why the lock was lost, or nil if it is still held
+func (l *Lock) Err() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+func (l *Lock) heartbeat() {
+	l.mu.Lock()
+	expiresAt := l.info.ExpiresAt
+	l.mu.Unlock()
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-time.After(l.locker.ttl() / 3):
+		}
+		l.mu.Lock()
+		l.info.ExpiresAt = time.Now().UTC().Add(l.locker.ttl())
+		info := l.info
+		l.mu.Unlock()
+		ctx, cancel := context.WithTimeout(context.Background(), l.locker.ttl()/3)
+		err := l.locker.Backend.Refresh(ctx, info)
+		cancel()
+		if err == nil {
+			expiresAt = info.ExpiresAt
+			continue
+		}
+		l.locker.Logger.Log(0, "unable to refresh lock on %s: %s", info.Key, err.Error())
+		if _, taken := errors.Cause(err).(*LostError); !taken && time.Now().Before(expiresAt) {
+			// Nobody can take the lock before it expires: try again
+			continue
+		}
+		l.mu.Lock()
+		l.err = errors.Wrapf(err, "lost lock on %s", info.Key)
+		l.mu.Unlock()
+		close(l.lost)
+		return
+	}
+}
+
+// Unlock stops refreshing the lock and releases it
+func (l *Lock) Unlock(ctx context.Context) error {
+	l.once.Do(func() {
+		close(l.done)
+	})
+	l.mu.Lock()
+	info := l.info
+	l.mu.Unlock()
+	return errors.Wrapf(l.locker.Backend.Release(ctx, info), "unable to release lock on %s", info.Key)
+}
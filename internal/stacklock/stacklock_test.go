@@ -0,0 +1,147 @@
+package stacklock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func testInfo(id string, ttl time.Duration) Info {
+	now := time.Now().UTC()
+	return Info{
+		Key:       "k",
+		ID:        id,
+		Owner:     id + "@host",
+		Acquired:  now,
+		ExpiresAt: now.Add(ttl),
+	}
+}
+
+func isLost(err error) bool {
+	_, ok := err.(*LostError)
+	return ok
+}
+
+// testBackend checks the behavior every Backend shares
+func testBackend(t *testing.T, b Backend) {
+	ctx := context.Background()
+
+	first := testInfo("first", time.Hour)
+	if err := b.Acquire(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	err := b.Acquire(ctx, testInfo("second", time.Hour))
+	locked, ok := err.(*LockedError)
+	if !ok {
+		t.Fatalf("acquiring a held lock returned %v, want a *LockedError", err)
+	}
+	if locked.Holder.ID != "first" {
+		t.Fatalf("lock reported held by %s, want first", locked.Holder.ID)
+	}
+
+	// Releasing someone else's lock must leave it alone
+	if err := b.Release(ctx, testInfo("second", time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if current, err := b.Get(ctx, "k"); err != nil || current == nil || current.ID != "first" {
+		t.Fatalf("after releasing a foreign lock, lock is %v (%v), want first", current, err)
+	}
+	if err := b.Refresh(ctx, testInfo("second", time.Hour)); !isLost(err) {
+		t.Fatalf("refreshing someone else's lock returned %v, want a *LostError", err)
+	}
+
+	// An expired lock is taken over, and its old holder can neither refresh nor release it
+	expired := first
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	if err := b.Refresh(ctx, expired); err != nil {
+		t.Fatal(err)
+	}
+	third := testInfo("third", time.Hour)
+	if err := b.Acquire(ctx, third); err != nil {
+		t.Fatalf("unable to take over an expired lock: %v", err)
+	}
+	if err := b.Refresh(ctx, first); !isLost(err) {
+		t.Fatalf("refreshing a lock that was taken over returned %v, want a *LostError", err)
+	}
+	if err := b.Release(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	if current, err := b.Get(ctx, "k"); err != nil || current == nil || current.ID != "third" {
+		t.Fatalf("after the old holder released, lock is %v (%v), want third", current, err)
+	}
+
+	if err := b.Release(ctx, third); err != nil {
+		t.Fatal(err)
+	}
+	if current, err := b.Get(ctx, "k"); err != nil || current != nil {
+		t.Fatalf("after release, lock is %v (%v), want none", current, err)
+	}
+	if err := b.Acquire(ctx, testInfo("fourth", time.Hour)); err != nil {
+		t.Fatalf("unable to acquire a released lock: %v", err)
+	}
+	if err := b.ForceRelease(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if current, err := b.Get(ctx, "k"); err != nil || current != nil {
+		t.Fatalf("after force release, lock is %v (%v), want none", current, err)
+	}
+}
+
+func TestLockLost(t *testing.T) {
+	b, remove := newFileBackend(t)
+	defer remove()
+	l := &Locker{
+		Backend: b,
+		TTL:     time.Millisecond * 150,
+	}
+	ctx := context.Background()
+	held, err := l.Lock(ctx, "k", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := held.Unlock(ctx); err != nil {
+			t.Error(err)
+		}
+	}()
+	select {
+	case <-held.Lost():
+		t.Fatal("lost a lock nobody took")
+	case <-time.After(l.TTL * 2):
+	}
+	if err := held.Err(); err != nil {
+		t.Fatalf("held lock has error %v", err)
+	}
+
+	if err := b.ForceRelease(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Acquire(ctx, testInfo("other", time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-held.Lost():
+	case <-time.After(l.TTL * 2):
+		t.Fatal("taking over a lock did not make its holder lose it")
+	}
+	if !isLost(errors.Cause(held.Err())) {
+		t.Fatalf("lost lock has error %v, want a *LostError", held.Err())
+	}
+	if current, err := b.Get(ctx, "k"); err != nil || current == nil || current.ID != "other" {
+		t.Fatalf("after losing the lock, lock is %v (%v), want other", current, err)
+	}
+}
+
+func TestNilLockIsNeverLost(t *testing.T) {
+	var held *Lock
+	select {
+	case <-held.Lost():
+		t.Fatal("nil lock was lost")
+	default:
+	}
+	if err := held.Err(); err != nil {
+		t.Fatalf("nil lock has error %v", err)
+	}
+}
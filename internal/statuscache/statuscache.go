@@ -0,0 +1,104 @@
+package statuscache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+)
+
+// Entry is the changeset status computed for a rendered input against a stack
+type Entry struct {
+	Computed  time.Time
+	Changeset *cloudformation.DescribeChangeSetOutput
+}
+
+// Cache keeps computed changesets in a local directory, one file per key
+type Cache struct {
+	Dir string
+	// MaxAge is how long an entry is reused.  Zero means a day.
+	MaxAge time.Duration
+}
+
+// DefaultDir is where the cache lives when no directory is given
+func DefaultDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".cfmanage", "status")
+}
+
+// Key identifies the changeset an input creates against a stack.  It changes when the input changes, or when the stack
+// is updated.  stack is nil for stacks that do not exist.
+func Key(inputHash string, stack *cloudformation.Stack) string {
+	h := sha256.New()
+	_, _ = h.Write([]byte(inputHash))
+	if stack != nil {
+		for _, s := range []*string{stack.StackId, stack.StackStatus} {
+			if s != nil {
+				_, _ = h.Write([]byte("|" + *s))
+			}
+		}
+		for _, t := range []*time.Time{stack.CreationTime, stack.LastUpdatedTime} {
+			if t != nil {
+				_, _ = h.Write([]byte("|" + t.UTC().Format(time.RFC3339Nano)))
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *Cache) maxAge() time.Duration {
+	if c.MaxAge == 0 {
+		return time.Hour * 24
+	}
+	return c.MaxAge
+}
+
+func (c *Cache) filename(key string) string {
+	return filepath.Join(c.Dir, key+".json")
+}
+
+// Get returns the entry for key, or nil if there is none or it is too old
+func (c *Cache) Get(key string, now time.Time) (*Entry, error) {
+	b, err := ioutil.ReadFile(c.filename(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "unable to read status cache %s", c.filename(key))
+	}
+	var ret Entry
+	if err := json.Unmarshal(b, &ret); err != nil {
+		// A corrupt entry is a miss: it is overwritten by the next Put
+		return nil, nil
+	}
+	if now.Sub(ret.Computed) > c.maxAge() {
+		return nil, nil
+	}
+	return &ret, nil
+}
+
+// Put stores the entry for key
+func (c *Cache) Put(key string, e Entry) error {
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return errors.Wrapf(err, "unable to make status cache directory %s", c.Dir)
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal status cache entry")
+	}
+	tmp := c.filename(key) + "." + strconv.Itoa(os.Getpid()) + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return errors.Wrapf(err, "unable to write status cache %s", tmp)
+	}
+	return errors.Wrapf(os.Rename(tmp, c.filename(key)), "unable to write status cache %s", c.filename(key))
+}
@@ -2,6 +2,8 @@ package templatereader
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"io"
 	"io/ioutil"
@@ -17,7 +19,168 @@ type ChangesetInput struct {
 	cloudformation.CreateChangeSetInput
 	Profile string `json:"profile"`
 	Region  string `json:"region"`
-	Bucket  string `json:"bucket"`
+	// AssumeRoleARN, if set, is an IAM role assumed with the credentials of Profile.  RoleARN is the service role
+	// CloudFormation acts as.
+	AssumeRoleARN string         `json:"assumeRoleARN"`
+	Bucket        string         `json:"bucket"`
+	Lock          *LockConfig    `json:"lock"`
+	History       *HistoryConfig `json:"history"`
+	Notify        *NotifyConfig  `json:"notify"`
+	Hooks         *HooksConfig   `json:"hooks"`
+	// StackSet, if set, deploys the template as a stack set named StackName instead of as a stack
+	StackSet *StackSetConfig `json:"stackSet"`
+	// Targets, if set, deploys the stack to each target instead of to Profile and Region.  The params file is
+	// rendered again for each target with its Region and AccountID.
+	Targets []TargetConfig `json:"targets"`
+	// Rollout orders deploying to Targets
+	Rollout *RolloutConfig `json:"rollout"`
+}
+
+// TargetConfig is one account and region a params file deploys to.  Empty fields default to those of the params file.
+type TargetConfig struct {
+	Profile       string `json:"profile"`
+	AssumeRoleARN string `json:"assumeRoleARN"`
+	Region        string `json:"region"`
+}
+
+// RolloutConfig orders deploying a params file to its targets
+type RolloutConfig struct {
+	// Strategy is serial (the default), parallel, or canary: the first target alone, then the others in parallel
+	Strategy string `json:"strategy"`
+	// MaxParallel bounds how many targets deploy at once.  Zero means no bound.
+	MaxParallel int `json:"maxParallel"`
+	// ContinueOnFailure keeps deploying to the other targets after one fails.  By default, targets that have not
+	// started are skipped.
+	ContinueOnFailure bool `json:"continueOnFailure"`
+}
+
+// StackSetConfig describes a stack set and where its instances go.  The template, Parameters, Tags and Capabilities
+// of the params file are those of the stack set.
+type StackSetConfig struct {
+	// PermissionModel is SELF_MANAGED, the default, or SERVICE_MANAGED: instances go to the accounts of
+	// OrganizationalUnitIDs, through roles AWS Organizations manages
+	PermissionModel string `json:"permissionModel"`
+	// AdministrationRoleARN and ExecutionRoleName default to CloudFormation's AWSCloudFormationStackSetAdministrationRole
+	// and AWSCloudFormationStackSetExecutionRole.  SELF_MANAGED only.
+	AdministrationRoleARN string `json:"administrationRoleARN"`
+	ExecutionRoleName     string `json:"executionRoleName"`
+	// Accounts get an instance in each of Regions.  Accounts defaults to the account of the profile.  SELF_MANAGED only.
+	Accounts []string `json:"accounts"`
+	// OrganizationalUnitIDs are where a SERVICE_MANAGED stack set goes: each of their accounts gets an instance in each
+	// of Regions
+	OrganizationalUnitIDs []string `json:"organizationalUnitIds"`
+	// AutoDeployment of a SERVICE_MANAGED stack set adds instances to accounts that join its organizational units, and
+	// removes them from accounts that leave
+	AutoDeployment *cloudformation.AutoDeployment `json:"autoDeployment"`
+	// Regions defaults to the region of the profile
+	Regions              []string                                     `json:"regions"`
+	OperationPreferences *cloudformation.StackSetOperationPreferences `json:"operationPreferences"`
+}
+
+// ServiceManaged is true if AWS Organizations manages the permissions of the stack set
+func (c *StackSetConfig) ServiceManaged() bool {
+	return c.PermissionModel == cloudformation.PermissionModelsServiceManaged
+}
+
+func (c *StackSetConfig) validate() error {
+	switch c.PermissionModel {
+	case "", cloudformation.PermissionModelsSelfManaged:
+		if len(c.OrganizationalUnitIDs) != 0 || c.AutoDeployment != nil {
+			return errors.New("stack set organizationalUnitIds and autoDeployment need the SERVICE_MANAGED permission model")
+		}
+	case cloudformation.PermissionModelsServiceManaged:
+		if len(c.OrganizationalUnitIDs) == 0 {
+			return errors.New("a SERVICE_MANAGED stack set needs organizationalUnitIds")
+		}
+		if len(c.Accounts) != 0 {
+			return errors.New("a SERVICE_MANAGED stack set deploys to organizationalUnitIds, not accounts")
+		}
+		if c.AdministrationRoleARN != "" || c.ExecutionRoleName != "" {
+			return errors.New("a SERVICE_MANAGED stack set has no administrationRoleARN or executionRoleName")
+		}
+	default:
+		return errors.Errorf("unknown stack set permission model %s: use SELF_MANAGED or SERVICE_MANAGED", c.PermissionModel)
+	}
+	return nil
+}
+
+// HooksConfig lists local commands run around deploying the stack.  Each is given the stack as CFMANAGE_ environment
+// variables and as JSON on stdin.
+type HooksConfig struct {
+	// PreChangeset runs before the changeset is created.  A failure aborts the deploy.
+	PreChangeset []HookConfig `json:"preChangeset"`
+	// PreExecute runs once the changeset is confirmed, before it is executed.  A failure aborts the deploy.
+	PreExecute []HookConfig `json:"preExecute"`
+	// PostSuccess runs after the stack updated.  A failure fails the command, but the stack stays updated.
+	PostSuccess []HookConfig `json:"postSuccess"`
+	// PostFailure runs after the update failed
+	PostFailure []HookConfig `json:"postFailure"`
+}
+
+// HookConfig is a local command run around a deploy
+type HookConfig struct {
+	// Command is the program and its arguments.  It is not run by a shell: use ["sh", "-c", "..."] for one.
+	Command []string `json:"command"`
+	// Dir is where the command runs, relative to the template directory.  Defaults to the template directory.
+	Dir string `json:"dir"`
+	// Timeout bounds the command, as a Go duration.  Defaults to 5m.
+	Timeout string `json:"timeout"`
+	// Env is added to the environment of the command
+	Env map[string]string `json:"env"`
+}
+
+// NotifyConfig lists the webhooks told when the stack is deployed
+type NotifyConfig struct {
+	Webhooks []WebhookConfig `json:"webhooks"`
+	// Timeout bounds posting an event to each webhook, retries included, as a Go duration.  Defaults to 30s.
+	Timeout string `json:"timeout"`
+	// Retries is how many times a failed post is retried.  Defaults to 3.
+	Retries *int `json:"retries"`
+}
+
+// WebhookConfig is an endpoint deploy events are posted to
+type WebhookConfig struct {
+	URL string `json:"url"`
+	// Format is generic (the default), slack or teams
+	Format string `json:"format"`
+	// Events limits the events posted to some of started, succeeded and failed.  Empty means all of them.
+	Events []string `json:"events"`
+}
+
+// HistoryConfig picks where the deployments of a stack are recorded
+type HistoryConfig struct {
+	// Backend is one of file (the default), s3 or none
+	Backend string `json:"backend"`
+	// Bucket and Prefix locate deployments for the s3 backend.  Bucket defaults to the artifact bucket.
+	Bucket string `json:"bucket"`
+	Prefix string `json:"prefix"`
+}
+
+// LockConfig picks where the lock that stops two people executing a stack at once is stored
+type LockConfig struct {
+	// Backend is one of file (the default), s3, dynamodb or none
+	Backend string `json:"backend"`
+	// Bucket and Prefix locate lock objects for the s3 backend
+	Bucket string `json:"bucket"`
+	Prefix string `json:"prefix"`
+	// Table holds lock items for the dynamodb backend.  Its hash key must be a string named LockKey.
+	Table string `json:"table"`
+	// TTL is how long a lock lives if the process holding it dies, as a Go duration
+	TTL string `json:"ttl"`
+}
+
+// Hash identifies the rendered input: two inputs with the same hash create the same changeset.  Fields that
+// cfmanage fills in while creating a changeset are ignored.
+func (c *ChangesetInput) Hash() string {
+	cp := *c
+	cp.ChangeSetName = nil
+	cp.ClientToken = nil
+	b, err := json.Marshal(&cp)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
 }
 
 func LoadCreateChangeSet(changesetFilename string, translator *CreateChangeSetTemplate, logger *logger.Logger) (*ChangesetInput, error) {
@@ -31,6 +194,18 @@ func LoadCreateChangeSet(changesetFilename string, translator *CreateChangeSetTe
 // CreateChangeSetTemplate is passed to the changeset.json file when Executing the template
 type CreateChangeSetTemplate struct {
 	Ctx
+	// Region and AccountID are those of the target being rendered.  They are empty for params files without targets,
+	// and while the targets are read.
+	Region    string
+	AccountID string
+}
+
+// ForTarget is t rendering a params file for the target in region of accountID
+func (t *CreateChangeSetTemplate) ForTarget(region string, accountID string) *CreateChangeSetTemplate {
+	ret := *t
+	ret.Region = region
+	ret.AccountID = accountID
+	return &ret
 }
 
 func (t *CreateChangeSetTemplate) createRegisterTaskDefinitionInput(in io.Reader, logger *logger.Logger) (*ChangesetInput, error) {
@@ -54,5 +229,10 @@ func (t *CreateChangeSetTemplate) createRegisterTaskDefinitionInput(in io.Reader
 		logger.Log(1, "Failing template body: %s", templateResult.String())
 		return nil, errors.Wrap(err, "unable to deserialize given template (is it valid json?)")
 	}
+	if out.StackSet != nil {
+		if err := out.StackSet.validate(); err != nil {
+			return nil, errors.Wrap(err, "invalid stackSet")
+		}
+	}
 	return &out, nil
 }
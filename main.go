@@ -30,7 +30,9 @@ func (a *Application) main() {
 	l := &logger.Logger{
 		Logger: log.New(a.Out, "cfmanage", log.LstdFlags),
 	}
-	Cleanup := &cleanup.Cleanup{}
+	Cleanup := &cleanup.Cleanup{
+		Journal: &cleanup.Journal{},
+	}
 	rootCmd := cobracmds.RootCommand{
 		AWSCache: &awscache.AWSCache{
 			Cleanup: Cleanup,
@@ -45,8 +47,8 @@ func (a *Application) main() {
 		ContextFinder: &ctxfinder.ContextFinder{},
 	}
 
-	if err := rootCmd.Cobra().Execute(); err != nil {
+	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		os.Exit(cobracmds.ExitCode(err))
 	}
 }